@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// AdaptiveConfig lets a monitor's check interval follow its behaviour:
+// while it stays up the interval stretches towards MaxInterval, and right
+// after a failure or recovery it is rechecked every FastInterval so the
+// change is confirmed quickly.
+type AdaptiveConfig struct {
+	// MaxInterval is the longest the interval stretches to. Defaults to
+	// four times the monitor's interval.
+	MaxInterval Duration `json:"max_interval"`
+	// StableAfter is how many up results in a row double the interval,
+	// each time, until MaxInterval. Defaults to 10.
+	StableAfter int `json:"stable_after"`
+	// FastInterval is the interval right after the result changes.
+	// Defaults to 10s.
+	FastInterval Duration `json:"fast_interval"`
+	// FastChecks is how many checks run at FastInterval after a change.
+	// Defaults to 5.
+	FastChecks int `json:"fast_checks"`
+}
+
+type adaptiveState struct {
+	status string
+	// stable counts results in a row with the same status.
+	stable int
+	// fast counts the checks still to run at the fast interval.
+	fast int
+	// current is the interval last chosen.
+	current time.Duration
+	// base is the configured interval current was chosen from.
+	base time.Duration
+}
+
+type adaptiveIntervals struct {
+	mu     sync.Mutex
+	states map[string]*adaptiveState
+}
+
+var adaptive = &adaptiveIntervals{states: make(map[string]*adaptiveState)}
+
+// observe records the outcome of a local check of target.
+func (a *adaptiveIntervals) observe(target Target, status string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if target.Adaptive == nil {
+		delete(a.states, target.URL)
+		return
+	}
+	s := a.states[target.URL]
+	if s == nil {
+		a.states[target.URL] = &adaptiveState{status: status, stable: 1}
+		return
+	}
+	if s.fast > 0 {
+		s.fast--
+	}
+	if status == s.status {
+		s.stable++
+		return
+	}
+	s.status, s.stable = status, 1
+	s.fast = target.Adaptive.FastChecks
+	if s.fast <= 0 {
+		s.fast = 5
+	}
+}
+
+// interval returns how long to wait before checking target again, given
+// its configured interval base.
+func (a *adaptiveIntervals) interval(target Target, base time.Duration) time.Duration {
+	c := target.Adaptive
+	if c == nil {
+		return base
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.states[target.URL]
+	if s == nil {
+		return base
+	}
+	s.current, s.base = s.next(c, base), base
+	return s.current
+}
+
+// weight returns how many configured intervals url's latest result stands
+// for: the interval until its next check over the configured one. History
+// weighs results by it, so that uptime reflects time spent up and down
+// rather than how often each was checked. It is 1 for monitors whose
+// interval is not adaptive.
+func (a *adaptiveIntervals) weight(target Target) float64 {
+	c := target.Adaptive
+	if c == nil {
+		return 1
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.states[target.URL]
+	if s == nil || s.base <= 0 {
+		return 1
+	}
+	return float64(s.next(c, s.base)) / float64(s.base)
+}
+
+func (s *adaptiveState) next(c *AdaptiveConfig, base time.Duration) time.Duration {
+	if s.fast > 0 {
+		fast := time.Duration(c.FastInterval)
+		if fast <= 0 {
+			fast = 10 * time.Second
+		}
+		return min(fast, base)
+	}
+	stableAfter := c.StableAfter
+	if stableAfter <= 0 {
+		stableAfter = 10
+	}
+	if s.status != "up" || s.stable < stableAfter {
+		return base
+	}
+	longest := time.Duration(c.MaxInterval)
+	if longest <= 0 {
+		longest = 4 * base
+	}
+	interval := base
+	for n := s.stable / stableAfter; n > 0 && interval < longest; n-- {
+		interval *= 2
+	}
+	return max(base, min(interval, longest))
+}
+
+// current returns the interval last chosen for url, or zero if its
+// interval is not adaptive.
+func (a *adaptiveIntervals) current(url string) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s := a.states[url]; s != nil {
+		return s.current
+	}
+	return 0
+}
+
+func (a *adaptiveIntervals) remove(url string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.states, url)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveResultsWeighedByInterval(t *testing.T) {
+	target := Target{URL: "https://adaptive.example.com/", Adaptive: &AdaptiveConfig{StableAfter: 2, FastChecks: 2}}
+	defer adaptive.remove(target.URL)
+	base := time.Minute
+
+	adaptive.observe(target, "up")
+	if got := adaptive.weight(target); got != 1 {
+		t.Errorf("weight before any interval was chosen is %v, want 1", got)
+	}
+	adaptive.interval(target, base)
+	adaptive.observe(target, "up")
+	if got := adaptive.weight(target); got != 2 {
+		t.Errorf("weight of a stable result is %v, want 2 for the doubled interval", got)
+	}
+	adaptive.interval(target, base)
+	adaptive.observe(target, "down")
+	if got := adaptive.weight(target); math.Abs(got-1.0/6) > 1e-9 {
+		t.Errorf("weight of a failure is %v, want 1/6 for the 10s recheck", got)
+	}
+
+	// One stable up result followed by six fast down rechecks covers as
+	// much up time as down time, though most checks failed.
+	var list []historyBucket
+	now := time.Now()
+	list = appendBucket(list, historyCoarseStep, now, true, 10, 1)
+	for i := 0; i < 6; i++ {
+		list = appendBucket(list, historyCoarseStep, now, false, 10, 1.0/6)
+	}
+	total, up := list[len(list)-1].weights()
+	if got := 100 * up / total; math.Abs(got-50) > 1e-9 {
+		t.Errorf("uptime is %v%%, want 50%%", got)
+	}
+	if total, up := (historyBucket{Checks: 4, Up: 3}).weights(); total != 4 || up != 3 {
+		t.Errorf("a bucket without weights weighs %v, %v, want each check once", total, up)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Agents are remote probes that pull their assignments from a central
+// instance and push results back, so the same websites can be checked from
+// several networks or regions.
+
+// AgentCredential authorizes one remote probe against the coordinator.
+type AgentCredential struct {
+	// Name identifies the probe's location, e.g. "eu-west" or "office".
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+type AgentAssignment struct {
+	Interval Duration      `json:"interval"`
+	Targets  []AgentTarget `json:"targets"`
+}
+
+// AgentTarget is a target as resolved on the coordinator, with its type and
+// settings, so that agents check it exactly as the coordinator would. Body
+// patterns travel as text and are compiled again by the agent.
+type AgentTarget struct {
+	Target
+	BodyMatches    string `json:",omitempty"`
+	BodyNotMatches string `json:",omitempty"`
+}
+
+func agentTarget(t Target) AgentTarget {
+	a := AgentTarget{Target: t}
+	if t.BodyMatches != nil {
+		a.BodyMatches = t.BodyMatches.String()
+	}
+	if t.BodyNotMatches != nil {
+		a.BodyNotMatches = t.BodyNotMatches.String()
+	}
+	return a
+}
+
+// target compiles what the coordinator compiled when it resolved the
+// target.
+func (a AgentTarget) target() (Target, error) {
+	t := a.Target
+	var err error
+	if a.BodyMatches != "" {
+		if t.BodyMatches, err = regexp.Compile(a.BodyMatches); err != nil {
+			return t, err
+		}
+	}
+	if a.BodyNotMatches != "" {
+		if t.BodyNotMatches, err = regexp.Compile(a.BodyNotMatches); err != nil {
+			return t, err
+		}
+	}
+	t.ExpectHeaders = append([]HeaderAssertion(nil), t.ExpectHeaders...)
+	for i := range t.ExpectHeaders {
+		if err := t.ExpectHeaders[i].compile(); err != nil {
+			return t, err
+		}
+	}
+	// UDP payloads and DNS record types are decoded by validate into
+	// fields that are not sent.
+	if t.UDP != nil {
+		if err := t.UDP.validate(); err != nil {
+			return t, err
+		}
+	}
+	if t.DNS != nil {
+		if err := t.DNS.validate(); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+type AgentReport struct {
+	Results []CheckResult `json:"results"`
+}
+
+type AgentInfo struct {
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// agents lists every configured agent with the time of its last report.
+func (l *locationResults) agents(configured []AgentCredential) []AgentInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	infos := make([]AgentInfo, 0, len(configured))
+	for _, a := range configured {
+		infos = append(infos, AgentInfo{Name: a.Name, LastSeen: l.seen[a.Name]})
+	}
+	return infos
+}
+
+// authenticateAgent returns the name of the agent presenting a valid bearer
+// token, or "" if none matches.
+func authenticateAgent(r *http.Request, agents []AgentCredential) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+	for _, a := range agents {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1 {
+			return a.Name
+		}
+	}
+	return ""
+}
+
+func agentAssignmentsHandler(config Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authenticateAgent(r, config.Agents) == "" {
+			writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "a valid agent token is required")
+			return
+		}
+		interval := config.Interval
+		if interval <= 0 {
+			interval = Duration(time.Minute)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		assignment := AgentAssignment{Interval: interval, Targets: []AgentTarget{}}
+		for _, url := range targets.urls() {
+			if target, ok := targets.get(url); ok && target.Type != pushType {
+				assignment.Targets = append(assignment.Targets, agentTarget(target))
+			}
+		}
+		json.NewEncoder(w).Encode(assignment)
+	}
+}
+
+func agentsHandler(config Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		writeJSONCached(w, r, probeResults.agents(config.Agents))
+	}
+}
+
+func agentResultsHandler(config Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if methodNotAllowed(w, r, http.MethodPost) {
+			return
+		}
+		location := authenticateAgent(r, config.Agents)
+		if location == "" {
+			writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "a valid agent token is required")
+			return
+		}
+		var report AgentReport
+		if !decodeBody(w, r, &report, "report") {
+			return
+		}
+		for _, res := range report.Results {
+			if !targets.has(res.URL) {
+				continue
+			}
+			if res.CheckedAt.IsZero() {
+				res.CheckedAt = time.Now().UTC()
+			}
+			if res.Status == "down" {
+				fmt.Printf("Website %s is down from %s: %s\n", res.URL, location, res.Detail)
+			}
+			recordResult(location, res)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// runAgent runs the probe side: every interval it fetches its assignment
+// from the coordinator, checks each website and reports the results.
+func runAgent(args []string) {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	coordinator := fs.String("coordinator", "http://localhost:8080", "base URL of the central instance")
+	token := fs.String("token", "", "agent token configured on the central instance")
+	fs.StringVar(&defaultSource, "source", "", "local IP address or interface to send checks from")
+	fs.Parse(args)
+
+	if *token == "" {
+		fmt.Println("Error: agent mode requires -token")
+		return
+	}
+	if defaultSource != "" {
+		if _, err := sourceIP(defaultSource); err != nil {
+			fmt.Println("Error: -source:", err)
+			return
+		}
+	}
+	base := strings.TrimRight(*coordinator, "/")
+	fmt.Printf("Uptime Monitor agent reporting to %s\n", base)
+
+	for {
+		interval := time.Minute
+		assignment, err := fetchAssignment(base, *token)
+		if err != nil {
+			fmt.Println("Error fetching assignment:", err)
+		} else {
+			if assignment.Interval > 0 {
+				interval = time.Duration(assignment.Interval)
+			}
+			report := runAssignment(assignment)
+			if err := postReport(base, *token, report); err != nil {
+				fmt.Println("Error reporting results:", err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+func fetchAssignment(base, token string) (AgentAssignment, error) {
+	var assignment AgentAssignment
+	req, err := http.NewRequest(http.MethodGet, base+"/agent/assignments", nil)
+	if err != nil {
+		return assignment, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return assignment, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return assignment, fmt.Errorf("coordinator returned %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&assignment)
+	return assignment, err
+}
+
+func runAssignment(assignment AgentAssignment) AgentReport {
+	results := make([]CheckResult, len(assignment.Targets))
+	var wg sync.WaitGroup
+	for i, a := range assignment.Targets {
+		wg.Add(1)
+		go func(i int, a AgentTarget) {
+			defer wg.Done()
+			target, err := a.target()
+			if err != nil {
+				results[i] = CheckResult{URL: a.URL, Status: "down", Detail: "invalid assignment: " + err.Error(),
+					Failure: failureOther, CheckedAt: time.Now().UTC()}
+				return
+			}
+			results[i] = probeTarget(target)
+		}(i, a)
+	}
+	wg.Wait()
+	return AgentReport{Results: results}
+}
+
+func postReport(base, token string, report AgentReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, base+"/agent/results", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("coordinator returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// udpEcho answers "ping" with "pong" until the test ends.
+func udpEcho(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if string(buf[:n]) == "ping" {
+				conn.WriteTo([]byte("pong"), addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestAgentRunsTypedChecks(t *testing.T) {
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("build 42 ok"))
+	}))
+	defer web.Close()
+
+	udpURL := "udp://" + udpEcho(t)
+	monitors := []MonitorConfig{
+		{URL: udpURL, Type: udpType, UDP: &UDPCheckConfig{Send: "ping", Expect: "pong", Attempts: 1}},
+		{URL: web.URL + "/", BodyNotMatches: `build \d+ failed`, BodyMatches: `build (?P<build>\d+)`},
+		{URL: web.URL + "/push", Type: pushType, PushToken: "t"},
+	}
+	var list []Target
+	for _, m := range monitors {
+		list = append(list, m.target())
+	}
+	targets.set("config", list)
+	defer targets.set("config", nil)
+
+	config := Config{Agents: []AgentCredential{{Name: "eu-west", Token: "secret"}}, Interval: Duration(time.Minute)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agent/assignments", agentAssignmentsHandler(config))
+	mux.HandleFunc("/agent/results", agentResultsHandler(config))
+	coordinator := httptest.NewServer(mux)
+	defer coordinator.Close()
+
+	assignment, err := fetchAssignment(coordinator.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignment.Targets) != 2 {
+		t.Fatalf("assignment has %d targets, want 2 without the push monitor", len(assignment.Targets))
+	}
+	report := runAssignment(assignment)
+	byURL := map[string]CheckResult{}
+	for _, r := range report.Results {
+		byURL[r.URL] = r
+	}
+	if r := byURL[udpURL]; r.Status != "up" {
+		t.Errorf("udp monitor checked by the agent is %s: %s", r.Status, r.Detail)
+	}
+	if r := byURL[web.URL+"/"]; r.Status != "up" || r.Captures["build"] != "42" {
+		t.Errorf("http monitor checked by the agent is %s with captures %v: %s", r.Status, r.Captures, r.Detail)
+	}
+
+	if err := postReport(coordinator.URL, "secret", report); err != nil {
+		t.Fatal(err)
+	}
+	if got := probeResults.fresh(udpURL, time.Minute)["eu-west"]; got != StatusUp {
+		t.Errorf("coordinator recorded the agent's udp result as %q", got)
+	}
+}
+
+func TestAgentTargetKeepsPatterns(t *testing.T) {
+	target := MonitorConfig{URL: "http://example.com/", BodyMatches: `ok`,
+		ExpectHeaders: []HeaderAssertion{{Name: "Server", Matches: "^nginx"}}}.target()
+	back, err := agentTarget(target).target()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.BodyMatches == nil || back.BodyMatches.String() != "ok" {
+		t.Errorf("body pattern lost: %v", back.BodyMatches)
+	}
+	if len(back.ExpectHeaders) != 1 || back.ExpectHeaders[0].re == nil {
+		t.Errorf("header assertion not compiled: %+v", back.ExpectHeaders)
+	}
+	if _, err := (AgentTarget{Target: Target{URL: "http://example.com/"}, BodyMatches: "("}).target(); err == nil ||
+		!strings.Contains(err.Error(), "missing closing )") {
+		t.Errorf("invalid pattern accepted: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// alertHolds keeps down alerts back while a reason to hold them lasts,
+// remembering the outages it holds.
+type alertHolds struct {
+	// grace is how long after started no down alert is sent.
+	grace time.Duration
+	// started is when the monitor started, or when the first process of an
+	// upgrade handover did.
+	started time.Time
+	// confirmations is how many consecutive down results a monitor that
+	// has not been up since startup needs before its first alert.
+	confirmations int
+
+	mu   sync.Mutex
+	held map[string]*heldAlert
+}
+
+type heldAlert struct {
+	Downs int `json:"downs"`
+	// FirstOutage is set when the monitor has not been up since startup.
+	FirstOutage bool `json:"firstOutage"`
+}
+
+var holds = &alertHolds{confirmations: 1, started: time.Now(), held: make(map[string]*heldAlert)}
+
+func newAlertHolds(config Config) *alertHolds {
+	h := &alertHolds{
+		grace:         time.Duration(config.StartupGrace),
+		started:       diag.started,
+		confirmations: config.FirstAlertConfirmations,
+		held:          make(map[string]*heldAlert),
+	}
+	if h.confirmations < 1 {
+		h.confirmations = 1
+	}
+	return h
+}
+
+// down is called for each down result of t while no down alert has been
+// sent for its outage, prev being its state before the result. It reports
+// whether the alert must still be held back.
+func (h *alertHolds) down(t Target, prev MonitorState) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a, ok := h.held[t.URL]
+	if !ok {
+		a = &heldAlert{FirstOutage: prev.Status == StatusUnknown}
+		h.held[t.URL] = a
+	}
+	a.Downs++
+	if reason := h.holdReason(t, a, time.Now()); reason != "" {
+		if !ok {
+			fmt.Printf("Holding down alert for %s: %s\n", t.URL, reason)
+		}
+		return true
+	}
+	delete(h.held, t.URL)
+	return false
+}
+
+// holdReason returns the first reason to hold back a down alert for t at
+// now, or "" if it may be sent.
+func (h *alertHolds) holdReason(t Target, a *heldAlert, now time.Time) string {
+	switch {
+	case now.Sub(h.started) < h.grace:
+		return "startup grace"
+	case a.FirstOutage && a.Downs < h.confirmations:
+		return "first outage confirmations"
+	case deploys.suppressing(t.URL):
+		return "deploy"
+	case inMaintenance(t, now):
+		return "maintenance window"
+	case calendars.silencing(t.URL, now):
+		return "silencing calendar"
+	case silenced(t.URL, now):
+		return "silence"
+	}
+	return ""
+}
+
+// release forgets a held alert for url, reporting whether there was one,
+// in which case its recovery must not be announced either.
+func (h *alertHolds) release(url string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.held[url]
+	delete(h.held, url)
+	return ok
+}
+
+// isHeld reports whether url is down without having been alerted on.
+func (h *alertHolds) isHeld(url string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.held[url]
+	return ok
+}
+
+// snapshot returns a copy of the held alerts and the start time, for
+// handing them over to the next process.
+func (h *alertHolds) snapshot() (map[string]heldAlert, time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[string]heldAlert, len(h.held))
+	for url, a := range h.held {
+		out[url] = *a
+	}
+	return out, h.started
+}
+
+// restore takes over alerts held by a previous process and, unless it is
+// zero, the time it started.
+func (h *alertHolds) restore(held map[string]heldAlert, started time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for url, a := range held {
+		a := a
+		h.held[url] = &a
+	}
+	if !started.IsZero() {
+		h.started = started
+	}
+}
+
+func (h *alertHolds) describe() string {
+	s := fmt.Sprintf("startup grace %s", h.grace)
+	if h.confirmations > 1 {
+		s += fmt.Sprintf(", %d confirmations before a first alert", h.confirmations)
+	}
+	return s
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFirstAlertHeldDuringMaintenance(t *testing.T) {
+	target := Target{URL: "https://example.com/"}
+	now := time.Now()
+	maintenanceWindows = []MaintenanceWindow{{Start: now.Add(-time.Minute), End: now.Add(time.Hour), Monitors: []string{target.URL}}}
+	defer func() { maintenanceWindows = nil }()
+
+	h := &alertHolds{confirmations: 1, started: now, held: make(map[string]*heldAlert)}
+	up := MonitorState{Status: StatusUp}
+	if !h.down(target, up) {
+		t.Fatal("down alert sent during a maintenance window")
+	}
+	maintenanceWindows = nil
+	if h.down(target, up) {
+		t.Error("down alert still held after the maintenance window")
+	}
+}
+
+func TestHoldReason(t *testing.T) {
+	now := time.Now()
+	h := &alertHolds{grace: time.Minute, confirmations: 3, started: now}
+	target := Target{URL: "https://example.com/"}
+	if got := h.holdReason(target, &heldAlert{Downs: 1, FirstOutage: true}, now); got != "startup grace" {
+		t.Errorf("in grace: got %q", got)
+	}
+	later := now.Add(2 * time.Minute)
+	if got := h.holdReason(target, &heldAlert{Downs: 1, FirstOutage: true}, later); got != "first outage confirmations" {
+		t.Errorf("unconfirmed first outage: got %q", got)
+	}
+	if got := h.holdReason(target, &heldAlert{Downs: 3, FirstOutage: true}, later); got != "" {
+		t.Errorf("confirmed first outage: got %q", got)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// AnomalyConfig enables latency anomaly detection. Each monitor's normal
+// response time is learned as an exponentially weighted moving average and
+// variance, per location; a run of checks that are much slower than normal
+// raises a performance anomaly even though the monitor is still up.
+type AnomalyConfig struct {
+	// Alpha is the weight given to each new sample. Defaults to 0.1.
+	Alpha float64 `json:"alpha"`
+	// Threshold is how many standard deviations above the mean a check must
+	// be to count as anomalous. Defaults to 3.
+	Threshold float64 `json:"threshold"`
+	// Consecutive is how many anomalous checks in a row raise the event.
+	// Defaults to 3.
+	Consecutive int `json:"consecutive"`
+	// Warmup is how many successful checks are needed before a monitor is
+	// judged at all, and how many more slow checks it takes for a lasting
+	// slowdown to be accepted as the new normal. Defaults to 20.
+	Warmup int `json:"warmup"`
+	// MinDeviation ignores slowdowns smaller than this, so very stable
+	// endpoints do not alert on a few milliseconds. Defaults to 50ms.
+	MinDeviation Duration `json:"min_deviation"`
+}
+
+type latencyBaseline struct {
+	mean, variance float64
+	samples        int
+	// slow counts consecutive anomalous checks.
+	slow      int
+	anomalous bool
+}
+
+type anomalyDetector struct {
+	config AnomalyConfig
+
+	mu sync.Mutex
+	// baselines is keyed by URL, then location.
+	baselines map[string]map[string]*latencyBaseline
+}
+
+// anomalies is nil unless anomaly detection is configured.
+var anomalies *anomalyDetector
+
+func newAnomalyDetector(config AnomalyConfig) *anomalyDetector {
+	if config.Alpha <= 0 || config.Alpha >= 1 {
+		config.Alpha = 0.1
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 3
+	}
+	if config.Consecutive <= 0 {
+		config.Consecutive = 3
+	}
+	if config.Warmup <= 0 {
+		config.Warmup = 20
+	}
+	if config.MinDeviation <= 0 {
+		config.MinDeviation = Duration(50 * time.Millisecond)
+	}
+	return &anomalyDetector{config: config, baselines: make(map[string]map[string]*latencyBaseline)}
+}
+
+// observe feeds one check result into location's baseline for target and
+// notifies when the monitor enters or leaves an anomalous state. Failed
+// checks are left to the up/down logic.
+func (a *anomalyDetector) observe(target Target, location string, r CheckResult) {
+	if r.Status != "up" {
+		return
+	}
+	x := float64(r.Latency) / float64(time.Millisecond)
+
+	a.mu.Lock()
+	byLocation := a.baselines[r.URL]
+	if byLocation == nil {
+		byLocation = make(map[string]*latencyBaseline)
+		a.baselines[r.URL] = byLocation
+	}
+	b := byLocation[location]
+	if b == nil {
+		b = &latencyBaseline{mean: x}
+		byLocation[location] = b
+	}
+	mean, std := b.mean, math.Sqrt(b.variance)
+	deviation := x - mean
+	minDeviation := float64(a.config.MinDeviation) / float64(time.Millisecond)
+	slow := b.samples >= a.config.Warmup && deviation > minDeviation && deviation > a.config.Threshold*std
+
+	// Slow samples are kept out of the baseline so a slowdown cannot
+	// normalize itself within a few checks.
+	if slow {
+		b.slow++
+	} else {
+		b.slow = 0
+		diff := x - b.mean
+		incr := a.config.Alpha * diff
+		b.mean += incr
+		b.variance = (1 - a.config.Alpha) * (b.variance + diff*incr)
+		b.samples++
+	}
+	var n *notification
+	switch {
+	case b.anomalous && b.slow >= a.config.Consecutive+a.config.Warmup:
+		// A slowdown that lasts this long is the new normal; learn it afresh.
+		*b = latencyBaseline{mean: x}
+		n = &notification{Status: alertResolved, Detail: fmt.Sprintf(
+			"Response time of %s from %s has stayed around %.0fms and is now treated as normal",
+			target.displayName(), location, x)}
+	case !b.anomalous && b.slow >= a.config.Consecutive:
+		b.anomalous = true
+		n = &notification{Status: "slow", Detail: fmt.Sprintf(
+			"Response time of %s from %s is %.0fms, normally %.0fms ± %.0fms",
+			target.displayName(), location, x, mean, std)}
+	case b.anomalous && !slow:
+		b.anomalous = false
+		n = &notification{Status: alertResolved, Detail: fmt.Sprintf(
+			"Response time of %s from %s is back to normal at %.0fms",
+			target.displayName(), location, x)}
+	}
+	a.mu.Unlock()
+
+	if n != nil {
+		fmt.Println(n.Detail)
+		n.Kind, n.Target, n.Time, n.Location = notifyAnomaly, target, time.Now().UTC(), location
+		enqueueNotification(*n)
+	}
+}
+
+// remove forgets every baseline for url.
+func (a *anomalyDetector) remove(url string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.baselines, url)
+}
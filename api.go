@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LocationStatus struct {
+	Location string        `json:"location"`
+	Status   MonitorStatus `json:"status"`
+}
+
+type StatusEntry struct {
+	URL    string        `json:"url"`
+	Status MonitorStatus `json:"status"`
+	// Locations is the latest status seen from each vantage point. It is
+	// only present when agents are configured.
+	Locations []LocationStatus `json:"locations,omitempty"`
+	// Since is when the monitor entered Status, in UTC.
+	Since time.Time `json:"since"`
+}
+
+type PaginatedStatusResponse struct {
+	TotalPages  int           `json:"totalPages"`
+	CurrentPage int           `json:"currentPage"`
+	Data        []StatusEntry `json:"data"`
+	// Timezone is the IANA zone clients should display times in.
+	Timezone string `json:"timezone"`
+}
+
+// pageCacheSize bounds how many encoded pages are kept per snapshot version.
+const pageCacheSize = 128
+
+type pageKey struct {
+	page, limit int
+	project     string
+}
+
+// pageCache holds /status bodies encoded from a single snapshot version.
+// It is emptied whenever the store's version moves on.
+type pageCache struct {
+	mu      sync.Mutex
+	version uint64
+	pages   map[pageKey][]byte
+}
+
+// instanceTag keeps ETags from one process from matching another's, since
+// snapshot versions restart at zero.
+var instanceTag = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+var statusPages = &pageCache{pages: make(map[pageKey][]byte)}
+
+func (c *pageCache) get(version uint64, key pageKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != version {
+		return nil, false
+	}
+	b, ok := c.pages[key]
+	return b, ok
+}
+
+func (c *pageCache) put(version uint64, key pageKey, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != version {
+		c.version = version
+		c.pages = make(map[pageKey][]byte)
+	}
+	if len(c.pages) >= pageCacheSize {
+		return
+	}
+	c.pages[key] = body
+}
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	page, ok := intParam(w, r, "page", 1, 1, math.MaxInt32)
+	if !ok {
+		return
+	}
+	limit, ok := intParam(w, r, "limit", 10, 1, statusMaxLimit)
+	if !ok {
+		return
+	}
+
+	project := requestScope(r).projectFilter()
+	key := pageKey{page: page, limit: limit, project: project}
+	stamp := statuses.currentStamp()
+	body, cached := statusPages.get(stamp.version, key)
+	if !cached {
+		start := (page - 1) * limit
+		var data []StatusEntry
+		var totalItems int
+		if project == "" {
+			data, totalItems, stamp = statuses.page(start, start+limit)
+		} else {
+			data, totalItems, stamp = statuses.pageWhere(start, start+limit, func(e StatusEntry) bool {
+				t, ok := targets.get(e.URL)
+				return ok && t.Project == project
+			})
+		}
+		if page > 1 && start >= totalItems {
+			writeProblem(w, r, http.StatusNotFound, problemPageOutOfRange,
+				fmt.Sprintf("page %d is past the last page, %d", page, (totalItems+limit-1)/limit))
+			return
+		}
+		body, _ = json.Marshal(PaginatedStatusResponse{
+			TotalPages:  (totalItems + limit - 1) / limit,
+			CurrentPage: page,
+			Data:        data,
+			Timezone:    displayZone.String(),
+		})
+		statusPages.put(stamp.version, key, body)
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*") // For development, allow any origin
+	writeCached(w, r, fmt.Sprintf("%s-%d", instanceTag, stamp.version), stamp.modified, "application/json", body)
+}
+
+// statusMaxLimit caps the page size of /status.
+const statusMaxLimit = 1000
+
+// intParam parses the integer query parameter name, which must lie in
+// [lo, hi], returning def when it is absent. It sends invalid_parameter
+// and returns false when the value is unusable.
+func intParam(w http.ResponseWriter, r *http.Request, name string, def, lo, hi int) (int, bool) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < lo || n > hi {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter,
+			fmt.Sprintf("%s must be an integer from %d to %d", name, lo, hi))
+		return 0, false
+	}
+	return n, true
+}
+
+// durationParam is intParam for a Go duration such as "24h".
+func durationParam(w http.ResponseWriter, r *http.Request, name string, def, lo, hi time.Duration) (time.Duration, bool) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < lo || d > hi {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter,
+			fmt.Sprintf("%s must be a duration from %s to %s", name, formatDuration(lo), formatDuration(hi)))
+		return 0, false
+	}
+	return d, true
+}
+
+// zoneParam resolves the IANA timezone in the tz query parameter, which
+// defaults to the display timezone.
+func zoneParam(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return displayZone, true
+	}
+	zone, err := time.LoadLocation(tz)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter, "unknown timezone "+tz)
+		return nil, false
+	}
+	return zone, true
+}
+
+// writeCached writes body with an ETag derived from tag and, when modified
+// is set, a Last-Modified date. It answers 304 when the client already holds
+// the body, and gzip-compresses when the client accepts it.
+func writeCached(w http.ResponseWriter, r *http.Request, tag string, modified time.Time, contentType string, body []byte) {
+	gz := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+	etag := `"` + tag + `"`
+	if gz {
+		etag = `"` + tag + `-gzip"`
+	}
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "no-cache")
+	h.Add("Vary", "Accept-Encoding")
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", contentType)
+	if gz {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		zw.Close()
+		body = buf.Bytes()
+		h.Set("Content-Encoding", "gzip")
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
+
+// notModified evaluates r's conditional headers. If-None-Match takes
+// precedence; If-Modified-Since is only consulted without it.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return etagMatches(match, etag)
+	}
+	if modified.IsZero() || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.Truncate(time.Second).After(since)
+}
+
+// writeJSONCached encodes v and sends it through writeCached, tagged with a
+// hash of the encoding. It saves the transfer, not the encoding, for
+// endpoints without a versioned snapshot.
+func writeJSONCached(w http.ResponseWriter, r *http.Request, v any) {
+	body, _ := json.Marshal(v)
+	h := fnv.New64a()
+	h.Write(body)
+	writeCached(w, r, strconv.FormatUint(h.Sum64(), 36), time.Time{}, "application/json", append(body, '\n'))
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func startAPIServer(config Config) {
+	urlParam := apiParam{name: "url", in: "query", doc: "Monitor URL", required: true}
+	http.HandleFunc("/", notFoundHandler)
+	handle("/openapi.json", openAPIHandler,
+		apiOp{method: "GET", summary: "This OpenAPI document", result: map[string]any{}})
+	handle("/status", statusHandler, apiOp{method: "GET", summary: "Current status of every monitor, paginated",
+		params: []apiParam{queryInt("page", "Page number, from 1"), queryInt("limit", "Monitors per page, up to 1000")},
+		result: PaginatedStatusResponse{}})
+	handle("/status.txt", statusTextHandler, apiOp{method: "GET", summary: "Nagios-style plain-text status summary",
+		params: []apiParam{query("url", "Only this monitor"), query("group", "Only monitors in this group")},
+		result: ""})
+	handle("/summary", summaryHandler, apiOp{method: "GET", summary: "Counts of monitors by status, for load balancer health checks",
+		params: []apiParam{query("group", "Only monitors in this group"),
+			query("fail_if_any_down", `Present or "true" to answer 503 while any monitor is down`)},
+		result: Summary{}})
+	handle("/status/monitor", monitorStateHandler, apiOp{method: "GET", summary: "Detailed state of one monitor",
+		params: []apiParam{urlParam}, result: MonitorState{}})
+	handle("/monitors/export", monitorsExportHandler, apiOp{method: "GET", summary: "The configured monitors, as JSON or YAML",
+		params: []apiParam{{name: "format", in: "query", doc: `"yaml" for YAML; also chosen by an Accept header naming YAML`}},
+		result: MonitorList{}})
+	handle("/monitors/import", monitorsImportHandler, apiOp{method: "POST", summary: "Replace the configured monitors, or plan to",
+		params: []apiParam{query("dry_run", `"true" to report the changes without making them`)},
+		body:   MonitorList{}, result: ImportResult{}})
+	monitorParam := pathParam("monitor", "Monitor name or URL-escaped URL")
+	handle("/monitors/", monitorPathHandler,
+		apiOp{method: "GET", path: "/monitors/{monitor}/latency", summary: "Min, average and max latency over a window, for sparklines",
+			params: []apiParam{monitorParam,
+				query("window", "How far back to go, as a Go duration (default 24h)"),
+				query("resolution", "Width of each point: a multiple of 5m for windows under 48h, of 1h otherwise")},
+			result: LatencySeries{}},
+		apiOp{method: "GET", path: "/monitors/{monitor}/regions", summary: "Uptime and average latency from each location over a window",
+			params: []apiParam{monitorParam,
+				query("window", "How far back to go, as a Go duration (default 168h)"),
+				query("resolution", "Width of each point: a multiple of 1h (default 1h)")},
+			result: RegionSeries{}},
+		apiOp{method: "GET", path: "/monitors/{monitor}/uptime", summary: "Uptime and incidents per day, for status page bars",
+			params: []apiParam{monitorParam, queryInt("days", "How many days, today included (default 90)"),
+				query("tz", "IANA timezone days are aligned to")},
+			result: DailyUptime{}},
+		apiOp{method: "GET", path: "/monitors/{monitor}/silence", summary: "The monitor's silences, newest first",
+			params: []apiParam{monitorParam}, result: []Silence{}},
+		apiOp{method: "POST", path: "/monitors/{monitor}/silence", summary: "Hold back the monitor's alerts for a while",
+			params: []apiParam{monitorParam}, body: SilenceRequest{}, result: Silence{}, status: http.StatusCreated},
+		apiOp{method: "DELETE", path: "/monitors/{monitor}/silence", summary: "End the monitor's silence early",
+			params: []apiParam{monitorParam}})
+	handle("/backup", backupHandler, apiOp{method: "GET", summary: "Back up monitors, state, history and accepted baselines", result: Backup{}})
+	handle("/restore", restoreHandler, apiOp{method: "POST", summary: "Restore a backup", body: Backup{}, result: RestoreResult{}})
+	handle("/reports", reportsHandler, apiOp{method: "GET", summary: "Uptime report for the last complete period",
+		params: []apiParam{query("period", "daily, weekly or monthly"), query("group", "Only monitors in this group"),
+			query("tz", "IANA timezone the period is aligned to"), query("format", "json or text")},
+		result: Report{}, text: true})
+	monthParam := pathParam("month", "Calendar month such as 2026-09; the current month is covered to date")
+	reportFileParams := []apiParam{monthParam, query("group", "Only monitors in this group"), query("tz", "IANA timezone the month is aligned to")}
+	handle("/reports/", reportFileHandler,
+		apiOp{method: "GET", path: "/reports/{month}.pdf", summary: "Printable monthly report with charts and an incident timeline, as PDF",
+			params: reportFileParams, result: "", media: "application/pdf"},
+		apiOp{method: "GET", path: "/reports/{month}.html", summary: "Printable monthly report with charts and an incident timeline, as HTML",
+			params: reportFileParams, result: "", media: "text/html"})
+	handle("/slo", sloHandler, apiOp{method: "GET", summary: "SLO status of monitors with an objective", result: []SLOStatus{}})
+	handle("/tls", tlsHandler, apiOp{method: "GET", summary: "Latest TLS grade of graded monitors", result: []TLSReport{}})
+	handle("/certs", certsHandler, apiOp{method: "GET", summary: "Accepted certificate of each pinned monitor", result: []CertInfo{}})
+	handle("/certs/accept", certsHandler, apiOp{method: "POST", summary: "Accept a monitor's changed certificate",
+		params: []apiParam{urlParam}})
+	handle("/sessions/reset", sessionResetHandler, apiOp{method: "POST", summary: "Discard a monitor's stored login session",
+		params: []apiParam{urlParam}})
+	handle("/content/accept", contentAcceptHandler, apiOp{method: "POST", summary: "Accept a monitor's changed content",
+		params: []apiParam{urlParam}})
+	handle("/results/", resultsHandler, apiOp{method: "POST", path: "/results/{monitor}", summary: "Report a push monitor's result",
+		params: []apiParam{pathParam("monitor", "Monitor name or path-escaped URL")}, body: PushedResult{}})
+	handle("/audit", auditHandler, apiOp{method: "GET", summary: "Audit log, newest first",
+		params: []apiParam{query("type", "notification or admin"), query("target", "Monitor URL"), query("channel", "Notifier"),
+			query("since", "RFC 3339 time"), queryInt("limit", "Maximum entries, default 100")},
+		result: []AuditEntry{}})
+	handle("/channels", channelsHandler, apiOp{method: "GET", summary: "Delivery health of the notification channels", result: []ChannelHealth{}})
+	handle("/debug", debugHandler, apiOp{method: "GET", summary: "The monitor's diagnostics about itself", result: Diagnostics{}})
+	if config.Debug.Pprof {
+		handle("/debug/pprof/", pprofHandler)
+	}
+	if oidc != nil {
+		handle("/auth/login", oidc.loginHandler)
+		handle("/auth/callback", oidc.callbackHandler)
+		handle("/auth/logout", oidc.logoutHandler, apiOp{method: "POST", summary: "End the login session"})
+		handle("/auth/me", oidc.meHandler, apiOp{method: "GET", summary: "The logged-in user and role", result: map[string]any{}})
+	}
+	if len(onCall) > 0 {
+		handle("/oncall", onCallHandler, apiOp{method: "GET", summary: "Who is on call for each team, now and next", result: []OnCallStatus{}})
+	}
+	if chaos != nil {
+		chaosParams := []apiParam{urlParam, query("status", "down (default) or up"), query("duration", "Go duration, default 5m")}
+		handle("/chaos", chaosHandler,
+			apiOp{method: "GET", summary: "Forced monitor states in effect", result: []ChaosOverride{}},
+			apiOp{method: "POST", summary: "Force a monitor down or up for a while", params: chaosParams, result: ChaosOverride{}},
+			apiOp{method: "DELETE", summary: "End a forced state early", params: []apiParam{urlParam}})
+	}
+	if deploys != nil {
+		handle("/deploys", deploysHandler,
+			apiOp{method: "GET", summary: "Recent deploys, newest first",
+				params: []apiParam{query("service", "Only this service"), query("since", "Go duration, default 24h")}, result: []DeployEvent{}},
+			apiOp{method: "POST", summary: "Record a deploy", body: DeployEvent{}, result: DeployEvent{}, status: http.StatusCreated})
+	}
+	if len(calendars) > 0 {
+		handle("/calendars", calendarsHandler, apiOp{method: "GET", summary: "Calendars with their current and upcoming excluded periods", result: []CalendarStatus{}})
+	}
+	if dnsCache != nil {
+		handle("/dns", dnsCacheHandler, apiOp{method: "GET", summary: "Cached host names and their resolution results", result: []DNSCacheEntry{}})
+	}
+	if apiTokens != nil {
+		idParam := pathParam("id", "Token ID")
+		handle("/tokens", tokensHandler,
+			apiOp{method: "GET", summary: "List API tokens", result: []APIToken{}},
+			apiOp{method: "POST", summary: "Create an API token", body: APIToken{}, result: APIToken{}, status: http.StatusCreated})
+		handle("/tokens/", tokensHandler,
+			apiOp{method: "GET", path: "/tokens/{id}", summary: "Get an API token", params: []apiParam{idParam}, result: APIToken{}},
+			apiOp{method: "DELETE", path: "/tokens/{id}", summary: "Revoke an API token", params: []apiParam{idParam}},
+			apiOp{method: "POST", path: "/tokens/{id}/rotate", summary: "Replace an API token's secret",
+				params: []apiParam{idParam, query("grace", "Go duration the old secret stays valid, default 0")}, result: APIToken{}})
+	}
+	if statusSubscribers != nil {
+		tokenParam := apiParam{name: "token", in: "query", doc: "Token from the email link", required: true}
+		handle("/updates/", updatesHandler,
+			apiOp{method: "GET", path: "/updates/groups", summary: "Groups status page visitors may subscribe to", result: []string{}},
+			apiOp{method: "POST", path: "/updates/subscribe", summary: "Subscribe an email address to incidents, pending confirmation",
+				body: subscribeRequest{}, status: http.StatusAccepted},
+			apiOp{method: "GET", path: "/updates/confirm", summary: "Confirm a subscription", params: []apiParam{tokenParam}},
+			apiOp{method: "GET", path: "/updates/unsubscribe", summary: "Unsubscribe", params: []apiParam{tokenParam}},
+			apiOp{method: "POST", path: "/updates/unsubscribe", summary: "Unsubscribe in one click", params: []apiParam{tokenParam}})
+		handle("/subscribers", subscribersHandler, apiOp{method: "GET", summary: "Status page subscribers", result: []StatusSubscriber{}})
+		handle("/subscribers/", subscribersHandler, apiOp{method: "DELETE", path: "/subscribers/{id}", summary: "Remove a status page subscriber",
+			params: []apiParam{pathParam("id", "Subscriber ID")}})
+	}
+	if subscriptions != nil {
+		idParam := pathParam("id", "Subscription ID")
+		handle("/subscriptions", subscriptionsHandler,
+			apiOp{method: "GET", summary: "List webhook subscriptions", result: []Subscription{}},
+			apiOp{method: "POST", summary: "Create a webhook subscription", body: Subscription{}, result: Subscription{}, status: http.StatusCreated})
+		handle("/subscriptions/", subscriptionsHandler,
+			apiOp{method: "GET", path: "/subscriptions/{id}", summary: "Get a subscription", params: []apiParam{idParam}, result: Subscription{}},
+			apiOp{method: "DELETE", path: "/subscriptions/{id}", summary: "Delete a subscription", params: []apiParam{idParam}},
+			apiOp{method: "GET", path: "/subscriptions/{id}/deliveries", summary: "Recent deliveries, newest first",
+				params: []apiParam{idParam}, result: []Delivery{}},
+			apiOp{method: "POST", path: "/subscriptions/{id}/deliveries/{delivery}/retry", summary: "Retry a delivery now",
+				params: []apiParam{idParam, pathParam("delivery", "Delivery ID")}, result: Delivery{}})
+	}
+	if len(config.Agents) > 0 {
+		handle("/agent/assignments", agentAssignmentsHandler(config),
+			apiOp{method: "GET", summary: "The calling agent's assignment", result: AgentAssignment{}})
+		handle("/agent/results", agentResultsHandler(config),
+			apiOp{method: "POST", summary: "Submit an agent's check results", body: AgentReport{}})
+		handle("/agents", agentsHandler(config), apiOp{method: "GET", summary: "Configured agents", result: []AgentInfo{}})
+		handle("/regions", regionsReportHandler, apiOp{method: "GET", summary: "Each monitor's locations compared, flagging degraded ones",
+			params: []apiParam{query("window", "Go duration, default 24h")}, result: []RegionReport{}})
+	}
+	limits := config.API.withDefaults()
+	access = newAPIAccess(limits)
+	var accessLog *accessLogger
+	if limits.AccessLog != nil {
+		var err error
+		if accessLog, err = newAccessLogger(*limits.AccessLog); err != nil {
+			fmt.Println("Error opening access log:", err)
+		}
+	}
+	server := &http.Server{
+		Handler:           withAccessLog(accessLog, withAccess(withLimits(limits, withReadOnly(withAPIAuth(http.DefaultServeMux))))),
+		ReadHeaderTimeout: time.Duration(limits.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(limits.ReadTimeout),
+		WriteTimeout:      time.Duration(limits.WriteTimeout),
+		IdleTimeout:       time.Duration(limits.IdleTimeout),
+		MaxHeaderBytes:    64 << 10,
+	}
+	ln, err := apiListener(limits)
+	if err != nil {
+		fmt.Println("Error starting API server:", err)
+		if handover != "" {
+			// The previous process carries on when this one can't serve.
+			os.Exit(1)
+		}
+		return
+	}
+	serving.mu.Lock()
+	serving.server, serving.ln = server, ln
+	serving.mu.Unlock()
+	fmt.Println("API server listening on", ln.Addr())
+	upgradeReady()
+	if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("Error starting API server:", err)
+	}
+}
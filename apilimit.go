@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// APIConfig sets where the API server listens and hardens it against abuse.
+type APIConfig struct {
+	// Listen is a TCP address such as "127.0.0.1:8080" or ":9000", or a Unix
+	// socket path prefixed with "unix:". Defaults to ":8080".
+	Listen string `json:"listen"`
+	// SocketMode is the octal permission of a Unix socket, e.g. "0660".
+	// Defaults to "0660".
+	SocketMode string `json:"socket_mode"`
+	// RateLimit is the sustained requests per second allowed from one
+	// client IP. Zero disables rate limiting.
+	RateLimit float64 `json:"rate_limit"`
+	// Burst is how many requests a client may make at once before being
+	// limited. Defaults to twice RateLimit, at least 1.
+	Burst int `json:"burst"`
+	// MaxBodyBytes caps request bodies. Defaults to 1 MiB.
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// The server timeouts default to 5s for headers, 15s to read the whole
+	// request, 30s to write the response and 2m for idle keep-alives.
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	ReadTimeout       Duration `json:"read_timeout"`
+	WriteTimeout      Duration `json:"write_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout"`
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers name the real client.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// Allow, when set, limits the API to clients in these addresses or
+	// ranges. Deny refuses clients in them.
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+	// AdminAllow limits requests that change the instance or need an admin
+	// key to clients in these addresses or ranges.
+	AdminAllow []string `json:"admin_allow"`
+	// AccessLog, when set, logs every request.
+	AccessLog *AccessLogConfig `json:"access_log"`
+}
+
+func (c APIConfig) withDefaults() APIConfig {
+	if c.Listen == "" {
+		c.Listen = ":8080"
+	}
+	if c.SocketMode == "" {
+		c.SocketMode = "0660"
+	}
+	if c.Burst <= 0 {
+		c.Burst = int(math.Max(1, math.Ceil(2*c.RateLimit)))
+	}
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = 1 << 20
+	}
+	if c.ReadHeaderTimeout <= 0 {
+		c.ReadHeaderTimeout = Duration(5 * time.Second)
+	}
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = Duration(15 * time.Second)
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = Duration(30 * time.Second)
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = Duration(2 * time.Minute)
+	}
+	return c
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// clientLimiter is a token bucket per client IP.
+type clientLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newClientLimiter(rate float64, burst int) *clientLimiter {
+	return &clientLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket), swept: time.Now()}
+}
+
+// allow takes a token for ip, or reports how long until one is available.
+func (l *clientLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Buckets that have refilled completely carry no state worth keeping.
+	if full := time.Duration(l.burst / l.rate * float64(time.Second)); now.Sub(l.swept) > full && now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > full {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b := l.buckets[ip]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// restoreMaxBytes caps backups posted to /restore, which carry months of
+// history and so are far larger than other request bodies.
+const restoreMaxBytes = 512 << 20
+
+// withLimits applies the per-IP rate limit and body size cap.
+func withLimits(config APIConfig, next http.Handler) http.Handler {
+	var limiter *clientLimiter
+	if config.RateLimit > 0 {
+		limiter = newClientLimiter(config.RateLimit, config.Burst)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limiter != nil {
+			if ok, wait := limiter.allow(clientIP(r), time.Now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeProblem(w, r, http.StatusTooManyRequests, problemRateLimited, "too many requests from this address")
+				return
+			}
+		}
+		limit := config.MaxBodyBytes
+		if r.URL.Path == "/restore" {
+			limit = max(limit, restoreMaxBytes)
+		}
+		if r.ContentLength > limit {
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, problemBodyTooLarge, fmt.Sprintf("request bodies are limited to %d bytes", limit))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
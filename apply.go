@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runApply converges a running instance's monitors on a file: it prints
+// the plan the instance reports for the file, asks for confirmation and
+// then imports it, provided nobody changed the monitors in between.
+func runApply(args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	file := fs.String("f", "", "monitor list to apply, JSON or YAML")
+	server := fs.String("server", "http://localhost:8080", "base URL of the instance")
+	key := fs.String("key", "", "admin API key, when projects are configured")
+	planOnly := fs.Bool("plan", false, "print the plan without applying it")
+	autoApprove := fs.Bool("auto-approve", false, "apply without asking for confirmation")
+	fs.Parse(args)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "Error: apply requires -f")
+		os.Exit(2)
+	}
+	list, err := readMonitorFile(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading monitors:", err)
+		os.Exit(1)
+	}
+	if err := validateMonitorList(list); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in %s: %s\n", *file, err)
+		os.Exit(1)
+	}
+	base := strings.TrimRight(*server, "/")
+
+	plan, revision, err := postMonitors(base, *key, list, "", true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error planning:", err)
+		os.Exit(1)
+	}
+	if len(plan.Added)+len(plan.Updated)+len(plan.Removed) == 0 {
+		fmt.Printf("No changes. %d monitors are up to date.\n", plan.Unchanged)
+		return
+	}
+	printPlan(plan)
+	if *planOnly {
+		return
+	}
+	if !*autoApprove {
+		fmt.Print("\nApply these changes? Only 'yes' will be accepted: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+			fmt.Println("Apply cancelled.")
+			os.Exit(1)
+		}
+	}
+	result, _, err := postMonitors(base, *key, list, revision, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error applying:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Apply complete: %d added, %d changed, %d removed.\n", len(result.Added), len(result.Updated), len(result.Removed))
+}
+
+// readMonitorFile reads a monitor list, either {"monitors": [...]} or a
+// bare list, from a JSON file or, for .yaml and .yml, a YAML one.
+func readMonitorFile(path string) ([]MonitorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		doc, err := parseYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var list []MonitorConfig
+		err = dec.Decode(&list)
+		return list, err
+	}
+	var list MonitorList
+	err = dec.Decode(&list)
+	return list.Monitors, err
+}
+
+// postMonitors sends list to base's /monitors/import and returns the
+// result and the revision of the monitors it reports.
+func postMonitors(base, key string, list []MonitorConfig, ifMatch string, dryRun bool) (ImportResult, string, error) {
+	var result ImportResult
+	body, _ := json.Marshal(MonitorList{Monitors: list})
+	url := base + "/monitors/import"
+	if dryRun {
+		url += "?dry_run=true"
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return result, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return result, "", err
+	}
+	defer resp.Body.Close()
+	if err := responseError(resp); err != nil {
+		return result, "", err
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, resp.Header.Get("ETag"), err
+}
+
+// responseError describes a failed API response, using the problem's
+// detail when there is one.
+func responseError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var p Problem
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(b, &p) == nil && p.Detail != "" {
+		return fmt.Errorf("%s: %s", resp.Status, p.Detail)
+	}
+	return fmt.Errorf("server returned %s", resp.Status)
+}
+
+// callAPI sends req with key and returns the body of its 200 response.
+func callAPI(req *http.Request, key string) ([]byte, error) {
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := responseError(resp); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func printPlan(plan ImportResult) {
+	for _, url := range plan.Added {
+		fmt.Printf("  + %s\n", url)
+	}
+	for _, url := range plan.Updated {
+		fmt.Printf("  ~ %s (%s)\n", url, strings.Join(plan.Changes[url], ", "))
+	}
+	for _, url := range plan.Removed {
+		fmt.Printf("  - %s\n", url)
+	}
+	fmt.Printf("\nPlan: %d to add, %d to change, %d to remove, %d unchanged.\n",
+		len(plan.Added), len(plan.Updated), len(plan.Removed), plan.Unchanged)
+}
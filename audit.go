@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AuditConfig controls the audit log of notifications sent and admin API
+// actions taken.
+type AuditConfig struct {
+	// File, when set, receives every entry as a JSON line and is read back
+	// at startup.
+	File string `json:"file"`
+	// MaxEntries bounds the entries kept in memory for /audit. Defaults to
+	// 10000.
+	MaxEntries int `json:"max_entries"`
+}
+
+// AuditEntry is one line of the audit log.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Type is "notification" or "admin".
+	Type string `json:"type"`
+	// Action is the event notified (see eventType) or the admin action,
+	// e.g. "cert.accept".
+	Action string `json:"action"`
+	// Channel is the notifier a notification was sent through.
+	Channel string `json:"channel,omitempty"`
+	Target  string `json:"target,omitempty"`
+	// Actor is who performed an admin action.
+	Actor string `json:"actor,omitempty"`
+	// Outcome is "ok" or "error".
+	Outcome string `json:"outcome"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+type auditLog struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+	max     int
+	file    *os.File
+}
+
+var audit = &auditLog{max: 10000}
+
+func startAudit(config AuditConfig) {
+	if config.MaxEntries > 0 {
+		audit.max = config.MaxEntries
+	}
+	if config.File == "" {
+		return
+	}
+	if err := audit.load(config.File); err != nil {
+		fmt.Println("Error loading audit log:", err)
+	}
+	f, err := os.OpenFile(config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		fmt.Println("Error opening audit log:", err)
+		return
+	}
+	audit.mu.Lock()
+	audit.file = f
+	audit.mu.Unlock()
+}
+
+func (a *auditLog) load(file string) error {
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			a.append(e)
+		}
+	}
+	return scanner.Err()
+}
+
+// append must be called with a.mu held.
+func (a *auditLog) append(e AuditEntry) {
+	a.entries = append(a.entries, e)
+	if len(a.entries) > a.max {
+		a.entries = append(a.entries[:0:0], a.entries[len(a.entries)-a.max:]...)
+	}
+}
+
+func (a *auditLog) record(e AuditEntry) {
+	e.Time = time.Now().UTC()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.append(e)
+	if a.file != nil {
+		b, _ := json.Marshal(e)
+		if _, err := a.file.Write(append(b, '\n')); err != nil {
+			fmt.Println("Error writing audit log:", err)
+		}
+	}
+}
+
+// notification records that n was sent through channel.
+func (a *auditLog) notification(channel string, n notification, err error) {
+	e := AuditEntry{Type: "notification", Action: eventType(n), Channel: channel, Target: n.Target.URL, Outcome: "ok"}
+	switch {
+	case err != nil:
+		e.Outcome, e.Detail = "error", err.Error()
+	case dryRun:
+		e.Detail = "dry run, not sent"
+	}
+	a.record(e)
+}
+
+// admin records an admin action on target made through r.
+func (a *auditLog) admin(r *http.Request, action, target, detail string) {
+	a.record(AuditEntry{Type: "admin", Action: action, Target: target, Actor: requestActor(r), Outcome: "ok", Detail: detail})
+}
+
+// requestActor identifies who made r: the logged-in user, or else the
+// client address.
+func requestActor(r *http.Request) string {
+	if user := requestScope(r).user; user != "" {
+		return user
+	}
+	return clientIP(r)
+}
+
+// auditHandler serves GET /audit, newest first, filtered by the optional
+// type, target, channel, since (RFC 3339) and limit (default 100) parameters.
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 100
+	}
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter, "since must be an RFC 3339 time")
+			return
+		}
+	}
+	match := func(e AuditEntry) bool {
+		return (q.Get("type") == "" || e.Type == q.Get("type")) &&
+			(q.Get("target") == "" || e.Target == q.Get("target")) &&
+			(q.Get("channel") == "" || e.Channel == q.Get("channel")) &&
+			!e.Time.Before(since)
+	}
+
+	scope := requestScope(r)
+	audit.mu.Lock()
+	out := []AuditEntry{}
+	for i := len(audit.entries) - 1; i >= 0 && len(out) < limit; i-- {
+		if match(audit.entries[i]) && scope.canSee(audit.entries[i].Target) {
+			out = append(out, audit.entries[i])
+		}
+	}
+	audit.mu.Unlock()
+	writeJSON(w, http.StatusOK, out)
+}
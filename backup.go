@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// backupVersion is bumped whenever Backup changes incompatibly.
+const backupVersion = 1
+
+// Backup is everything a monitor has learned or been told at runtime, as
+// opposed to what config.json says: the configured monitors, including
+// imports, their current state and history, and the accepted content,
+// certificates and subscriptions. Restoring it on another host picks up
+// where the original left off.
+type Backup struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Sections left out are not touched by a restore.
+	Monitors         []MonitorConfig             `json:"monitors,omitempty"`
+	States           []MonitorState              `json:"states,omitempty"`
+	History          map[string]*monitorHistory  `json:"history,omitempty"`
+	ContentBaselines map[string]*contentBaseline `json:"contentBaselines,omitempty"`
+	CertPins         map[string]*CertRecord      `json:"certPins,omitempty"`
+	Subscriptions    []*Subscription             `json:"subscriptions,omitempty"`
+}
+
+// RestoreResult counts what a restore put back.
+type RestoreResult struct {
+	Monitors         int `json:"monitors"`
+	States           int `json:"states"`
+	History          int `json:"history"`
+	ContentBaselines int `json:"contentBaselines"`
+	CertPins         int `json:"certPins"`
+	Subscriptions    int `json:"subscriptions"`
+}
+
+// takeBackup copies every store into a Backup. Each section is consistent
+// in itself; a check landing meanwhile may show in one but not another.
+func takeBackup() Backup {
+	b := Backup{Version: backupVersion, CreatedAt: time.Now().UTC()}
+	configMonitors.Lock()
+	b.Monitors = append([]MonitorConfig{}, configMonitors.list...)
+	configMonitors.Unlock()
+	b.States = statuses.states()
+
+	history.mu.Lock()
+	b.History = make(map[string]*monitorHistory, len(history.monitors))
+	for url, m := range history.monitors {
+		b.History[url] = &monitorHistory{
+			Fine:      append([]historyBucket{}, m.Fine...),
+			Coarse:    append([]historyBucket{}, m.Coarse...),
+			Incidents: append([]Incident{}, m.Incidents...),
+		}
+		for location, list := range m.Locations {
+			if b.History[url].Locations == nil {
+				b.History[url].Locations = make(map[string][]historyBucket, len(m.Locations))
+			}
+			b.History[url].Locations[location] = append([]historyBucket{}, list...)
+		}
+	}
+	history.mu.Unlock()
+
+	contentBaselines.mu.Lock()
+	b.ContentBaselines = make(map[string]*contentBaseline, len(contentBaselines.baselines))
+	for url, c := range contentBaselines.baselines {
+		copied := *c
+		b.ContentBaselines[url] = &copied
+	}
+	contentBaselines.mu.Unlock()
+
+	certPins.mu.Lock()
+	b.CertPins = make(map[string]*CertRecord, len(certPins.known))
+	for url, c := range certPins.known {
+		copied := *c
+		b.CertPins[url] = &copied
+	}
+	certPins.mu.Unlock()
+
+	if subscriptions != nil {
+		subscriptions.mu.Lock()
+		for _, sub := range subscriptions.sorted() {
+			copied := *sub
+			b.Subscriptions = append(b.Subscriptions, &copied)
+		}
+		subscriptions.mu.Unlock()
+	}
+	return b
+}
+
+// restoreBackup replaces the stores b has a section for with it and saves
+// them to their files.
+func restoreBackup(b Backup) (RestoreResult, error) {
+	var result RestoreResult
+	if b.Version != backupVersion {
+		return result, fmt.Errorf("backup version %d is not supported, only %d", b.Version, backupVersion)
+	}
+	if b.Monitors != nil {
+		if err := validateMonitorList(b.Monitors); err != nil {
+			return result, err
+		}
+		replaceConfigMonitors(b.Monitors, "", false)
+		result.Monitors = len(b.Monitors)
+	}
+	for _, st := range b.States {
+		if _, ok := targets.get(st.URL); ok {
+			statuses.restore(st)
+			result.States++
+		}
+	}
+	if b.History != nil {
+		history.mu.Lock()
+		history.monitors = b.History
+		history.mu.Unlock()
+		if history.file != "" {
+			if err := history.save(); err != nil {
+				fmt.Println("Error saving history:", err)
+			}
+		}
+		result.History = len(b.History)
+	}
+	if b.ContentBaselines != nil {
+		contentBaselines.mu.Lock()
+		contentBaselines.baselines = b.ContentBaselines
+		contentBaselines.save()
+		contentBaselines.mu.Unlock()
+		result.ContentBaselines = len(b.ContentBaselines)
+	}
+	if b.CertPins != nil {
+		certPins.mu.Lock()
+		certPins.known = b.CertPins
+		certPins.save()
+		certPins.mu.Unlock()
+		result.CertPins = len(b.CertPins)
+	}
+	if b.Subscriptions != nil && subscriptions != nil {
+		subscriptions.mu.Lock()
+		subscriptions.subs = make(map[string]*Subscription, len(b.Subscriptions))
+		for _, sub := range b.Subscriptions {
+			subscriptions.subs[sub.ID] = sub
+		}
+		subscriptions.save()
+		subscriptions.mu.Unlock()
+		result.Subscriptions = len(b.Subscriptions)
+	}
+	return result, nil
+}
+
+// backupHandler serves GET /backup, a Backup of the instance, to admins.
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	if !requireAdmin(w, r, "backups require an admin key") {
+		return
+	}
+	b := takeBackup()
+	audit.admin(r, "backup", "", fmt.Sprintf("%d monitors", len(b.Monitors)))
+	w.Header().Set("Content-Disposition", `attachment; filename="uptime-monitor-`+b.CreatedAt.Format("20060102-150405")+`.json"`)
+	writeJSON(w, http.StatusOK, b)
+}
+
+// restoreHandler serves POST /restore, loading a Backup posted by an
+// admin.
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodPost) {
+		return
+	}
+	if !requireAdmin(w, r, "restoring a backup requires an admin key") {
+		return
+	}
+	var b Backup
+	if !decodeBody(w, r, &b, "backup") {
+		return
+	}
+	result, err := restoreBackup(b)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, "invalid backup: "+err.Error())
+		return
+	}
+	fmt.Printf("Restored backup from %s: %d monitors, %d states, history of %d monitors\n",
+		b.CreatedAt.Format(time.RFC3339), result.Monitors, result.States, result.History)
+	audit.admin(r, "restore", "", "backup from "+b.CreatedAt.Format(time.RFC3339))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// runBackup saves a running instance's backup to a file, gzipped when its
+// name ends in .gz.
+func runBackup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("o", "", "file to write the backup to (default standard output)")
+	server := fs.String("server", "http://localhost:8080", "base URL of the instance")
+	key := fs.String("key", "", "admin API key, when projects are configured")
+	fs.Parse(args)
+
+	req, _ := http.NewRequest(http.MethodGet, strings.TrimRight(*server, "/")+"/backup", nil)
+	body, err := callAPI(req, *key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error taking backup:", err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		os.Stdout.Write(body)
+		return
+	}
+	if strings.HasSuffix(*out, ".gz") {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		zw.Close()
+		body = buf.Bytes()
+	}
+	if err := os.WriteFile(*out, body, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing backup:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Backup written to %s\n", *out)
+}
+
+// runRestore loads a backup file, gzipped or not, into a running instance.
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	file := fs.String("f", "", "backup file to restore")
+	server := fs.String("server", "http://localhost:8080", "base URL of the instance")
+	key := fs.String("key", "", "admin API key, when projects are configured")
+	fs.Parse(args)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "Error: restore requires -f")
+		os.Exit(2)
+	}
+	data, err := os.ReadFile(*file)
+	if err == nil && bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			data, err = io.ReadAll(zr)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading backup:", err)
+		os.Exit(1)
+	}
+	req, _ := http.NewRequest(http.MethodPost, strings.TrimRight(*server, "/")+"/restore", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	body, err := callAPI(req, *key)
+	var result RestoreResult
+	if err == nil {
+		err = json.Unmarshal(body, &result)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error restoring backup:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Restored %d monitors, %d states, history of %d monitors, %d content baselines, %d certificate pins and %d subscriptions.\n",
+		result.Monitors, result.States, result.History, result.ContentBaselines, result.CertPins, result.Subscriptions)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// compileBodyPattern compiles a body_matches or body_not_matches setting.
+func compileBodyPattern(field, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", field, err)
+	}
+	return re, nil
+}
+
+// captureGroups returns the groups of re's first match in body, keyed by
+// name for named groups and by number for all of them. It returns nil if
+// re does not match.
+func captureGroups(re *regexp.Regexp, body []byte) map[string]string {
+	m := re.FindSubmatch(body)
+	if m == nil {
+		return nil
+	}
+	groups := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		groups[strconv.Itoa(i)] = string(m[i])
+		if name != "" {
+			groups[name] = string(m[i])
+		}
+	}
+	return groups
+}
+
+// checkBody applies target's body patterns, returning the groups captured
+// and why the body fails them, or "" if it passes.
+func checkBody(target Target, body []byte) (captures map[string]string, failure string) {
+	if re := target.BodyNotMatches; re != nil {
+		if groups := captureGroups(re, body); groups != nil {
+			return groups, fmt.Sprintf("body matches /%s/", re)
+		}
+	}
+	if re := target.BodyMatches; re != nil {
+		groups := captureGroups(re, body)
+		if groups == nil {
+			return nil, fmt.Sprintf("body does not match /%s/", re)
+		}
+		return groups, ""
+	}
+	return nil, ""
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// BrokerCheckConfig configures "kafka" and "amqp" monitors. Their url is
+// kafka://host:port or amqp://host:port/vhost, with kafkas:// and amqps://
+// for TLS.
+type BrokerCheckConfig struct {
+	// Username and Password authenticate with SASL PLAIN. AMQP defaults to
+	// guest/guest; Kafka skips authentication without them.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// CAFile verifies the broker's TLS certificate against these CAs
+	// instead of the system roots.
+	CAFile string `json:"ca_file,omitempty"`
+	// Topic, for Kafka, must exist with a leader for every partition.
+	Topic string `json:"topic,omitempty"`
+	// Timeout bounds the whole handshake. Defaults to 10s.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+const (
+	kafkaType = "kafka"
+	amqpType  = "amqp"
+)
+
+// dialBroker connects to target's broker, over TLS for secureScheme. The
+// ports are the defaults for the plain and TLS schemes.
+func dialBroker(target Target, secureScheme, plainPort, securePort string) (net.Conn, *url.URL, error) {
+	cfg := target.Broker
+	if cfg == nil {
+		cfg = &BrokerCheckConfig{}
+	}
+	u, err := url.Parse(target.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("invalid broker url %q", target.URL)
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = plainPort
+		if u.Scheme == secureScheme {
+			port = securePort
+		}
+	}
+	addr := net.JoinHostPort(host, port)
+	if target.dialAddr != "" {
+		addr = target.dialAddr
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(strings.Trim(addr, "[]"), port)
+		}
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	dialer, err := checkDialer(target, "tcp", timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	var conn net.Conn
+	if u.Scheme == secureScheme {
+		tlsConfig := &tls.Config{ServerName: u.Hostname()}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, nil, err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			tlsConfig.RootCAs.AppendCertsFromPEM(pem)
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	return conn, u, nil
+}
+
+func brokerResult(target Target, start time.Time, detail string, err error) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", Latency: Duration(time.Since(start)), CheckedAt: start.UTC()}
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	result.Status = "up"
+	result.Detail = detail
+	return result
+}
+
+// Kafka
+
+// kafkaReader decodes Kafka's big-endian wire format. The first error
+// sticks and later reads return zero values.
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = errors.New("truncated Kafka response")
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *kafkaReader) int16() int16 {
+	b := r.take(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (r *kafkaReader) int32() int32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.take(int(n)))
+}
+
+func kafkaString(s string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(s)))
+	return append(b, s...)
+}
+
+// kafkaRequest sends one request and returns the response body after the
+// correlation ID.
+func kafkaRequest(conn net.Conn, apiKey, version int16, correlation int32, body []byte) ([]byte, error) {
+	req := binary.BigEndian.AppendUint16(nil, uint16(apiKey))
+	req = binary.BigEndian.AppendUint16(req, uint16(version))
+	req = binary.BigEndian.AppendUint32(req, uint32(correlation))
+	req = append(req, kafkaString("uptime-monitor")...)
+	req = append(req, body...)
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(req))), req...)); err != nil {
+		return nil, err
+	}
+	resp, err := kafkaFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 4 || int32(binary.BigEndian.Uint32(resp)) != correlation {
+		return nil, errors.New("unexpected Kafka response")
+	}
+	return resp[4:], nil
+}
+
+// kafkaMaxResponse caps the metadata of very large clusters.
+const kafkaMaxResponse = 64 << 20
+
+func kafkaFrame(conn net.Conn) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("broker closed the connection")
+		}
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > kafkaMaxResponse {
+		return nil, fmt.Errorf("Kafka response of %d bytes is too large", n)
+	}
+	resp := make([]byte, n)
+	_, err := io.ReadFull(conn, resp)
+	return resp, err
+}
+
+// probeKafka authenticates if configured and fetches the cluster metadata.
+func probeKafka(target Target) CheckResult {
+	start := time.Now()
+	conn, _, err := dialBroker(target, "kafkas", "9092", "9093")
+	if err != nil {
+		return brokerResult(target, start, "", err)
+	}
+	defer conn.Close()
+	cfg := target.Broker
+	if cfg == nil {
+		cfg = &BrokerCheckConfig{}
+	}
+	if cfg.Username != "" {
+		if err := kafkaSASLPlain(conn, cfg.Username, cfg.Password); err != nil {
+			return brokerResult(target, start, "", err)
+		}
+	}
+	// Metadata v0 with no topics lists them all, without creating any.
+	resp, err := kafkaRequest(conn, 3, 0, 2, binary.BigEndian.AppendUint32(nil, 0))
+	if err != nil {
+		return brokerResult(target, start, "", err)
+	}
+	r := &kafkaReader{b: resp}
+	brokers := int(r.int32())
+	for i := 0; i < brokers && r.err == nil; i++ {
+		r.int32()
+		r.string()
+		r.int32()
+	}
+	topics := int(r.int32())
+	topicErr := fmt.Errorf("topic %s does not exist", cfg.Topic)
+	for i := 0; i < topics && r.err == nil; i++ {
+		code, name := r.int16(), r.string()
+		partitions := int(r.int32())
+		leaderless := 0
+		for p := 0; p < partitions && r.err == nil; p++ {
+			r.int16()
+			r.int32()
+			if r.int32() < 0 {
+				leaderless++
+			}
+			r.take(4 * int(r.int32()))
+			r.take(4 * int(r.int32()))
+		}
+		if name != cfg.Topic {
+			continue
+		}
+		switch {
+		case code != 0:
+			topicErr = fmt.Errorf("topic %s has error code %d", name, code)
+		case leaderless > 0:
+			topicErr = fmt.Errorf("topic %s has %d of %d partitions without a leader", name, leaderless, partitions)
+		default:
+			topicErr = nil
+		}
+	}
+	if r.err != nil {
+		return brokerResult(target, start, "", r.err)
+	}
+	if brokers == 0 {
+		return brokerResult(target, start, "", errors.New("broker reported no brokers"))
+	}
+	if cfg.Topic != "" && topicErr != nil {
+		return brokerResult(target, start, "", topicErr)
+	}
+	return brokerResult(target, start, fmt.Sprintf("%d brokers, %d topics", brokers, topics), nil)
+}
+
+// kafkaSASLPlain authenticates with SaslHandshake v0 followed by a raw
+// PLAIN token.
+func kafkaSASLPlain(conn net.Conn, username, password string) error {
+	resp, err := kafkaRequest(conn, 17, 0, 1, kafkaString("PLAIN"))
+	if err != nil {
+		return fmt.Errorf("SASL handshake: %w", err)
+	}
+	r := &kafkaReader{b: resp}
+	if code := r.int16(); code != 0 {
+		return fmt.Errorf("broker does not accept SASL PLAIN (error code %d)", code)
+	}
+	token := []byte("\x00" + username + "\x00" + password)
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(token))), token...)); err != nil {
+		return err
+	}
+	if _, err := kafkaFrame(conn); err != nil {
+		return fmt.Errorf("SASL authentication failed: %w", err)
+	}
+	return nil
+}
+
+// AMQP 0-9-1
+
+const amqpFrameEnd = 0xce
+
+type amqpMethod struct {
+	class, method uint16
+	args          []byte
+}
+
+func amqpShortString(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func amqpLongString(s string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(s))), s...)
+}
+
+func writeAMQPMethod(conn net.Conn, class, method uint16, args ...[]byte) error {
+	payload := binary.BigEndian.AppendUint16(nil, class)
+	payload = binary.BigEndian.AppendUint16(payload, method)
+	payload = append(payload, bytes.Join(args, nil)...)
+	frame := []byte{1, 0, 0}
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(append(frame, payload...), amqpFrameEnd)
+	_, err := conn.Write(frame)
+	return err
+}
+
+// readAMQPMethod returns the next method frame on channel 0, skipping
+// heartbeats.
+func readAMQPMethod(conn net.Conn) (amqpMethod, error) {
+	for {
+		var header [7]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return amqpMethod{}, errors.New("broker closed the connection")
+			}
+			return amqpMethod{}, err
+		}
+		if string(header[:4]) == "AMQP" {
+			return amqpMethod{}, errors.New("broker does not support AMQP 0-9-1")
+		}
+		size := binary.BigEndian.Uint32(header[3:])
+		if size > 1<<20 {
+			return amqpMethod{}, errors.New("AMQP frame too large")
+		}
+		body := make([]byte, size+1)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return amqpMethod{}, err
+		}
+		if body[size] != amqpFrameEnd {
+			return amqpMethod{}, errors.New("malformed AMQP frame")
+		}
+		if header[0] == 8 {
+			continue
+		}
+		if header[0] != 1 || size < 4 {
+			return amqpMethod{}, fmt.Errorf("unexpected AMQP frame type %d", header[0])
+		}
+		m := amqpMethod{class: binary.BigEndian.Uint16(body), method: binary.BigEndian.Uint16(body[2:]), args: body[4:size]}
+		if m.class == 10 && m.method == 50 {
+			return m, amqpCloseError(m.args)
+		}
+		return m, nil
+	}
+}
+
+// amqpCloseError describes a Connection.Close sent by the broker.
+func amqpCloseError(args []byte) error {
+	if len(args) < 3 || len(args) < 3+int(args[2]) {
+		return errors.New("broker closed the connection")
+	}
+	return fmt.Errorf("broker closed the connection: %d %s", binary.BigEndian.Uint16(args), args[3:3+int(args[2])])
+}
+
+func expectAMQPMethod(conn net.Conn, class, method uint16, name string) (amqpMethod, error) {
+	m, err := readAMQPMethod(conn)
+	if err != nil {
+		return m, err
+	}
+	if m.class != class || m.method != method {
+		return m, fmt.Errorf("expected %s, got method %d.%d", name, m.class, m.method)
+	}
+	return m, nil
+}
+
+// probeAMQP opens and closes a connection to the virtual host in the url's
+// path.
+func probeAMQP(target Target) CheckResult {
+	start := time.Now()
+	conn, u, err := dialBroker(target, "amqps", "5672", "5671")
+	if err != nil {
+		return brokerResult(target, start, "", err)
+	}
+	defer conn.Close()
+	detail, err := amqpHandshake(conn, u, target.Broker)
+	return brokerResult(target, start, detail, err)
+}
+
+func amqpHandshake(conn net.Conn, u *url.URL, cfg *BrokerCheckConfig) (string, error) {
+	username, password := "guest", "guest"
+	if cfg != nil && cfg.Username != "" {
+		username, password = cfg.Username, cfg.Password
+	}
+	vhost := "/"
+	if p := strings.TrimPrefix(u.Path, "/"); p != "" {
+		vhost = p
+	}
+
+	if _, err := conn.Write([]byte("AMQP\x00\x00\x09\x01")); err != nil {
+		return "", err
+	}
+	start, err := expectAMQPMethod(conn, 10, 10, "Connection.Start")
+	if err != nil {
+		return "", err
+	}
+	product := amqpServerProduct(start.args)
+
+	if err := writeAMQPMethod(conn, 10, 11,
+		binary.BigEndian.AppendUint32(nil, 0), // no client properties
+		amqpShortString("PLAIN"),
+		amqpLongString("\x00"+username+"\x00"+password),
+		amqpShortString("en_US")); err != nil {
+		return "", err
+	}
+	tune, err := expectAMQPMethod(conn, 10, 30, "Connection.Tune")
+	if err != nil {
+		return "", fmt.Errorf("logging in as %s: %w", username, err)
+	}
+	if len(tune.args) < 6 {
+		return "", errors.New("malformed Connection.Tune")
+	}
+	// Echo the broker's limits, without heartbeats.
+	if err := writeAMQPMethod(conn, 10, 31, tune.args[:6], []byte{0, 0}); err != nil {
+		return "", err
+	}
+	if err := writeAMQPMethod(conn, 10, 40, amqpShortString(vhost), amqpShortString(""), []byte{0}); err != nil {
+		return "", err
+	}
+	if _, err := expectAMQPMethod(conn, 10, 41, "Connection.OpenOk"); err != nil {
+		return "", err
+	}
+	if err := writeAMQPMethod(conn, 10, 50, []byte{0, 200}, amqpShortString("bye"), []byte{0, 0, 0, 0}); err == nil {
+		expectAMQPMethod(conn, 10, 51, "Connection.CloseOk")
+	}
+	detail := "opened vhost " + vhost
+	if product != "" {
+		detail = product + ", " + detail
+	}
+	return detail, nil
+}
+
+// amqpFieldSize returns the encoded size of a field table value of kind at
+// the start of b, or -1 if it cannot tell.
+func amqpFieldSize(kind byte, b []byte) int {
+	switch kind {
+	case 'V':
+		return 0
+	case 't', 'b', 'B':
+		return 1
+	case 's', 'u':
+		return 2
+	case 'I', 'i', 'f':
+		return 4
+	case 'D':
+		return 5
+	case 'l', 'L', 'd', 'T':
+		return 8
+	case 'S', 'x', 'A', 'F':
+		if len(b) < 4 {
+			return -1
+		}
+		return 4 + int(binary.BigEndian.Uint32(b))
+	}
+	return -1
+}
+
+// amqpServerProduct picks the product and version out of Connection.Start's
+// server properties, e.g. "RabbitMQ 3.13.1".
+func amqpServerProduct(args []byte) string {
+	if len(args) < 6 {
+		return ""
+	}
+	n := int(binary.BigEndian.Uint32(args[2:]))
+	table := args[6:]
+	if n > len(table) {
+		return ""
+	}
+	table = table[:n]
+	props := make(map[string]string)
+	for len(table) > 0 {
+		kl := int(table[0])
+		if len(table) < 2+kl {
+			break
+		}
+		key, kind := string(table[1:1+kl]), table[1+kl]
+		table = table[2+kl:]
+		size := amqpFieldSize(kind, table)
+		if size < 0 || size > len(table) {
+			break
+		}
+		if kind == 'S' {
+			props[key] = string(table[4:size])
+		}
+		table = table[size:]
+	}
+	return strings.TrimSpace(props["product"] + " " + props["version"])
+}
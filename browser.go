@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BrowserConfig sets up "browser" monitors, which load the page in headless
+// Chrome so JavaScript-rendered apps are checked as users see them.
+type BrowserConfig struct {
+	// Path is the Chrome or Chromium binary. By default the usual names are
+	// looked up on PATH.
+	Path string `json:"path"`
+	// ScreenshotDir, when set, receives a PNG of each failed check. Chrome
+	// can't dump the DOM and take a screenshot in one run, so the page is
+	// loaded again for it and may differ from the load that failed.
+	ScreenshotDir string `json:"screenshot_dir"`
+	// MaxConcurrent caps how many browsers run at once. Defaults to 2.
+	MaxConcurrent int `json:"max_concurrent"`
+	// Timeout bounds each page load. Defaults to 30s.
+	Timeout Duration `json:"timeout"`
+	// Flags are extra command-line flags, e.g. "--no-sandbox" in containers.
+	Flags []string `json:"flags"`
+}
+
+// BrowserCheckConfig configures one "browser" monitor.
+type BrowserCheckConfig struct {
+	// WaitFor is a simple selector (see content monitors) that must be
+	// present in the DOM once Budget has run out for the check to pass.
+	// The check does not end early when the element appears.
+	WaitFor string `json:"wait_for,omitempty"`
+	// Budget is how long scripts may run after the page starts loading
+	// before the DOM is captured. Defaults to 5s.
+	Budget Duration `json:"budget,omitempty"`
+}
+
+var browserNames = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "headless_shell"}
+
+type browserRunner struct {
+	config BrowserConfig
+	path   string
+	slots  chan struct{}
+}
+
+// browser is nil until browser checks are configured.
+var browser *browserRunner
+
+func newBrowserRunner(config BrowserConfig) (*browserRunner, error) {
+	path := config.Path
+	if path == "" {
+		for _, name := range browserNames {
+			if p, err := exec.LookPath(name); err == nil {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("no Chrome or Chromium binary found on PATH; set browser.path")
+		}
+	}
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 2
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = Duration(30 * time.Second)
+	}
+	if config.ScreenshotDir != "" {
+		if err := os.MkdirAll(config.ScreenshotDir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &browserRunner{config: config, path: path, slots: make(chan struct{}, config.MaxConcurrent)}, nil
+}
+
+// run starts headless Chrome with extra flags for url and returns stdout.
+func (b *browserRunner) run(url string, flags ...string) ([]byte, error) {
+	b.slots <- struct{}{}
+	defer func() { <-b.slots }()
+
+	profile, err := os.MkdirTemp("", "uptime-browser-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(profile)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(b.config.Timeout))
+	defer cancel()
+	args := []string{"--headless", "--disable-gpu", "--hide-scrollbars", "--no-first-run",
+		"--user-data-dir=" + profile}
+	args = append(args, b.config.Flags...)
+	args = append(args, flags...)
+	args = append(args, url)
+	cmd := exec.CommandContext(ctx, b.path, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("page did not load within %s", time.Duration(b.config.Timeout))
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+			msg = msg[i+1:]
+		}
+		return nil, fmt.Errorf("browser failed: %v: %s", err, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// probeBrowser renders target in headless Chrome and checks that the
+// expected element is present. Latency is the time to a rendered DOM.
+func probeBrowser(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	if browser == nil {
+		result.Detail = "browser checks are not configured"
+		return result
+	}
+	cfg := target.Browser
+	if cfg == nil {
+		cfg = &BrowserCheckConfig{}
+	}
+	budget := time.Duration(cfg.Budget)
+	if budget <= 0 {
+		budget = 5 * time.Second
+	}
+
+	start := time.Now()
+	flags := []string{fmt.Sprintf("--virtual-time-budget=%d", budget.Milliseconds())}
+	if target.dialAddr != "" {
+		if u, err := url.Parse(target.URL); err == nil {
+			flags = append(flags, fmt.Sprintf("--host-resolver-rules=MAP %s %s", u.Hostname(), target.dialAddr))
+		}
+	}
+	if ua := checkHeaders(target)["User-Agent"]; ua != "" {
+		flags = append(flags, "--user-agent="+ua)
+	}
+	dom, err := browser.run(target.URL, append(flags, "--dump-dom")...)
+	result.Latency = Duration(time.Since(start))
+	switch {
+	case err != nil:
+		result.Detail = err.Error()
+	case len(bytes.TrimSpace(dom)) == 0:
+		result.Detail = "page rendered an empty document"
+	case cfg.WaitFor != "":
+		if _, ok := selectHTML(string(dom), cfg.WaitFor); !ok {
+			result.Detail = fmt.Sprintf("no element matches %q after %s", cfg.WaitFor, budget)
+			break
+		}
+		fallthrough
+	default:
+		result.Status = "up"
+		result.Detail = fmt.Sprintf("rendered in %s", time.Duration(result.Latency).Round(time.Millisecond))
+	}
+
+	if result.Status == "down" && browser.config.ScreenshotDir != "" {
+		name := fmt.Sprintf("%s-%s.png", topicSlug(target.displayName()), result.CheckedAt.Format("20060102T150405Z"))
+		path := filepath.Join(browser.config.ScreenshotDir, name)
+		if _, err := browser.run(target.URL, append(flags, "--screenshot="+path, "--window-size=1280,1024")...); err != nil {
+			fmt.Printf("Error capturing screenshot of %s: %s\n", target.URL, err)
+		} else {
+			result.Detail += " (screenshot of a reload: " + path + ")"
+		}
+	}
+	return result
+}
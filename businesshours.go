@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BusinessHoursConfig defines the working week that routes can tell apart
+// from after hours with hours=business and hours=after.
+type BusinessHoursConfig struct {
+	// Days are the working days, e.g. ["mon", "tue", "wed", "thu", "fri"],
+	// which is the default.
+	Days []string `json:"days"`
+	// Start and End are the working hours in 24-hour "15:04" form.
+	// Default to 09:00 and 17:00.
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Timezone is the IANA zone the hours are in. Defaults to the display
+	// timezone.
+	Timezone string `json:"timezone"`
+	// Holidays are dates, e.g. "2026-12-25", treated as after hours all day.
+	Holidays []string `json:"holidays"`
+}
+
+type businessCalendar struct {
+	days       [7]bool
+	start, end time.Duration
+	zone       *time.Location
+	holidays   map[string]bool
+}
+
+// businessHours is nil unless business hours are configured.
+var businessHours *businessCalendar
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want e.g. 09:00", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func newBusinessCalendar(config BusinessHoursConfig) (*businessCalendar, error) {
+	c := &businessCalendar{zone: zoneOrDefault(config.Timezone), holidays: make(map[string]bool)}
+	if config.Timezone != "" {
+		if _, err := time.LoadLocation(config.Timezone); err != nil {
+			return nil, err
+		}
+	}
+	days := config.Days
+	if len(days) == 0 {
+		days = []string{"mon", "tue", "wed", "thu", "fri"}
+	}
+	for _, d := range days {
+		wd, ok := weekdayNames[strings.ToLower(d)[:min(3, len(d))]]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", d)
+		}
+		c.days[wd] = true
+	}
+	start, end := config.Start, config.End
+	if start == "" {
+		start = "09:00"
+	}
+	if end == "" {
+		end = "17:00"
+	}
+	var err error
+	if c.start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if c.end, err = parseClock(end); err != nil {
+		return nil, err
+	}
+	if c.end <= c.start {
+		return nil, fmt.Errorf("end %s must be after start %s", end, start)
+	}
+	for _, h := range config.Holidays {
+		if _, err := time.Parse("2006-01-02", h); err != nil {
+			return nil, fmt.Errorf("invalid holiday %q, want e.g. 2026-12-25", h)
+		}
+		c.holidays[h] = true
+	}
+	return c, nil
+}
+
+// open reports whether now falls within business hours.
+func (c *businessCalendar) open(now time.Time) bool {
+	now = now.In(c.zone)
+	if !c.days[now.Weekday()] || c.holidays[now.Format("2006-01-02")] {
+		return false
+	}
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	return offset >= c.start && offset < c.end
+}
+
+func setupBusinessHours(config Config) {
+	if config.BusinessHours == nil {
+		return
+	}
+	c, err := newBusinessCalendar(*config.BusinessHours)
+	if err != nil {
+		fmt.Println("Error in business hours:", err)
+		return
+	}
+	businessHours = c
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CalendarConfig names periods, such as company holidays or a provider's
+// maintenance calendar, during which the monitors it selects skip their
+// checks or hold back their alerts.
+type CalendarConfig struct {
+	Name string `json:"name"`
+	// URL is an iCalendar (.ics) feed whose events are excluded periods.
+	URL string `json:"url,omitempty"`
+	// Refresh is how often URL is fetched again. Defaults to 1h.
+	Refresh Duration `json:"refresh,omitempty"`
+	// Dates are excluded days, "2026-12-25", or ranges of days,
+	// "2026-12-24/2026-12-26", in Timezone.
+	Dates []string `json:"dates,omitempty"`
+	// Timezone applies to Dates and to feed events without a zone of their
+	// own. Defaults to the display timezone.
+	Timezone string `json:"timezone,omitempty"`
+	// Action is "silence" (the default) to keep checking but hold back
+	// alerts, or "skip" to not check at all.
+	Action string `json:"action,omitempty"`
+	// Monitors lists the names or URLs covered, and Match selects monitors
+	// in the syntax of routes. With neither, every monitor is covered.
+	Monitors []string `json:"monitors,omitempty"`
+	Match    string   `json:"match,omitempty"`
+}
+
+// Calendar actions.
+const (
+	calendarSilence = "silence"
+	calendarSkip    = "skip"
+)
+
+// CalendarPeriod is one excluded period of a calendar.
+type CalendarPeriod struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Summary string    `json:"summary,omitempty"`
+}
+
+// CalendarStatus is what GET /calendars reports for a calendar.
+type CalendarStatus struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// RefreshedAt is when the feed was last fetched. The feed's URL is not
+	// shown, since private calendar URLs hold a secret.
+	RefreshedAt *time.Time `json:"refreshedAt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	// Active is the period in effect now, if any, and Upcoming the next
+	// ones, up to 10.
+	Active   *CalendarPeriod  `json:"active,omitempty"`
+	Upcoming []CalendarPeriod `json:"upcoming"`
+}
+
+type calendar struct {
+	config CalendarConfig
+	zone   *time.Location
+	match  route
+	// fixed are the periods from Dates.
+	fixed []CalendarPeriod
+
+	mu          sync.Mutex
+	feed        []CalendarPeriod
+	refreshedAt *time.Time
+	lastError   string
+}
+
+type calendarSet []*calendar
+
+// calendars are the configured calendars.
+var calendars calendarSet
+
+func newCalendar(config CalendarConfig) (*calendar, error) {
+	switch config.Action {
+	case "":
+		config.Action = calendarSilence
+	case calendarSilence, calendarSkip:
+	default:
+		return nil, fmt.Errorf("unknown action %q: use silence or skip", config.Action)
+	}
+	if config.URL == "" && len(config.Dates) == 0 {
+		return nil, fmt.Errorf("a calendar needs a url or dates")
+	}
+	if config.Refresh <= 0 {
+		config.Refresh = Duration(time.Hour)
+	}
+	conds, err := parseRouteMatch(config.Match)
+	if err != nil {
+		return nil, err
+	}
+	c := &calendar{config: config, zone: zoneOrDefault(config.Timezone), match: route{conditions: conds}}
+	for _, d := range config.Dates {
+		from, to, _ := strings.Cut(d, "/")
+		if to == "" {
+			to = from
+		}
+		start, err1 := time.ParseInLocation("2006-01-02", from, c.zone)
+		end, err2 := time.ParseInLocation("2006-01-02", to, c.zone)
+		if err1 != nil || err2 != nil || end.Before(start) {
+			return nil, fmt.Errorf("date %q must be YYYY-MM-DD or YYYY-MM-DD/YYYY-MM-DD", d)
+		}
+		c.fixed = append(c.fixed, CalendarPeriod{Start: start, End: end.AddDate(0, 0, 1)})
+	}
+	return c, nil
+}
+
+func startCalendars(configs []CalendarConfig) {
+	for _, config := range configs {
+		c, err := newCalendar(config)
+		if err != nil {
+			fmt.Printf("Error configuring calendar %s: %s\n", config.Name, err)
+			continue
+		}
+		calendars = append(calendars, c)
+		if c.config.URL != "" {
+			go c.refreshLoop()
+		}
+	}
+}
+
+func (c *calendar) refreshLoop() {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for {
+		periods, err := fetchCalendar(client, c.config.URL, c.zone)
+		now := time.Now().UTC()
+		c.mu.Lock()
+		if err != nil {
+			// The last good copy of the feed stays in effect.
+			c.lastError = err.Error()
+			fmt.Printf("Error refreshing calendar %s: %s\n", c.config.Name, err)
+		} else {
+			c.feed, c.refreshedAt, c.lastError = periods, &now, ""
+		}
+		c.mu.Unlock()
+		time.Sleep(time.Duration(c.config.Refresh))
+	}
+}
+
+func fetchCalendar(client *http.Client, feed string, zone *time.Location) ([]CalendarPeriod, error) {
+	resp, err := client.Get(feed)
+	if err != nil {
+		// Leave the URL out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return parseICS(io.LimitReader(resp.Body, 10<<20), zone)
+}
+
+// parseICS reads the events of an iCalendar feed as periods, with floating
+// times in zone. Recurrence rules are not expanded: a recurring event only
+// excludes its first occurrence.
+func parseICS(r io.Reader, zone *time.Location) ([]CalendarPeriod, error) {
+	// Long lines are folded onto lines that start with a space or tab.
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("not an iCalendar feed")
+	}
+	var periods []CalendarPeriod
+	var event map[string]string
+	var params map[string]string
+	// nested counts the components, such as alarms, open inside an event,
+	// whose properties are not the event's.
+	nested := 0
+	for _, line := range lines {
+		nameParams, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, paramList, _ := strings.Cut(nameParams, ";")
+		name = strings.ToUpper(name)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event, params, nested = make(map[string]string), make(map[string]string), 0
+		case event == nil:
+		case name == "BEGIN":
+			nested++
+		case name == "END" && nested > 0:
+			nested--
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if p, err := icsPeriod(event, params, zone); err == nil {
+				periods = append(periods, p)
+			}
+			event = nil
+		case nested == 0:
+			event[name], params[name] = value, paramList
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Start.Before(periods[j].Start) })
+	return periods, nil
+}
+
+// icsPeriod turns the properties of an event into a period. An event
+// without an end lasts its duration, or a day if it is all-day.
+func icsPeriod(event, params map[string]string, zone *time.Location) (CalendarPeriod, error) {
+	if strings.EqualFold(event["STATUS"], "CANCELLED") {
+		return CalendarPeriod{}, fmt.Errorf("cancelled")
+	}
+	start, allDay, err := icsTime(event["DTSTART"], params["DTSTART"], zone)
+	if err != nil {
+		return CalendarPeriod{}, err
+	}
+	p := CalendarPeriod{Start: start, Summary: icsUnescape(event["SUMMARY"])}
+	switch {
+	case event["DTEND"] != "":
+		if p.End, _, err = icsTime(event["DTEND"], params["DTEND"], zone); err != nil {
+			return CalendarPeriod{}, err
+		}
+	case event["DURATION"] != "":
+		d, err := icsDuration(event["DURATION"])
+		if err != nil {
+			return CalendarPeriod{}, err
+		}
+		p.End = start.Add(d)
+	case allDay:
+		p.End = start.AddDate(0, 0, 1)
+	default:
+		p.End = start
+	}
+	if !p.End.After(p.Start) {
+		return CalendarPeriod{}, fmt.Errorf("empty event")
+	}
+	return p, nil
+}
+
+// icsTime parses a DATE or DATE-TIME value, in UTC when it ends in Z, in
+// its TZID parameter's zone, or else in zone.
+func icsTime(value, params string, zone *time.Location) (time.Time, bool, error) {
+	loc := zone
+	for _, p := range strings.Split(params, ";") {
+		if k, v, _ := strings.Cut(p, "="); strings.EqualFold(k, "TZID") {
+			if l, err := time.LoadLocation(strings.Trim(v, `"`)); err == nil {
+				loc = l
+			}
+		}
+	}
+	switch {
+	case len(value) == 8:
+		t, err := time.ParseInLocation("20060102", value, zone)
+		return t, true, err
+	case strings.HasSuffix(value, "Z"):
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+var icsDurationPattern = regexp.MustCompile(`^\+?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// icsDuration parses a DURATION value such as "PT2H30M" or "P1D".
+func icsDuration(value string) (time.Duration, error) {
+	m := icsDurationPattern.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("bad duration %q", value)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] != "" {
+			n, _ := strconv.Atoi(m[i+1])
+			d += time.Duration(n) * unit
+		}
+	}
+	return d, nil
+}
+
+func icsUnescape(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// covers reports whether c applies to t.
+func (c *calendar) covers(t Target) bool {
+	if len(c.config.Monitors) > 0 {
+		found := false
+		for _, m := range c.config.Monitors {
+			if m == t.URL || (t.Name != "" && m == t.Name) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return c.match.matches(notification{Target: t})
+}
+
+// periods returns every period of c, sorted by start.
+func (c *calendar) periods() []CalendarPeriod {
+	c.mu.Lock()
+	all := append(append([]CalendarPeriod(nil), c.fixed...), c.feed...)
+	c.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].Start.Before(all[j].Start) })
+	return all
+}
+
+// active returns the period of c in effect at now, if any.
+func (c *calendar) active(now time.Time) (CalendarPeriod, bool) {
+	for _, p := range c.periods() {
+		if !now.Before(p.Start) && now.Before(p.End) {
+			return p, true
+		}
+	}
+	return CalendarPeriod{}, false
+}
+
+// excluding reports whether a calendar with action excludes t at now.
+func (cs calendarSet) excluding(t Target, action string, now time.Time) bool {
+	for _, c := range cs {
+		if c.config.Action != action || !c.covers(t) {
+			continue
+		}
+		if _, ok := c.active(now); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skipping reports whether t's checks are skipped at now.
+func (cs calendarSet) skipping(t Target, now time.Time) bool {
+	return cs.excluding(t, calendarSkip, now)
+}
+
+// silencing reports whether down alerts for url are held back at now.
+func (cs calendarSet) silencing(url string, now time.Time) bool {
+	t, ok := targets.get(url)
+	return ok && cs.excluding(t, calendarSilence, now)
+}
+
+// calendarsHandler serves GET /calendars, the calendars with their current
+// and upcoming periods.
+func calendarsHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	now := time.Now()
+	out := make([]CalendarStatus, 0, len(calendars))
+	for _, c := range calendars {
+		s := CalendarStatus{Name: c.config.Name, Action: c.config.Action, Upcoming: []CalendarPeriod{}}
+		c.mu.Lock()
+		s.RefreshedAt, s.LastError = c.refreshedAt, c.lastError
+		c.mu.Unlock()
+		if p, ok := c.active(now); ok {
+			s.Active = &p
+		}
+		for _, p := range c.periods() {
+			if p.Start.After(now) && len(s.Upcoming) < 10 {
+				s.Upcoming = append(s.Upcoming, p)
+			}
+		}
+		out = append(out, s)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertPinConfig watches the leaf certificate an HTTPS monitor presents.
+type CertPinConfig struct {
+	// Fingerprints pins the SHA-256 fingerprints (hex, colons optional) the
+	// leaf certificate may have. Empty learns the first one seen; a change
+	// then alerts until accepted with POST /certs/accept, unless it happens
+	// during a maintenance window.
+	Fingerprints []string `json:"fingerprints,omitempty"`
+}
+
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
+
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+type CertRecord struct {
+	Fingerprint string    `json:"fingerprint"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	NotAfter    time.Time `json:"notAfter"`
+	SeenAt      time.Time `json:"seenAt"`
+	// Pending is an unexpected certificate awaiting acceptance.
+	Pending *CertRecord `json:"pending,omitempty"`
+}
+
+// CertInfo is a monitor's accepted certificate as served by /certs.
+type CertInfo struct {
+	URL string `json:"url"`
+	CertRecord
+}
+
+type certPinStore struct {
+	mu    sync.Mutex
+	file  string
+	known map[string]*CertRecord
+	// alerting records which monitors have an open certificate alert.
+	alerting map[string]bool
+}
+
+var certPins = &certPinStore{known: make(map[string]*CertRecord), alerting: make(map[string]bool)}
+
+func (c *certPinStore) load(file string) error {
+	c.file = file
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Unmarshal(b, &c.known)
+}
+
+// save must be called with c.mu held.
+func (c *certPinStore) save() {
+	if c.file == "" {
+		return
+	}
+	b, err := json.Marshal(c.known)
+	if err == nil {
+		tmp := c.file + ".tmp"
+		if err = os.WriteFile(tmp, b, 0o644); err == nil {
+			err = os.Rename(tmp, c.file)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error saving certificate fingerprints:", err)
+	}
+}
+
+// observe checks the leaf certificate target presented and alerts when it
+// is not the expected one.
+func (c *certPinStore) observe(target Target, cert *x509.Certificate) {
+	now := time.Now().UTC()
+	seen := &CertRecord{
+		Fingerprint: certFingerprint(cert),
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		NotAfter:    cert.NotAfter,
+		SeenAt:      now,
+	}
+
+	c.mu.Lock()
+	var expected string
+	unexpected := false
+	if pins := target.CertPin.Fingerprints; len(pins) > 0 {
+		unexpected = true
+		for _, pin := range pins {
+			if normalizeFingerprint(pin) == seen.Fingerprint {
+				unexpected = false
+			}
+		}
+		expected = strings.Join(pins, " or ")
+	} else {
+		known := c.known[target.URL]
+		switch {
+		case known == nil:
+			c.known[target.URL] = seen
+			c.save()
+		case known.Fingerprint == seen.Fingerprint:
+			if known.Pending != nil {
+				known.Pending = nil
+				c.save()
+			}
+		case inMaintenance(target, now):
+			fmt.Printf("Certificate for %s changed during maintenance; now expecting %s\n", target.URL, seen.Fingerprint)
+			c.known[target.URL] = seen
+			c.save()
+		default:
+			unexpected = true
+			expected = known.Fingerprint
+			if known.Pending == nil || known.Pending.Fingerprint != seen.Fingerprint {
+				known.Pending = seen
+				c.save()
+			}
+		}
+	}
+	wasAlerting := c.alerting[target.URL]
+	c.alerting[target.URL] = unexpected
+	c.mu.Unlock()
+
+	if unexpected == wasAlerting {
+		return
+	}
+	n := notification{Kind: notifyCert, Target: target, Time: now}
+	if unexpected {
+		n.Status = "changed"
+		n.Detail = fmt.Sprintf("Certificate for %s changed unexpectedly: got %s (subject %s, issuer %s), expected %s",
+			target.displayName(), seen.Fingerprint, seen.Subject, seen.Issuer, expected)
+	} else {
+		n.Status = alertResolved
+		n.Detail = fmt.Sprintf("Certificate for %s matches the expected fingerprint", target.displayName())
+	}
+	fmt.Println(n.Detail)
+	enqueueNotification(n)
+}
+
+// accept makes the pending certificate for url the expected one.
+func (c *certPinStore) accept(url string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	known := c.known[url]
+	if known == nil || known.Pending == nil {
+		return false
+	}
+	c.known[url] = known.Pending
+	c.save()
+	return true
+}
+
+// certsHandler serves GET /certs with the certificate last accepted for
+// each monitor and POST /certs/accept?url=... to accept a changed one.
+func certsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/certs/accept" {
+		if methodNotAllowed(w, r, http.MethodPost) {
+			return
+		}
+		url := r.URL.Query().Get("url")
+		if !knownMonitor(w, r, url) {
+			return
+		}
+		if !certPins.accept(url) {
+			writeProblem(w, r, http.StatusNotFound, problemNoPendingChange, "no pending certificate change for "+url)
+			return
+		}
+		fmt.Printf("Accepted new certificate for %s\n", url)
+		audit.admin(r, "cert.accept", url, "")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	scope := requestScope(r)
+	certPins.mu.Lock()
+	out := []CertInfo{}
+	for url, rec := range certPins.known {
+		if targets.has(url) && scope.canSee(url) {
+			out = append(out, CertInfo{URL: url, CertRecord: *rec})
+		}
+	}
+	certPins.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSONCached(w, r, out)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CertRenewalConfig alerts when an HTTPS monitor keeps serving a
+// certificate that automated renewal, such as an ACME client, should
+// already have replaced. It fires well before an expiry alert would.
+type CertRenewalConfig struct {
+	// RenewBefore is how much validity the served certificate may have
+	// left before it counts as overdue for renewal. Defaults to a quarter
+	// of its lifetime: about 22 days for a 90-day certificate, leaving a
+	// week of slack after ACME clients renew at 30 days.
+	RenewBefore Duration `json:"renew_before,omitempty"`
+}
+
+// renewBefore is the threshold for cert.
+func (c *CertRenewalConfig) renewBefore(cert *x509.Certificate) time.Duration {
+	if c.RenewBefore > 0 {
+		return time.Duration(c.RenewBefore)
+	}
+	return cert.NotAfter.Sub(cert.NotBefore) / 4
+}
+
+type certRenewalTracker struct {
+	mu       sync.Mutex
+	alerting map[string]bool
+}
+
+var certRenewals = &certRenewalTracker{alerting: make(map[string]bool)}
+
+// observe alerts when the leaf certificate target presented is inside its
+// renewal window, and resolves once a renewed one is served.
+func (c *certRenewalTracker) observe(target Target, cert *x509.Certificate) {
+	now := time.Now().UTC()
+	left := cert.NotAfter.Sub(now)
+	threshold := target.CertRenewal.renewBefore(cert)
+	overdue := left < threshold
+
+	c.mu.Lock()
+	wasAlerting := c.alerting[target.URL]
+	c.alerting[target.URL] = overdue
+	c.mu.Unlock()
+
+	if overdue == wasAlerting {
+		return
+	}
+	n := notification{Kind: notifyRenewal, Target: target, Time: now}
+	issued := cert.NotBefore.UTC().Format(time.DateOnly)
+	if overdue {
+		n.Status = "overdue"
+		n.Detail = fmt.Sprintf("Certificate for %s was not renewed: issued %s, %s left, renewal expected with %s left",
+			target.displayName(), issued, formatDays(left), formatDays(threshold))
+	} else {
+		n.Status = alertResolved
+		n.Detail = fmt.Sprintf("Certificate for %s was renewed on %s, %s left", target.displayName(), issued, formatDays(left))
+	}
+	fmt.Println(n.Detail)
+	enqueueNotification(n)
+}
+
+// formatDays renders d in whole days, or hours below two days.
+func formatDays(d time.Duration) string {
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours()/24))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ChannelHealthConfig watches deliveries per notification channel, failing
+// over to a backup channel and raising a channel alert when one breaks.
+type ChannelHealthConfig struct {
+	// Failures is how many deliveries in a row must fail before a channel
+	// counts as failing and an alert is raised. Defaults to 3.
+	Failures int `json:"failures"`
+	// Failover names the backup of a channel, e.g. {"ops-slack": "email"}.
+	// A notification the channel fails to deliver is sent to its backup.
+	Failover map[string]string `json:"failover"`
+}
+
+// ChannelHealth is the delivery health of one notification channel.
+type ChannelHealth struct {
+	Channel string `json:"channel"`
+	// Status is "ok" or "failing".
+	Status string `json:"status"`
+	// ConsecutiveFailures counts the failed deliveries since the last one
+	// that succeeded.
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	FailingSince        *time.Time `json:"failingSince,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastErrorAt         *time.Time `json:"lastErrorAt,omitempty"`
+	LastSuccessAt       *time.Time `json:"lastSuccessAt,omitempty"`
+	Backup              string     `json:"backup,omitempty"`
+	// FailedOver counts the notifications sent to the backup instead.
+	FailedOver int `json:"failedOver"`
+}
+
+type channelMonitor struct {
+	failures  int
+	failover  map[string]string
+	notifiers map[string]notifier
+
+	mu       sync.Mutex
+	channels map[string]*ChannelHealth
+}
+
+var channelHealth = newChannelMonitor(ChannelHealthConfig{}, nil)
+
+// newChannelMonitor watches the channels of notifiers, dropping failovers
+// from or to channels that are not configured.
+func newChannelMonitor(config ChannelHealthConfig, notifiers map[string]notifier) *channelMonitor {
+	m := &channelMonitor{failures: config.Failures, failover: make(map[string]string), notifiers: notifiers, channels: make(map[string]*ChannelHealth)}
+	if m.failures <= 0 {
+		m.failures = 3
+	}
+	for channel, backup := range config.Failover {
+		switch {
+		case notifiers[channel] == nil:
+			fmt.Printf("Error configuring failover: unknown channel %s\n", channel)
+		case notifiers[backup] == nil:
+			fmt.Printf("Error configuring failover of %s: unknown channel %s\n", channel, backup)
+		case backup == channel:
+			fmt.Printf("Error configuring failover of %s: a channel can't be its own backup\n", channel)
+		default:
+			m.failover[channel] = backup
+		}
+	}
+	return m
+}
+
+// backup returns the name of the channel that takes over from channel, or
+// "" if it has none.
+func (m *channelMonitor) backup(channel string) string {
+	return m.failover[channel]
+}
+
+// failOver hands n, which channel failed to deliver, to channel's backup,
+// unless it has none or the backup is sent n anyway.
+func (m *channelMonitor) failOver(channel string, n notification) {
+	backup := m.notifiers[m.failover[channel]]
+	if backup == nil || routes.allows(backup.name(), n) {
+		return
+	}
+	m.failedOver(channel)
+	deliver(backup, n)
+}
+
+// channelTarget stands in for a monitor in a channel alert.
+func channelTarget(channel string) Target {
+	return Target{Name: "channel " + channel, URL: "channel:" + channel}
+}
+
+func (m *channelMonitor) get(channel string) *ChannelHealth {
+	h := m.channels[channel]
+	if h == nil {
+		h = &ChannelHealth{Channel: channel, Status: alertResolved, Backup: m.failover[channel]}
+		m.channels[channel] = h
+	}
+	return h
+}
+
+// delivered records the outcome of a delivery through channel, raising a
+// channel alert when it starts failing and resolving it when a delivery
+// succeeds again.
+func (m *channelMonitor) delivered(channel string, err error) {
+	now := time.Now().UTC()
+	m.mu.Lock()
+	h := m.get(channel)
+	var n *notification
+	if err == nil {
+		if h.Status == "failing" {
+			n = &notification{Status: alertResolved, Detail: fmt.Sprintf(
+				"Notification channel %s delivers again after failing for %s", channel, formatDuration(now.Sub(*h.FailingSince).Round(time.Second)))}
+		}
+		h.Status, h.ConsecutiveFailures, h.FailingSince, h.LastSuccessAt = alertResolved, 0, nil, &now
+	} else {
+		h.ConsecutiveFailures++
+		h.LastError, h.LastErrorAt = err.Error(), &now
+		if h.Status != "failing" && h.ConsecutiveFailures >= m.failures {
+			h.Status, h.FailingSince = "failing", &now
+			detail := fmt.Sprintf("Notification channel %s failed %d deliveries in a row: %s", channel, h.ConsecutiveFailures, err)
+			if h.Backup != "" {
+				detail += "; failing over to " + h.Backup
+			}
+			n = &notification{Status: "failing", Detail: detail}
+		}
+	}
+	m.mu.Unlock()
+	if n != nil {
+		n.Kind, n.Target, n.Time = notifyChannel, channelTarget(channel), now
+		fmt.Println(n.Detail)
+		enqueueNotification(*n)
+	}
+}
+
+// failedOver records that a notification for channel went to its backup.
+func (m *channelMonitor) failedOver(channel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(channel).FailedOver++
+}
+
+func (m *channelMonitor) list() []ChannelHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]ChannelHealth, 0, len(m.channels))
+	for _, h := range m.channels {
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Channel < out[j].Channel })
+	return out
+}
+
+// channelsHandler serves GET /channels, the delivery health of every
+// channel that has sent a notification.
+func channelsHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	if !requireAdmin(w, r, "channel health requires an admin key") {
+		return
+	}
+	writeJSON(w, http.StatusOK, channelHealth.list())
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ChaosConfig enables the /chaos endpoint, which forces monitors down or up
+// for a while so runbooks and notification routing can be rehearsed.
+type ChaosConfig struct {
+	// MaxDuration caps how long a state may be forced. Defaults to 1h.
+	MaxDuration Duration `json:"max_duration"`
+}
+
+// ChaosOverride is a forced state in effect.
+type ChaosOverride struct {
+	URL     string    `json:"url"`
+	Status  string    `json:"status"`
+	Actor   string    `json:"actor"`
+	Until   time.Time `json:"until"`
+	Started time.Time `json:"started"`
+}
+
+type chaosStore struct {
+	mu        sync.Mutex
+	overrides map[string]ChaosOverride
+	max       time.Duration
+}
+
+// chaos is nil unless the chaos endpoint is enabled.
+var chaos *chaosStore
+
+func newChaosStore(config ChaosConfig) *chaosStore {
+	max := time.Duration(config.MaxDuration)
+	if max <= 0 {
+		max = time.Hour
+	}
+	return &chaosStore{overrides: make(map[string]ChaosOverride), max: max}
+}
+
+// apply replaces r with the state forced on its monitor, if any, whichever
+// location it came from.
+func (c *chaosStore) apply(r CheckResult) CheckResult {
+	if c == nil {
+		return r
+	}
+	c.mu.Lock()
+	o, ok := c.overrides[r.URL]
+	if ok && time.Now().After(o.Until) {
+		delete(c.overrides, r.URL)
+		ok = false
+		fmt.Printf("Chaos test on %s ended\n", r.URL)
+	}
+	c.mu.Unlock()
+	if ok {
+		r.Status = o.Status
+		r.Detail = fmt.Sprintf("chaos test: forced %s by %s until %s", o.Status, o.Actor, o.Until.Format(time.RFC3339))
+	}
+	return r
+}
+
+// chaosHandler serves the chaos API to admins:
+//
+//	GET    /chaos                                   forced states in effect
+//	POST   /chaos?url=...&status=down&duration=10m  force a state
+//	DELETE /chaos?url=...                           end it early
+func chaosHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, "chaos tests require an admin key") {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now()
+		chaos.mu.Lock()
+		out := []ChaosOverride{}
+		for _, o := range chaos.overrides {
+			if now.Before(o.Until) {
+				out = append(out, o)
+			}
+		}
+		chaos.mu.Unlock()
+		sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+		writeJSON(w, http.StatusOK, out)
+
+	case http.MethodPost:
+		q := r.URL.Query()
+		url := q.Get("url")
+		if !knownMonitor(w, r, url) {
+			return
+		}
+		status := q.Get("status")
+		if status == "" {
+			status = "down"
+		}
+		if status != "down" && status != "up" {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter, `status must be "down" or "up"`)
+			return
+		}
+		duration := 5 * time.Minute
+		if s := q.Get("duration"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 || d > chaos.max {
+				writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter,
+					fmt.Sprintf("duration must be a positive Go duration up to %s", chaos.max))
+				return
+			}
+			duration = d
+		}
+		now := time.Now().UTC()
+		o := ChaosOverride{URL: url, Status: status, Actor: requestActor(r), Started: now, Until: now.Add(duration)}
+		chaos.mu.Lock()
+		chaos.overrides[url] = o
+		chaos.mu.Unlock()
+		fmt.Printf("Chaos test: %s forced %s by %s for %s\n", url, status, o.Actor, duration)
+		audit.admin(r, "chaos.inject", url, fmt.Sprintf("%s for %s", status, duration))
+		// Take effect now rather than at the next check.
+		recordResult(localLocation, CheckResult{URL: url, CheckedAt: now})
+		writeJSON(w, http.StatusOK, o)
+
+	case http.MethodDelete:
+		url := r.URL.Query().Get("url")
+		if !knownMonitor(w, r, url) {
+			return
+		}
+		chaos.mu.Lock()
+		_, ok := chaos.overrides[url]
+		delete(chaos.overrides, url)
+		chaos.mu.Unlock()
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "no chaos test running on "+url)
+			return
+		}
+		fmt.Printf("Chaos test on %s ended by %s\n", url, requestActor(r))
+		audit.admin(r, "chaos.clear", url, "")
+		// Restore the real state without waiting for the next check.
+		go checkWebsite(url)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeProblem(w, r, http.StatusMethodNotAllowed, problemMethodNotAllowed, r.Method+" is not supported here")
+	}
+}
@@ -0,0 +1,246 @@
+// Package client is a typed client for the uptime monitor's HTTP API, as
+// described by the /openapi.json document the server publishes.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client calls the API at BaseURL, e.g. "http://localhost:8080".
+type Client struct {
+	BaseURL string
+	// APIKey is sent as X-API-Key when set.
+	APIKey string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Error is a problem response from the API.
+type Error struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code identifies the problem, e.g. "unknown_monitor".
+	Code string `json:"code"`
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Detail)
+	}
+	return fmt.Sprintf("%d %s", e.Status, e.Code)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	return c.send(ctx, method, path, query, body, out, nil)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body, out any, header http.Header) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		problem := &Error{Status: resp.StatusCode, Code: "http_" + strconv.Itoa(resp.StatusCode)}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(b, problem) != nil {
+			problem.Detail = string(bytes.TrimSpace(b))
+		}
+		return problem
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func urlQuery(monitor string) url.Values {
+	return url.Values{"url": {monitor}}
+}
+
+// Status returns one page of monitor statuses. Zero page and limit use the
+// server's defaults.
+func (c *Client) Status(ctx context.Context, page, limit int) (StatusPage, error) {
+	q := url.Values{}
+	if page > 0 {
+		q.Set("page", strconv.Itoa(page))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var out StatusPage
+	err := c.do(ctx, http.MethodGet, "/status", q, nil, &out)
+	return out, err
+}
+
+// MonitorState returns the detailed state of the monitor at monitorURL.
+func (c *Client) MonitorState(ctx context.Context, monitorURL string) (MonitorState, error) {
+	var out MonitorState
+	err := c.do(ctx, http.MethodGet, "/status/monitor", urlQuery(monitorURL), nil, &out)
+	return out, err
+}
+
+// Report returns the uptime report for the last complete period ("daily",
+// "weekly" or "monthly"), optionally limited to group.
+func (c *Client) Report(ctx context.Context, period, group string) (Report, error) {
+	q := url.Values{}
+	if period != "" {
+		q.Set("period", period)
+	}
+	if group != "" {
+		q.Set("group", group)
+	}
+	var out Report
+	err := c.do(ctx, http.MethodGet, "/reports", q, nil, &out)
+	return out, err
+}
+
+func (c *Client) SLOs(ctx context.Context) ([]SLOStatus, error) {
+	var out []SLOStatus
+	err := c.do(ctx, http.MethodGet, "/slo", nil, nil, &out)
+	return out, err
+}
+
+// OnCall returns who is on call for each team. It is only served when
+// on-call schedules are configured.
+func (c *Client) OnCall(ctx context.Context) ([]OnCallStatus, error) {
+	var out []OnCallStatus
+	err := c.do(ctx, http.MethodGet, "/oncall", nil, nil, &out)
+	return out, err
+}
+
+func (c *Client) TLSReports(ctx context.Context) ([]TLSReport, error) {
+	var out []TLSReport
+	err := c.do(ctx, http.MethodGet, "/tls", nil, nil, &out)
+	return out, err
+}
+
+func (c *Client) Certs(ctx context.Context) ([]CertInfo, error) {
+	var out []CertInfo
+	err := c.do(ctx, http.MethodGet, "/certs", nil, nil, &out)
+	return out, err
+}
+
+// AcceptCert accepts the changed certificate of the monitor at monitorURL.
+func (c *Client) AcceptCert(ctx context.Context, monitorURL string) error {
+	return c.do(ctx, http.MethodPost, "/certs/accept", urlQuery(monitorURL), nil, nil)
+}
+
+// AcceptContent accepts the changed content of the monitor at monitorURL.
+func (c *Client) AcceptContent(ctx context.Context, monitorURL string) error {
+	return c.do(ctx, http.MethodPost, "/content/accept", urlQuery(monitorURL), nil, nil)
+}
+
+// ResetSession discards the stored login session of the monitor at
+// monitorURL.
+func (c *Client) ResetSession(ctx context.Context, monitorURL string) error {
+	return c.do(ctx, http.MethodPost, "/sessions/reset", urlQuery(monitorURL), nil, nil)
+}
+
+// PushResult reports a result for a push monitor, named by its name or URL.
+// token is the monitor's push_token, if it has one.
+func (c *Client) PushResult(ctx context.Context, monitor, token string, result PushedResult) error {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return c.send(ctx, http.MethodPost, "/results/"+url.PathEscape(monitor), nil, result, nil, header)
+}
+
+// Audit returns audit log entries, newest first.
+func (c *Client) Audit(ctx context.Context, query AuditQuery) ([]AuditEntry, error) {
+	q := url.Values{}
+	for k, v := range map[string]string{"type": query.Type, "target": query.Target, "channel": query.Channel} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if !query.Since.IsZero() {
+		q.Set("since", query.Since.Format(time.RFC3339))
+	}
+	if query.Limit > 0 {
+		q.Set("limit", strconv.Itoa(query.Limit))
+	}
+	var out []AuditEntry
+	err := c.do(ctx, http.MethodGet, "/audit", q, nil, &out)
+	return out, err
+}
+
+func (c *Client) Subscriptions(ctx context.Context) ([]Subscription, error) {
+	var out []Subscription
+	err := c.do(ctx, http.MethodGet, "/subscriptions", nil, nil, &out)
+	return out, err
+}
+
+// CreateSubscription adds a webhook subscription. The result carries the
+// signing secret, which is not returned again.
+func (c *Client) CreateSubscription(ctx context.Context, sub Subscription) (Subscription, error) {
+	var out Subscription
+	err := c.do(ctx, http.MethodPost, "/subscriptions", nil, sub, &out)
+	return out, err
+}
+
+func (c *Client) Subscription(ctx context.Context, id string) (Subscription, error) {
+	var out Subscription
+	err := c.do(ctx, http.MethodGet, "/subscriptions/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+func (c *Client) DeleteSubscription(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/subscriptions/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Deliveries returns a subscription's recent deliveries, newest first.
+func (c *Client) Deliveries(ctx context.Context, id string) ([]Delivery, error) {
+	var out []Delivery
+	err := c.do(ctx, http.MethodGet, "/subscriptions/"+url.PathEscape(id)+"/deliveries", nil, nil, &out)
+	return out, err
+}
+
+// RetryDelivery attempts a delivery again now and returns its outcome.
+func (c *Client) RetryDelivery(ctx context.Context, id, delivery string) (Delivery, error) {
+	var out Delivery
+	err := c.do(ctx, http.MethodPost, "/subscriptions/"+url.PathEscape(id)+"/deliveries/"+url.PathEscape(delivery)+"/retry", nil, nil, &out)
+	return out, err
+}
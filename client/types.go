@@ -0,0 +1,194 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration is a time.Duration encoded as a Go duration string, e.g. "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+type LocationStatus struct {
+	Location string `json:"location"`
+	Status   string `json:"status"`
+}
+
+type StatusEntry struct {
+	URL       string           `json:"url"`
+	Status    string           `json:"status"`
+	Locations []LocationStatus `json:"locations,omitempty"`
+	Since     time.Time        `json:"since"`
+}
+
+type MonitorState struct {
+	URL         string            `json:"url"`
+	Status      string            `json:"status"`
+	Since       time.Time         `json:"since"`
+	LastChecked time.Time         `json:"lastChecked"`
+	LastError   string            `json:"lastError,omitempty"`
+	LastFailure string            `json:"lastFailure,omitempty"`
+	LastLatency Duration          `json:"lastLatency"`
+	CheckCount  uint64            `json:"checkCount"`
+	Locations   []LocationStatus  `json:"locations,omitempty"`
+	Components  []HealthComponent `json:"components,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Interval    Duration          `json:"interval,omitempty"`
+}
+
+type HealthComponent struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type StatusPage struct {
+	TotalPages  int           `json:"totalPages"`
+	CurrentPage int           `json:"currentPage"`
+	Data        []StatusEntry `json:"data"`
+	Timezone    string        `json:"timezone"`
+}
+
+type MonitorReport struct {
+	Name          string   `json:"name"`
+	URL           string   `json:"url"`
+	Group         string   `json:"group,omitempty"`
+	UptimePercent float64  `json:"uptimePercent"`
+	Checks        int      `json:"checks"`
+	Incidents     int      `json:"incidents"`
+	Downtime      Duration `json:"downtime"`
+	MTTR          Duration `json:"mttr"`
+	AvgLatencyMs  float64  `json:"avgLatencyMs"`
+}
+
+type Report struct {
+	Period        string          `json:"period"`
+	Timezone      string          `json:"timezone"`
+	Group         string          `json:"group,omitempty"`
+	Project       string          `json:"project,omitempty"`
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"`
+	UptimePercent float64         `json:"uptimePercent"`
+	Incidents     int             `json:"incidents"`
+	MTTR          Duration        `json:"mttr"`
+	Monitors      []MonitorReport `json:"monitors"`
+	Slowest       []MonitorReport `json:"slowest"`
+}
+
+type SLOStatus struct {
+	Name            string   `json:"name"`
+	URL             string   `json:"url"`
+	Target          float64  `json:"target"`
+	Window          Duration `json:"window"`
+	UptimePercent   float64  `json:"uptimePercent"`
+	BudgetRemaining float64  `json:"budgetRemaining"`
+	BurnRate        float64  `json:"burnRate"`
+	// State is "ok", "burning" or "exhausted".
+	State string `json:"state"`
+}
+
+type OnCallShift struct {
+	Member string    `json:"member"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+type OnCallStatus struct {
+	Team    string      `json:"team"`
+	Current OnCallShift `json:"current"`
+	Next    OnCallShift `json:"next"`
+}
+
+type TLSReport struct {
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	Grade       string    `json:"grade"`
+	Versions    []string  `json:"versions"`
+	WeakCiphers []string  `json:"weakCiphers,omitempty"`
+	ChainValid  bool      `json:"chainValid"`
+	OCSPStapled bool      `json:"ocspStapled"`
+	Issues      []string  `json:"issues,omitempty"`
+	CheckedAt   time.Time `json:"checkedAt"`
+}
+
+type CertRecord struct {
+	Fingerprint string    `json:"fingerprint"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	NotAfter    time.Time `json:"notAfter"`
+	SeenAt      time.Time `json:"seenAt"`
+	// Pending is an unexpected certificate awaiting acceptance.
+	Pending *CertRecord `json:"pending,omitempty"`
+}
+
+type CertInfo struct {
+	URL string `json:"url"`
+	CertRecord
+}
+
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Action  string    `json:"action"`
+	Channel string    `json:"channel,omitempty"`
+	Target  string    `json:"target,omitempty"`
+	Actor   string    `json:"actor,omitempty"`
+	Outcome string    `json:"outcome"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// AuditQuery filters Audit. Zero fields are not applied.
+type AuditQuery struct {
+	Type    string
+	Target  string
+	Channel string
+	Since   time.Time
+	Limit   int
+}
+
+type Subscription struct {
+	ID     string   `json:"id,omitempty"`
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	// Secret is only returned by CreateSubscription.
+	Secret    string    `json:"secret,omitempty"`
+	Project   string    `json:"project,omitempty"`
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+}
+
+type Delivery struct {
+	ID           string     `json:"id"`
+	Event        string     `json:"event"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	ResponseCode int        `json:"responseCode,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	NextAttempt  *time.Time `json:"nextAttempt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	DeliveredAt  *time.Time `json:"deliveredAt,omitempty"`
+}
+
+// PushedResult is a push monitor's result.
+type PushedResult struct {
+	// Status is "up" or "down".
+	Status  string   `json:"status"`
+	Detail  string   `json:"detail,omitempty"`
+	Latency Duration `json:"latency,omitempty"`
+	Source  string   `json:"source,omitempty"`
+}
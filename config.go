@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Duration is a time.Duration that reads from JSON as a Go duration string
+// such as "30s" or "1m30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type EmailConfig struct {
+	SMTPHost string `json:"smtp_host"`
+	SMTPPort int    `json:"smtp_port"`
+	Sender   string `json:"sender"`
+	// Username logs in to the SMTP server. Defaults to Sender.
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Recipient string `json:"recipient"`
+	// Locale selects the language of the messages sent to Recipient, e.g.
+	// "de". Defaults to the top-level locale.
+	Locale string `json:"locale"`
+	// Timezone shows times to Recipient in this IANA zone, e.g.
+	// "Europe/Berlin". Defaults to the top-level timezone.
+	Timezone string `json:"timezone"`
+	// MinSeverity skips email for monitors less severe than this, e.g.
+	// "high" so low and info outages are left to other channels.
+	MinSeverity string `json:"min_severity"`
+	// OnCall sends to whoever is on call in that schedule instead of
+	// Recipient, which remains the fallback if the schedule is missing.
+	OnCall string `json:"oncall"`
+	// CorrelationWindow, when set, holds each down alert back this long and
+	// sends the alerts that arrived meanwhile as one digest.
+	CorrelationWindow Duration `json:"correlation_window"`
+}
+
+// RateLimitConfig bounds how hard checks hit a single host.
+type RateLimitConfig struct {
+	// MinSpacing is the minimum gap between the start of two requests to the
+	// same host.
+	MinSpacing Duration `json:"min_spacing"`
+	// MaxConcurrent caps in-flight requests per host. Zero means unlimited.
+	MaxConcurrent int `json:"max_concurrent"`
+}
+
+// MonitorConfig describes one website to check, for when a bare URL in
+// websites is not enough.
+type MonitorConfig struct {
+	Name string `json:"name,omitempty"`
+	// Template names an entry of templates whose settings the monitor
+	// inherits, before defaults.
+	Template string `json:"template,omitempty"`
+	// Type is the kind of check: "http" (the default), "content-change",
+	// "browser", "udp", "snmp", "ntp", "kafka", "amqp", "elasticsearch",
+	// "s3", "dns", "dnsbl" or "health".
+	Type string `json:"type,omitempty"`
+	URL  string `json:"url"`
+	// Interval overrides the global check interval.
+	Interval Duration `json:"interval,omitempty"`
+	// Adaptive stretches the interval while the monitor is stable and
+	// shortens it right after a failure or recovery.
+	Adaptive *AdaptiveConfig `json:"adaptive,omitempty"`
+	// Timeout bounds each HTTP request of a check, including reading the
+	// body. Other check types have timeouts in their own settings.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Retries is how many times a failed check is repeated right away
+	// before its failure is recorded, to ride out single dropped requests.
+	Retries int      `json:"retries,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	// Group collects related monitors for reports.
+	Group string     `json:"group,omitempty"`
+	SLO   *SLOConfig `json:"slo,omitempty"`
+	// Content configures "content-change" monitors.
+	Content *ContentCheckConfig `json:"content,omitempty"`
+	// Browser configures "browser" monitors.
+	Browser *BrowserCheckConfig `json:"browser,omitempty"`
+	// UDP configures "udp" monitors.
+	UDP *UDPCheckConfig `json:"udp,omitempty"`
+	// SNMP configures "snmp" monitors.
+	SNMP *SNMPCheckConfig `json:"snmp,omitempty"`
+	// NTP configures "ntp" monitors.
+	NTP *NTPCheckConfig `json:"ntp,omitempty"`
+	// Broker configures "kafka" and "amqp" monitors.
+	Broker *BrokerCheckConfig `json:"broker,omitempty"`
+	// Elasticsearch configures "elasticsearch" monitors.
+	Elasticsearch *ElasticsearchCheckConfig `json:"elasticsearch,omitempty"`
+	// Health configures "health" monitors.
+	Health *HealthCheckConfig `json:"health,omitempty"`
+	// S3 configures "s3" monitors.
+	S3 *S3CheckConfig `json:"s3,omitempty"`
+	// DNS configures "dns" monitors.
+	DNS *DNSCheckConfig `json:"dns,omitempty"`
+	// DNSBL configures "dnsbl" monitors.
+	DNSBL *DNSBLCheckConfig `json:"dnsbl,omitempty"`
+	// TLSGrade periodically grades an HTTPS monitor's TLS setup.
+	TLSGrade *TLSGradeConfig `json:"tls_grade,omitempty"`
+	// CertPin alerts when the leaf certificate changes unexpectedly.
+	CertPin *CertPinConfig `json:"cert_pin,omitempty"`
+	// CertRenewal alerts when the certificate is overdue for renewal.
+	CertRenewal *CertRenewalConfig `json:"cert_renewal,omitempty"`
+	// Headers are sent with this monitor's requests, overriding the global
+	// ones. An empty value removes a global header.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Steps are requests made in order before url is checked, sharing one
+	// cookie jar, e.g. to log in.
+	Steps []CheckStep `json:"steps,omitempty"`
+	// KeepSession keeps the cookie jar across check cycles instead of
+	// starting each check with a fresh one.
+	KeepSession bool `json:"keep_session,omitempty"`
+	// ExpectedStatus lists the status codes that count as up, in place of
+	// any 2xx, e.g. [200, 301].
+	ExpectedStatus []int `json:"expected_status,omitempty"`
+	// Expect replaces the 2xx rule with an expression that must be true,
+	// e.g. `status == 200 && latency < 800ms && body.contains("ok")`.
+	Expect string `json:"expect,omitempty"`
+	// ExpectHeaders are assertions on the response headers, which must all
+	// hold for the monitor to be up.
+	ExpectHeaders []HeaderAssertion `json:"expect_headers,omitempty"`
+	// BodyMatches is a regular expression the response body must match.
+	// Its capture groups are available to notification messages.
+	BodyMatches string `json:"body_matches,omitempty"`
+	// BodyNotMatches marks the monitor down when the body matches it, e.g.
+	// an error page. Its capture groups are available too.
+	BodyNotMatches string `json:"body_not_matches,omitempty"`
+	// MaxBodyBytes caps how much of a response is read. Defaults to 1 MiB,
+	// or 2 MiB for content-change monitors.
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+	// Endpoints fans the check out to several URLs, or to several addresses
+	// (IPs or hosts) that url is sent to, such as every node in a pool.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Origin compares the content served through a CDN with the origin's.
+	Origin *OriginConfig `json:"origin,omitempty"`
+	// Source is the local IP address or interface checks are sent from, on
+	// hosts with several networks.
+	Source string `json:"source,omitempty"`
+	// AllowedFailures is how many endpoints may fail before the monitor is
+	// down. Fewer failures are reported as a partial outage.
+	AllowedFailures int `json:"allowed_failures,omitempty"`
+	// PushToken lets external systems post results for this monitor to
+	// POST /results/{monitor} with it as a bearer token.
+	PushToken string `json:"push_token,omitempty"`
+	// Project is the tenant the monitor belongs to.
+	Project string `json:"project,omitempty"`
+	// Severity is how urgent an outage is: "critical", "high" (the
+	// default), "low" or "info". Channels and reminders use it to decide
+	// who to wake up.
+	Severity string `json:"severity,omitempty"`
+	// Notify names the channels this monitor's notifications go to, in
+	// place of routes, as in a route's notify.
+	Notify []string `json:"notify,omitempty"`
+	// Metadata is free-form information about the monitor, such as its
+	// owner or runbook, passed through to notifications and the API.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type Config struct {
+	// Version is the config schema version the file was written for;
+	// migrate-config upgrades older files. Files without one are version 1.
+	Version int `json:"version"`
+	// Websites is deprecated in favour of monitors with only a url.
+	Websites []string        `json:"websites"`
+	Monitors []MonitorConfig `json:"monitors"`
+	// Defaults are settings every monitor, and every entry in websites,
+	// inherits unless it sets them itself.
+	Defaults *MonitorConfig `json:"defaults"`
+	// Templates are named presets of monitor settings, e.g. "static-site",
+	// that monitors pick with template.
+	Templates map[string]MonitorConfig `json:"templates"`
+	// Interval between checks of the same website. Defaults to one minute.
+	Interval Duration `json:"interval"`
+	// Workers is the number of checks that may run at once. Defaults to 64.
+	Workers   int             `json:"workers"`
+	Email     EmailConfig     `json:"email"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	// Agents lists the remote probes allowed to pull assignments and report
+	// results. Agent endpoints are only served when at least one is set.
+	Agents []AgentCredential `json:"agents"`
+	// Quorum is how many locations (this instance counts as one) must see a
+	// website down before it is marked down and alerted on. Defaults to 1.
+	Quorum int `json:"quorum"`
+	// StartupGrace is how long after startup no down alert is sent. Monitors
+	// still down when it ends alert on their next check.
+	StartupGrace Duration `json:"startup_grace"`
+	// FirstAlertConfirmations is how many consecutive down results a
+	// monitor that has not been up since startup needs before it alerts,
+	// so a typo in the config doesn't page on the first check. Defaults
+	// to 1.
+	FirstAlertConfirmations int      `json:"first_alert_confirmations"`
+	HA                      HAConfig `json:"ha"`
+	// Discovery adds targets found at runtime to those listed in websites.
+	Discovery DiscoveryConfig `json:"discovery"`
+	// Alertmanager, when set, receives every state change as an alert.
+	Alertmanager *AlertmanagerConfig `json:"alertmanager"`
+	StatusPages  []StatusPageConfig  `json:"status_pages"`
+	Tickets      []TicketConfig      `json:"tickets"`
+	Metrics      MetricsConfig       `json:"metrics"`
+	Syslog       *SyslogConfig       `json:"syslog"`
+	MQTT         *MQTTConfig         `json:"mqtt"`
+	PubSub       *PubSubConfig       `json:"pubsub"`
+	History      HistoryConfig       `json:"history"`
+	Reports      ReportsConfig       `json:"reports"`
+	Anomaly      *AnomalyConfig      `json:"anomaly"`
+	// ContentBaselineFile keeps content-change baselines across restarts.
+	ContentBaselineFile string `json:"content_baseline_file"`
+	// Browser is required by "browser" monitors.
+	Browser *BrowserConfig `json:"browser"`
+	// CertPinFile keeps learned certificate fingerprints across restarts.
+	CertPinFile string              `json:"cert_pin_file"`
+	Maintenance []MaintenanceWindow `json:"maintenance"`
+	// Calendars skip checks or hold back alerts on excluded dates.
+	Calendars []CalendarConfig `json:"calendars"`
+	// ChannelHealth fails over from notification channels that stop
+	// delivering.
+	ChannelHealth ChannelHealthConfig `json:"channel_health"`
+	// DNSCache resolves the host names of checks through an internal cache.
+	DNSCache *DNSCacheConfig `json:"dns_cache"`
+	// UserAgent is sent with every check. Defaults to "uptime-monitor/1.0".
+	UserAgent string `json:"user_agent"`
+	// Headers are sent with every check.
+	Headers map[string]string `json:"headers"`
+	// Subscriptions enables the /subscriptions API for event callbacks.
+	Subscriptions *SubscriptionsConfig `json:"subscriptions"`
+	Audit         AuditConfig          `json:"audit"`
+	// StatusSubscribers lets status page visitors subscribe to incident
+	// emails.
+	StatusSubscribers *StatusSubscribersConfig `json:"status_subscribers"`
+	// Projects splits monitors, channels and API keys between tenants.
+	Projects []ProjectConfig `json:"projects"`
+	// AdminKeys are API keys that see every project.
+	AdminKeys []string `json:"admin_keys"`
+	// Tokens enables issuing API tokens through /tokens.
+	Tokens *TokensConfig `json:"tokens"`
+	// OIDC enables browser login through an OpenID Connect provider.
+	OIDC *OIDCConfig `json:"oidc"`
+	API  APIConfig   `json:"api"`
+	// Debug controls the /debug diagnostics.
+	Debug DebugConfig `json:"debug"`
+	// Chaos enables forcing monitor states through /chaos.
+	Chaos *ChaosConfig `json:"chaos"`
+	// Deploys enables reporting deploys through /deploys.
+	Deploys *DeploysConfig `json:"deploys"`
+	// Restart controls shutting down, restarting and upgrading cleanly.
+	Restart RestartConfig `json:"restart"`
+	// Timezone is the IANA zone times are displayed in, and report periods
+	// are aligned to. Defaults to the server's local zone.
+	Timezone string `json:"timezone"`
+	// Locale is the default language of notifications. Defaults to "en".
+	Locale string `json:"locale"`
+	// Messages adds or overrides notification strings, by locale and then
+	// message ID.
+	Messages map[string]map[string]string `json:"messages"`
+	// Reminders re-sends down notifications while a monitor stays down,
+	// at an interval per severity, e.g. {"critical": "15m"}.
+	Reminders map[string]Duration `json:"reminders"`
+	// Channels are named notification destinations for routes.
+	Channels map[string]ChannelConfig `json:"channels"`
+	// Routes pick the channels a notification goes to by the monitor's
+	// tags and severity.
+	Routes []RouteConfig `json:"routes"`
+	// BusinessHours lets routes treat working hours and after hours
+	// differently.
+	BusinessHours *BusinessHoursConfig `json:"business_hours"`
+	// OnCall holds on-call rotations by team, which email settings can send
+	// to instead of a fixed recipient.
+	OnCall map[string]OnCallSchedule `json:"oncall"`
+}
+
+func loadConfiguration(file string) (Config, error) {
+	var config Config
+	configFile, err := os.Open(file)
+	if err != nil {
+		return config, err
+	}
+	defer configFile.Close()
+	jsonParser := json.NewDecoder(configFile)
+	err = jsonParser.Decode(&config)
+	return config, err
+}
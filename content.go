@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentCheckConfig configures a "content-change" monitor, which is down
+// while the page differs from its accepted baseline.
+type ContentCheckConfig struct {
+	// Selector limits the comparison to the first element matching a simple
+	// CSS selector such as "main", "#terms" or "div.content". Empty compares
+	// the whole body.
+	Selector string `json:"selector,omitempty"`
+	// Ignore lists regular expressions whose matches are removed before
+	// comparing, for timestamps, CSRF tokens and the like.
+	Ignore []string `json:"ignore,omitempty"`
+	// AutoAccept makes a change alert once and then become the new baseline.
+	// Otherwise the monitor stays down until the change is accepted with
+	// POST /content/accept.
+	AutoAccept bool `json:"auto_accept,omitempty"`
+}
+
+func (c *ContentCheckConfig) validate() error {
+	if c.Selector != "" {
+		if _, err := parseSimpleSelector(c.Selector); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range c.Ignore {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("bad ignore pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// contentMaxBytes is how much of a page is read and kept as a baseline by
+// default.
+const contentMaxBytes = 2 << 20
+
+type contentBaseline struct {
+	Hash     string    `json:"hash"`
+	Text     string    `json:"text"`
+	Accepted time.Time `json:"accepted"`
+	// Pending is the latest differing content, accepted on request.
+	Pending *contentBaseline `json:"pending,omitempty"`
+}
+
+type contentStore struct {
+	mu        sync.Mutex
+	file      string
+	baselines map[string]*contentBaseline
+}
+
+var contentBaselines = &contentStore{baselines: make(map[string]*contentBaseline)}
+
+func (c *contentStore) load(file string) error {
+	c.file = file
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Unmarshal(b, &c.baselines)
+}
+
+// save must be called with c.mu held.
+func (c *contentStore) save() {
+	if c.file == "" {
+		return
+	}
+	b, err := json.Marshal(c.baselines)
+	if err == nil {
+		tmp := c.file + ".tmp"
+		if err = os.WriteFile(tmp, b, 0o644); err == nil {
+			err = os.Rename(tmp, c.file)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error saving content baselines:", err)
+	}
+}
+
+// compare checks text against url's baseline, recording it as the baseline
+// if there is none yet. It returns a description of the change, or "" if
+// the content matches.
+func (c *contentStore) compare(url, text string, autoAccept bool) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sum := sha256.Sum256([]byte(text))
+	current := &contentBaseline{Hash: hex.EncodeToString(sum[:]), Text: text, Accepted: time.Now().UTC()}
+	base := c.baselines[url]
+	if base == nil {
+		c.baselines[url] = current
+		c.save()
+		return ""
+	}
+	if base.Hash == current.Hash {
+		if base.Pending != nil {
+			base.Pending = nil
+			c.save()
+		}
+		return ""
+	}
+	change := fmt.Sprintf("content changed (sha256 %s -> %s): %s", base.Hash[:12], current.Hash[:12], firstDifference(base.Text, current.Text))
+	if autoAccept {
+		c.baselines[url] = current
+	} else {
+		base.Pending = current
+	}
+	c.save()
+	return change
+}
+
+// accept makes the pending content for url its baseline.
+func (c *contentStore) accept(url string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	base := c.baselines[url]
+	if base == nil || base.Pending == nil {
+		return false
+	}
+	c.baselines[url] = base.Pending
+	c.save()
+	return true
+}
+
+// firstDifference describes the first line that differs between a and b.
+func firstDifference(a, b string) string {
+	al, bl := strings.Split(a, "\n"), strings.Split(b, "\n")
+	for i := 0; i < len(al) || i < len(bl); i++ {
+		var x, y string
+		if i < len(al) {
+			x = al[i]
+		}
+		if i < len(bl) {
+			y = bl[i]
+		}
+		if x != y {
+			col := 0
+			for col < len(x) && col < len(y) && x[col] == y[col] {
+				col++
+			}
+			from := max(0, col-30)
+			return fmt.Sprintf("line %d was %q, now %q", i+1, snippet(x, from), snippet(y, from))
+		}
+	}
+	return "whitespace only"
+}
+
+// snippet returns up to 80 bytes of s starting at from.
+func snippet(s string, from int) string {
+	if from >= len(s) {
+		return ""
+	}
+	out := s[from:]
+	if len(out) > 80 {
+		out = out[:80] + "…"
+	}
+	if from > 0 {
+		out = "…" + out
+	}
+	return out
+}
+
+var contentWhitespace = regexp.MustCompile(`[ \t\r]+`)
+
+// probeContent fetches target and compares the selected content against its
+// baseline.
+func probeContent(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	cfg := target.Content
+	if cfg == nil {
+		cfg = &ContentCheckConfig{}
+	}
+	start := time.Now()
+	resp, err := checkGet(target)
+	if err != nil {
+		result.Latency = Duration(time.Since(start))
+		result.Detail = err.Error()
+		return result
+	}
+	body, err := readBody(resp, target.bodyLimit(contentMaxBytes))
+	result.Latency = Duration(time.Since(start))
+	result.Detail = resp.Status
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result
+	}
+
+	text := string(body)
+	if cfg.Selector != "" {
+		var ok bool
+		if text, ok = selectHTML(text, cfg.Selector); !ok {
+			result.Detail = fmt.Sprintf("no element matches %q", cfg.Selector)
+			return result
+		}
+	}
+	for _, pattern := range cfg.Ignore {
+		text = regexp.MustCompile(pattern).ReplaceAllString(text, "")
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(contentWhitespace.ReplaceAllString(line, " ")); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if change := contentBaselines.compare(target.URL, strings.Join(lines, "\n"), cfg.AutoAccept); change != "" {
+		result.Detail = change
+		return result
+	}
+	result.Status = "up"
+	return result
+}
+
+// contentAcceptHandler serves POST /content/accept?url=..., making the
+// monitor's current content its new baseline.
+func contentAcceptHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodPost) {
+		return
+	}
+	url := r.URL.Query().Get("url")
+	if !knownMonitor(w, r, url) {
+		return
+	}
+	if !contentBaselines.accept(url) {
+		writeProblem(w, r, http.StatusNotFound, problemNoPendingChange, "no pending content change for "+url)
+		return
+	}
+	fmt.Printf("Accepted new content for %s\n", url)
+	audit.admin(r, "content.accept", url, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// selectHTML returns the inner HTML of the first element in doc matching a
+// simple selector: an optional tag name followed by any number of #id and
+// .class parts. Parsing is tolerant rather than spec-complete, which is
+// enough to isolate a region of a page.
+func selectHTML(doc, selector string) (string, bool) {
+	sel, err := parseSimpleSelector(selector)
+	if err != nil {
+		return "", false
+	}
+	// Lower-case ASCII only, so offsets into lower are offsets into doc.
+	lower := []byte(doc)
+	for i, c := range lower {
+		if 'A' <= c && c <= 'Z' {
+			lower[i] = c + 'a' - 'A'
+		}
+	}
+	for i := 0; i < len(doc); {
+		lt := strings.IndexByte(doc[i:], '<')
+		if lt < 0 {
+			break
+		}
+		start := i + lt
+		gt := strings.IndexByte(doc[start:], '>')
+		if gt < 0 {
+			break
+		}
+		end := start + gt + 1
+		tag := doc[start+1 : end-1]
+		i = end
+		if tag == "" || tag[0] == '/' || tag[0] == '!' || tag[0] == '?' {
+			continue
+		}
+		name, attrs := parseStartTag(tag)
+		if !sel.matches(name, attrs) {
+			continue
+		}
+		if htmlVoidElements[name] || strings.HasSuffix(tag, "/") {
+			return "", true
+		}
+		// Find the matching close tag, counting nested elements of the same
+		// name.
+		depth, pos := 1, end
+		for depth > 0 {
+			open := indexTag(string(lower[pos:]), "<"+name)
+			closing := indexTag(string(lower[pos:]), "</"+name)
+			if closing < 0 {
+				return doc[end:], true
+			}
+			if open >= 0 && open < closing {
+				depth++
+				pos += open + 1
+				continue
+			}
+			depth--
+			if depth == 0 {
+				return doc[end : pos+closing], true
+			}
+			pos += closing + 1
+		}
+	}
+	return "", false
+}
+
+// indexTag finds prefix in s followed by a character that ends a tag name.
+func indexTag(s, prefix string) int {
+	for off := 0; ; {
+		i := strings.Index(s[off:], prefix)
+		if i < 0 {
+			return -1
+		}
+		j := off + i + len(prefix)
+		if j >= len(s) || strings.IndexByte(" \t\r\n/>", s[j]) >= 0 {
+			return off + i
+		}
+		off = j
+	}
+}
+
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+var htmlAttr = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+
+func parseStartTag(tag string) (string, map[string]string) {
+	tag = strings.TrimSuffix(tag, "/")
+	name, rest, _ := strings.Cut(tag, " ")
+	if i := strings.IndexAny(name, "\t\r\n"); i >= 0 {
+		name, rest = name[:i], name[i:]+" "+rest
+	}
+	attrs := make(map[string]string)
+	for _, m := range htmlAttr.FindAllStringSubmatch(rest, -1) {
+		attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+	}
+	return strings.ToLower(name), attrs
+}
+
+type simpleSelector struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+var selectorPart = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9-]*)?((?:[#.][-_a-zA-Z0-9]+)*)$`)
+
+func parseSimpleSelector(s string) (simpleSelector, error) {
+	m := selectorPart.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || (m[1] == "" && m[2] == "") {
+		return simpleSelector{}, fmt.Errorf("unsupported selector %q", s)
+	}
+	sel := simpleSelector{tag: strings.ToLower(m[1])}
+	for _, part := range regexp.MustCompile(`[#.][^#.]+`).FindAllString(m[2], -1) {
+		if part[0] == '#' {
+			sel.id = part[1:]
+		} else {
+			sel.classes = append(sel.classes, part[1:])
+		}
+	}
+	return sel, nil
+}
+
+func (s simpleSelector) matches(tag string, attrs map[string]string) bool {
+	if s.tag != "" && s.tag != tag {
+		return false
+	}
+	if s.id != "" && attrs["id"] != s.id {
+		return false
+	}
+	classes := strings.Fields(attrs["class"])
+	for _, want := range s.classes {
+		found := false
+		for _, c := range classes {
+			if c == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// DailyUptime is one monitor's uptime day by day, oldest first, the data
+// behind a status page's row of daily bars.
+type DailyUptime struct {
+	URL      string      `json:"url"`
+	Timezone string      `json:"timezone"`
+	Days     []UptimeDay `json:"days"`
+}
+
+// UptimeDay covers one calendar day in the response's timezone. The last
+// day is today, so far.
+type UptimeDay struct {
+	Date   string `json:"date"`
+	Checks int    `json:"checks"`
+	// UptimePercent is omitted for days without checks, which status pages
+	// usually draw as "no data".
+	UptimePercent *float64 `json:"uptimePercent,omitempty"`
+	// Incidents counts the incidents that overlap the day, and Downtime the
+	// part of them that fell within it.
+	Incidents int      `json:"incidents"`
+	Downtime  Duration `json:"downtime"`
+}
+
+// dailyUptime returns url's uptime for the days days up to and including
+// the one now falls on, in zone.
+func dailyUptime(url string, days int, now time.Time, zone *time.Location) []UptimeDay {
+	now = now.In(zone)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, zone)
+	starts := make([]time.Time, days+1)
+	for i := range starts {
+		starts[i] = today.AddDate(0, 0, i-days+1)
+	}
+	from, to := starts[0], now
+	// day returns the index of the day t falls on.
+	day := func(t time.Time) int {
+		return sort.Search(days, func(i int) bool { return starts[i+1].After(t) })
+	}
+
+	out := make([]UptimeDay, days)
+	weight, up := make([]float64, days), make([]float64, days)
+	for i := range out {
+		out[i].Date = starts[i].Format("2006-01-02")
+	}
+	for _, b := range history.buckets(url, from, to) {
+		i := day(time.Unix(b.Start, 0))
+		out[i].Checks += b.Checks
+		total, ups := b.weights()
+		weight[i] += total
+		up[i] += ups
+	}
+	for _, inc := range history.incidents(url, from, to) {
+		start, end := inc.Start, to
+		if inc.End != nil && inc.End.Before(to) {
+			end = *inc.End
+		}
+		if start.Before(from) {
+			start = from
+		}
+		for i := day(start); i < days && starts[i].Before(end); i++ {
+			s, e := start, end
+			if s.Before(starts[i]) {
+				s = starts[i]
+			}
+			if e.After(starts[i+1]) {
+				e = starts[i+1]
+			}
+			out[i].Incidents++
+			out[i].Downtime += Duration(e.Sub(s))
+		}
+	}
+	for i := range out {
+		if out[i].Checks > 0 {
+			pct := math.Round(10000*up[i]/weight[i]) / 100
+			out[i].UptimePercent = &pct
+		}
+	}
+	return out
+}
+
+// dailyUptimeHandler serves GET /monitors/{monitor}/uptime?days=90&tz=.
+func dailyUptimeHandler(w http.ResponseWriter, r *http.Request, target Target) {
+	days, ok := intParam(w, r, "days", 90, 1, int(history.retention/(24*time.Hour))+1)
+	if !ok {
+		return
+	}
+	zone, ok := zoneParam(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSONCached(w, r, DailyUptime{
+		URL:      target.URL,
+		Timezone: zone.String(),
+		Days:     dailyUptime(target.URL, days, time.Now(), zone),
+	})
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugConfig controls the diagnostics the monitor exposes about itself.
+type DebugConfig struct {
+	// Pprof serves Go runtime profiles under /debug/pprof/.
+	Pprof bool `json:"pprof"`
+}
+
+// durationWindow keeps the most recent samples of a latency.
+type durationWindow struct {
+	mu      sync.Mutex
+	samples [256]time.Duration
+	n       int
+}
+
+func (w *durationWindow) add(d time.Duration) {
+	w.mu.Lock()
+	w.samples[w.n%len(w.samples)] = d
+	w.n++
+	w.mu.Unlock()
+}
+
+// LatencySummary describes a durationWindow in milliseconds.
+type LatencySummary struct {
+	Samples int     `json:"samples"`
+	P50Ms   float64 `json:"p50Ms"`
+	P99Ms   float64 `json:"p99Ms"`
+	MaxMs   float64 `json:"maxMs"`
+}
+
+func (w *durationWindow) summary() LatencySummary {
+	w.mu.Lock()
+	sorted := append([]time.Duration{}, w.samples[:min(w.n, len(w.samples))]...)
+	w.mu.Unlock()
+	if len(sorted) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return LatencySummary{
+		Samples: len(sorted),
+		P50Ms:   ms(sorted[len(sorted)/2]),
+		P99Ms:   ms(sorted[len(sorted)*99/100]),
+		MaxMs:   ms(sorted[len(sorted)-1]),
+	}
+}
+
+// ChannelStats counts deliveries through one notifier.
+type ChannelStats struct {
+	Sent      int        `json:"sent"`
+	Failed    int        `json:"failed"`
+	ErrorRate float64    `json:"errorRate"`
+	LastError string     `json:"lastError,omitempty"`
+	LastErrAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// diagnostics gathers the monitor's measurements of itself.
+type diagnostics struct {
+	started      time.Time
+	schedulerLag durationWindow
+	storeLatency durationWindow
+
+	mu       sync.Mutex
+	sched    *scheduler
+	dropped  int
+	channels map[string]*ChannelStats
+}
+
+var diag = &diagnostics{started: time.Now(), channels: make(map[string]*ChannelStats)}
+
+func (d *diagnostics) delivery(channel string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.channels[channel]
+	if c == nil {
+		c = &ChannelStats{}
+		d.channels[channel] = c
+	}
+	if err == nil {
+		c.Sent++
+	} else {
+		c.Failed++
+		now := time.Now().UTC()
+		c.LastError, c.LastErrAt = err.Error(), &now
+	}
+	c.ErrorRate = float64(c.Failed) / float64(c.Sent+c.Failed)
+}
+
+func (d *diagnostics) droppedNotification() {
+	d.mu.Lock()
+	d.dropped++
+	d.mu.Unlock()
+}
+
+// Diagnostics is the body of GET /debug.
+type Diagnostics struct {
+	Uptime     Duration `json:"uptime"`
+	GoVersion  string   `json:"goVersion"`
+	Goroutines int      `json:"goroutines"`
+	HeapBytes  uint64   `json:"heapBytes"`
+	Scheduler  struct {
+		Jobs        int `json:"jobs"`
+		Queued      int `json:"queued"`
+		Workers     int `json:"workers"`
+		BusyWorkers int `json:"busyWorkers"`
+		// Lag is how long due checks waited for a worker.
+		Lag LatencySummary `json:"lag"`
+	} `json:"scheduler"`
+	Notifications struct {
+		Queued   int                      `json:"queued"`
+		Capacity int                      `json:"capacity"`
+		Dropped  int                      `json:"dropped"`
+		Channels map[string]*ChannelStats `json:"channels"`
+	} `json:"notifications"`
+	// StoreLatency is how long recording a result in the status store and
+	// history took.
+	StoreLatency LatencySummary `json:"storeLatency"`
+	// Warnings name measurements that suggest the monitor is unhealthy.
+	Warnings []string `json:"warnings"`
+}
+
+func (d *diagnostics) snapshot() Diagnostics {
+	var out Diagnostics
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	out.Uptime = Duration(time.Since(d.started).Round(time.Second))
+	out.GoVersion = runtime.Version()
+	out.Goroutines = runtime.NumGoroutine()
+	out.HeapBytes = mem.HeapAlloc
+	out.Scheduler.Lag = d.schedulerLag.summary()
+	out.StoreLatency = d.storeLatency.summary()
+	out.Notifications.Queued = len(notifyQueue) + len(stateQueue) + stateSpill.len()
+	out.Notifications.Capacity = cap(notifyQueue) + cap(stateQueue) + stateOverflowMax
+	out.Warnings = []string{}
+
+	d.mu.Lock()
+	sched := d.sched
+	out.Notifications.Dropped = d.dropped
+	out.Notifications.Channels = make(map[string]*ChannelStats, len(d.channels))
+	for name, c := range d.channels {
+		view := *c
+		out.Notifications.Channels[name] = &view
+	}
+	d.mu.Unlock()
+
+	if sched != nil {
+		sched.mu.Lock()
+		out.Scheduler.Jobs = len(sched.jobs)
+		out.Scheduler.Queued = len(sched.queue)
+		sched.mu.Unlock()
+		out.Scheduler.Workers = sched.workers
+		out.Scheduler.BusyWorkers = int(sched.busy.Load())
+		if lag := time.Duration(out.Scheduler.Lag.P99Ms * float64(time.Millisecond)); lag > sched.interval/2 {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("checks are starting late: p99 scheduler lag is %s", lag.Round(time.Millisecond)))
+		}
+		if out.Scheduler.BusyWorkers == out.Scheduler.Workers {
+			out.Warnings = append(out.Warnings, "every check worker is busy")
+		}
+	}
+	if out.Notifications.Queued > out.Notifications.Capacity*3/4 {
+		out.Warnings = append(out.Warnings, fmt.Sprintf("notification queue is %d of %d full", out.Notifications.Queued, out.Notifications.Capacity))
+	}
+	for name, c := range out.Notifications.Channels {
+		if c.Sent+c.Failed >= 5 && c.ErrorRate >= 0.5 {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("%.0f%% of %s notifications failed", 100*c.ErrorRate, name))
+		}
+	}
+	sort.Strings(out.Warnings)
+	return out
+}
+
+// debugHandler serves GET /debug. The figures cover every project, so only
+// unscoped callers may see them.
+func debugHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	if !requireAdmin(w, r, "diagnostics require an admin key") {
+		return
+	}
+	writeJSON(w, http.StatusOK, diag.snapshot())
+}
+
+// pprofHandler serves /debug/pprof/ from runtime/pprof rather than
+// net/http/pprof, whose import registers the profiles unconditionally.
+//
+//	GET /debug/pprof/                     lists the profiles
+//	GET /debug/pprof/profile?seconds=30   CPU profile
+//	GET /debug/pprof/{name}?debug=1       heap, goroutine, block, ...
+func pprofHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	if !requireAdmin(w, r, "profiles require an admin key") {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+	switch name {
+	case "":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "profile")
+		for _, p := range pprof.Profiles() {
+			fmt.Fprintf(w, "%s (%d)\n", p.Name(), p.Count())
+		}
+	case "profile":
+		seconds, ok := intParam(w, r, "seconds", 30, 1, 300)
+		if !ok {
+			return
+		}
+		// The profile can outlast the server's write timeout.
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Duration(seconds+10) * time.Second))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := pprof.StartCPUProfile(w); err != nil {
+			writeProblem(w, r, http.StatusConflict, problemConflict, err.Error())
+			return
+		}
+		select {
+		case <-time.After(time.Duration(seconds) * time.Second):
+		case <-r.Context().Done():
+		}
+		pprof.StopCPUProfile()
+	default:
+		p := pprof.Lookup(name)
+		if p == nil {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "no profile "+name)
+			return
+		}
+		debug, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+		if debug > 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		p.WriteTo(w, debug)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// perMonitorFields are the settings that identify a monitor and so are
+// never inherited from defaults or templates. Templates don't nest.
+var perMonitorFields = map[string]bool{"Name": true, "URL": true, "PushToken": true, "Template": true}
+
+// resolveMonitor applies m's template and then the defaults to m.
+func resolveMonitor(config Config, m MonitorConfig) MonitorConfig {
+	if m.Template != "" {
+		if tpl, ok := config.Templates[m.Template]; ok {
+			m = inheritDefaults(m, tpl)
+		} else {
+			fmt.Printf("Unknown template %q for %s; using defaults only\n", m.Template, m.URL)
+		}
+	}
+	if config.Defaults != nil {
+		m = inheritDefaults(m, *config.Defaults)
+	}
+	return m
+}
+
+// discoveredTarget builds the target for a monitor found by a discovery
+// provider, which inherits the defaults like a configured monitor.
+func discoveredTarget(m MonitorConfig) Target {
+	configMonitors.Lock()
+	config := configMonitors.config
+	configMonitors.Unlock()
+	return resolveMonitor(config, m).target()
+}
+
+// inheritDefaults returns m with every setting it leaves unset taken from
+// d. Headers and metadata are merged, m's value winning for a key both
+// set. A setting can't be turned back off by its zero value, such as false
+// for keep_session, so defaults are best kept to values most monitors
+// share.
+func inheritDefaults(m, d MonitorConfig) MonitorConfig {
+	mv, dv := reflect.ValueOf(&m).Elem(), reflect.ValueOf(d)
+	for i := 0; i < mv.NumField(); i++ {
+		if perMonitorFields[mv.Type().Field(i).Name] {
+			continue
+		}
+		if f := mv.Field(i); f.IsZero() {
+			f.Set(dv.Field(i))
+		}
+	}
+	if len(d.Headers) > 0 && len(m.Headers) > 0 {
+		m.Headers = mergeHeaders(d.Headers, m.Headers)
+	}
+	if len(d.Metadata) > 0 && len(m.Metadata) > 0 {
+		merged := make(map[string]string, len(d.Metadata)+len(m.Metadata))
+		for k, v := range d.Metadata {
+			merged[k] = v
+		}
+		for k, v := range m.Metadata {
+			merged[k] = v
+		}
+		m.Metadata = merged
+	}
+	return m
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeploysConfig enables the /deploys endpoint, where deploy pipelines report
+// changes so outages can be correlated with them.
+type DeploysConfig struct {
+	// Window is how long before an outage a deploy of the monitor's service
+	// is linked to it. Defaults to 30m.
+	Window Duration `json:"window"`
+	// Suppress holds back down alerts for a monitor this long after its
+	// service is deployed. An outage that outlasts it is alerted on then;
+	// one that ends sooner is not alerted on at all.
+	Suppress Duration `json:"suppress"`
+	// Retention is how long deploys are kept. Defaults to 168h.
+	Retention Duration `json:"retention"`
+}
+
+// DeployEvent is one deployment of a service.
+type DeployEvent struct {
+	Service string `json:"service"`
+	Version string `json:"version,omitempty"`
+	// Time defaults to when the deploy is reported.
+	Time        time.Time `json:"time"`
+	Description string    `json:"description,omitempty"`
+	// Actor is who reported the deploy. It is set by the server.
+	Actor string `json:"actor,omitempty"`
+}
+
+// deployMax bounds how many deploys are kept, whatever the retention.
+const deployMax = 10000
+
+type deployStore struct {
+	window    time.Duration
+	suppress  time.Duration
+	retention time.Duration
+
+	mu sync.Mutex
+	// events are ordered by Time, oldest first.
+	events []DeployEvent
+}
+
+// deploys is nil unless the deploys endpoint is enabled.
+var deploys *deployStore
+
+func newDeployStore(config DeploysConfig) *deployStore {
+	d := &deployStore{
+		window:    time.Duration(config.Window),
+		suppress:  time.Duration(config.Suppress),
+		retention: time.Duration(config.Retention),
+	}
+	if d.window <= 0 {
+		d.window = 30 * time.Minute
+	}
+	if d.retention <= 0 {
+		d.retention = 7 * 24 * time.Hour
+	}
+	return d
+}
+
+// deployedService reports whether a deploy of service affects t: t is
+// tagged service=<service>, or its group or name is service.
+func deployedService(t Target, service string) bool {
+	return hasTag(t, "service="+service) || t.Group == service || t.Name == service
+}
+
+func (d *deployStore) add(e DeployEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := sort.Search(len(d.events), func(i int) bool { return d.events[i].Time.After(e.Time) })
+	d.events = append(d.events, DeployEvent{})
+	copy(d.events[i+1:], d.events[i:])
+	d.events[i] = e
+	cutoff := time.Now().Add(-d.retention)
+	drop := sort.Search(len(d.events), func(i int) bool { return !d.events[i].Time.Before(cutoff) })
+	if n := len(d.events) - deployMax; n > drop {
+		drop = n
+	}
+	d.events = d.events[drop:]
+}
+
+// list returns the deploys since from, of service unless it is empty,
+// newest first.
+func (d *deployStore) list(service string, from time.Time) []DeployEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := []DeployEvent{}
+	for i := len(d.events) - 1; i >= 0 && !d.events[i].Time.Before(from); i-- {
+		if service == "" || d.events[i].Service == service {
+			out = append(out, d.events[i])
+		}
+	}
+	return out
+}
+
+// before returns the latest deploy affecting t within the window up to
+// at, if any.
+func (d *deployStore) before(t Target, at time.Time, window time.Duration) (DeployEvent, bool) {
+	if d == nil {
+		return DeployEvent{}, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := len(d.events) - 1; i >= 0; i-- {
+		e := d.events[i]
+		if e.Time.After(at) {
+			continue
+		}
+		if at.Sub(e.Time) > window {
+			break
+		}
+		if deployedService(t, e.Service) {
+			return e, true
+		}
+	}
+	return DeployEvent{}, false
+}
+
+// linked returns the deploy an outage of t starting at is attributed to.
+func (d *deployStore) linked(t Target, at time.Time) *DeployEvent {
+	if d == nil {
+		return nil
+	}
+	if e, ok := d.before(t, at, d.window); ok {
+		return &e
+	}
+	return nil
+}
+
+// suppressing reports whether down alerts for url are held back because
+// its service was just deployed.
+func (d *deployStore) suppressing(url string) bool {
+	if d == nil || d.suppress <= 0 {
+		return false
+	}
+	t, ok := targets.get(url)
+	if !ok {
+		return false
+	}
+	_, ok = d.before(t, time.Now(), d.suppress)
+	return ok
+}
+
+// describe is a short note on e for alert texts, such as "deploy of api
+// 1.4.2 3m before".
+func (e DeployEvent) describe(at time.Time) string {
+	s := "deploy of " + e.Service
+	if e.Version != "" {
+		s += " " + e.Version
+	}
+	return s + " " + formatDuration(at.Sub(e.Time).Round(time.Second)) + " before"
+}
+
+// deploysHandler serves the deploys API:
+//
+//	GET  /deploys?service=api&since=24h  recent deploys, newest first
+//	POST /deploys                        record a deploy (admin)
+func deploysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		since, ok := durationParam(w, r, "since", 24*time.Hour, time.Minute, deploys.retention)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, deploys.list(r.URL.Query().Get("service"), time.Now().Add(-since)))
+
+	case http.MethodPost:
+		if !requireAdmin(w, r, "recording deploys requires an admin key") {
+			return
+		}
+		var e DeployEvent
+		if !decodeBody(w, r, &e, "deploy") {
+			return
+		}
+		e.Service = strings.TrimSpace(e.Service)
+		if e.Service == "" {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, "a deploy needs a service")
+			return
+		}
+		now := time.Now().UTC()
+		if e.Time.IsZero() {
+			e.Time = now
+		}
+		if e.Time.After(now.Add(time.Minute)) || now.Sub(e.Time) > deploys.retention {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidBody,
+				fmt.Sprintf("time must lie within the last %s", formatDuration(deploys.retention)))
+			return
+		}
+		e.Time = e.Time.UTC()
+		e.Actor = requestActor(r)
+		deploys.add(e)
+		fmt.Printf("Deploy of %s %s recorded by %s\n", e.Service, e.Version, e.Actor)
+		audit.admin(r, "deploy.record", e.Service, e.Version)
+		writeJSON(w, http.StatusCreated, e)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeProblem(w, r, http.StatusMethodNotAllowed, problemMethodNotAllowed, r.Method+" is not supported here")
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+// DiscoveryConfig enables providers that add and remove targets at runtime.
+type DiscoveryConfig struct {
+	Kubernetes *KubernetesDiscovery `json:"kubernetes"`
+	Docker     *DockerDiscovery     `json:"docker"`
+	Consul     *ConsulDiscovery     `json:"consul"`
+	DNSSRV     *DNSSRVDiscovery     `json:"dns_srv"`
+	Files      *FileDiscovery       `json:"files"`
+}
+
+func startDiscovery(config DiscoveryConfig) {
+	if config.Kubernetes != nil {
+		go runKubernetesDiscovery(*config.Kubernetes)
+	}
+	if config.Docker != nil {
+		go runDockerDiscovery(*config.Docker)
+	}
+	if config.Consul != nil {
+		go runConsulDiscovery(*config.Consul)
+	}
+	if config.DNSSRV != nil {
+		go runDNSSRVDiscovery(*config.DNSSRV)
+	}
+	if config.Files != nil {
+		go runFileDiscovery(*config.Files)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsulDiscovery turns every catalog instance of services carrying Tag into
+// a target.
+type ConsulDiscovery struct {
+	// Address of the Consul HTTP API. Defaults to http://127.0.0.1:8500.
+	Address    string `json:"address"`
+	Token      string `json:"token"`
+	Datacenter string `json:"datacenter"`
+	// Tag selects which services to monitor. Defaults to "uptime".
+	Tag string `json:"tag"`
+	// Scheme and Path build the URL checked for each instance. They default
+	// to "http" and "/", and can be overridden per service with the
+	// uptime_scheme and uptime_path service meta keys.
+	Scheme  string   `json:"scheme"`
+	Path    string   `json:"path"`
+	Refresh Duration `json:"refresh"`
+}
+
+type consulCatalogEntry struct {
+	Address        string            `json:"Address"`
+	ServiceName    string            `json:"ServiceName"`
+	ServiceAddress string            `json:"ServiceAddress"`
+	ServicePort    int               `json:"ServicePort"`
+	ServiceMeta    map[string]string `json:"ServiceMeta"`
+}
+
+func runConsulDiscovery(cfg ConsulDiscovery) {
+	if cfg.Address == "" {
+		cfg.Address = "http://127.0.0.1:8500"
+	}
+	if cfg.Tag == "" {
+		cfg.Tag = "uptime"
+	}
+	refresh := time.Duration(cfg.Refresh)
+	if refresh <= 0 {
+		refresh = 30 * time.Second
+	}
+	fmt.Printf("Consul discovery watching services tagged %q at %s\n", cfg.Tag, cfg.Address)
+	for {
+		found, err := consulTargets(cfg)
+		if err != nil {
+			// Keep the last known targets rather than dropping them all on a
+			// transient Consul failure.
+			fmt.Println("Consul discovery:", err)
+		} else {
+			targets.set("consul", found)
+		}
+		time.Sleep(refresh)
+	}
+}
+
+func consulGet(cfg ConsulDiscovery, path string, query url.Values, out any) error {
+	if cfg.Datacenter != "" {
+		query.Set("dc", cfg.Datacenter)
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(cfg.Address, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if cfg.Token != "" {
+		req.Header.Set("X-Consul-Token", cfg.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func consulTargets(cfg ConsulDiscovery) ([]Target, error) {
+	var services map[string][]string
+	if err := consulGet(cfg, "/v1/catalog/services", url.Values{}, &services); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(services))
+	for name, tags := range services {
+		for _, tag := range tags {
+			if tag == cfg.Tag {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var found []Target
+	for _, name := range names {
+		var entries []consulCatalogEntry
+		if err := consulGet(cfg, "/v1/catalog/service/"+url.PathEscape(name), url.Values{"tag": {cfg.Tag}}, &entries); err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			host := e.ServiceAddress
+			if host == "" {
+				host = e.Address
+			}
+			scheme, path := cfg.Scheme, cfg.Path
+			if v := e.ServiceMeta["uptime_scheme"]; v != "" {
+				scheme = v
+			}
+			if v := e.ServiceMeta["uptime_path"]; v != "" {
+				path = v
+			}
+			found = append(found, discoveredTarget(MonitorConfig{URL: buildURL(scheme, net.JoinHostPort(host, strconv.Itoa(e.ServicePort)), path)}))
+		}
+	}
+	return found, nil
+}
+
+// buildURL joins discovered address parts, defaulting to http and "/".
+func buildURL(scheme, hostport, path string) string {
+	if scheme == "" {
+		scheme = "http"
+	}
+	if path == "" {
+		path = "/"
+	} else if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return scheme + "://" + hostport + path
+}
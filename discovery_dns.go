@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNSSRVDiscovery resolves SRV records and checks every host:port they
+// return.
+type DNSSRVDiscovery struct {
+	// Records are full SRV names such as "_http._tcp.api.example.com".
+	Records []string `json:"records"`
+	// Scheme and Path build the URL checked for each record target. They
+	// default to "http" and "/".
+	Scheme  string   `json:"scheme"`
+	Path    string   `json:"path"`
+	Refresh Duration `json:"refresh"`
+}
+
+func runDNSSRVDiscovery(cfg DNSSRVDiscovery) {
+	refresh := time.Duration(cfg.Refresh)
+	if refresh <= 0 {
+		refresh = time.Minute
+	}
+	fmt.Printf("DNS SRV discovery resolving %s\n", strings.Join(cfg.Records, ", "))
+	last := make(map[string][]Target)
+	for {
+		var found []Target
+		for _, record := range cfg.Records {
+			_, addrs, err := net.LookupSRV("", "", record)
+			if err != nil {
+				// Serve the previous answer so a resolver blip doesn't remove
+				// and re-add every target.
+				fmt.Printf("DNS SRV discovery (%s): %s\n", record, err)
+				found = append(found, last[record]...)
+				continue
+			}
+			var list []Target
+			for _, a := range addrs {
+				host := strings.TrimSuffix(a.Target, ".")
+				list = append(list, discoveredTarget(MonitorConfig{URL: buildURL(cfg.Scheme, net.JoinHostPort(host, strconv.Itoa(int(a.Port))), cfg.Path)}))
+			}
+			last[record] = list
+			found = append(found, list...)
+		}
+		targets.set("dns-srv", found)
+		time.Sleep(refresh)
+	}
+}
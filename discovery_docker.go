@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Container labels read by Docker discovery.
+const (
+	dockerLabelURL      = "uptime.url"
+	dockerLabelInterval = "uptime.interval"
+)
+
+// DockerDiscovery manages targets for running containers labelled with
+// uptime.url.
+type DockerDiscovery struct {
+	// Host is the Docker daemon address, unix:///path or tcp://host:port.
+	// Defaults to unix:///var/run/docker.sock.
+	Host string `json:"host"`
+}
+
+type dockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+}
+
+type dockerClient struct {
+	base string
+	http *http.Client
+}
+
+func newDockerClient(cfg DockerDiscovery) (*dockerClient, error) {
+	host := cfg.Host
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+	switch {
+	case strings.HasPrefix(host, "unix://"):
+		path := strings.TrimPrefix(host, "unix://")
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+		return &dockerClient{base: "http://docker", http: &http.Client{Transport: transport}}, nil
+	case strings.HasPrefix(host, "tcp://"):
+		return &dockerClient{base: "http://" + strings.TrimPrefix(host, "tcp://"), http: &http.Client{}}, nil
+	}
+	return nil, fmt.Errorf("unsupported docker host %q", host)
+}
+
+func (c *dockerClient) get(path string) (*http.Response, error) {
+	resp, err := c.http.Get(c.base + path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+func runDockerDiscovery(cfg DockerDiscovery) {
+	client, err := newDockerClient(cfg)
+	if err != nil {
+		fmt.Println("Error starting Docker discovery:", err)
+		return
+	}
+	fmt.Println("Docker discovery enabled")
+	for {
+		err := syncDockerContainers(client)
+		if err == nil {
+			err = followDockerEvents(client)
+		}
+		if err != nil {
+			fmt.Println("Docker discovery:", err)
+			time.Sleep(10 * time.Second)
+		}
+	}
+}
+
+// syncDockerContainers replaces the "docker" source with the labelled
+// containers currently running.
+func syncDockerContainers(client *dockerClient) error {
+	resp, err := client.get("/containers/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return err
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].ID < containers[j].ID })
+
+	var found []Target
+	for _, c := range containers {
+		u := c.Labels[dockerLabelURL]
+		if u == "" {
+			continue
+		}
+		m := MonitorConfig{URL: u}
+		if v := c.Labels[dockerLabelInterval]; v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				fmt.Printf("Docker discovery: ignoring bad %s on %s: %s\n", dockerLabelInterval, strings.Join(c.Names, ","), err)
+			}
+			m.Interval = Duration(d)
+		}
+		found = append(found, discoveredTarget(m))
+	}
+	targets.set("docker", found)
+	return nil
+}
+
+// followDockerEvents resyncs whenever a container starts or stops, and
+// returns when the event stream ends.
+func followDockerEvents(client *dockerClient) error {
+	filters := `{"type":["container"],"event":["start","die","destroy"]}`
+	resp, err := client.get("/events?filters=" + url.QueryEscape(filters))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if err := syncDockerContainers(client); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("event stream closed")
+}
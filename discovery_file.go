@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileDiscovery reads targets from external files that are re-read whenever
+// they change, so automation can maintain them without touching config.json.
+//
+// Files ending in .yaml, .yml or .json hold a list whose items are either a
+// URL string or an object with "url" and optional "interval"; the list may
+// also sit under a top-level "targets" key. Any other file is read as one URL
+// per line, with blank lines and lines starting with # ignored.
+type FileDiscovery struct {
+	Paths []string `json:"paths"`
+	// Refresh is how often files are checked for changes. Defaults to 5s.
+	Refresh Duration `json:"refresh"`
+}
+
+type targetFileEntry struct {
+	URL      string   `json:"url"`
+	Interval Duration `json:"interval"`
+}
+
+func (e *targetFileEntry) UnmarshalJSON(b []byte) error {
+	var url string
+	if err := json.Unmarshal(b, &url); err == nil {
+		e.URL = url
+		return nil
+	}
+	type plain targetFileEntry
+	return json.Unmarshal(b, (*plain)(e))
+}
+
+func runFileDiscovery(cfg FileDiscovery) {
+	refresh := time.Duration(cfg.Refresh)
+	if refresh <= 0 {
+		refresh = 5 * time.Second
+	}
+	modTimes := make(map[string]time.Time)
+	for {
+		for _, path := range cfg.Paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				if last, seen := modTimes[path]; !seen || !last.IsZero() {
+					fmt.Printf("Target file %s: %s\n", path, err)
+					targets.set("file:"+path, nil)
+				}
+				modTimes[path] = time.Time{}
+				continue
+			}
+			if info.ModTime().Equal(modTimes[path]) {
+				continue
+			}
+			modTimes[path] = info.ModTime()
+
+			found, err := readTargetFile(path)
+			if err != nil {
+				// Keep the previous contents until the file is fixed.
+				fmt.Printf("Error reading target file %s: %s\n", path, err)
+				continue
+			}
+			fmt.Printf("Loaded %d targets from %s\n", len(found), path)
+			targets.set("file:"+path, found)
+		}
+		time.Sleep(refresh)
+	}
+}
+
+func readTargetFile(path string) ([]Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []targetFileEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		var wrapped struct {
+			Targets []targetFileEntry `json:"targets"`
+		}
+		decode := unmarshalYAML
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			decode = json.Unmarshal
+		}
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) > 0 && trimmed[0] != '[' && trimmed[0] != '-' {
+			err = decode(data, &wrapped)
+			entries = wrapped.Targets
+		} else {
+			err = decode(data, &entries)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, targetFileEntry{URL: line})
+		}
+	}
+
+	list := make([]Target, 0, len(entries))
+	for _, e := range entries {
+		if e.URL == "" {
+			return nil, fmt.Errorf("target without a url")
+		}
+		list = append(list, discoveredTarget(MonitorConfig{URL: e.URL, Interval: e.Interval}))
+	}
+	return list, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTargetFileInheritsDefaults(t *testing.T) {
+	config := Config{Defaults: &MonitorConfig{
+		Timeout:        Duration(7 * time.Second),
+		Retries:        2,
+		Interval:       Duration(time.Minute),
+		ExpectedStatus: []int{204},
+		Headers:        map[string]string{"Authorization": "Bearer abc"},
+		BodyMatches:    "ok",
+	}}
+	loadConfigMonitors(config)
+	defer loadConfigMonitors(Config{})
+
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	data := "targets:\n  - https://a.example.com/\n  - url: https://b.example.com/\n    interval: 5m\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	found, err := readTargetFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("read %d targets, want 2", len(found))
+	}
+	for _, target := range found {
+		if target.Timeout != 7*time.Second || target.Retries != 2 || len(target.ExpectedStatus) != 1 ||
+			target.Headers["Authorization"] != "Bearer abc" || target.BodyMatches == nil {
+			t.Errorf("%s did not inherit the defaults: %+v", target.URL, target)
+		}
+	}
+	if found[0].Interval != time.Minute {
+		t.Errorf("%s interval is %s, want the default 1m", found[0].URL, found[0].Interval)
+	}
+	if found[1].Interval != 5*time.Minute {
+		t.Errorf("%s interval is %s, want its own 5m", found[1].URL, found[1].Interval)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Annotations read from Ingresses and Services.
+const (
+	k8sAnnotationEnabled  = "uptime-monitor/enabled"
+	k8sAnnotationURL      = "uptime-monitor/url"
+	k8sAnnotationPath     = "uptime-monitor/path"
+	k8sAnnotationPort     = "uptime-monitor/port"
+	k8sAnnotationScheme   = "uptime-monitor/scheme"
+	k8sAnnotationInterval = "uptime-monitor/interval"
+)
+
+const (
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	k8sWatchTimeout      = 5 * time.Minute
+)
+
+// KubernetesDiscovery watches Ingresses and Services annotated with
+// uptime-monitor/enabled: "true". With no fields set it uses the in-cluster
+// service account.
+type KubernetesDiscovery struct {
+	// APIServer defaults to https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT.
+	APIServer string `json:"api_server"`
+	TokenFile string `json:"token_file"`
+	CAFile    string `json:"ca_file"`
+	// Namespace limits discovery to one namespace. Empty means all.
+	Namespace string `json:"namespace"`
+}
+
+type k8sMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Annotations     map[string]string `json:"annotations"`
+	ResourceVersion string            `json:"resourceVersion"`
+}
+
+// k8sObject decodes just the parts of an Ingress or Service we need.
+type k8sObject struct {
+	Metadata k8sMeta `json:"metadata"`
+	Spec     struct {
+		// Ingress
+		TLS []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tls"`
+		Rules []struct {
+			Host string `json:"host"`
+		} `json:"rules"`
+		// Service
+		Ports []struct {
+			Port int `json:"port"`
+		} `json:"ports"`
+	} `json:"spec"`
+}
+
+type k8sList struct {
+	Metadata k8sMeta     `json:"metadata"`
+	Items    []k8sObject `json:"items"`
+}
+
+type k8sEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type k8sResource struct {
+	kind string
+	// path is the collection path without the namespace segment.
+	group, plural string
+}
+
+var k8sResources = []k8sResource{
+	{kind: "ingress", group: "/apis/networking.k8s.io/v1", plural: "ingresses"},
+	{kind: "service", group: "/api/v1", plural: "services"},
+}
+
+type k8sClient struct {
+	base      string
+	tokenFile string
+	namespace string
+	http      *http.Client
+}
+
+func newK8sClient(cfg KubernetesDiscovery) (*k8sClient, error) {
+	base := cfg.APIServer
+	if base == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("api_server not set and not running in a cluster")
+		}
+		base = "https://" + host + ":" + port
+	}
+	tokenFile := cfg.TokenFile
+	if tokenFile == "" && cfg.APIServer == "" {
+		tokenFile = k8sServiceAccountDir + "/token"
+	}
+	caFile := cfg.CAFile
+	if caFile == "" && cfg.APIServer == "" {
+		caFile = k8sServiceAccountDir + "/ca.crt"
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &k8sClient{
+		base:      strings.TrimRight(base, "/"),
+		tokenFile: tokenFile,
+		namespace: cfg.Namespace,
+		http:      &http.Client{Transport: transport},
+	}, nil
+}
+
+func (c *k8sClient) get(r k8sResource, query string) (*http.Response, error) {
+	path := c.base + r.group
+	if c.namespace != "" {
+		path += "/namespaces/" + c.namespace
+	}
+	path += "/" + r.plural + query
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.tokenFile != "" {
+		// Re-read every time: projected service account tokens rotate.
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", req.Method, r.plural, resp.Status)
+	}
+	return resp, nil
+}
+
+// k8sTargets collects the targets derived from each watched object and
+// publishes the union as the "kubernetes" source.
+type k8sTargets struct {
+	mu      sync.Mutex
+	objects map[string][]Target
+}
+
+func (k *k8sTargets) put(key string, list []Target) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(list) == 0 {
+		delete(k.objects, key)
+	} else {
+		k.objects[key] = list
+	}
+	k.publish()
+}
+
+// replace swaps every object of kind for the given set, as after a relist.
+func (k *k8sTargets) replace(kind string, objects map[string][]Target) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for key := range k.objects {
+		if strings.HasPrefix(key, kind+"/") {
+			delete(k.objects, key)
+		}
+	}
+	for key, list := range objects {
+		k.objects[key] = list
+	}
+	k.publish()
+}
+
+func (k *k8sTargets) publish() {
+	keys := make([]string, 0, len(k.objects))
+	for key := range k.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var all []Target
+	for _, key := range keys {
+		all = append(all, k.objects[key]...)
+	}
+	targets.set("kubernetes", all)
+}
+
+func runKubernetesDiscovery(cfg KubernetesDiscovery) {
+	client, err := newK8sClient(cfg)
+	if err != nil {
+		fmt.Println("Error starting Kubernetes discovery:", err)
+		return
+	}
+	fmt.Printf("Kubernetes discovery watching %s\n", client.base)
+	discovered := &k8sTargets{objects: make(map[string][]Target)}
+	for _, r := range k8sResources {
+		go watchK8sResource(client, r, discovered)
+	}
+}
+
+// watchK8sResource lists r, then follows changes with a watch, relisting
+// whenever the watch breaks or its resource version expires.
+func watchK8sResource(client *k8sClient, r k8sResource, discovered *k8sTargets) {
+	for {
+		version, err := listK8sResource(client, r, discovered)
+		if err == nil {
+			err = followK8sResource(client, r, version, discovered)
+		}
+		if err != nil {
+			fmt.Printf("Kubernetes discovery (%s): %s\n", r.plural, err)
+			time.Sleep(10 * time.Second)
+		}
+	}
+}
+
+func listK8sResource(client *k8sClient, r k8sResource, discovered *k8sTargets) (string, error) {
+	resp, err := client.get(r, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var list k8sList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", err
+	}
+	objects := make(map[string][]Target)
+	for _, obj := range list.Items {
+		if found := k8sObjectTargets(r.kind, obj); len(found) > 0 {
+			objects[k8sKey(r.kind, obj)] = found
+		}
+	}
+	discovered.replace(r.kind, objects)
+	return list.Metadata.ResourceVersion, nil
+}
+
+// followK8sResource applies watch events until the server ends the stream.
+// It returns nil on a normal timeout and an error when a relist is needed.
+func followK8sResource(client *k8sClient, r k8sResource, version string, discovered *k8sTargets) error {
+	query := fmt.Sprintf("?watch=1&resourceVersion=%s&timeoutSeconds=%d", version, int(k8sWatchTimeout.Seconds()))
+	for {
+		resp, err := client.get(r, query)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			var ev k8sEvent
+			if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+				resp.Body.Close()
+				return err
+			}
+			if ev.Type == "ERROR" {
+				resp.Body.Close()
+				return fmt.Errorf("watch error: %s", ev.Object)
+			}
+			var obj k8sObject
+			if err := json.Unmarshal(ev.Object, &obj); err != nil {
+				resp.Body.Close()
+				return err
+			}
+			version = obj.Metadata.ResourceVersion
+			if ev.Type == "DELETED" {
+				discovered.put(k8sKey(r.kind, obj), nil)
+			} else {
+				discovered.put(k8sKey(r.kind, obj), k8sObjectTargets(r.kind, obj))
+			}
+		}
+		err = scanner.Err()
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		query = fmt.Sprintf("?watch=1&resourceVersion=%s&timeoutSeconds=%d", version, int(k8sWatchTimeout.Seconds()))
+	}
+}
+
+func k8sKey(kind string, obj k8sObject) string {
+	return kind + "/" + obj.Metadata.Namespace + "/" + obj.Metadata.Name
+}
+
+// k8sObjectTargets returns the targets an annotated object asks for.
+func k8sObjectTargets(kind string, obj k8sObject) []Target {
+	ann := obj.Metadata.Annotations
+	if ann[k8sAnnotationEnabled] != "true" {
+		return nil
+	}
+	var interval time.Duration
+	if v := ann[k8sAnnotationInterval]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			fmt.Printf("Kubernetes discovery: ignoring bad %s on %s: %s\n", k8sAnnotationInterval, k8sKey(kind, obj), err)
+		}
+		interval = d
+	}
+	if u := ann[k8sAnnotationURL]; u != "" {
+		return []Target{discoveredTarget(MonitorConfig{URL: u, Interval: Duration(interval)})}
+	}
+
+	path := ann[k8sAnnotationPath]
+	if path == "" {
+		path = "/"
+	}
+	var found []Target
+	switch kind {
+	case "ingress":
+		secure := make(map[string]bool)
+		for _, t := range obj.Spec.TLS {
+			for _, h := range t.Hosts {
+				secure[h] = true
+			}
+		}
+		for _, rule := range obj.Spec.Rules {
+			if rule.Host == "" || strings.Contains(rule.Host, "*") {
+				continue
+			}
+			scheme := "http"
+			if secure[rule.Host] {
+				scheme = "https"
+			}
+			found = append(found, discoveredTarget(MonitorConfig{URL: scheme + "://" + rule.Host + path, Interval: Duration(interval)}))
+		}
+	case "service":
+		port := 0
+		if v := ann[k8sAnnotationPort]; v != "" {
+			port, _ = strconv.Atoi(v)
+		} else if len(obj.Spec.Ports) > 0 {
+			port = obj.Spec.Ports[0].Port
+		}
+		if port == 0 {
+			return nil
+		}
+		scheme := ann[k8sAnnotationScheme]
+		if scheme == "" {
+			scheme = "http"
+		}
+		found = append(found, discoveredTarget(MonitorConfig{
+			URL:      fmt.Sprintf("%s://%s.%s.svc:%d%s", scheme, obj.Metadata.Name, obj.Metadata.Namespace, port, path),
+			Interval: Duration(interval),
+		}))
+	}
+	return found
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DNSCheckConfig configures "dns" monitors, whose url is dns://name, e.g.
+// dns://www.example.com.
+type DNSCheckConfig struct {
+	// Server is the resolver queried, as host or host:port. Defaults to the
+	// first nameserver in /etc/resolv.conf.
+	Server string `json:"server,omitempty"`
+	// RecordType is the type looked up: "A" (the default), "AAAA",
+	// "CNAME", "MX", "NS", "TXT", "SOA", "SRV" or "PTR".
+	RecordType string `json:"record_type,omitempty"`
+	// Expect must appear in one of the answers, e.g. an address or a TXT
+	// value. Empty accepts any answer.
+	Expect string `json:"expect,omitempty"`
+	// DNSSEC validates the answer's RRSIG against the zone's DNSKEYs, so a
+	// broken or expired signature fails the check even when the resolver
+	// itself does not validate.
+	DNSSEC bool `json:"dnssec,omitempty"`
+	// MinSignatureValidity fails signatures that expire sooner than this,
+	// catching stalled re-signing before validating resolvers break.
+	MinSignatureValidity Duration `json:"min_signature_validity,omitempty"`
+	// Timeout is how long each query waits. Defaults to 5s.
+	Timeout Duration `json:"timeout,omitempty"`
+
+	qtype uint16
+}
+
+const dnsType = "dns"
+
+// DNS record types and classes used by the check.
+const (
+	dnsTypeA      = 1
+	dnsTypeNS     = 2
+	dnsTypeCNAME  = 5
+	dnsTypeSOA    = 6
+	dnsTypePTR    = 12
+	dnsTypeMX     = 15
+	dnsTypeTXT    = 16
+	dnsTypeAAAA   = 28
+	dnsTypeSRV    = 33
+	dnsTypeDNAME  = 39
+	dnsTypeOPT    = 41
+	dnsTypeRRSIG  = 46
+	dnsTypeDNSKEY = 48
+
+	dnsClassIN = 1
+)
+
+var dnsTypeNames = map[string]uint16{
+	"A": dnsTypeA, "NS": dnsTypeNS, "CNAME": dnsTypeCNAME, "SOA": dnsTypeSOA, "PTR": dnsTypePTR,
+	"MX": dnsTypeMX, "TXT": dnsTypeTXT, "AAAA": dnsTypeAAAA, "SRV": dnsTypeSRV,
+}
+
+var dnsRcodes = map[int]string{1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED"}
+
+func dnsTypeName(t uint16) string {
+	for name, v := range dnsTypeNames {
+		if v == t {
+			return name
+		}
+	}
+	switch t {
+	case dnsTypeDNSKEY:
+		return "DNSKEY"
+	case dnsTypeRRSIG:
+		return "RRSIG"
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+func (c *DNSCheckConfig) validate() error {
+	c.qtype = dnsTypeA
+	if c.RecordType != "" {
+		t, ok := dnsTypeNames[strings.ToUpper(c.RecordType)]
+		if !ok {
+			return fmt.Errorf("unsupported record_type %q", c.RecordType)
+		}
+		c.qtype = t
+	}
+	return nil
+}
+
+// dnsRR is one resource record. Name is the owner in canonical wire form;
+// Data is the raw RDATA, which may hold names compressed against msg.
+type dnsRR struct {
+	Name  []byte
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+	msg   []byte
+	off   int
+}
+
+type dnsMessage struct {
+	Rcode     int
+	Truncated bool
+	Answers   []dnsRR
+}
+
+// dnsWireName encodes a dotted name in canonical (lowercase) wire form.
+func dnsWireName(name string) ([]byte, error) {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(strings.ToLower(name), "."), ".") {
+		if label == "" {
+			if len(b) == 0 {
+				break
+			}
+			return nil, fmt.Errorf("invalid name %q", name)
+		}
+		if len(label) > 63 {
+			return nil, fmt.Errorf("label too long in %q", name)
+		}
+		b = append(append(b, byte(len(label))), label...)
+	}
+	return append(b, 0), nil
+}
+
+// dnsNameString renders a wire name as "www.example.com.".
+func dnsNameString(wire []byte) string {
+	if len(wire) <= 1 {
+		return "."
+	}
+	var parts []string
+	for i := 0; i < len(wire) && wire[i] != 0; i += 1 + int(wire[i]) {
+		parts = append(parts, string(wire[i+1:i+1+int(wire[i])]))
+	}
+	return strings.Join(parts, ".") + "."
+}
+
+func dnsLabelCount(wire []byte) int {
+	n := 0
+	for i := 0; i < len(wire) && wire[i] != 0; i += 1 + int(wire[i]) {
+		n++
+	}
+	return n
+}
+
+// readDNSName decompresses the name at off in msg, returning it in
+// canonical wire form and the offset after it.
+func readDNSName(msg []byte, off int) ([]byte, int, error) {
+	var name []byte
+	end := -1
+	for hops := 0; ; hops++ {
+		if off >= len(msg) || hops > 64 {
+			return nil, 0, errors.New("malformed DNS name")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return append(name, 0), end, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return nil, 0, errors.New("malformed DNS name")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		case n > 63 || off+1+n > len(msg):
+			return nil, 0, errors.New("malformed DNS name")
+		default:
+			name = append(append(name, byte(n)), strings.ToLower(string(msg[off+1:off+1+n]))...)
+			off += 1 + n
+		}
+	}
+}
+
+func parseDNSMessage(msg []byte, id uint16) (*dnsMessage, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id || msg[2]&0x80 == 0 {
+		return nil, errors.New("malformed DNS response")
+	}
+	m := &dnsMessage{Rcode: int(msg[3] & 0x0f), Truncated: msg[2]&0x02 != 0}
+	qd, an := int(binary.BigEndian.Uint16(msg[4:])), int(binary.BigEndian.Uint16(msg[6:]))
+	off := 12
+	for i := 0; i < qd; i++ {
+		_, next, err := readDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next + 4
+	}
+	for i := 0; i < an; i++ {
+		name, next, err := readDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errors.New("truncated DNS response")
+		}
+		rr := dnsRR{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(msg[next:]),
+			Class: binary.BigEndian.Uint16(msg[next+2:]),
+			TTL:   binary.BigEndian.Uint32(msg[next+4:]),
+			msg:   msg,
+			off:   next + 10,
+		}
+		size := int(binary.BigEndian.Uint16(msg[next+8:]))
+		if rr.off+size > len(msg) {
+			return nil, errors.New("truncated DNS response")
+		}
+		rr.Data = msg[rr.off : rr.off+size]
+		m.Answers = append(m.Answers, rr)
+		off = rr.off + size
+	}
+	return m, nil
+}
+
+// dnsClient queries one resolver for a monitor's checks.
+type dnsClient struct {
+	target  Target
+	server  string
+	timeout time.Duration
+}
+
+// query asks the server for name/qtype, setting the DNSSEC OK bit when do
+// is true, and retries over TCP when the UDP answer is truncated.
+func (c dnsClient) query(name []byte, qtype uint16, do bool) (*dnsMessage, error) {
+	var idb [2]byte
+	rand.Read(idb[:])
+	id := binary.BigEndian.Uint16(idb[:])
+	q := binary.BigEndian.AppendUint16(nil, id)
+	q = append(q, 0x01, 0x00) // recursion desired
+	if do {
+		// Checking disabled, so a validating resolver passes bogus answers
+		// through for us to diagnose instead of returning SERVFAIL.
+		q[3] |= 0x10
+	}
+	q = append(q, 0, 1, 0, 0, 0, 0, 0, 1)
+	q = append(q, name...)
+	q = binary.BigEndian.AppendUint16(q, qtype)
+	q = binary.BigEndian.AppendUint16(q, dnsClassIN)
+	// EDNS0 OPT record advertising a 4096-byte buffer.
+	q = append(q, 0)
+	q = binary.BigEndian.AppendUint16(q, dnsTypeOPT)
+	q = binary.BigEndian.AppendUint16(q, 4096)
+	if do {
+		q = append(q, 0, 0, 0x80, 0)
+	} else {
+		q = append(q, 0, 0, 0, 0)
+	}
+	q = append(q, 0, 0)
+
+	conn, err := dialCheck(c.target, "udp", c.server, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write(q); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseDNSMessage(buf[:n], id)
+	if err != nil || !m.Truncated {
+		return m, err
+	}
+
+	tcp, err := dialCheck(c.target, "tcp", c.server, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer tcp.Close()
+	tcp.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := tcp.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(q))), q...)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(tcp)
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, resp); err != nil {
+		return nil, err
+	}
+	return parseDNSMessage(resp, id)
+}
+
+// canonicalRData returns rr's RDATA with any embedded names decompressed
+// and lowercased, as DNSSEC signs it (RFC 4034 section 6.2).
+func (rr dnsRR) canonicalRData() ([]byte, error) {
+	prefix, names := 0, 0
+	switch rr.Type {
+	case dnsTypeNS, dnsTypeCNAME, dnsTypePTR, dnsTypeDNAME:
+		names = 1
+	case dnsTypeMX:
+		prefix, names = 2, 1
+	case dnsTypeSRV:
+		prefix, names = 6, 1
+	case dnsTypeSOA:
+		names = 2
+	default:
+		return rr.Data, nil
+	}
+	if len(rr.Data) < prefix {
+		return nil, errors.New("malformed record data")
+	}
+	out := append([]byte(nil), rr.Data[:prefix]...)
+	off := rr.off + prefix
+	for i := 0; i < names; i++ {
+		name, next, err := readDNSName(rr.msg, off)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, name...)
+		off = next
+	}
+	return append(out, rr.msg[off:rr.off+len(rr.Data)]...), nil
+}
+
+// String renders the record data in presentation form.
+func (rr dnsRR) String() string {
+	data, err := rr.canonicalRData()
+	if err != nil {
+		return "?"
+	}
+	switch rr.Type {
+	case dnsTypeA, dnsTypeAAAA:
+		return net.IP(data).String()
+	case dnsTypeNS, dnsTypeCNAME, dnsTypePTR, dnsTypeDNAME:
+		return dnsNameString(data)
+	case dnsTypeMX:
+		return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(data), dnsNameString(data[2:]))
+	case dnsTypeSRV:
+		return fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:]),
+			binary.BigEndian.Uint16(data[4:]), dnsNameString(data[6:]))
+	case dnsTypeSOA:
+		mname, _, _ := readDNSName(data, 0)
+		return dnsNameString(mname)
+	case dnsTypeTXT:
+		var parts []string
+		for i := 0; i < len(data); i += 1 + int(data[i]) {
+			end := i + 1 + int(data[i])
+			if end > len(data) {
+				break
+			}
+			parts = append(parts, string(data[i+1:end]))
+		}
+		return strings.Join(parts, "")
+	}
+	return hex.EncodeToString(data)
+}
+
+// defaultResolver returns the first nameserver in /etc/resolv.conf.
+func defaultResolver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1]
+		}
+	}
+	return "127.0.0.1"
+}
+
+// dnsServer returns the host:port a dns monitor queries.
+func dnsServer(target Target, cfg *DNSCheckConfig) string {
+	server := cfg.Server
+	if target.dialAddr != "" {
+		server = target.dialAddr
+	}
+	if server == "" {
+		server = defaultResolver()
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	return server
+}
+
+// probeDNS resolves the monitor's name and checks the answer, validating
+// its DNSSEC signatures when configured.
+func probeDNS(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	cfg := target.DNS
+	if cfg == nil {
+		cfg = &DNSCheckConfig{qtype: dnsTypeA}
+	}
+	u, err := url.Parse(target.URL)
+	if err != nil || u.Scheme != "dns" || u.Host == "" {
+		result.Detail = "dns monitors need a dns://name url"
+		return result
+	}
+	name, err := dnsWireName(u.Host)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	server := dnsServer(target, cfg)
+	client := dnsClient{target: target, server: server, timeout: timeout}
+
+	start := time.Now()
+	m, err := client.query(name, cfg.qtype, cfg.DNSSEC)
+	result.Latency = Duration(time.Since(start))
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	if m.Rcode != 0 {
+		rcode, ok := dnsRcodes[m.Rcode]
+		if !ok {
+			rcode = fmt.Sprintf("rcode %d", m.Rcode)
+		}
+		result.Detail = fmt.Sprintf("%s from %s", rcode, server)
+		return result
+	}
+	var answers []string
+	for _, rr := range m.Answers {
+		if rr.Type == cfg.qtype {
+			answers = append(answers, rr.String())
+		}
+	}
+	qname := dnsNameString(name)
+	if len(answers) == 0 {
+		result.Detail = fmt.Sprintf("no %s records for %s", dnsTypeName(cfg.qtype), qname)
+		return result
+	}
+	result.Detail = strings.Join(answers, ", ")
+	if cfg.Expect != "" && !strings.Contains(strings.Join(answers, "\n"), cfg.Expect) {
+		result.Detail += fmt.Sprintf(": expected %q", cfg.Expect)
+		return result
+	}
+	if cfg.DNSSEC {
+		status, err := validateDNSSEC(client, m.Answers, time.Duration(cfg.MinSignatureValidity))
+		if err != nil {
+			result.Detail += ": DNSSEC: " + err.Error()
+			return result
+		}
+		result.Detail += "; " + status
+	}
+	result.Status = "up"
+	return result
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// dnsResponse builds a response to query id with one question for
+// example.com MX and the given answer records, already encoded.
+func dnsResponse(id uint16, answers ...[]byte) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = append(msg, 0x81, 0x80, 0, 1)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(answers)))
+	msg = append(msg, 0, 0, 0, 0)
+	msg = append(msg, "\x07example\x03com\x00"...)
+	msg = append(msg, 0, dnsTypeMX, 0, dnsClassIN)
+	for _, a := range answers {
+		msg = append(msg, a...)
+	}
+	return msg
+}
+
+// dnsAnswer encodes a record owned by the question name, through a
+// compression pointer to it.
+func dnsAnswer(rtype uint16, rdata []byte) []byte {
+	rr := []byte{0xc0, 12}
+	rr = binary.BigEndian.AppendUint16(rr, rtype)
+	rr = binary.BigEndian.AppendUint16(rr, dnsClassIN)
+	rr = binary.BigEndian.AppendUint32(rr, 3600)
+	rr = binary.BigEndian.AppendUint16(rr, uint16(len(rdata)))
+	return append(rr, rdata...)
+}
+
+func TestDNSWireNames(t *testing.T) {
+	wire, err := dnsWireName("WWW.Example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(wire) != "\x03www\x07example\x03com\x00" {
+		t.Errorf("wire form %q", wire)
+	}
+	if got := dnsNameString(wire); got != "www.example.com." {
+		t.Errorf("dnsNameString = %q", got)
+	}
+	if got := dnsLabelCount(wire); got != 3 {
+		t.Errorf("dnsLabelCount = %d, want 3", got)
+	}
+	if root, _ := dnsWireName("."); string(root) != "\x00" {
+		t.Errorf("root is %q", root)
+	}
+	for _, bad := range []string{"a..b", strings.Repeat("x", 64) + ".com"} {
+		if _, err := dnsWireName(bad); err == nil {
+			t.Errorf("dnsWireName(%q) accepted", bad)
+		}
+	}
+}
+
+func TestParseDNSMessageCompressed(t *testing.T) {
+	// MX 10 mail.example.com., the exchange compressed against the owner.
+	mx := append([]byte{0, 10}, "\x04MAIL\xc0\x0c"...)
+	msg := dnsResponse(0x1234, dnsAnswer(dnsTypeMX, mx))
+	m, err := parseDNSMessage(msg, 0x1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Answers) != 1 {
+		t.Fatalf("%d answers, want 1", len(m.Answers))
+	}
+	rr := m.Answers[0]
+	if dnsNameString(rr.Name) != "example.com." || rr.Type != dnsTypeMX || rr.TTL != 3600 {
+		t.Errorf("answer %s type %d ttl %d", dnsNameString(rr.Name), rr.Type, rr.TTL)
+	}
+	data, err := rr.canonicalRData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x00\x0a\x04mail\x07example\x03com\x00"; string(data) != want {
+		t.Errorf("canonical RDATA %q, want %q", data, want)
+	}
+	if got := rr.String(); !strings.Contains(got, "mail.example.com.") {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestParseDNSMessageMalformed(t *testing.T) {
+	good := dnsResponse(7, dnsAnswer(dnsTypeA, []byte{192, 0, 2, 1}))
+	loop := dnsResponse(7)
+	loop = append(loop, 0xc0, byte(len(loop))) // a name pointing at itself
+	loop = append(loop, 0, dnsTypeA, 0, dnsClassIN, 0, 0, 0, 0, 0, 0)
+	loop[7] = 1
+	beyond := dnsResponse(7, dnsAnswer(dnsTypeA, []byte{192, 0, 2, 1}))
+	beyond[len(beyond)-6] = 0xff // RDLENGTH past the end
+	forward := dnsResponse(7, append([]byte{0xc0, 0xff}, dnsAnswer(dnsTypeA, []byte{192, 0, 2, 1})[2:]...))
+	longLabel := dnsResponse(7)
+	longLabel[12] = 64
+
+	if _, err := parseDNSMessage(good, 7); err != nil {
+		t.Fatalf("well-formed response: %v", err)
+	}
+	tests := []struct {
+		name string
+		msg  []byte
+		id   uint16
+	}{
+		{"short header", good[:11], 7},
+		{"wrong id", good, 8},
+		{"not a response", append([]byte{0, 7, 0x01}, good[3:]...), 7},
+		{"truncated record", good[:len(good)-2], 7},
+		{"pointer loop", loop, 7},
+		{"rdata past the end", beyond, 7},
+		{"label over 63 bytes", longLabel, 7},
+		{"pointer past the end", forward, 7},
+	}
+	for _, tt := range tests {
+		if _, err := parseDNSMessage(tt.msg, tt.id); err == nil {
+			t.Errorf("%s: parsed without error", tt.name)
+		}
+	}
+}
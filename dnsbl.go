@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DNSBLCheckConfig configures "dnsbl" monitors, whose url is dnsbl://ip or
+// dnsbl://mail-host, e.g. dnsbl://mail.example.com. A host is resolved and
+// each of its addresses is checked.
+type DNSBLCheckConfig struct {
+	// Lists are the DNSBL zones queried. Defaults to zen.spamhaus.org,
+	// bl.spamcop.net and b.barracudacentral.org.
+	Lists []string `json:"lists,omitempty"`
+	// Server is the resolver queried, as for dns monitors. Spamhaus refuses
+	// queries through large public resolvers, so use your own.
+	Server string `json:"server,omitempty"`
+	// Timeout is how long each query waits. Defaults to 5s.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+const dnsblType = "dnsbl"
+
+var defaultDNSBLs = []string{"zen.spamhaus.org", "bl.spamcop.net", "b.barracudacentral.org"}
+
+// dnsblName returns the query name for ip in zone: the reversed octets for
+// IPv4, or reversed nibbles for IPv6.
+func dnsblName(ip net.IP, zone string) string {
+	var labels []string
+	if v4 := ip.To4(); v4 != nil {
+		for i := 3; i >= 0; i-- {
+			labels = append(labels, fmt.Sprint(v4[i]))
+		}
+	} else {
+		const hexDigits = "0123456789abcdef"
+		for i := len(ip) - 1; i >= 0; i-- {
+			labels = append(labels, string(hexDigits[ip[i]&0x0f]), string(hexDigits[ip[i]>>4]))
+		}
+	}
+	return strings.Join(labels, ".") + "." + strings.TrimSuffix(zone, ".")
+}
+
+// dnsblLookup reports whether ip is listed in zone and why.
+func dnsblLookup(client dnsClient, ip net.IP, zone string) (listed bool, reason string, err error) {
+	name, err := dnsWireName(dnsblName(ip, zone))
+	if err != nil {
+		return false, "", err
+	}
+	m, err := client.query(name, dnsTypeA, false)
+	if err != nil {
+		return false, "", err
+	}
+	if m.Rcode == 3 {
+		return false, "", nil
+	}
+	if m.Rcode != 0 {
+		return false, "", fmt.Errorf("rcode %d", m.Rcode)
+	}
+	var codes []string
+	for _, rr := range m.Answers {
+		if rr.Type != dnsTypeA || len(rr.Data) != 4 {
+			continue
+		}
+		if rr.Data[0] != 127 {
+			continue
+		}
+		// 127.255.255.0/24 is Spamhaus telling us the query was refused,
+		// not that the address is listed.
+		if rr.Data[1] == 255 && rr.Data[2] == 255 {
+			return false, "", fmt.Errorf("query refused (%s)", net.IP(rr.Data))
+		}
+		codes = append(codes, net.IP(rr.Data).String())
+	}
+	if len(codes) == 0 {
+		return false, "", nil
+	}
+	reason = strings.Join(codes, ", ")
+	if txt, err := client.query(name, dnsTypeTXT, false); err == nil {
+		for _, rr := range txt.Answers {
+			if rr.Type == dnsTypeTXT {
+				reason += ": " + rr.String()
+				break
+			}
+		}
+	}
+	return true, reason, nil
+}
+
+// probeDNSBL queries every list for every address and is down when any
+// address is listed, or when no list could be queried at all.
+func probeDNSBL(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	cfg := target.DNSBL
+	if cfg == nil {
+		cfg = &DNSBLCheckConfig{}
+	}
+	u, err := url.Parse(target.URL)
+	if err != nil || u.Scheme != "dnsbl" || u.Hostname() == "" {
+		result.Detail = "dnsbl monitors need a dnsbl://ip or dnsbl://host url"
+		return result
+	}
+	lists := cfg.Lists
+	if len(lists) == 0 {
+		lists = defaultDNSBLs
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	client := dnsClient{target: target, server: dnsServer(target, &DNSCheckConfig{Server: cfg.Server}), timeout: timeout}
+
+	start := time.Now()
+	var ips []net.IP
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		ips = []net.IP{ip}
+	} else if ips, err = net.LookupIP(u.Hostname()); err != nil {
+		result.Latency = Duration(time.Since(start))
+		result.Detail = err.Error()
+		return result
+	}
+
+	var listings, failures []string
+	queried := 0
+	for _, ip := range ips {
+		for _, zone := range lists {
+			listed, reason, err := dnsblLookup(client, ip, zone)
+			switch {
+			case err != nil:
+				failures = append(failures, fmt.Sprintf("%s: %s", zone, err))
+			case listed:
+				queried++
+				listings = append(listings, fmt.Sprintf("%s on %s (%s)", ip, zone, reason))
+			default:
+				queried++
+			}
+		}
+	}
+	result.Latency = Duration(time.Since(start))
+
+	switch {
+	case len(listings) > 0:
+		result.Detail = "listed: " + strings.Join(listings, "; ")
+	case queried == 0:
+		result.Detail = "no list could be queried: " + strings.Join(failures, "; ")
+	default:
+		result.Status = "up"
+		result.Detail = fmt.Sprintf("not listed on %d lists", len(lists))
+		if len(ips) > 1 {
+			result.Detail = fmt.Sprintf("%d addresses %s", len(ips), result.Detail)
+		}
+		if len(failures) > 0 {
+			result.Detail = fmt.Sprintf("not listed in %d of %d lookups; %s", queried, queried+len(failures), strings.Join(failures, "; "))
+		}
+	}
+	return result
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSCacheConfig makes checks resolve host names through an internal cache
+// instead of on every check, and records resolution results apart from the
+// checks' own failures.
+type DNSCacheConfig struct {
+	// Mode is "ttl" (the default) to cache answers for their TTL, "stale"
+	// to also keep using an expired answer while the resolver fails, or
+	// "bypass" to resolve on every check while still recording results.
+	Mode string `json:"mode"`
+	// Server is the resolver queried, as host or host:port. Defaults to the
+	// first nameserver in /etc/resolv.conf.
+	Server string `json:"server"`
+	// MinTTL and MaxTTL clamp the TTLs of answers. MaxTTL defaults to 1h.
+	MinTTL Duration `json:"min_ttl"`
+	MaxTTL Duration `json:"max_ttl"`
+	// StaleFor is how long past its TTL an answer is served in stale mode.
+	// Defaults to 1h.
+	StaleFor Duration `json:"stale_for"`
+	// Timeout bounds each query. Defaults to 5s.
+	Timeout Duration `json:"timeout"`
+}
+
+// DNS cache modes.
+const (
+	dnsCacheTTL    = "ttl"
+	dnsCacheStale  = "stale"
+	dnsCacheBypass = "bypass"
+)
+
+// DNSCacheEntry is what the cache knows about one host name.
+type DNSCacheEntry struct {
+	Host      string    `json:"host"`
+	Addresses []string  `json:"addresses,omitempty"`
+	Resolved  time.Time `json:"resolved,omitempty"`
+	Expires   time.Time `json:"expires,omitempty"`
+	// Lookups counts every resolution asked of the cache, Hits those
+	// answered without querying the resolver, Failures the queries that
+	// failed and StaleServed the failures answered with an expired entry.
+	Lookups     uint64    `json:"lookups"`
+	Hits        uint64    `json:"hits"`
+	Failures    uint64    `json:"failures"`
+	StaleServed uint64    `json:"staleServed"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// resolveError is a failure to resolve a check's host name, as opposed to
+// a failure of the check itself.
+type resolveError struct {
+	host string
+	err  error
+}
+
+func (e *resolveError) Error() string {
+	return fmt.Sprintf("DNS resolution of %s failed: %s", e.host, e.err)
+}
+
+func (e *resolveError) Unwrap() error { return e.err }
+
+type resolverCache struct {
+	config  DNSCacheConfig
+	server  string
+	timeout time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*DNSCacheEntry
+}
+
+// dnsCache is nil unless dns_cache is configured.
+var dnsCache *resolverCache
+
+func newResolverCache(config DNSCacheConfig) (*resolverCache, error) {
+	switch config.Mode {
+	case "":
+		config.Mode = dnsCacheTTL
+	case dnsCacheTTL, dnsCacheStale, dnsCacheBypass:
+	default:
+		return nil, fmt.Errorf("unknown mode %q: use ttl, stale or bypass", config.Mode)
+	}
+	if config.MaxTTL <= 0 {
+		config.MaxTTL = Duration(time.Hour)
+	}
+	if config.MinTTL > config.MaxTTL {
+		return nil, fmt.Errorf("min_ttl must not exceed max_ttl")
+	}
+	if config.StaleFor <= 0 {
+		config.StaleFor = Duration(time.Hour)
+	}
+	c := &resolverCache{config: config, timeout: time.Duration(config.Timeout), entries: make(map[string]*DNSCacheEntry)}
+	if c.timeout <= 0 {
+		c.timeout = 5 * time.Second
+	}
+	c.server = dnsServer(Target{}, &DNSCheckConfig{Server: config.Server})
+	return c, nil
+}
+
+// lookup returns the addresses of host for one of target's checks, IPv4
+// first.
+func (c *resolverCache) lookup(ctx context.Context, target Target, host string) ([]string, error) {
+	now := time.Now()
+	c.mu.Lock()
+	e := c.entries[host]
+	if e == nil {
+		e = &DNSCacheEntry{Host: host}
+		c.entries[host] = e
+	}
+	e.Lookups++
+	if c.config.Mode != dnsCacheBypass && len(e.Addresses) > 0 && now.Before(e.Expires) {
+		e.Hits++
+		addrs := e.Addresses
+		c.mu.Unlock()
+		return addrs, nil
+	}
+	c.mu.Unlock()
+
+	addrs, ttl, err := c.resolve(ctx, target, host)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		e.Failures++
+		e.LastError, e.LastErrorAt = err.Error(), now.UTC()
+		var dnsErr *net.DNSError
+		notFound := errors.As(err, &dnsErr) && dnsErr.IsNotFound
+		if c.config.Mode == dnsCacheStale && !notFound && len(e.Addresses) > 0 &&
+			now.Before(e.Expires.Add(time.Duration(c.config.StaleFor))) {
+			e.StaleServed++
+			return e.Addresses, nil
+		}
+		return nil, &resolveError{host: host, err: err}
+	}
+	ttl = max(ttl, time.Duration(c.config.MinTTL))
+	ttl = min(ttl, time.Duration(c.config.MaxTTL))
+	e.Addresses, e.Resolved, e.Expires = addrs, now.UTC(), now.Add(ttl).UTC()
+	return addrs, nil
+}
+
+// resolve queries the resolver for host's A and AAAA records, returning
+// the addresses and the lowest TTL of the answers. Single-label names,
+// such as localhost, are left to the system resolver, which knows
+// /etc/hosts and search domains, and are cached for MinTTL.
+func (c *resolverCache) resolve(ctx context.Context, target Target, host string) ([]string, time.Duration, error) {
+	if !strings.Contains(host, ".") {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		return addrs, time.Duration(c.config.MinTTL), err
+	}
+	name, err := dnsWireName(host)
+	if err != nil {
+		return nil, 0, err
+	}
+	client := dnsClient{target: target, server: c.server, timeout: c.timeout}
+	var v4, v6 []string
+	ttl := time.Duration(-1)
+	var failures []string
+	for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		m, err := client.query(name, qtype, false)
+		if err != nil {
+			failures = appendUnique(failures, err.Error())
+			continue
+		}
+		switch m.Rcode {
+		case 0:
+		case 3:
+			return nil, 0, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		default:
+			failures = appendUnique(failures, "resolver answered "+dnsRcodes[m.Rcode])
+			continue
+		}
+		for _, rr := range m.Answers {
+			if ttl < 0 || time.Duration(rr.TTL)*time.Second < ttl {
+				ttl = time.Duration(rr.TTL) * time.Second
+			}
+			switch {
+			case rr.Type == dnsTypeA && len(rr.Data) == net.IPv4len:
+				v4 = append(v4, net.IP(rr.Data).String())
+			case rr.Type == dnsTypeAAAA && len(rr.Data) == net.IPv6len:
+				v6 = append(v6, net.IP(rr.Data).String())
+			}
+		}
+	}
+	addrs := append(v4, v6...)
+	if len(addrs) == 0 {
+		if len(failures) > 0 {
+			return nil, 0, errors.New(strings.Join(failures, "; "))
+		}
+		return nil, 0, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	return addrs, max(ttl, 0), nil
+}
+
+// appendUnique appends s to list unless it already holds it, so the A and
+// AAAA queries failing alike are reported once.
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// dial connects to addr, resolving its host through the cache and trying
+// each address in turn.
+func (c *resolverCache) dial(ctx context.Context, dialer *net.Dialer, target Target, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	addrs, err := c.lookup(ctx, target, strings.ToLower(strings.TrimSuffix(host, ".")))
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, ip := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+func (c *resolverCache) list() []DNSCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]DNSCacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		copied := *e
+		copied.Addresses = append([]string(nil), e.Addresses...)
+		out = append(out, copied)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+// dnsCacheHandler serves GET /dns, the cached names and their resolution
+// results.
+func dnsCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	writeJSONCached(w, r, dnsCache.list())
+}
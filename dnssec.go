@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// dnssecAlgorithms names the DNSKEY algorithms that can be validated.
+var dnssecAlgorithms = map[uint8]string{
+	5:  "RSASHA1",
+	7:  "RSASHA1-NSEC3-SHA1",
+	8:  "RSASHA256",
+	10: "RSASHA512",
+	13: "ECDSAP256SHA256",
+	14: "ECDSAP384SHA384",
+	15: "ED25519",
+}
+
+type rrsig struct {
+	TypeCovered uint16
+	Algorithm   uint8
+	Labels      uint8
+	OriginalTTL uint32
+	Expiration  time.Time
+	Inception   time.Time
+	KeyTag      uint16
+	Signer      []byte
+	Signature   []byte
+	// signed is the RDATA before the signature, with the signer name in
+	// canonical form, which the signature covers.
+	signed []byte
+}
+
+func parseRRSIG(rr dnsRR) (rrsig, error) {
+	d := rr.Data
+	if len(d) < 19 {
+		return rrsig{}, errors.New("malformed RRSIG")
+	}
+	signer, next, err := readDNSName(rr.msg, rr.off+18)
+	if err != nil {
+		return rrsig{}, err
+	}
+	end := rr.off + len(d)
+	if next > end {
+		return rrsig{}, errors.New("malformed RRSIG")
+	}
+	return rrsig{
+		TypeCovered: binary.BigEndian.Uint16(d),
+		Algorithm:   d[2],
+		Labels:      d[3],
+		OriginalTTL: binary.BigEndian.Uint32(d[4:]),
+		Expiration:  time.Unix(int64(binary.BigEndian.Uint32(d[8:])), 0).UTC(),
+		Inception:   time.Unix(int64(binary.BigEndian.Uint32(d[12:])), 0).UTC(),
+		KeyTag:      binary.BigEndian.Uint16(d[16:]),
+		Signer:      signer,
+		Signature:   rr.msg[next:end],
+		signed:      append(append([]byte(nil), d[:18]...), signer...),
+	}, nil
+}
+
+type dnskey struct {
+	Flags     uint16
+	Algorithm uint8
+	PublicKey []byte
+	Tag       uint16
+}
+
+func parseDNSKEY(rr dnsRR) (dnskey, error) {
+	d := rr.Data
+	if len(d) < 5 || d[2] != 3 {
+		return dnskey{}, errors.New("malformed DNSKEY")
+	}
+	return dnskey{Flags: binary.BigEndian.Uint16(d), Algorithm: d[3], PublicKey: d[4:], Tag: dnsKeyTag(d)}, nil
+}
+
+// dnsKeyTag computes a DNSKEY's key tag (RFC 4034 appendix B).
+func dnsKeyTag(rdata []byte) uint16 {
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return uint16(ac)
+}
+
+// signedData builds the data sig covers over rrset (RFC 4034 section 6).
+func (sig rrsig) signedData(rrset []dnsRR) ([]byte, error) {
+	owner := rrset[0].Name
+	if labels := dnsLabelCount(owner); int(sig.Labels) < labels {
+		// A wildcard expansion is signed as the wildcard name.
+		for i := 0; i < labels-int(sig.Labels); i++ {
+			owner = owner[1+int(owner[0]):]
+		}
+		owner = append([]byte{1, '*'}, owner...)
+	}
+	var records [][]byte
+	for _, rr := range rrset {
+		data, err := rr.canonicalRData()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, data)
+	}
+	sort.Slice(records, func(i, j int) bool { return bytes.Compare(records[i], records[j]) < 0 })
+
+	out := append([]byte(nil), sig.signed...)
+	for i, data := range records {
+		if i > 0 && bytes.Equal(data, records[i-1]) {
+			continue
+		}
+		out = append(out, owner...)
+		out = binary.BigEndian.AppendUint16(out, rrset[0].Type)
+		out = binary.BigEndian.AppendUint16(out, rrset[0].Class)
+		out = binary.BigEndian.AppendUint32(out, sig.OriginalTTL)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(data)))
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// verify checks sig over rrset with key.
+func (sig rrsig) verify(rrset []dnsRR, key dnskey) error {
+	data, err := sig.signedData(rrset)
+	if err != nil {
+		return err
+	}
+	switch sig.Algorithm {
+	case 5, 7, 8, 10:
+		pub, err := dnskeyRSA(key.PublicKey)
+		if err != nil {
+			return err
+		}
+		var h crypto.Hash
+		var digest []byte
+		switch sig.Algorithm {
+		case 8:
+			sum := sha256.Sum256(data)
+			h, digest = crypto.SHA256, sum[:]
+		case 10:
+			sum := sha512.Sum512(data)
+			h, digest = crypto.SHA512, sum[:]
+		default:
+			sum := sha1.Sum(data)
+			h, digest = crypto.SHA1, sum[:]
+		}
+		return rsa.VerifyPKCS1v15(pub, h, digest, sig.Signature)
+	case 13, 14:
+		curve, size := elliptic.P256(), 32
+		var digest []byte
+		if sig.Algorithm == 14 {
+			curve, size = elliptic.P384(), 48
+			sum := sha512.Sum384(data)
+			digest = sum[:]
+		} else {
+			sum := sha256.Sum256(data)
+			digest = sum[:]
+		}
+		if len(key.PublicKey) != 2*size || len(sig.Signature) != 2*size {
+			return errors.New("malformed ECDSA key or signature")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(key.PublicKey[:size]),
+			Y:     new(big.Int).SetBytes(key.PublicKey[size:]),
+		}
+		r, s := new(big.Int).SetBytes(sig.Signature[:size]), new(big.Int).SetBytes(sig.Signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("signature does not verify")
+		}
+		return nil
+	case 15:
+		if len(key.PublicKey) != ed25519.PublicKeySize {
+			return errors.New("malformed Ed25519 key")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key.PublicKey), data, sig.Signature) {
+			return errors.New("signature does not verify")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %d", sig.Algorithm)
+}
+
+// dnskeyRSA decodes an RSA public key in RFC 3110 format.
+func dnskeyRSA(b []byte) (*rsa.PublicKey, error) {
+	if len(b) < 3 {
+		return nil, errors.New("malformed RSA key")
+	}
+	n, off := int(b[0]), 1
+	if n == 0 {
+		n, off = int(binary.BigEndian.Uint16(b[1:])), 3
+	}
+	if n > 4 || off+n >= len(b) {
+		return nil, errors.New("unsupported RSA key")
+	}
+	e := 0
+	for _, c := range b[off : off+n] {
+		e = e<<8 | int(c)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(b[off+n:]), E: e}, nil
+}
+
+// rrsetKey identifies an RRset by owner and type.
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+// groupRRsets splits records into RRsets and the signatures covering each.
+func groupRRsets(records []dnsRR) (order []rrsetKey, sets map[rrsetKey][]dnsRR, sigs map[rrsetKey][]rrsig, err error) {
+	sets = make(map[rrsetKey][]dnsRR)
+	sigs = make(map[rrsetKey][]rrsig)
+	for _, rr := range records {
+		if rr.Type == dnsTypeRRSIG {
+			sig, err := parseRRSIG(rr)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			k := rrsetKey{string(rr.Name), sig.TypeCovered}
+			sigs[k] = append(sigs[k], sig)
+			continue
+		}
+		k := rrsetKey{string(rr.Name), rr.Type}
+		if _, ok := sets[k]; !ok {
+			order = append(order, k)
+		}
+		sets[k] = append(sets[k], rr)
+	}
+	return order, sets, sigs, nil
+}
+
+// verifyRRset checks that one of sigs is current and verifies rrset with
+// one of keys, returning the signature used.
+func verifyRRset(rrset []dnsRR, sigs []rrsig, keys []dnskey, now time.Time) (rrsig, error) {
+	name := fmt.Sprintf("%s %s", dnsNameString(rrset[0].Name), dnsTypeName(rrset[0].Type))
+	if len(sigs) == 0 {
+		return rrsig{}, fmt.Errorf("no RRSIG for %s; is the zone signed?", name)
+	}
+	var lastErr error
+	for _, sig := range sigs {
+		if _, ok := dnssecAlgorithms[sig.Algorithm]; !ok {
+			lastErr = fmt.Errorf("RRSIG for %s uses unsupported algorithm %d", name, sig.Algorithm)
+			continue
+		}
+		if now.After(sig.Expiration) {
+			lastErr = fmt.Errorf("RRSIG for %s expired %s", name, sig.Expiration.Format(time.RFC3339))
+			continue
+		}
+		if now.Before(sig.Inception) {
+			lastErr = fmt.Errorf("RRSIG for %s is not valid until %s", name, sig.Inception.Format(time.RFC3339))
+			continue
+		}
+		lastErr = fmt.Errorf("no DNSKEY %d for RRSIG over %s", sig.KeyTag, name)
+		for _, key := range keys {
+			if key.Tag != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if err := sig.verify(rrset, key); err != nil {
+				lastErr = fmt.Errorf("RRSIG for %s does not verify with key %d: %w", name, key.Tag, err)
+				continue
+			}
+			return sig, nil
+		}
+	}
+	return rrsig{}, lastErr
+}
+
+// validateDNSSEC verifies the signatures over every RRset in answers using
+// the signer zones' DNSKEY sets, which must themselves be self-signed. It
+// does not follow the chain of trust up to the root.
+func validateDNSSEC(client dnsClient, answers []dnsRR, minValidity time.Duration) (string, error) {
+	order, sets, sigs, err := groupRRsets(answers)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	zoneKeys := make(map[string][]dnskey)
+	var earliest rrsig
+	for _, k := range order {
+		covering := sigs[k]
+		if len(covering) == 0 {
+			return "", fmt.Errorf("no RRSIG for %s %s; is the zone signed?", dnsNameString([]byte(k.name)), dnsTypeName(k.rtype))
+		}
+		signer := covering[0].Signer
+		keys, ok := zoneKeys[string(signer)]
+		if !ok {
+			keys, err = fetchDNSKEYs(client, signer, now)
+			if err != nil {
+				return "", err
+			}
+			zoneKeys[string(signer)] = keys
+		}
+		sig, err := verifyRRset(sets[k], covering, keys, now)
+		if err != nil {
+			return "", err
+		}
+		if earliest.Expiration.IsZero() || sig.Expiration.Before(earliest.Expiration) {
+			earliest = sig
+		}
+	}
+	left := earliest.Expiration.Sub(now)
+	if minValidity > 0 && left < minValidity {
+		return "", fmt.Errorf("RRSIG by %s expires in %s, under %s", dnsNameString(earliest.Signer), formatDays(left), formatDays(minValidity))
+	}
+	return fmt.Sprintf("DNSSEC valid, signed by %s key %d (%s), expires in %s",
+		dnsNameString(earliest.Signer), earliest.KeyTag, dnssecAlgorithms[earliest.Algorithm], formatDays(left)), nil
+}
+
+// fetchDNSKEYs looks up zone's DNSKEY set and verifies it is signed by one
+// of its own keys.
+func fetchDNSKEYs(client dnsClient, zone []byte, now time.Time) ([]dnskey, error) {
+	m, err := client.query(zone, dnsTypeDNSKEY, true)
+	if err != nil {
+		return nil, fmt.Errorf("DNSKEY lookup for %s: %w", dnsNameString(zone), err)
+	}
+	if m.Rcode != 0 {
+		return nil, fmt.Errorf("DNSKEY lookup for %s: rcode %d", dnsNameString(zone), m.Rcode)
+	}
+	var rrset []dnsRR
+	var sigs []rrsig
+	var keys []dnskey
+	for _, rr := range m.Answers {
+		if !bytes.Equal(rr.Name, zone) {
+			continue
+		}
+		switch rr.Type {
+		case dnsTypeDNSKEY:
+			key, err := parseDNSKEY(rr)
+			if err != nil {
+				return nil, err
+			}
+			rrset = append(rrset, rr)
+			keys = append(keys, key)
+		case dnsTypeRRSIG:
+			sig, err := parseRRSIG(rr)
+			if err != nil {
+				return nil, err
+			}
+			if sig.TypeCovered == dnsTypeDNSKEY {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no DNSKEY records for %s", dnsNameString(zone))
+	}
+	if _, err := verifyRRset(rrset, sigs, keys, now); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
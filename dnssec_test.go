@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The Ed25519 example of RFC 8080 section 6: example.com's MX RRset,
+// signed with key tag 3613 and valid from 1438207200 to 1440021600.
+const (
+	rfc8080Key = "l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4="
+	rfc8080Sig = "oL9krJun7xfBOIWcGHi7mag5/hdZrKWw15jPGrHpjQeRAvTdszaPD+QLs3fx8A4M3e23mRZ9VrbpMngwcrqNAg=="
+)
+
+// rrsigData encodes RRSIG RDATA over example.com with the given fields.
+func rrsigData(covered uint16, alg uint8, inception, expiration uint32, tag uint16, sig []byte) []byte {
+	d := binary.BigEndian.AppendUint16(nil, covered)
+	d = append(d, alg, 2)
+	d = binary.BigEndian.AppendUint32(d, 3600)
+	d = binary.BigEndian.AppendUint32(d, expiration)
+	d = binary.BigEndian.AppendUint32(d, inception)
+	d = binary.BigEndian.AppendUint16(d, tag)
+	d = append(d, "\x07example\x03com\x00"...)
+	return append(d, sig...)
+}
+
+// dnskeyRR builds a zone key record for example.com.
+func dnskeyRR(alg uint8, pub []byte) dnsRR {
+	data := append([]byte{1, 1, 3, alg}, pub...)
+	return dnsRR{Name: []byte("\x07example\x03com\x00"), Type: dnsTypeDNSKEY, Class: dnsClassIN, TTL: 3600, Data: data, msg: data}
+}
+
+// signedMX parses a response holding example.com's MX record, with the
+// exchange compressed and in upper case, and the given RRSIG.
+func signedMX(t *testing.T, preference byte, sig []byte) ([]dnsRR, []rrsig) {
+	t.Helper()
+	mx := append([]byte{0, preference}, "\x04MAIL\xc0\x0c"...)
+	m, err := parseDNSMessage(dnsResponse(1, dnsAnswer(dnsTypeMX, mx), dnsAnswer(dnsTypeRRSIG, sig)), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, sets, sigs, err := groupRRsets(m.Answers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 1 {
+		t.Fatalf("%d RRsets, want the MX RRset", len(order))
+	}
+	return sets[order[0]], sigs[order[0]]
+}
+
+func TestDNSSECKnownGoodRRset(t *testing.T) {
+	pub, _ := base64.StdEncoding.DecodeString(rfc8080Key)
+	signature, _ := base64.StdEncoding.DecodeString(rfc8080Sig)
+	key, err := parseDNSKEY(dnskeyRR(15, pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Tag != 3613 {
+		t.Errorf("key tag %d, want 3613", key.Tag)
+	}
+	valid := time.Unix(1439000000, 0)
+	good := rrsigData(dnsTypeMX, 15, 1438207200, 1440021600, 3613, signature)
+
+	rrset, sigs := signedMX(t, 10, good)
+	if _, err := verifyRRset(rrset, sigs, []dnskey{key}, valid); err != nil {
+		t.Fatalf("RFC 8080 example does not verify: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		pref byte
+		sig  []byte
+		keys []dnskey
+		now  time.Time
+		want string
+	}{
+		{"altered record", 20, good, []dnskey{key}, valid, "does not verify"},
+		{"expired", 10, good, []dnskey{key}, time.Unix(1440021601, 0), "expired"},
+		{"not yet valid", 10, good, []dnskey{key}, time.Unix(1438207199, 0), "not valid until"},
+		{"unknown key", 10, rrsigData(dnsTypeMX, 15, 1438207200, 1440021600, 1, signature), []dnskey{key}, valid, "no DNSKEY 1"},
+		{"unsupported algorithm", 10, rrsigData(dnsTypeMX, 3, 1438207200, 1440021600, 3613, signature), []dnskey{key}, valid, "unsupported algorithm"},
+	}
+	for _, tt := range tests {
+		rrset, sigs := signedMX(t, tt.pref, tt.sig)
+		_, err := verifyRRset(rrset, sigs, tt.keys, tt.now)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := verifyRRset(rrset, nil, []dnskey{key}, valid); err == nil || !strings.Contains(err.Error(), "is the zone signed") {
+		t.Errorf("unsigned RRset: got %v", err)
+	}
+}
+
+func TestDNSSECECDSA(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := append(priv.X.FillBytes(make([]byte, 32)), priv.Y.FillBytes(make([]byte, 32))...)
+	key, err := parseDNSKEY(dnskeyRR(13, pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The signed data of RFC 4034 section 3.1.8.1, built by hand.
+	unsigned := rrsigData(dnsTypeMX, 13, 1438207200, 1440021600, key.Tag, nil)
+	data := append([]byte(nil), unsigned...)
+	data = append(data, "\x07example\x03com\x00"...)
+	data = append(data, 0, dnsTypeMX, 0, dnsClassIN, 0, 0, 0x0e, 0x10, 0, 20)
+	data = append(data, 0, 10)
+	data = append(data, "\x04mail\x07example\x03com\x00"...)
+	sum := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, priv, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	rrset, sigs := signedMX(t, 10, append(unsigned, sig...))
+	if _, err := verifyRRset(rrset, sigs, []dnskey{key}, time.Unix(1439000000, 0)); err != nil {
+		t.Errorf("ECDSA P-256 signature does not verify: %v", err)
+	}
+}
+
+func TestDNSSECMalformedRecords(t *testing.T) {
+	if _, err := parseRRSIG(dnsRR{Type: dnsTypeRRSIG, Data: make([]byte, 18)}); err == nil {
+		t.Error("short RRSIG accepted")
+	}
+	if _, err := parseDNSKEY(dnsRR{Type: dnsTypeDNSKEY, Data: []byte{1, 1, 2, 15, 0}}); err == nil {
+		t.Error("DNSKEY with protocol 2 accepted")
+	}
+	for _, b := range [][]byte{{1}, {5, 1, 0, 1}, {0, 0, 9, 1, 2}} {
+		if _, err := dnskeyRSA(b); err == nil {
+			t.Errorf("RSA key %x accepted", b)
+		}
+	}
+	if _, err := dnskeyRSA([]byte{3, 1, 0, 1, 0xc5, 0x3f}); err != nil {
+		t.Errorf("well-formed RSA key: %v", err)
+	}
+}
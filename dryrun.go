@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dryRun is set by --dry-run. Checks, state changes and notification
+// rendering all run as usual, but every outbound delivery is logged instead
+// of sent, so a configuration can be tried out without paging anyone.
+var dryRun bool
+
+// dryRunSkip logs what channel would have sent to dest and reports whether
+// the caller must skip the real delivery.
+func dryRunSkip(channel, dest string, payload []byte) bool {
+	if !dryRun {
+		return false
+	}
+	body := strings.TrimRight(strings.ReplaceAll(string(payload), "\r\n", "\n"), "\n")
+	if len(body) > 2048 {
+		body = body[:2048] + "…"
+	}
+	fmt.Printf("[dry-run] %s to %s:\n%s\n", channel, dest, indent(body))
+	return true
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(s, "\n", "\n    ")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ElasticsearchCheckConfig configures "elasticsearch" monitors, whose url
+// is the cluster's base url, e.g. https://es.example.com:9200. OpenSearch
+// serves the same API.
+type ElasticsearchCheckConfig struct {
+	// Username and Password authenticate with HTTP basic auth, or APIKey
+	// with an Elasticsearch API key (the base64 "id:key" form).
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	APIKey   string `json:"api_key,omitempty"`
+	// YellowDown counts a yellow cluster as down instead of raising a
+	// degraded alert while it stays up.
+	YellowDown bool `json:"yellow_down,omitempty"`
+	// Timeout bounds the request. Defaults to 10s.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+const elasticsearchType = "elasticsearch"
+
+func (c *ElasticsearchCheckConfig) validate() error {
+	if c.APIKey != "" && (c.Username != "" || c.Password != "") {
+		return fmt.Errorf("set username and password or api_key, not both")
+	}
+	return nil
+}
+
+type clusterHealth struct {
+	ClusterName      string `json:"cluster_name"`
+	Status           string `json:"status"`
+	Nodes            int    `json:"number_of_nodes"`
+	UnassignedShards int    `json:"unassigned_shards"`
+}
+
+// clusterHealthTracker remembers which clusters were last yellow so that a
+// degraded alert is raised once when a cluster turns yellow and resolved
+// when it turns green again.
+type clusterHealthTracker struct {
+	mu     sync.Mutex
+	yellow map[string]bool
+}
+
+var clusterHealths = &clusterHealthTracker{yellow: make(map[string]bool)}
+
+func (c *clusterHealthTracker) observe(target Target, health clusterHealth) {
+	isYellow := health.Status == "yellow"
+	c.mu.Lock()
+	wasYellow := c.yellow[target.URL]
+	c.yellow[target.URL] = isYellow
+	c.mu.Unlock()
+	if isYellow == wasYellow || health.Status == "red" {
+		return
+	}
+	n := notification{Kind: notifyCluster, Target: target, Time: time.Now().UTC()}
+	if isYellow {
+		n.Status = "degraded"
+		n.Detail = fmt.Sprintf("Cluster %s behind %s is yellow with %d unassigned shards", health.ClusterName, target.displayName(), health.UnassignedShards)
+	} else {
+		n.Status = alertResolved
+		n.Detail = fmt.Sprintf("Cluster %s behind %s is green again", health.ClusterName, target.displayName())
+	}
+	fmt.Println(n.Detail)
+	enqueueNotification(n)
+}
+
+// probeElasticsearch fetches _cluster/health. Green is up and red is down;
+// yellow is up, but raises a degraded alert.
+func probeElasticsearch(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	cfg := target.Elasticsearch
+	if cfg == nil {
+		cfg = &ElasticsearchCheckConfig{}
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	healthTarget := target
+	healthTarget.URL = strings.TrimSuffix(target.URL, "/") + "/_cluster/health"
+	req, err := newCheckRequest(http.MethodGet, healthTarget, nil)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+	switch {
+	case cfg.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+cfg.APIKey)
+	case cfg.Username != "":
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+
+	start := time.Now()
+	resp, err := checkClient(target).Do(req)
+	if err != nil {
+		result.Latency = Duration(time.Since(start))
+		result.Detail = err.Error()
+		return result
+	}
+	body, err := readBody(resp, target.bodyLimit(expectMaxBody))
+	result.Latency = Duration(time.Since(start))
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		result.Detail = resp.Status + ": check the monitor's credentials"
+		return result
+	}
+	// Some versions answer a red cluster with 503, still with the health
+	// in the body.
+	var health clusterHealth
+	if err := json.Unmarshal(body, &health); err != nil || health.Status == "" {
+		result.Detail = resp.Status + ": not a cluster health response"
+		return result
+	}
+
+	result.Detail = fmt.Sprintf("%s, %d nodes, %d unassigned shards", health.Status, health.Nodes, health.UnassignedShards)
+	switch health.Status {
+	case "green":
+		result.Status = "up"
+	case "yellow":
+		if !cfg.YellowDown {
+			result.Status = "up"
+		}
+	}
+	if !cfg.YellowDown {
+		clusterHealths.observe(target, health)
+	}
+	return result
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// This file implements the small expression language used by a monitor's
+// expect setting, e.g.
+//
+//	status == 200 && latency < 800ms && body.contains("healthy")
+//
+// Values are numbers, durations, strings, booleans and the headers map.
+// Operators are || && ! == != < <= > >= and parentheses; strings have
+// contains, startsWith, endsWith and matches methods, and size(x) gives a
+// string's length. headers["Name"] looks up a response header.
+
+type exprNode interface {
+	eval(env exprEnv) (any, error)
+}
+
+// exprEnv holds the variables available to an expression.
+type exprEnv map[string]any
+
+type exprLiteral struct{ value any }
+
+type exprIdent struct{ name string }
+
+type exprUnary struct {
+	op string
+	x  exprNode
+}
+
+type exprBinary struct {
+	op   string
+	x, y exprNode
+}
+
+type exprIndex struct {
+	x, key exprNode
+}
+
+type exprCall struct {
+	// recv is nil for plain function calls.
+	recv exprNode
+	name string
+	args []exprNode
+}
+
+type exprToken struct {
+	kind string // "num", "dur", "str", "ident", "op", "eof"
+	text string
+	pos  int
+}
+
+func tokenizeExpr(src string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			// A unit suffix makes a duration, which may have several
+			// parts, e.g. 1m30s.
+			k := j
+			for k < len(src) && unicode.IsLetter(rune(src[k])) {
+				k++
+				for k < len(src) && unicode.IsLetter(rune(src[k])) {
+					k++
+				}
+				for k < len(src) && (src[k] >= '0' && src[k] <= '9' || src[k] == '.') {
+					k++
+				}
+			}
+			if k > j {
+				toks = append(toks, exprToken{"dur", src[i:k], i})
+			} else {
+				toks = append(toks, exprToken{"num", src[i:j], i})
+			}
+			i = k
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			text := src[i : j+1]
+			if c == '\'' {
+				text = `"` + strings.ReplaceAll(text[1:len(text)-1], `"`, `\"`) + `"`
+			}
+			s, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("bad string at %d", i)
+			}
+			toks = append(toks, exprToken{"str", s, i})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, exprToken{"ident", src[i:j], i})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ".", ","} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			toks = append(toks, exprToken{"op", op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, exprToken{"eof", "", len(src)}), nil
+}
+
+type exprParser struct {
+	toks []exprToken
+	pos  int
+}
+
+// compileExpr parses src into an expression tree.
+func compileExpr(src string) (exprNode, error) {
+	toks, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks}
+	n, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+func (p *exprParser) peek() exprToken { return p.toks[p.pos] }
+
+func (p *exprParser) next() exprToken {
+	t := p.toks[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *exprParser) expect(op string) error {
+	if t := p.next(); t.kind != "op" || t.text != op {
+		return fmt.Errorf("expected %q at %d", op, t.pos)
+	}
+	return nil
+}
+
+var exprPrecedence = map[string]int{
+	"||": 1, "&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+}
+
+func (p *exprParser) parseBinary(minPrec int) (exprNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := exprPrecedence[t.text]
+		if t.kind != "op" || !ok || prec <= minPrec {
+			return x, nil
+		}
+		p.next()
+		y, err := p.parseBinary(prec)
+		if err != nil {
+			return nil, err
+		}
+		x = exprBinary{op: t.text, x: x, y: y}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if t := p.peek(); t.kind == "op" && t.text == "!" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprUnary{op: "!", x: x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == "op" && t.text == "[":
+			p.next()
+			key, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = exprIndex{x: x, key: key}
+		case t.kind == "op" && t.text == ".":
+			p.next()
+			name := p.next()
+			if name.kind != "ident" {
+				return nil, fmt.Errorf("expected method name at %d", name.pos)
+			}
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			x = exprCall{recv: x, name: name.text, args: args}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *exprParser) parseArgs() ([]exprNode, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []exprNode
+	if t := p.peek(); t.kind == "op" && t.text == ")" {
+		p.next()
+		return args, nil
+	}
+	for {
+		a, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+		t := p.next()
+		if t.kind == "op" && t.text == ")" {
+			return args, nil
+		}
+		if t.kind != "op" || t.text != "," {
+			return nil, fmt.Errorf("expected \",\" or \")\" at %d", t.pos)
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case "num":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q at %d", t.text, t.pos)
+		}
+		return exprLiteral{f}, nil
+	case "dur":
+		d, err := time.ParseDuration(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("bad duration %q at %d", t.text, t.pos)
+		}
+		return exprLiteral{d}, nil
+	case "str":
+		return exprLiteral{t.text}, nil
+	case "ident":
+		switch t.text {
+		case "true":
+			return exprLiteral{true}, nil
+		case "false":
+			return exprLiteral{false}, nil
+		}
+		if n := p.peek(); n.kind == "op" && n.text == "(" {
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			return exprCall{name: t.text, args: args}, nil
+		}
+		return exprIdent{t.text}, nil
+	case "op":
+		if t.text == "(" {
+			x, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	if t.kind == "eof" {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (n exprLiteral) eval(env exprEnv) (any, error) { return n.value, nil }
+
+func (n exprIdent) eval(env exprEnv) (any, error) {
+	v, ok := env[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %q", n.name)
+	}
+	return v, nil
+}
+
+func (n exprUnary) eval(env exprEnv) (any, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := x.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! needs a boolean, got %T", x)
+	}
+	return !b, nil
+}
+
+func (n exprBinary) eval(env exprEnv) (any, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" || n.op == "||" {
+		xb, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs booleans, got %T", n.op, x)
+		}
+		if (n.op == "&&" && !xb) || (n.op == "||" && xb) {
+			return xb, nil
+		}
+		y, err := n.y.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		yb, ok := y.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs booleans, got %T", n.op, y)
+		}
+		return yb, nil
+	}
+
+	y, err := n.y.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	var cmp int
+	switch xv := x.(type) {
+	case float64:
+		yv, ok := y.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare a number with %T", y)
+		}
+		cmp = compareOrdered(xv, yv)
+	case time.Duration:
+		yv, ok := y.(time.Duration)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare a duration with %T; write e.g. 800ms", y)
+		}
+		cmp = compareOrdered(xv, yv)
+	case string:
+		yv, ok := y.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare a string with %T", y)
+		}
+		cmp = strings.Compare(xv, yv)
+	case bool:
+		yv, ok := y.(bool)
+		if !ok || (n.op != "==" && n.op != "!=") {
+			return nil, fmt.Errorf("booleans only support == and !=")
+		}
+		if xv != yv {
+			cmp = 1
+		}
+	default:
+		return nil, fmt.Errorf("cannot compare %T", x)
+	}
+	switch n.op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func compareOrdered[T float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (n exprIndex) eval(env exprEnv) (any, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := x.(map[string]string)
+	k, kok := key.(string)
+	if !ok || !kok {
+		return nil, fmt.Errorf("only headers[\"Name\"] can be indexed")
+	}
+	return m[strings.ToLower(k)], nil
+}
+
+func (n exprCall) eval(env exprEnv) (any, error) {
+	var args []any
+	for _, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	if n.recv == nil {
+		if n.name == "size" && len(args) == 1 {
+			if s, ok := args[0].(string); ok {
+				return float64(len(s)), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown function %s", n.name)
+	}
+
+	recv, err := n.recv.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := recv.(string)
+	if !ok || len(args) != 1 {
+		return nil, fmt.Errorf("%s takes a string receiver and one argument", n.name)
+	}
+	arg, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s needs a string argument", n.name)
+	}
+	switch n.name {
+	case "contains":
+		return strings.Contains(s, arg), nil
+	case "startsWith":
+		return strings.HasPrefix(s, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(s, arg), nil
+	case "matches":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	}
+	return nil, fmt.Errorf("unknown method %s", n.name)
+}
+
+// checkEnv returns the variables available to a check expression.
+func checkEnv(status int, latency time.Duration, body string, header map[string][]string) exprEnv {
+	headers := make(map[string]string, len(header))
+	for k, v := range header {
+		if len(v) > 0 {
+			headers[strings.ToLower(k)] = v[0]
+		}
+	}
+	return exprEnv{"status": float64(status), "latency": latency, "body": body, "headers": headers}
+}
+
+// validateCondition compiles src and evaluates it against an empty response
+// to catch unknown names and type errors at startup.
+func validateCondition(src string) error {
+	_, err := evalCondition(src, checkEnv(200, 0, "", nil))
+	return err
+}
+
+// evalCondition evaluates src and requires a boolean result.
+func evalCondition(src string, env exprEnv) (bool, error) {
+	n, err := compileExpr(src)
+	if err != nil {
+		return false, err
+	}
+	v, err := n.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression must be true or false, got %T", v)
+	}
+	return b, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Failure classes of a down check result, so triage can start from the
+// alert: was the name unresolvable, the port closed, the handshake broken,
+// the server too slow, or did it answer wrongly?
+const (
+	failureDNS       = "dns"
+	failureRefused   = "connection_refused"
+	failureConnect   = "connection"
+	failureTLS       = "tls"
+	failureTimeout   = "timeout"
+	failureStatus    = "http_status"
+	failureAssertion = "assertion"
+	// failureOther covers everything else, such as a failed login step or
+	// a check type's own protocol errors.
+	failureOther = "other"
+)
+
+// classifyError returns the failure class of an error from making a
+// request or reading its response.
+func classifyError(err error) string {
+	var resolveErr *resolveError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &resolveErr), errors.As(err, &dnsErr):
+		return failureDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return failureTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return failureRefused
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &certErr),
+		errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), errors.As(err, &invalidErr),
+		strings.Contains(err.Error(), "tls: "):
+		return failureTLS
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EHOSTUNREACH),
+		errors.Is(err, syscall.ENETUNREACH), errors.As(err, new(*net.OpError)):
+		return failureConnect
+	}
+	return failureOther
+}
+
+// failureMessages are the catalog IDs of the failure classes shown in
+// alerts. Other failures are left to the detail.
+var failureMessages = map[string]string{
+	failureDNS:       "cause.dns",
+	failureRefused:   "cause.refused",
+	failureConnect:   "cause.connect",
+	failureTLS:       "cause.tls",
+	failureTimeout:   "cause.timeout",
+	failureStatus:    "cause.status",
+	failureAssertion: "cause.assertion",
+}
+
+// describeFailure prefixes detail with the label of class, if it has one.
+func describeFailure(class, detail string) string {
+	id, ok := failureMessages[class]
+	if !ok {
+		return detail
+	}
+	return "[" + message(defaultLocale, id) + "] " + detail
+}
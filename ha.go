@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// HAConfig enables active/standby operation. Every instance pointed at the
+// same lease competes for it; only the holder runs checks and sends alerts.
+type HAConfig struct {
+	// LeaseFile is a path on storage shared by all instances.
+	LeaseFile string `json:"lease_file"`
+	// NodeID must be unique per instance. Defaults to the hostname.
+	NodeID string `json:"node_id"`
+	// LeaseTTL is how long a lease stays valid without renewal, and so
+	// roughly how long a standby waits before taking over. Defaults to half
+	// the check interval.
+	LeaseTTL Duration `json:"lease_ttl"`
+}
+
+// leaseBackend is a shared lock that at most one node holds at a time.
+type leaseBackend interface {
+	// tryAcquire takes or renews the lease for node until expires and
+	// reports whether node now holds it.
+	tryAcquire(node string, expires time.Time) (bool, error)
+}
+
+type leaseRecord struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// fileLease stores the lease as a small JSON file, replaced atomically by
+// rename. Nodes must have reasonably synchronized clocks.
+type fileLease struct {
+	path string
+}
+
+func (f fileLease) read() (leaseRecord, error) {
+	var rec leaseRecord
+	b, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rec, nil
+	}
+	if err != nil {
+		return rec, err
+	}
+	err = json.Unmarshal(b, &rec)
+	return rec, err
+}
+
+func (f fileLease) tryAcquire(node string, expires time.Time) (bool, error) {
+	rec, err := f.read()
+	if err != nil {
+		return false, err
+	}
+	if rec.Holder != node && time.Now().Before(rec.Expires) {
+		return false, nil
+	}
+
+	b, err := json.Marshal(leaseRecord{Holder: node, Expires: expires})
+	if err != nil {
+		return false, err
+	}
+	tmp := fmt.Sprintf("%s.%s.tmp", f.path, filepath.Base(node))
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return false, err
+	}
+
+	// Two standbys may both have seen an expired lease; whoever renamed last
+	// wins, so read back to find out.
+	time.Sleep(100 * time.Millisecond)
+	rec, err = f.read()
+	if err != nil {
+		return false, err
+	}
+	return rec.Holder == node, nil
+}
+
+type leaderElector struct {
+	backend leaseBackend
+	node    string
+	ttl     time.Duration
+	leader  atomic.Bool
+}
+
+// elector is nil when HA is disabled, in which case this instance always
+// acts as leader.
+var elector *leaderElector
+
+func isLeader() bool {
+	return elector == nil || elector.leader.Load()
+}
+
+func newLeaderElector(config Config) *leaderElector {
+	if config.HA.LeaseFile == "" {
+		return nil
+	}
+	node := config.HA.NodeID
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+	ttl := time.Duration(config.HA.LeaseTTL)
+	if ttl <= 0 {
+		ttl = time.Duration(config.Interval) / 2
+	}
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &leaderElector{backend: fileLease{path: config.HA.LeaseFile}, node: node, ttl: ttl}
+}
+
+// step makes one attempt to take or renew the lease.
+func (e *leaderElector) step() {
+	ok, err := e.backend.tryAcquire(e.node, time.Now().Add(e.ttl))
+	if err != nil {
+		fmt.Println("Error updating HA lease:", err)
+		ok = false
+	}
+	if ok != e.leader.Load() {
+		if ok {
+			fmt.Printf("Node %s is now the leader\n", e.node)
+		} else {
+			fmt.Printf("Node %s is now on standby\n", e.node)
+		}
+		e.leader.Store(ok)
+	}
+}
+
+// run renews or contends for the lease several times per TTL so a standby
+// takes over shortly after the leader's lease lapses.
+func (e *leaderElector) run() {
+	for {
+		time.Sleep(e.ttl / 3)
+		e.step()
+	}
+}
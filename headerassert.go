@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// HeaderAssertion is a check on one response header. With only Name set,
+// the header must be present.
+type HeaderAssertion struct {
+	Name string `json:"name"`
+	// Equals is the exact value required.
+	Equals string `json:"equals,omitempty"`
+	// Matches is a regular expression the value must match.
+	Matches string `json:"matches,omitempty"`
+	// Absent requires the header not to be sent at all.
+	Absent bool `json:"absent,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (a *HeaderAssertion) compile() error {
+	if a.Name == "" {
+		return fmt.Errorf("header assertion has no name")
+	}
+	if a.Absent && (a.Equals != "" || a.Matches != "") {
+		return fmt.Errorf("header %s cannot be both absent and have a value", a.Name)
+	}
+	if a.Matches != "" {
+		re, err := regexp.Compile(a.Matches)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", a.Name, err)
+		}
+		a.re = re
+	}
+	return nil
+}
+
+// check returns why h fails the assertion, or "" if it holds. Of several
+// values for the header, any one satisfying it is enough.
+func (a HeaderAssertion) check(h http.Header) string {
+	values := h.Values(a.Name)
+	if a.Absent {
+		if len(values) > 0 {
+			return fmt.Sprintf("header %s is present", a.Name)
+		}
+		return ""
+	}
+	if len(values) == 0 {
+		return fmt.Sprintf("header %s is missing", a.Name)
+	}
+	for _, v := range values {
+		if (a.Equals == "" || v == a.Equals) && (a.re == nil || a.re.MatchString(v)) {
+			return ""
+		}
+	}
+	var want string
+	if a.Equals != "" {
+		want = fmt.Sprintf("%q", a.Equals)
+	}
+	if a.re != nil {
+		if want != "" {
+			want += " and "
+		}
+		want += "/" + a.Matches + "/"
+	}
+	return fmt.Sprintf("header %s is %q, want %s", a.Name, values[0], want)
+}
+
+// checkResponseHeaders returns the first failed assertion, or "".
+func checkResponseHeaders(assertions []HeaderAssertion, h http.Header) string {
+	for _, a := range assertions {
+		if failure := a.check(h); failure != "" {
+			return failure
+		}
+	}
+	return ""
+}
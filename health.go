@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthCheckConfig configures "health" monitors, whose url is a health
+// endpoint reporting the status of the service's components.
+type HealthCheckConfig struct {
+	// Format is "spring" for Spring Boot's /actuator/health, "healthz" for
+	// Kubernetes-style /healthz?verbose output, "haproxy" for HAProxy's
+	// stats CSV, or "auto" (the default) to tell them apart by content
+	// type.
+	Format string `json:"format,omitempty"`
+	// DegradedDown counts a degraded service as down instead of raising a
+	// degraded alert while it stays up.
+	DegradedDown bool `json:"degraded_down,omitempty"`
+}
+
+const healthType = "health"
+
+// Health formats.
+const (
+	healthAuto    = "auto"
+	healthSpring  = "spring"
+	healthHealthz = "healthz"
+	healthHAProxy = "haproxy"
+)
+
+// Component statuses. Degraded is a component that works but not fully,
+// such as a backend with some of its servers down.
+const (
+	componentUp       = "up"
+	componentDegraded = "degraded"
+	componentDown     = "down"
+)
+
+func (c *HealthCheckConfig) validate() error {
+	switch c.Format {
+	case "", healthAuto, healthSpring, healthHealthz, healthHAProxy:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q: use auto, spring, healthz or haproxy", c.Format)
+}
+
+// HealthComponent is the status of one part of a service, as its health
+// endpoint reports it.
+type HealthComponent struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// healthReport is a parsed health response.
+type healthReport struct {
+	// status is the service's own verdict: componentUp or componentDown.
+	status     string
+	components []HealthComponent
+}
+
+// healthFormat picks the parser for a response with contentType and body.
+func healthFormat(contentType string, body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case strings.Contains(contentType, "csv") || bytes.HasPrefix(trimmed, []byte("# pxname")):
+		return healthHAProxy
+	case strings.Contains(contentType, "json") || bytes.HasPrefix(trimmed, []byte("{")):
+		return healthSpring
+	}
+	return healthHealthz
+}
+
+// springStatus maps a Spring Boot health status to a component status.
+func springStatus(s string) string {
+	switch strings.ToUpper(s) {
+	case "UP":
+		return componentUp
+	case "DOWN", "OUT_OF_SERVICE":
+		return componentDown
+	}
+	return componentDegraded
+}
+
+// parseSpringHealth reads Spring Boot's health JSON, whose components are
+// under "components" since Boot 2.2 and "details" before.
+func parseSpringHealth(body []byte) (healthReport, error) {
+	type component struct {
+		Status  string         `json:"status"`
+		Details map[string]any `json:"details"`
+	}
+	var h struct {
+		Status     string                     `json:"status"`
+		Components map[string]json.RawMessage `json:"components"`
+		Details    map[string]json.RawMessage `json:"details"`
+	}
+	if err := json.Unmarshal(body, &h); err != nil || h.Status == "" {
+		return healthReport{}, fmt.Errorf("not a Spring Boot health response")
+	}
+	report := healthReport{status: springStatus(h.Status)}
+	if report.status == componentDegraded {
+		report.status = componentUp
+	}
+	raw := h.Components
+	if raw == nil {
+		raw = h.Details
+	}
+	for name, msg := range raw {
+		var c component
+		if json.Unmarshal(msg, &c) != nil || c.Status == "" {
+			continue
+		}
+		hc := HealthComponent{Name: name, Status: springStatus(c.Status)}
+		if hc.Status != componentUp {
+			hc.Detail = c.Status
+			if e, ok := c.Details["error"].(string); ok {
+				hc.Detail += ": " + e
+			}
+		}
+		report.components = append(report.components, hc)
+	}
+	return report, nil
+}
+
+// parseHealthz reads verbose healthz output, a "[+]name ok" or
+// "[-]name failed: reason" line per check and a closing verdict such as
+// "healthz check passed".
+func parseHealthz(body []byte) (healthReport, error) {
+	var report healthReport
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "[+]"), strings.HasPrefix(line, "[-]"):
+			name, detail, _ := strings.Cut(line[3:], " ")
+			hc := HealthComponent{Name: name, Status: componentUp}
+			if line[1] == '-' {
+				hc.Status, hc.Detail = componentDown, detail
+			}
+			report.components = append(report.components, hc)
+		case strings.HasSuffix(line, "check passed"):
+			report.status = componentUp
+		case strings.HasSuffix(line, "check failed"):
+			report.status = componentDown
+		}
+	}
+	if len(report.components) == 0 && report.status == "" {
+		return healthReport{}, fmt.Errorf("not a verbose healthz response")
+	}
+	if report.status == "" {
+		report.status = componentUp
+		for _, c := range report.components {
+			if c.Status == componentDown {
+				report.status = componentDown
+			}
+		}
+	}
+	return report, nil
+}
+
+// haproxyStatus maps an HAProxy server or backend status, such as "UP",
+// "UP 1/3" while going down or "MAINT", to a component status.
+func haproxyStatus(s string) string {
+	switch {
+	case s == "UP", s == "OPEN", s == "no check":
+		return componentUp
+	case strings.HasPrefix(s, "DOWN"):
+		return componentDown
+	}
+	return componentDegraded
+}
+
+// parseHAProxy reads HAProxy's stats CSV. Backends and their servers
+// become components; the service is down when any backend is.
+func parseHAProxy(body []byte) (healthReport, error) {
+	r := csv.NewReader(bytes.NewReader(body))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil || len(records) == 0 || !strings.HasPrefix(records[0][0], "#") {
+		return healthReport{}, fmt.Errorf("not an HAProxy stats CSV")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "#"))] = i
+	}
+	px, okPx := columns["pxname"]
+	sv, okSv := columns["svname"]
+	st, okSt := columns["status"]
+	if !okPx || !okSv || !okSt {
+		return healthReport{}, fmt.Errorf("HAProxy stats CSV lacks pxname, svname or status")
+	}
+	checkStatus, hasCheck := columns["check_status"]
+	report := healthReport{status: componentUp}
+	for _, rec := range records[1:] {
+		if len(rec) <= st || rec[sv] == "FRONTEND" {
+			continue
+		}
+		hc := HealthComponent{Name: rec[px] + "/" + rec[sv], Status: haproxyStatus(rec[st])}
+		if rec[sv] == "BACKEND" {
+			hc.Name = rec[px]
+			if hc.Status == componentDown {
+				report.status = componentDown
+			}
+		}
+		if hc.Status != componentUp {
+			hc.Detail = rec[st]
+			if hasCheck && checkStatus < len(rec) && rec[checkStatus] != "" {
+				hc.Detail += " (" + rec[checkStatus] + ")"
+			}
+		}
+		report.components = append(report.components, hc)
+	}
+	return report, nil
+}
+
+var healthParsers = map[string]func([]byte) (healthReport, error){
+	healthSpring:  parseSpringHealth,
+	healthHealthz: parseHealthz,
+	healthHAProxy: parseHAProxy,
+}
+
+// healthTracker remembers which health monitors were last degraded, so a
+// degraded alert is raised once and resolved when they recover fully.
+type healthTracker struct {
+	mu       sync.Mutex
+	degraded map[string]bool
+}
+
+var healthStates = &healthTracker{degraded: make(map[string]bool)}
+
+func (h *healthTracker) observe(target Target, degraded bool, summary string) {
+	h.mu.Lock()
+	was := h.degraded[target.URL]
+	h.degraded[target.URL] = degraded
+	h.mu.Unlock()
+	if degraded == was {
+		return
+	}
+	n := notification{Kind: notifyHealth, Target: target, Time: time.Now().UTC()}
+	if degraded {
+		n.Status = componentDegraded
+		n.Detail = fmt.Sprintf("%s is degraded: %s", target.displayName(), summary)
+	} else {
+		n.Status = alertResolved
+		n.Detail = fmt.Sprintf("All components of %s are healthy again", target.displayName())
+	}
+	fmt.Println(n.Detail)
+	enqueueNotification(n)
+}
+
+// describeComponents lists the components that are not up, e.g.
+// "db: DOWN: Connection refused; redis: UNKNOWN".
+func describeComponents(components []HealthComponent) string {
+	var parts []string
+	for _, c := range components {
+		switch {
+		case c.Status == componentUp:
+		case c.Detail != "":
+			parts = append(parts, c.Name+": "+c.Detail)
+		default:
+			parts = append(parts, c.Name+": "+c.Status)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// probeHealth fetches a health endpoint and maps its verdict and component
+// statuses to the monitor's: down when the service reports itself down,
+// and up but degraded, with a degraded alert, when only some components
+// are unwell. Services answer 503 when down, so any status is parsed.
+func probeHealth(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	cfg := target.Health
+	if cfg == nil {
+		cfg = &HealthCheckConfig{}
+	}
+	start := time.Now()
+	resp, err := checkGet(target)
+	if err != nil {
+		result.Latency = Duration(time.Since(start))
+		result.Detail, result.Failure = err.Error(), classifyError(err)
+		return result
+	}
+	body, err := readBody(resp, target.bodyLimit(expectMaxBody))
+	result.Latency = Duration(time.Since(start))
+	if err != nil {
+		result.Detail, result.Failure = err.Error(), classifyError(err)
+		return result
+	}
+	format := cfg.Format
+	if format == "" || format == healthAuto {
+		format = healthFormat(resp.Header.Get("Content-Type"), body)
+	}
+	report, err := healthParsers[format](body)
+	if err != nil {
+		result.Detail = resp.Status + ": " + err.Error()
+		result.Failure = failureStatus
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			result.Failure = failureAssertion
+		}
+		return result
+	}
+	sort.Slice(report.components, func(i, j int) bool { return report.components[i].Name < report.components[j].Name })
+	result.Components = report.components
+	unwell := describeComponents(report.components)
+	degraded := report.status == componentUp && unwell != ""
+	switch {
+	case report.status == componentDown:
+		result.Failure = failureAssertion
+		result.Detail = "health reports down"
+	case degraded && cfg.DegradedDown:
+		result.Failure = failureAssertion
+		result.Detail = "health reports degraded"
+	case degraded:
+		result.Status = "up"
+		result.Detail = "health reports degraded"
+	default:
+		result.Status = "up"
+		result.Detail = fmt.Sprintf("health reports up, %d components", len(report.components))
+	}
+	if unwell != "" {
+		result.Detail += " (" + unwell + ")"
+	}
+	if !cfg.DegradedDown && report.status == componentUp {
+		healthStates.observe(target, degraded, unwell)
+	}
+	return result
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// HistoryConfig controls how long check history is kept and where it is
+// persisted between restarts.
+type HistoryConfig struct {
+	// File, when set, is loaded at startup and rewritten every minute.
+	File string `json:"file"`
+	// Retention defaults to 90 days.
+	Retention Duration `json:"retention"`
+}
+
+// History is kept as aggregated buckets rather than raw checks: fine
+// buckets for recent detail and hourly buckets for long-range reports.
+const (
+	historyFineStep   = 5 * time.Minute
+	historyFineKeep   = 48 * time.Hour
+	historyCoarseStep = time.Hour
+	historySaveEvery  = time.Minute
+)
+
+type historyBucket struct {
+	// Start is the bucket's start time in Unix seconds.
+	Start  int64 `json:"t"`
+	Checks int   `json:"n"`
+	Up     int   `json:"up"`
+	// Weight and UpWeight sum the weights of the results and of the up
+	// results, each weighing the number of configured intervals it stands
+	// for. Uptime is UpWeight over Weight.
+	Weight   float64 `json:"w,omitempty"`
+	UpWeight float64 `json:"uw,omitempty"`
+	// Latency figures are in milliseconds.
+	LatencySum float64 `json:"ls"`
+	LatencyMin float64 `json:"lmin"`
+	LatencyMax float64 `json:"lmax"`
+}
+
+func (b *historyBucket) add(up bool, latencyMs, weight float64) {
+	if b.Checks == 0 || latencyMs < b.LatencyMin {
+		b.LatencyMin = latencyMs
+	}
+	if latencyMs > b.LatencyMax {
+		b.LatencyMax = latencyMs
+	}
+	b.Weight, b.UpWeight = b.weights()
+	b.Checks++
+	b.Weight += weight
+	if up {
+		b.Up++
+		b.UpWeight += weight
+	}
+	b.LatencySum += latencyMs
+}
+
+// weights returns the total weight of b's results and that of its up
+// results. Buckets kept before results were weighed count each check once.
+func (b historyBucket) weights() (total, up float64) {
+	if b.Weight == 0 {
+		return float64(b.Checks), float64(b.Up)
+	}
+	return b.Weight, b.UpWeight
+}
+
+// merge adds o's results to b.
+func (b *historyBucket) merge(o historyBucket) {
+	total, up := o.weights()
+	b.Checks += o.Checks
+	b.Up += o.Up
+	b.Weight += total
+	b.UpWeight += up
+	b.LatencySum += o.LatencySum
+}
+
+// Incident is one continuous period during which a monitor was down.
+type Incident struct {
+	Start time.Time `json:"start"`
+	// End is nil while the incident is ongoing.
+	End    *time.Time `json:"end,omitempty"`
+	Detail string     `json:"detail"`
+	// Deploy is the deploy of the monitor's service shortly before the
+	// incident started, if any.
+	Deploy *DeployEvent `json:"deploy,omitempty"`
+	// Silence is the silence the incident fell in, if any: its alerts
+	// were expected and held back.
+	Silence *Silence `json:"silence,omitempty"`
+}
+
+// duration returns how long the incident lasted, or has lasted so far.
+func (i Incident) duration(now time.Time) time.Duration {
+	if i.End != nil {
+		return i.End.Sub(i.Start)
+	}
+	return now.Sub(i.Start)
+}
+
+type monitorHistory struct {
+	Fine      []historyBucket `json:"fine"`
+	Coarse    []historyBucket `json:"coarse"`
+	Incidents []Incident      `json:"incidents"`
+	// Locations are hourly buckets of the results from each location. They
+	// are only kept when agents are configured.
+	Locations map[string][]historyBucket `json:"locations,omitempty"`
+	// Silences are the monitor's silences, oldest first.
+	Silences []Silence `json:"silences,omitempty"`
+}
+
+type historyStore struct {
+	mu        sync.Mutex
+	monitors  map[string]*monitorHistory
+	retention time.Duration
+	file      string
+}
+
+var history = &historyStore{monitors: make(map[string]*monitorHistory), retention: 90 * 24 * time.Hour}
+
+// appendBucket adds a sample to the last bucket of list, starting a new one
+// when t falls past it.
+func appendBucket(list []historyBucket, step time.Duration, t time.Time, up bool, latencyMs, weight float64) []historyBucket {
+	start := t.Truncate(step).Unix()
+	if n := len(list); n == 0 || list[n-1].Start != start {
+		list = append(list, historyBucket{Start: start})
+	}
+	list[len(list)-1].add(up, latencyMs, weight)
+	return list
+}
+
+// record adds one aggregated check for url and opens or closes an incident
+// when the status changes.
+func (h *historyStore) record(url, status, detail string, latency time.Duration, weight float64, t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.monitors[url]
+	if m == nil {
+		m = &monitorHistory{}
+		h.monitors[url] = m
+	}
+	up := status == "up"
+	ms := float64(latency) / float64(time.Millisecond)
+	m.Fine = appendBucket(m.Fine, historyFineStep, t, up, ms, weight)
+	m.Coarse = appendBucket(m.Coarse, historyCoarseStep, t, up, ms, weight)
+
+	open := len(m.Incidents) > 0 && m.Incidents[len(m.Incidents)-1].End == nil
+	switch {
+	case !up && !open:
+		incident := Incident{Start: t, Detail: detail}
+		if s, ok := m.activeSilence(t); ok {
+			incident.Silence = &s
+		}
+		m.Incidents = append(m.Incidents, incident)
+	case up && open:
+		end := t
+		m.Incidents[len(m.Incidents)-1].End = &end
+	}
+}
+
+// recordLocation adds one result for url from location.
+func (h *historyStore) recordLocation(url, location string, up bool, latency time.Duration, weight float64, t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.monitors[url]
+	if m == nil {
+		m = &monitorHistory{}
+		h.monitors[url] = m
+	}
+	if m.Locations == nil {
+		m.Locations = make(map[string][]historyBucket)
+	}
+	ms := float64(latency) / float64(time.Millisecond)
+	m.Locations[location] = appendBucket(m.Locations[location], historyCoarseStep, t, up, ms, weight)
+}
+
+// locationBuckets returns copies of url's buckets per location starting
+// within [from, to).
+func (h *historyStore) locationBuckets(url string, from, to time.Time) map[string][]historyBucket {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[string][]historyBucket)
+	m := h.monitors[url]
+	if m == nil {
+		return out
+	}
+	for location, list := range m.Locations {
+		var copied []historyBucket
+		for _, b := range list {
+			if b.Start >= from.Unix() && b.Start < to.Unix() {
+				copied = append(copied, b)
+			}
+		}
+		out[location] = copied
+	}
+	return out
+}
+
+// linkDeploy attributes url's ongoing incident to deploy.
+func (h *historyStore) linkDeploy(url string, deploy *DeployEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.monitors[url]
+	if m == nil || len(m.Incidents) == 0 || m.Incidents[len(m.Incidents)-1].End != nil {
+		return
+	}
+	m.Incidents[len(m.Incidents)-1].Deploy = deploy
+}
+
+// addSilence records s for url, linking url's ongoing incident to it.
+func (h *historyStore) addSilence(url string, s Silence) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.monitors[url]
+	if m == nil {
+		m = &monitorHistory{}
+		h.monitors[url] = m
+	}
+	m.Silences = append(m.Silences, s)
+	if n := len(m.Incidents); n > 0 && m.Incidents[n-1].End == nil && m.Incidents[n-1].Silence == nil {
+		m.Incidents[n-1].Silence = &s
+	}
+}
+
+// endSilences ends url's silences that are active at now, returning them
+// as ended.
+func (h *historyStore) endSilences(url string, now time.Time) []Silence {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.monitors[url]
+	if m == nil {
+		return nil
+	}
+	var ended []Silence
+	for i := range m.Silences {
+		if s := &m.Silences[i]; s.active(now) {
+			s.End = now
+			ended = append(ended, *s)
+		}
+	}
+	return ended
+}
+
+// silenced returns the silence of url active at now, if any.
+func (h *historyStore) silenced(url string, now time.Time) (Silence, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.monitors[url]
+	if m == nil {
+		return Silence{}, false
+	}
+	return m.activeSilence(now)
+}
+
+// silences returns url's silences, newest first.
+func (h *historyStore) silences(url string) []Silence {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := []Silence{}
+	if m := h.monitors[url]; m != nil {
+		for i := len(m.Silences) - 1; i >= 0; i-- {
+			out = append(out, m.Silences[i])
+		}
+	}
+	return out
+}
+
+// activeSilence must be called with the store's mu held.
+func (m *monitorHistory) activeSilence(now time.Time) (Silence, bool) {
+	for i := len(m.Silences) - 1; i >= 0; i-- {
+		if m.Silences[i].active(now) {
+			return m.Silences[i], true
+		}
+	}
+	return Silence{}, false
+}
+
+// openIncident returns the ongoing incident for url, if any.
+func (h *historyStore) openIncident(url string) (Incident, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.monitors[url]
+	if m == nil || len(m.Incidents) == 0 || m.Incidents[len(m.Incidents)-1].End != nil {
+		return Incident{}, false
+	}
+	return m.Incidents[len(m.Incidents)-1], true
+}
+
+// buckets returns copies of url's buckets starting within [from, to). Fine
+// buckets are used when the whole window is still covered by them.
+func (h *historyStore) buckets(url string, from, to time.Time) []historyBucket {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.monitors[url]
+	if m == nil {
+		return nil
+	}
+	list := m.Coarse
+	if time.Since(from) < historyFineKeep {
+		list = m.Fine
+	}
+	var out []historyBucket
+	for _, b := range list {
+		if b.Start >= from.Unix() && b.Start < to.Unix() {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// incidents returns url's incidents overlapping [from, to).
+func (h *historyStore) incidents(url string, from, to time.Time) []Incident {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.monitors[url]
+	if m == nil {
+		return nil
+	}
+	var out []Incident
+	for _, i := range m.Incidents {
+		if i.Start.Before(to) && (i.End == nil || i.End.After(from)) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// prune drops data older than the retention period.
+func (h *historyStore) prune(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fineCutoff := now.Add(-historyFineKeep).Unix()
+	cutoff := now.Add(-h.retention)
+	for url, m := range h.monitors {
+		m.Fine = dropBucketsBefore(m.Fine, fineCutoff)
+		m.Coarse = dropBucketsBefore(m.Coarse, cutoff.Unix())
+		for location, list := range m.Locations {
+			if list = dropBucketsBefore(list, cutoff.Unix()); len(list) > 0 {
+				m.Locations[location] = list
+			} else {
+				delete(m.Locations, location)
+			}
+		}
+		i := 0
+		for i < len(m.Incidents) && m.Incidents[i].End != nil && m.Incidents[i].End.Before(cutoff) {
+			i++
+		}
+		m.Incidents = m.Incidents[i:]
+		i = 0
+		for i < len(m.Silences) && m.Silences[i].End.Before(cutoff) {
+			i++
+		}
+		m.Silences = m.Silences[i:]
+		if len(m.Coarse) == 0 && len(m.Incidents) == 0 && len(m.Silences) == 0 {
+			delete(h.monitors, url)
+		}
+	}
+}
+
+func dropBucketsBefore(list []historyBucket, cutoff int64) []historyBucket {
+	i := 0
+	for i < len(list) && list[i].Start < cutoff {
+		i++
+	}
+	return list[i:]
+}
+
+func (h *historyStore) load() error {
+	b, err := os.ReadFile(h.file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return json.Unmarshal(b, &h.monitors)
+}
+
+func (h *historyStore) save() error {
+	h.mu.Lock()
+	b, err := json.Marshal(h.monitors)
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := h.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.file)
+}
+
+func startHistory(config HistoryConfig) {
+	if config.Retention > 0 {
+		history.retention = time.Duration(config.Retention)
+	}
+	history.file = config.File
+	if history.file != "" {
+		if err := history.load(); err != nil {
+			fmt.Println("Error loading history:", err)
+		}
+	}
+	go func() {
+		for range time.Tick(historySaveEvery) {
+			history.prune(time.Now())
+			if history.file == "" {
+				continue
+			}
+			if err := history.save(); err != nil {
+				fmt.Println("Error saving history:", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// messageCatalog holds the strings notifications are rendered from, by
+// locale and then message ID. Text may use the placeholders {name}, {url},
+// {status}, {detail}, {time}, {downtime} and {title}, the localized name of
+// an alert kind. {match.NAME} is a group captured by the monitor's body
+// pattern, by name or number. {deploy} is the service and version of the
+// deploy an outage is attributed to, and {deploy.ago} how long before it
+// happened. {meta.KEY} is an entry of the monitor's metadata. {failure} is
+// the localized failure class of a down check, such as "TLS error". The
+// digest messages take {count}, the number of monitors.
+var messageCatalog = map[string]map[string]string{
+	"en": {
+		"detected":         "Detected at {time}.",
+		"downtime":         "Down for {downtime}.",
+		"deploy":           "{deploy} was deployed {deploy.ago} before the outage.",
+		"down.subject":     "Website Down: {url}",
+		"reminder.subject": "Still down: {url}",
+		"digest.subject":   "{count} websites down",
+		"digest.body":      "{count} websites went down together:",
+		"digest.item":      "- {url}: {detail}",
+		"down.body":        "The website {url} is currently down.",
+		"down.summary":     "Website {name} is down",
+		"alert.subject":    "{title}: {name}",
+		"title.slo":        "SLO Alert",
+		"title.anomaly":    "Performance Anomaly",
+		"title.tls":        "TLS Grade",
+		"title.cert":       "Certificate Change",
+		"title.cluster":    "Cluster Health",
+		"title.renewal":    "Certificate Renewal",
+		"title.health":     "Service Health",
+		"title.channel":    "Notification Channel",
+		"cause":            "Cause: {failure}.",
+		"cause.dns":        "DNS error",
+		"cause.refused":    "connection refused",
+		"cause.connect":    "connection error",
+		"cause.tls":        "TLS error",
+		"cause.timeout":    "timeout",
+		"cause.status":     "unexpected HTTP status",
+		"cause.assertion":  "assertion failed",
+		"incident.opened":  "Outage: {name}",
+		"incident.closed":  "Resolved: {name}",
+		"incident.down":    "{name} has been unavailable since {time}. We are looking into it.",
+		"incident.up":      "{name} is available again, after {downtime}.",
+		"confirm.subject":  "Confirm your subscription",
+		"confirm.body":     "Please confirm that you want status updates by email by opening this link:",
+		"unsubscribe":      "Unsubscribe:",
+	},
+	"de": {
+		"detected":         "Erkannt am {time}.",
+		"downtime":         "Ausgefallen seit {downtime}.",
+		"deploy":           "{deploy} wurde {deploy.ago} vor dem Ausfall ausgerollt.",
+		"down.subject":     "Website ausgefallen: {url}",
+		"reminder.subject": "Weiterhin ausgefallen: {url}",
+		"digest.subject":   "{count} Websites ausgefallen",
+		"digest.body":      "{count} Websites sind gleichzeitig ausgefallen:",
+		"down.body":        "Die Website {url} ist derzeit nicht erreichbar.",
+		"down.summary":     "Website {name} ist ausgefallen",
+		"alert.subject":    "{title}: {name}",
+		"title.slo":        "SLO-Warnung",
+		"title.anomaly":    "Leistungsanomalie",
+		"title.tls":        "TLS-Bewertung",
+		"title.cert":       "Zertifikatsänderung",
+		"title.cluster":    "Cluster-Zustand",
+		"title.renewal":    "Zertifikatserneuerung",
+		"title.health":     "Dienstzustand",
+		"title.channel":    "Benachrichtigungskanal",
+		"cause":            "Ursache: {failure}.",
+		"cause.dns":        "DNS-Fehler",
+		"cause.refused":    "Verbindung abgelehnt",
+		"cause.connect":    "Verbindungsfehler",
+		"cause.tls":        "TLS-Fehler",
+		"cause.timeout":    "Zeitüberschreitung",
+		"cause.status":     "unerwarteter HTTP-Status",
+		"cause.assertion":  "Prüfung fehlgeschlagen",
+		"incident.opened":  "Störung: {name}",
+		"incident.closed":  "Behoben: {name}",
+		"incident.down":    "{name} ist seit {time} nicht verfügbar. Wir kümmern uns darum.",
+		"incident.up":      "{name} ist nach {downtime} wieder verfügbar.",
+		"confirm.subject":  "Bestätigen Sie Ihr Abonnement",
+		"confirm.body":     "Bitte bestätigen Sie über diesen Link, dass Sie Statusmeldungen per E-Mail erhalten möchten:",
+		"unsubscribe":      "Abmelden:",
+	},
+	"es": {
+		"detected":         "Detectado el {time}.",
+		"downtime":         "Caído desde hace {downtime}.",
+		"deploy":           "{deploy} se desplegó {deploy.ago} antes de la caída.",
+		"down.subject":     "Sitio caído: {url}",
+		"reminder.subject": "Sigue caído: {url}",
+		"digest.subject":   "{count} sitios caídos",
+		"digest.body":      "{count} sitios se cayeron a la vez:",
+		"down.body":        "El sitio {url} está caído en este momento.",
+		"down.summary":     "El sitio {name} está caído",
+		"alert.subject":    "{title}: {name}",
+		"title.slo":        "Alerta de SLO",
+		"title.anomaly":    "Anomalía de rendimiento",
+		"title.tls":        "Calificación TLS",
+		"title.cert":       "Cambio de certificado",
+		"title.cluster":    "Estado del clúster",
+		"title.renewal":    "Renovación de certificado",
+		"title.health":     "Estado del servicio",
+		"title.channel":    "Canal de notificación",
+		"cause":            "Causa: {failure}.",
+		"cause.dns":        "error de DNS",
+		"cause.refused":    "conexión rechazada",
+		"cause.connect":    "error de conexión",
+		"cause.tls":        "error de TLS",
+		"cause.timeout":    "tiempo de espera agotado",
+		"cause.status":     "estado HTTP inesperado",
+		"cause.assertion":  "comprobación fallida",
+		"incident.opened":  "Incidencia: {name}",
+		"incident.closed":  "Resuelto: {name}",
+		"incident.down":    "{name} no está disponible desde {time}. Estamos investigándolo.",
+		"incident.up":      "{name} vuelve a estar disponible, tras {downtime}.",
+		"confirm.subject":  "Confirme su suscripción",
+		"confirm.body":     "Confirme que desea recibir actualizaciones de estado por correo abriendo este enlace:",
+		"unsubscribe":      "Darse de baja:",
+	},
+	"fr": {
+		"detected":         "Détecté le {time}.",
+		"downtime":         "Indisponible depuis {downtime}.",
+		"deploy":           "{deploy} a été déployé {deploy.ago} avant la panne.",
+		"down.subject":     "Site indisponible : {url}",
+		"reminder.subject": "Toujours indisponible : {url}",
+		"digest.subject":   "{count} sites indisponibles",
+		"digest.body":      "{count} sites sont devenus indisponibles en même temps :",
+		"down.body":        "Le site {url} est actuellement indisponible.",
+		"down.summary":     "Le site {name} est indisponible",
+		"alert.subject":    "{title} : {name}",
+		"title.slo":        "Alerte SLO",
+		"title.anomaly":    "Anomalie de performance",
+		"title.tls":        "Note TLS",
+		"title.cert":       "Changement de certificat",
+		"title.cluster":    "État du cluster",
+		"title.renewal":    "Renouvellement de certificat",
+		"title.health":     "État du service",
+		"title.channel":    "Canal de notification",
+		"cause":            "Cause : {failure}.",
+		"cause.dns":        "erreur DNS",
+		"cause.refused":    "connexion refusée",
+		"cause.connect":    "erreur de connexion",
+		"cause.tls":        "erreur TLS",
+		"cause.timeout":    "délai dépassé",
+		"cause.status":     "statut HTTP inattendu",
+		"cause.assertion":  "vérification échouée",
+		"incident.opened":  "Incident : {name}",
+		"incident.closed":  "Résolu : {name}",
+		"incident.down":    "{name} est indisponible depuis {time}. Nous y travaillons.",
+		"incident.up":      "{name} est de nouveau disponible, après {downtime}.",
+		"confirm.subject":  "Confirmez votre abonnement",
+		"confirm.body":     "Veuillez confirmer que vous souhaitez recevoir les mises à jour de statut par e-mail en ouvrant ce lien :",
+		"unsubscribe":      "Se désabonner :",
+	},
+}
+
+var unsetPlaceholder = regexp.MustCompile(`\{(match|meta)\.[^{}]*\}`)
+
+// defaultLocale is used by channels without a locale of their own.
+var defaultLocale = "en"
+
+// setupLocales merges the configured messages into the catalog and sets the
+// default locale.
+func setupLocales(config Config) {
+	for locale, msgs := range config.Messages {
+		locale = strings.ToLower(locale)
+		if messageCatalog[locale] == nil {
+			messageCatalog[locale] = make(map[string]string)
+		}
+		for id, text := range msgs {
+			if _, ok := messageCatalog["en"][id]; !ok {
+				fmt.Printf("Ignoring unknown message %q for locale %s\n", id, locale)
+				continue
+			}
+			messageCatalog[locale][id] = text
+		}
+	}
+	if config.Locale != "" {
+		defaultLocale = strings.ToLower(config.Locale)
+		if messageCatalog[defaultLocale] == nil && messageCatalog[baseLanguage(defaultLocale)] == nil {
+			fmt.Printf("No messages for locale %s; falling back to English\n", config.Locale)
+		}
+	}
+}
+
+func baseLanguage(locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	return lang
+}
+
+// message returns message id in locale, falling back to the locale's base
+// language ("pt" for "pt-br"), then the default locale, then English.
+func message(locale, id string) string {
+	locale = strings.ToLower(locale)
+	for _, l := range []string{locale, baseLanguage(locale), defaultLocale, baseLanguage(defaultLocale), "en"} {
+		if text, ok := messageCatalog[l][id]; ok {
+			return text
+		}
+	}
+	return id
+}
+
+// localize renders message id for n in locale, showing times in zone.
+func localize(locale string, zone *time.Location, id string, n notification) string {
+	pairs := []string{
+		"{time}", formatTime(n.Time, zone),
+		"{name}", n.Target.displayName(),
+		"{url}", n.Target.URL,
+		"{status}", n.Status,
+		"{detail}", n.Detail,
+		"{downtime}", formatDuration(n.Downtime),
+		"{title}", message(locale, "title."+n.Kind),
+	}
+	if id, ok := failureMessages[n.Failure]; ok {
+		pairs = append(pairs, "{failure}", message(locale, id))
+	}
+	if d := n.Deploy; d != nil {
+		pairs = append(pairs, "{deploy}", strings.TrimSpace(d.Service+" "+d.Version),
+			"{deploy.ago}", formatDuration(n.Time.Sub(d.Time).Round(time.Second)))
+	}
+	for group, value := range n.Captures {
+		pairs = append(pairs, "{match."+group+"}", value)
+	}
+	for key, value := range n.Target.Metadata {
+		pairs = append(pairs, "{meta."+key+"}", value)
+	}
+	text := strings.NewReplacer(pairs...).Replace(message(locale, id))
+	// Groups the check did not capture, and metadata the monitor doesn't
+	// have, render as nothing.
+	return unsetPlaceholder.ReplaceAllString(text, "")
+}
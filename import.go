@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importedConfig is the subset of Config an import can fill in.
+type importedConfig struct {
+	Monitors []MonitorConfig `json:"monitors"`
+	Email    *EmailConfig    `json:"email,omitempty"`
+}
+
+// runImport converts another tool's export into this tool's config format.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	from := fs.String("from", "", `source format: "kuma" or "uptimerobot" (detected when empty)`)
+	in := fs.String("in", "", "export file to read")
+	out := fs.String("out", "", "config file to write (default stdout)")
+	fs.Parse(args)
+
+	if *in == "" {
+		fmt.Fprintln(os.Stderr, "Error: import requires -in")
+		os.Exit(2)
+	}
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading export:", err)
+		os.Exit(1)
+	}
+
+	format := *from
+	if format == "" {
+		format = detectImportFormat(data)
+	}
+	var cfg importedConfig
+	switch format {
+	case "kuma":
+		cfg, err = importUptimeKuma(data)
+	case "uptimerobot":
+		cfg, err = importUptimeRobot(data)
+	default:
+		err = fmt.Errorf("unknown or undetected format %q; pass -from", format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error importing:", err)
+		os.Exit(1)
+	}
+
+	b, _ := json.MarshalIndent(cfg, "", "  ")
+	b = append(b, '\n')
+	if *out == "" {
+		os.Stdout.Write(b)
+		return
+	}
+	if err := os.WriteFile(*out, b, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing config:", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d monitors to %s\n", len(cfg.Monitors), *out)
+}
+
+func detectImportFormat(data []byte) string {
+	var probe map[string]json.RawMessage
+	if json.Unmarshal(data, &probe) != nil {
+		return ""
+	}
+	if _, ok := probe["monitorList"]; ok {
+		return "kuma"
+	}
+	if _, ok := probe["monitors"]; ok {
+		return "uptimerobot"
+	}
+	return ""
+}
+
+func importWarn(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", args...)
+}
+
+// Uptime Kuma backup files (Settings > Backup > Export).
+type kumaBackup struct {
+	NotificationList []struct {
+		ID     int    `json:"id"`
+		Name   string `json:"name"`
+		Active any    `json:"active"`
+		// Config is itself a JSON document.
+		Config string `json:"config"`
+	} `json:"notificationList"`
+	MonitorList []struct {
+		Name     string `json:"name"`
+		URL      string `json:"url"`
+		Type     string `json:"type"`
+		Interval int    `json:"interval"`
+		Active   any    `json:"active"`
+		Tags     []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"tags"`
+		NotificationIDList map[string]bool `json:"notificationIDList"`
+	} `json:"monitorList"`
+}
+
+type kumaNotification struct {
+	Type         string `json:"type"`
+	SMTPHost     string `json:"smtpHost"`
+	SMTPPort     any    `json:"smtpPort"`
+	SMTPUsername string `json:"smtpUsername"`
+	SMTPPassword string `json:"smtpPassword"`
+	SMTPFrom     string `json:"smtpFrom"`
+	SMTPTo       string `json:"smtpTo"`
+}
+
+// kumaTrue reads Uptime Kuma's booleans, which appear as true/false or 1/0.
+func kumaTrue(v any) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case float64:
+		return b != 0
+	}
+	return v == nil
+}
+
+func importUptimeKuma(data []byte) (importedConfig, error) {
+	var backup kumaBackup
+	var cfg importedConfig
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return cfg, err
+	}
+
+	used := make(map[string]bool)
+	for _, m := range backup.MonitorList {
+		switch m.Type {
+		case "http", "keyword", "json-query":
+		default:
+			importWarn("skipping %q: monitor type %q is not supported", m.Name, m.Type)
+			continue
+		}
+		if m.Type != "http" {
+			importWarn("%q: %s checks are imported as plain HTTP checks", m.Name, m.Type)
+		}
+		if !kumaTrue(m.Active) {
+			importWarn("%q is paused in Uptime Kuma but will be monitored", m.Name)
+		}
+		mc := MonitorConfig{Name: m.Name, URL: m.URL, Interval: Duration(time.Duration(m.Interval) * time.Second)}
+		for _, t := range m.Tags {
+			if t.Value != "" {
+				mc.Tags = append(mc.Tags, t.Name+"="+t.Value)
+			} else {
+				mc.Tags = append(mc.Tags, t.Name)
+			}
+		}
+		for id, on := range m.NotificationIDList {
+			if on {
+				used[id] = true
+			}
+		}
+		cfg.Monitors = append(cfg.Monitors, mc)
+	}
+
+	for _, n := range backup.NotificationList {
+		if !used[strconv.Itoa(n.ID)] {
+			continue
+		}
+		var nc kumaNotification
+		if err := json.Unmarshal([]byte(n.Config), &nc); err != nil {
+			importWarn("notification %q: %s", n.Name, err)
+			continue
+		}
+		if nc.Type != "smtp" {
+			importWarn("notification %q: type %q has no equivalent and was skipped", n.Name, nc.Type)
+			continue
+		}
+		if cfg.Email != nil {
+			importWarn("notification %q: only one email notification is supported, keeping the first", n.Name)
+			continue
+		}
+		port, _ := strconv.Atoi(fmt.Sprint(nc.SMTPPort))
+		cfg.Email = &EmailConfig{
+			SMTPHost:  nc.SMTPHost,
+			SMTPPort:  port,
+			Sender:    nc.SMTPUsername,
+			Password:  nc.SMTPPassword,
+			Recipient: nc.SMTPTo,
+		}
+		// Relays often refuse the login name as a sender, so the From
+		// address is used when it differs, with the login kept apart.
+		if from, err := mail.ParseAddress(nc.SMTPFrom); err == nil && from.Address != nc.SMTPUsername {
+			cfg.Email.Sender, cfg.Email.Username = from.Address, nc.SMTPUsername
+		}
+	}
+	return cfg, nil
+}
+
+// UptimeRobot getMonitors API responses, requested with alert_contacts=1.
+type uptimeRobotExport struct {
+	Monitors []struct {
+		FriendlyName  string `json:"friendly_name"`
+		URL           string `json:"url"`
+		Type          int    `json:"type"`
+		Interval      int    `json:"interval"`
+		Status        int    `json:"status"`
+		AlertContacts []struct {
+			Type  int    `json:"type"`
+			Value string `json:"value"`
+		} `json:"alert_contacts"`
+	} `json:"monitors"`
+}
+
+// UptimeRobot monitor and alert contact type codes.
+const (
+	uptimeRobotHTTP    = 1
+	uptimeRobotKeyword = 2
+	uptimeRobotPaused  = 0
+	uptimeRobotEmail   = 2
+)
+
+func importUptimeRobot(data []byte) (importedConfig, error) {
+	var export uptimeRobotExport
+	var cfg importedConfig
+	if err := json.Unmarshal(data, &export); err != nil {
+		return cfg, err
+	}
+
+	var recipients []string
+	seen := make(map[string]bool)
+	skipped := make(map[int]bool)
+	for _, m := range export.Monitors {
+		switch m.Type {
+		case uptimeRobotHTTP:
+		case uptimeRobotKeyword:
+			importWarn("%q: keyword checks are imported as plain HTTP checks", m.FriendlyName)
+		default:
+			importWarn("skipping %q: monitor type %d is not supported", m.FriendlyName, m.Type)
+			continue
+		}
+		if m.Status == uptimeRobotPaused {
+			importWarn("%q is paused in UptimeRobot but will be monitored", m.FriendlyName)
+		}
+		cfg.Monitors = append(cfg.Monitors, MonitorConfig{
+			Name:     m.FriendlyName,
+			URL:      m.URL,
+			Interval: Duration(time.Duration(m.Interval) * time.Second),
+		})
+		for _, c := range m.AlertContacts {
+			if c.Type != uptimeRobotEmail {
+				if !skipped[c.Type] {
+					importWarn("alert contacts of type %d have no equivalent and were skipped", c.Type)
+					skipped[c.Type] = true
+				}
+				continue
+			}
+			if !seen[c.Value] {
+				seen[c.Value] = true
+				recipients = append(recipients, c.Value)
+			}
+		}
+	}
+
+	if len(recipients) > 0 {
+		if len(recipients) > 1 {
+			importWarn("only one email recipient is supported; using %s (also found %s)", recipients[0], strings.Join(recipients[1:], ", "))
+		}
+		cfg.Email = &EmailConfig{Recipient: recipients[0]}
+		importWarn("UptimeRobot exports contain no SMTP settings; fill in email.smtp_host and credentials")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestKumaImportUsesFromAddress(t *testing.T) {
+	config, _ := json.Marshal(map[string]any{
+		"type": "smtp", "smtpHost": "smtp.example.com", "smtpPort": 587,
+		"smtpUsername": "apikey", "smtpPassword": "secret",
+		"smtpFrom": `"Uptime" <monitor@example.com>`, "smtpTo": "ops@example.com",
+	})
+	backup, _ := json.Marshal(map[string]any{
+		"notificationList": []map[string]any{{"id": 1, "name": "mail", "active": true, "config": string(config)}},
+		"monitorList": []map[string]any{{"name": "site", "url": "https://example.com/", "type": "http", "interval": 60,
+			"active": true, "notificationIDList": map[string]bool{"1": true}}},
+	})
+	cfg, err := importUptimeKuma(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Email == nil || cfg.Email.Sender != "monitor@example.com" || cfg.Email.Username != "apikey" {
+		t.Errorf("imported email settings %+v, want sender monitor@example.com logging in as apikey", cfg.Email)
+	}
+}
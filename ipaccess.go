@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ipList is a set of addresses and CIDR ranges.
+type ipList []netip.Prefix
+
+// parseIPList parses entries such as "10.0.0.0/8" or "192.0.2.7" for the
+// setting field, warning about and skipping the entries it can't parse.
+func parseIPList(field string, entries []string) ipList {
+	var list ipList
+	for _, e := range entries {
+		p, err := netip.ParsePrefix(e)
+		if err != nil {
+			a, aerr := netip.ParseAddr(e)
+			if aerr != nil {
+				if !strings.Contains(e, "/") {
+					err = aerr
+				}
+				fmt.Printf("Ignoring %s entry %q: %s\n", field, e, err)
+				continue
+			}
+			p = netip.PrefixFrom(a, a.BitLen())
+		}
+		list = append(list, p.Masked())
+	}
+	return list
+}
+
+func (l ipList) contains(a netip.Addr) bool {
+	a = a.Unmap()
+	for _, p := range l {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiAccess holds the API's address rules, parsed from APIConfig.
+type apiAccess struct {
+	trusted    ipList
+	allow      ipList
+	deny       ipList
+	adminAllow ipList
+}
+
+var access = &apiAccess{}
+
+func newAPIAccess(config APIConfig) *apiAccess {
+	return &apiAccess{
+		trusted:    parseIPList("api.trusted_proxies", config.TrustedProxies),
+		allow:      parseIPList("api.allow", config.Allow),
+		deny:       parseIPList("api.deny", config.Deny),
+		adminAllow: parseIPList("api.admin_allow", config.AdminAllow),
+	}
+}
+
+// resolve returns the address of the client behind r. The peer's own
+// address is used unless it is a trusted proxy, in which case the nearest
+// untrusted hop in X-Forwarded-For, or else X-Real-IP, is. Peers on a Unix
+// socket are always local, so they count as trusted.
+func (a *apiAccess) resolve(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err == nil && !a.trusted.contains(peer) {
+		return host
+	}
+	if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+		hops := strings.Split(strings.Join(fwd, ","), ",")
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			client = hop.Unmap().String()
+			if !a.trusted.contains(hop) {
+				break
+			}
+		}
+		if client != "" {
+			return client
+		}
+	}
+	if real, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return real.Unmap().String()
+	}
+	return host
+}
+
+// allowed reports whether ip may use the API at all.
+func (a *apiAccess) allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		// Local Unix socket peers without a forwarded address.
+		return len(a.allow) == 0
+	}
+	return !a.deny.contains(addr) && (len(a.allow) == 0 || a.allow.contains(addr))
+}
+
+// adminAllowed reports whether ip may make admin requests.
+func (a *apiAccess) adminAllowed(ip string) bool {
+	if len(a.adminAllow) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && a.adminAllow.contains(addr)
+}
+
+type clientIPKey struct{}
+
+// clientIP returns the address of the client behind r, as resolved by
+// withAccess.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return access.resolve(r)
+}
+
+// withAccess resolves the client's address for the handlers, the rate
+// limit and the audit log, and refuses clients outside the allow and deny
+// lists, and requests that change the instance from outside admin_allow.
+func withAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := access.resolve(r)
+		if !access.allowed(ip) {
+			writeProblem(w, r, http.StatusForbidden, problemForbidden, "requests from your address are not allowed")
+			return
+		}
+		if changesInstance(r) && !access.adminAllowed(ip) {
+			writeProblem(w, r, http.StatusForbidden, problemForbidden, "changes are not allowed from your address")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+	})
+}
+
+// requireAdmin reports whether r may use an admin-only endpoint: it needs
+// an admin key and, with admin_allow set, an allowed address. Otherwise it
+// answers forbidden, with detail when the key is missing.
+func requireAdmin(w http.ResponseWriter, r *http.Request, detail string) bool {
+	if !requestScope(r).all {
+		writeProblem(w, r, http.StatusForbidden, problemForbidden, detail)
+		return false
+	}
+	if !access.adminAllowed(clientIP(r)) {
+		writeProblem(w, r, http.StatusForbidden, problemForbidden, "admin requests are not allowed from your address")
+		return false
+	}
+	return true
+}
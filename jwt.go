@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// JWTConfig signs webhook deliveries with a short-lived JWT, sent in the
+// X-Uptime-JWT header, which receivers can check with the webhook package.
+type JWTConfig struct {
+	// Algorithm is "HS256" (the default) with Secret, or "RS256" or
+	// "ES256" with the PEM private key in KeyFile.
+	Algorithm string `json:"algorithm,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+	KeyFile   string `json:"key_file,omitempty"`
+	// KeyID is sent as the token's "kid", so receivers can pick the key
+	// when rotating keys.
+	KeyID string `json:"key_id,omitempty"`
+	// Issuer defaults to "uptime-monitor". Audience should name the
+	// receiver.
+	Issuer   string `json:"issuer,omitempty"`
+	Audience string `json:"audience,omitempty"`
+	// TTL is how long a token is valid. Defaults to 5m.
+	TTL Duration `json:"ttl,omitempty"`
+}
+
+// webhookClaims are the claims of a delivery's JWT. JTI is a nonce
+// receivers remember until Expires to refuse replays, and BodySHA256 ties
+// the token to the body it came with.
+type webhookClaims struct {
+	Issuer     string `json:"iss"`
+	Audience   string `json:"aud,omitempty"`
+	IssuedAt   int64  `json:"iat"`
+	Expires    int64  `json:"exp"`
+	JTI        string `json:"jti"`
+	BodySHA256 string `json:"body_sha256"`
+}
+
+type jwtSigner struct {
+	config JWTConfig
+	secret []byte
+	key    crypto.Signer
+}
+
+func newJWTSigner(config JWTConfig) (*jwtSigner, error) {
+	if config.Algorithm == "" {
+		config.Algorithm = "HS256"
+	}
+	if config.Issuer == "" {
+		config.Issuer = "uptime-monitor"
+	}
+	if config.TTL <= 0 {
+		config.TTL = Duration(5 * time.Minute)
+	}
+	s := &jwtSigner{config: config}
+	switch config.Algorithm {
+	case "HS256":
+		if len(config.Secret) < 32 {
+			return nil, errors.New("HS256 needs a secret of at least 32 characters")
+		}
+		s.secret = []byte(config.Secret)
+		return s, nil
+	case "RS256", "ES256":
+	default:
+		return nil, fmt.Errorf("unknown algorithm %q: use HS256, RS256 or ES256", config.Algorithm)
+	}
+	if config.KeyFile == "" {
+		return nil, fmt.Errorf("%s needs a key_file", config.Algorithm)
+	}
+	b, err := os.ReadFile(config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if s.key, err = parsePrivateKey(b); err != nil {
+		return nil, fmt.Errorf("%s: %w", config.KeyFile, err)
+	}
+	switch k := s.key.(type) {
+	case *rsa.PrivateKey:
+		if config.Algorithm != "RS256" {
+			return nil, fmt.Errorf("%s holds an RSA key; use RS256", config.KeyFile)
+		}
+	case *ecdsa.PrivateKey:
+		if config.Algorithm != "ES256" || k.Curve.Params().BitSize != 256 {
+			return nil, fmt.Errorf("%s holds an EC key; ES256 needs a P-256 key", config.KeyFile)
+		}
+	default:
+		return nil, fmt.Errorf("%s holds an unsupported key type", config.KeyFile)
+	}
+	return s, nil
+}
+
+// parsePrivateKey reads a PKCS#8, PKCS#1 or SEC 1 PEM private key.
+func parsePrivateKey(b []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM private key")
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := k.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	return nil, errors.New("unreadable private key")
+}
+
+// token returns a JWT for a delivery of body.
+func (s *jwtSigner) token(body []byte, now time.Time) (string, error) {
+	header := map[string]string{"alg": s.config.Algorithm, "typ": "JWT"}
+	if s.config.KeyID != "" {
+		header["kid"] = s.config.KeyID
+	}
+	sum := sha256.Sum256(body)
+	claims := webhookClaims{
+		Issuer:     s.config.Issuer,
+		Audience:   s.config.Audience,
+		IssuedAt:   now.Unix(),
+		Expires:    now.Add(time.Duration(s.config.TTL)).Unix(),
+		JTI:        randomID(16),
+		BodySHA256: hex.EncodeToString(sum[:]),
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(h) + "." + enc.EncodeToString(c)
+	sig, err := s.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
+
+func (s *jwtSigner) sign(input []byte) ([]byte, error) {
+	digest := sha256.Sum256(input)
+	switch k := s.key.(type) {
+	case nil:
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		// JWS wants r and s as two fixed-size big-endian halves, not ASN.1.
+		r, sv, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		sv.FillBytes(sig[32:])
+		return sig, nil
+	}
+	return nil, errors.New("no signing key")
+}
+
+// withJWT returns headers plus a token for body in X-Uptime-JWT, or
+// headers itself when s is nil.
+func (s *jwtSigner) withJWT(headers map[string]string, body []byte) (map[string]string, error) {
+	if s == nil {
+		return headers, nil
+	}
+	token, err := s.token(body, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("signing the delivery: %w", err)
+	}
+	out := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		out[k] = v
+	}
+	out["X-Uptime-JWT"] = token
+	return out, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"uptime-monitor/webhook"
+)
+
+const testJWTSecret = "0123456789abcdef0123456789abcdef"
+
+// jwtPair is a signer and the verifier a receiver would set up for it.
+type jwtPair struct {
+	signer   *jwtSigner
+	verifier *webhook.Verifier
+}
+
+// testSigners returns a jwtPair per algorithm.
+func testSigners(t *testing.T) map[string]jwtPair {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]jwtPair)
+	hs, err := newJWTSigner(JWTConfig{Secret: testJWTSecret, Audience: "ops-bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out["HS256"] = jwtPair{hs, &webhook.Verifier{Secret: []byte(testJWTSecret), Audience: "ops-bot"}}
+
+	for alg, key := range map[string]any{"RS256": rsaKey, "ES256": ecKey} {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyFile := filepath.Join(t.TempDir(), "key.pem")
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		signer, err := newJWTSigner(JWTConfig{Algorithm: alg, KeyFile: keyFile, Audience: "ops-bot"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubDER, err := x509.MarshalPKIXPublicKey(signer.key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := webhook.ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[alg] = jwtPair{signer, &webhook.Verifier{PublicKey: pub, Audience: "ops-bot"}}
+	}
+	return out
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	body := `{"monitor":"https://example.com","status":"down"}`
+	for alg, s := range testSigners(t) {
+		headers, err := s.signer.withJWT(map[string]string{"Content-Type": "application/json"}, []byte(body))
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		r, _ := http.NewRequest("POST", "http://receiver/uptime", strings.NewReader(body))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		got, err := s.verifier.Verify(r)
+		if err != nil {
+			t.Errorf("%s: %v", alg, err)
+			continue
+		}
+		if string(got) != body {
+			t.Errorf("%s: body %q", alg, got)
+		}
+		if _, err := s.verifier.VerifyToken(headers[webhook.Header], []byte(body)); !errors.Is(err, webhook.ErrReplayed) {
+			t.Errorf("%s: replayed token: got %v, want ErrReplayed", alg, err)
+		}
+	}
+}
+
+func TestJWTRejected(t *testing.T) {
+	signers := testSigners(t)
+	body := []byte(`{"status":"up"}`)
+	now := time.Now()
+	token := func(alg string, at time.Time) string {
+		tok, err := signers[alg].signer.token(body, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+
+	tests := []struct {
+		name     string
+		verifier *webhook.Verifier
+		token    string
+		body     []byte
+		want     error
+	}{
+		{"HS256 token, RSA key", signers["RS256"].verifier, token("HS256", now), body, webhook.ErrInvalid},
+		{"RS256 token, EC key", signers["ES256"].verifier, token("RS256", now), body, webhook.ErrInvalid},
+		{"ES256 token, secret", signers["HS256"].verifier, token("ES256", now), body, webhook.ErrInvalid},
+		{"wrong secret", &webhook.Verifier{Secret: []byte(strings.Repeat("x", 32))}, token("HS256", now), body, webhook.ErrInvalid},
+		{"body changed", signers["HS256"].verifier, token("HS256", now), []byte(`{"status":"down"}`), webhook.ErrInvalid},
+		{"wrong audience", &webhook.Verifier{Secret: []byte(testJWTSecret), Audience: "billing"}, token("HS256", now), body, webhook.ErrInvalid},
+		{"expired past leeway", signers["ES256"].verifier, token("ES256", now.Add(-6*time.Minute)), body, webhook.ErrExpired},
+		{"issued in the future", signers["RS256"].verifier, token("RS256", now.Add(time.Minute)), body, webhook.ErrInvalid},
+		{"not a JWT", signers["HS256"].verifier, "abc.def", body, webhook.ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := tt.verifier.VerifyToken(tt.token, tt.body); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// The default 30s leeway covers tokens that expired moments ago, or
+	// that were issued by a clock running slightly ahead.
+	for _, at := range []time.Time{now.Add(-5*time.Minute - 20*time.Second), now.Add(20 * time.Second)} {
+		if _, err := signers["HS256"].verifier.VerifyToken(token("HS256", at), body); err != nil {
+			t.Errorf("token issued at %s within leeway: %v", at.Sub(now), err)
+		}
+	}
+	strict := &webhook.Verifier{Secret: []byte(testJWTSecret), Leeway: time.Second}
+	if _, err := strict.VerifyToken(token("HS256", now.Add(-5*time.Minute-20*time.Second)), body); !errors.Is(err, webhook.ErrExpired) {
+		t.Errorf("expired token with 1s leeway: got %v, want ErrExpired", err)
+	}
+
+	r, _ := http.NewRequest("POST", "http://receiver/uptime", strings.NewReader(string(body)))
+	if _, err := signers["HS256"].verifier.Verify(r); !errors.Is(err, webhook.ErrMissing) {
+		t.Errorf("request without a token: got %v, want ErrMissing", err)
+	}
+}
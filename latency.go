@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// LatencySeries is a monitor's latency over a window, downsampled for
+// sparklines.
+type LatencySeries struct {
+	URL        string         `json:"url"`
+	Window     Duration       `json:"window"`
+	Resolution Duration       `json:"resolution"`
+	Points     []LatencyPoint `json:"points"`
+}
+
+// LatencyPoint covers Resolution from Time. The latency figures are
+// omitted when no check ran in it.
+type LatencyPoint struct {
+	Time   time.Time `json:"time"`
+	Checks int       `json:"checks"`
+	MinMs  *float64  `json:"minMs,omitempty"`
+	AvgMs  *float64  `json:"avgMs,omitempty"`
+	MaxMs  *float64  `json:"maxMs,omitempty"`
+}
+
+// latencyMaxPoints caps the points of one series.
+const latencyMaxPoints = 1000
+
+// latencySeries merges url's history buckets in [from, to) into points of
+// resolution, one for every step of the window whether or not it has data.
+func latencySeries(url string, from, to time.Time, resolution time.Duration) []LatencyPoint {
+	from = from.Truncate(resolution)
+	points := make([]LatencyPoint, 0, int(to.Sub(from)/resolution)+1)
+	for t := from; t.Before(to); t = t.Add(resolution) {
+		points = append(points, LatencyPoint{Time: t.UTC()})
+	}
+	merged := make([]historyBucket, len(points))
+	for _, b := range history.buckets(url, from, to) {
+		i := int(time.Unix(b.Start, 0).Sub(from) / resolution)
+		if i < 0 || i >= len(merged) || b.Checks == 0 {
+			continue
+		}
+		m := &merged[i]
+		if m.Checks == 0 || b.LatencyMin < m.LatencyMin {
+			m.LatencyMin = b.LatencyMin
+		}
+		if b.LatencyMax > m.LatencyMax {
+			m.LatencyMax = b.LatencyMax
+		}
+		m.Checks += b.Checks
+		m.LatencySum += b.LatencySum
+	}
+	for i, m := range merged {
+		if m.Checks == 0 {
+			continue
+		}
+		lo, avg, hi := roundMs(m.LatencyMin), roundMs(m.LatencySum/float64(m.Checks)), roundMs(m.LatencyMax)
+		points[i].Checks = m.Checks
+		points[i].MinMs, points[i].AvgMs, points[i].MaxMs = &lo, &avg, &hi
+	}
+	return points
+}
+
+func roundMs(ms float64) float64 {
+	return math.Round(ms*10) / 10
+}
+
+// latencyHandler serves GET /monitors/{monitor}/latency?window=24h&resolution=5m.
+func latencyHandler(w http.ResponseWriter, r *http.Request, target Target) {
+	window, ok := durationParam(w, r, "window", 24*time.Hour, historyFineStep, history.retention)
+	if !ok {
+		return
+	}
+	// The window's buckets can be no finer than the history they come from.
+	step := historyCoarseStep
+	if window < historyFineKeep {
+		step = historyFineStep
+	}
+	resolution, ok := durationParam(w, r, "resolution", step, step, window)
+	if !ok {
+		return
+	}
+	if resolution%step != 0 {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter,
+			fmt.Sprintf("resolution must be a multiple of %s for this window", formatDuration(step)))
+		return
+	}
+	if window/resolution > latencyMaxPoints {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter,
+			fmt.Sprintf("window/resolution must not exceed %d points", latencyMaxPoints))
+		return
+	}
+	now := time.Now()
+	writeJSONCached(w, r, LatencySeries{
+		URL:        target.URL,
+		Window:     Duration(window),
+		Resolution: Duration(resolution),
+		Points:     latencySeries(target.URL, now.Add(-window), now, resolution),
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// apiListener returns the socket an upgrade handed over or systemd
+// activated the service with, or else opens the one named by
+// config.Listen, which withDefaults has filled in.
+func apiListener(config APIConfig) (net.Listener, error) {
+	if ln, err := inheritedListener(); ln != nil || err != nil {
+		return ln, err
+	}
+	if ln, err := activatedListener(); ln != nil || err != nil {
+		return ln, err
+	}
+	path, ok := strings.CutPrefix(config.Listen, "unix:")
+	if !ok {
+		return net.Listen("tcp", config.Listen)
+	}
+	mode, err := strconv.ParseUint(config.SocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return nil, fmt.Errorf("invalid socket_mode %q: want octal permissions such as 0660", config.SocketMode)
+	}
+	// A socket left behind by an unclean exit would make the bind fail.
+	// Anything else at the path is left alone.
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if _, err := net.Dial("unix", path); err == nil {
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		os.Remove(path)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, fs.FileMode(mode)); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// localLocation names results produced by this instance's own checks.
+const localLocation = "local"
+
+// locationResults holds the latest result from each vantage point (this
+// instance plus any agents), keyed by URL and then by location name.
+type locationResults struct {
+	mu      sync.Mutex
+	results map[string]map[string]CheckResult
+	seen    map[string]time.Time
+}
+
+var probeResults = &locationResults{
+	results: make(map[string]map[string]CheckResult),
+	seen:    make(map[string]time.Time),
+}
+
+func (l *locationResults) record(location string, r CheckResult) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	byLocation := l.results[r.URL]
+	if byLocation == nil {
+		byLocation = make(map[string]CheckResult)
+		l.results[r.URL] = byLocation
+	}
+	byLocation[location] = r
+	l.seen[location] = time.Now()
+}
+
+func (l *locationResults) remove(url string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.results, url)
+}
+
+// fresh returns the status reported by each location for url, skipping
+// results older than maxAge so a silent agent doesn't pin a stale verdict.
+func (l *locationResults) fresh(url string, maxAge time.Duration) map[string]MonitorStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make(map[string]MonitorStatus)
+	cutoff := time.Now().Add(-maxAge)
+	for location, r := range l.results[url] {
+		if r.CheckedAt.After(cutoff) {
+			out[location] = resultStatus(r)
+		}
+	}
+	return out
+}
+
+// quorumPolicy decides when a website counts as down across locations.
+type quorumPolicy struct {
+	// quorum is how many locations must see the website down.
+	quorum int
+	// maxAge is how long a location's last result stays valid.
+	maxAge time.Duration
+	// showLocations adds per-location status to API entries.
+	showLocations bool
+}
+
+var policy = quorumPolicy{quorum: 1, maxAge: 2 * time.Minute}
+
+func newQuorumPolicy(config Config) quorumPolicy {
+	interval := time.Duration(config.Interval)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	p := quorumPolicy{
+		quorum:        config.Quorum,
+		maxAge:        2*interval + 30*time.Second,
+		showLocations: len(config.Agents) > 0,
+	}
+	if p.quorum < 1 {
+		p.quorum = 1
+	}
+	if p.quorum > len(config.Agents)+1 {
+		fmt.Printf("Warning: quorum %d exceeds the %d available locations; websites will never be marked down\n", p.quorum, len(config.Agents)+1)
+	}
+	return p
+}
+
+// recordResult stores a result from location and re-evaluates the website's
+// overall status, alerting when enough locations agree it has gone down.
+func recordResult(location string, r CheckResult) {
+	// A check that was in flight when its target was removed must not
+	// resurrect it.
+	target, ok := targets.get(r.URL)
+	if !ok {
+		return
+	}
+	r = chaos.apply(r)
+	probeResults.record(location, r)
+	// Agents check at a fixed interval; only local checks adapt theirs.
+	weight := 1.0
+	if location == localLocation {
+		weight = adaptive.weight(target)
+	}
+	if policy.showLocations {
+		history.recordLocation(r.URL, location, resultStatus(r) == StatusUp, time.Duration(r.Latency), weight, r.CheckedAt.UTC())
+	}
+	if eventLog != nil {
+		eventLog.checkResult(target, location, r)
+	}
+	if pubsub != nil {
+		pubsub.checkResult(target, location, r)
+	}
+	if anomalies != nil {
+		anomalies.observe(target, location, r)
+	}
+
+	byLocation := probeResults.fresh(r.URL, policy.maxAge)
+	down := 0
+	for _, status := range byLocation {
+		if status == StatusDown {
+			down++
+		}
+	}
+	status := StatusUp
+	if down >= policy.quorum {
+		status = StatusDown
+	}
+
+	var locations []LocationStatus
+	if policy.showLocations {
+		for name, s := range byLocation {
+			locations = append(locations, LocationStatus{Location: name, Status: s})
+		}
+		sort.Slice(locations, func(i, j int) bool { return locations[i].Location < locations[j].Location })
+	}
+
+	stored := time.Now()
+	prev := statuses.record(r, status, locations)
+	metrics.observe(target, status.String(), time.Duration(r.Latency))
+	history.record(r.URL, status.String(), r.Detail, time.Duration(r.Latency), weight, time.Now().UTC())
+	if status == StatusDown && prev.Status != StatusDown {
+		if d := deploys.linked(target, time.Now()); d != nil {
+			history.linkDeploy(r.URL, d)
+		}
+	}
+	diag.storeLatency.add(time.Since(stored))
+	switch {
+	case status == StatusDown && (prev.Status != StatusDown || holds.isHeld(r.URL)):
+		if holds.down(target, prev) {
+			break
+		}
+		if policy.quorum > 1 {
+			fmt.Printf("Website %s is down from %d of %d locations\n", r.URL, down, len(byLocation))
+		}
+		n := notification{Target: target, Status: "down", Detail: r.Detail, Failure: r.Failure, Captures: r.Captures, Time: time.Now().UTC()}
+		if incident, ok := history.openIncident(r.URL); ok {
+			n.Deploy = incident.Deploy
+		}
+		enqueueNotification(n)
+	case status == StatusUp && prev.Status == StatusDown:
+		if holds.release(r.URL) {
+			break
+		}
+		now := time.Now().UTC()
+		enqueueNotification(notification{Target: target, Status: "up", Detail: r.Detail, Captures: r.Captures, Time: now, Downtime: now.Sub(prev.Since)})
+	}
+}
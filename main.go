@@ -1,203 +1,351 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
-	"net/smtp"
 	"os"
-	"sort"
-	"strconv"
-	"sync"
 	"time"
 )
 
-type EmailConfig struct {
-	SMTPHost  string `json:"smtp_host"`
-	SMTPPort  int    `json:"smtp_port"`
-	Sender    string `json:"sender"`
-	Password  string `json:"password"`
-	Recipient string `json:"recipient"`
-}
+var statuses = newStatusStore()
 
-type Config struct {
-	Websites []string    `json:"websites"`
-	Email    EmailConfig `json:"email"`
-}
+var limiter = newHostLimiter(RateLimitConfig{})
 
-func loadConfiguration(file string) (Config, error) {
-	var config Config
-	configFile, err := os.Open(file)
-	if err != nil {
-		return config, err
-	}
-	defer configFile.Close()
-	jsonParser := json.NewDecoder(configFile)
-	err = jsonParser.Decode(&config)
-	return config, err
+// CheckResult is the outcome of one check, whether run locally or reported
+// by an agent.
+type CheckResult struct {
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	// Detail is the HTTP status line or the request error.
+	Detail    string    `json:"detail"`
+	Latency   Duration  `json:"latency"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// Captures are the groups captured by the monitor's body patterns.
+	Captures map[string]string `json:"captures,omitempty"`
+	// Failure classifies why a down check failed, e.g. "dns", "tls" or
+	// "http_status".
+	Failure string `json:"failure,omitempty"`
+	// Components are the component statuses reported by a health monitor.
+	Components []HealthComponent `json:"components,omitempty"`
+	// DNSError is set when the check failed because the DNS cache could
+	// not resolve its host name, rather than the site failing.
+	DNSError string `json:"dnsError,omitempty"`
 }
 
-var statusMap = make(map[string]string)
-var statusMutex = &sync.Mutex{}
+// expectMaxBody is how much of a response expect expressions and body
+// patterns see by default. The body is not read at all without them.
+const expectMaxBody = 1 << 20
 
-func sendEmail(emailConfig EmailConfig, url string) {
-	auth := smtp.PlainAuth("", emailConfig.Sender, emailConfig.Password, emailConfig.SMTPHost)
-	to := []string{emailConfig.Recipient}
-	msg := []byte("To: " + emailConfig.Recipient + "\r\n" +
-		"Subject: Website Down: " + url + "\r\n" +
-		"\r\n" +
-		"The website " + url + " is currently down.\r\n")
+// checkTypes maps each monitor type to the function that checks it.
+var checkTypes = map[string]func(Target) CheckResult{
+	"http":            probeHTTP,
+	"content-change":  probeContent,
+	"browser":         probeBrowser,
+	udpType:           probeUDP,
+	snmpType:          probeSNMP,
+	ntpType:           probeNTP,
+	kafkaType:         probeKafka,
+	amqpType:          probeAMQP,
+	elasticsearchType: probeElasticsearch,
+	s3Type:            probeS3,
+	dnsType:           probeDNS,
+	dnsblType:         probeDNSBL,
+	healthType:        probeHealth,
+}
 
-	addr := fmt.Sprintf("%s:%d", emailConfig.SMTPHost, emailConfig.SMTPPort)
-	err := smtp.SendMail(addr, auth, emailConfig.Sender, to, msg)
-	if err != nil {
-		fmt.Printf("Error sending email for %s: %s\n", url, err)
-		fmt.Println("Please ensure your email settings in config.json are correct.")
-		return
+// probeTarget checks target using its monitor type, retrying as many
+// times as it allows.
+func probeTarget(target Target) CheckResult {
+	result := probeOnce(target)
+	for i := 0; i < target.Retries && result.Status == "down"; i++ {
+		result = probeOnce(target)
+	}
+	if result.Status == "down" && target.Retries > 0 {
+		result.Detail += fmt.Sprintf(" (%d attempts)", target.Retries+1)
 	}
-	fmt.Printf("Email notification sent for %s\n", url)
+	return result
 }
 
-func checkWebsite(url string, emailConfig EmailConfig) {
-	resp, err := http.Get(url)
-	statusMutex.Lock()
-	defer statusMutex.Unlock()
-	lastStatus := statusMap[url]
+func probeOnce(target Target) CheckResult {
+	release := limiter.acquire(target.URL)
+	defer release()
+	check, ok := checkTypes[target.Type]
+	if !ok {
+		check = probeHTTP
+	}
+	var result CheckResult
+	switch {
+	case target.Origin != nil:
+		result = probeOrigin(target)
+	case len(target.Endpoints) > 0:
+		result = probeEndpoints(target, check)
+	default:
+		result = check(target)
+	}
+	if result.Status == "down" && result.Failure == "" {
+		result.Failure = failureOther
+	}
+	return result
+}
 
+// probeHTTP checks that target answers with a 2xx status, or one of its
+// expected statuses, or satisfies its expect expression, and that its
+// response headers and body pass any assertions.
+func probeHTTP(target Target) CheckResult {
+	url := target.URL
+	result := CheckResult{URL: url, Status: "down", CheckedAt: time.Now().UTC()}
+	start := time.Now()
+	resp, err := checkGet(target)
 	if err != nil {
-		fmt.Printf("Website %s is down: %s\n", url, err)
-		if lastStatus != "down" {
-			sendEmail(emailConfig, url)
-			statusMap[url] = "down"
+		result.Latency = Duration(time.Since(start))
+		result.Detail, result.Failure = err.Error(), classifyError(err)
+		var resolveErr *resolveError
+		if errors.As(err, &resolveErr) {
+			result.Detail, result.DNSError = resolveErr.Error(), resolveErr.err.Error()
 		}
-		return
+		return result
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
-		fmt.Printf("Website %s is up. Status: %s\n", url, resp.Status)
-		statusMap[url] = "up"
+	var body []byte
+	if target.Expect != "" || target.BodyMatches != nil || target.BodyNotMatches != nil {
+		body, err = readBody(resp, target.bodyLimit(expectMaxBody))
 	} else {
-		fmt.Printf("Website %s is down. Status: %s\n", url, resp.Status)
-		if lastStatus != "down" {
-			sendEmail(emailConfig, url)
-			statusMap[url] = "down"
+		resp.Body.Close()
+	}
+	result.Latency = Duration(time.Since(start))
+	if err != nil {
+		result.Detail, result.Failure = err.Error(), classifyError(err)
+		return result
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		if target.CertPin != nil {
+			certPins.observe(target, resp.TLS.PeerCertificates[0])
+		}
+		if target.CertRenewal != nil {
+			certRenewals.observe(target, resp.TLS.PeerCertificates[0])
 		}
 	}
-}
-
-func startMonitoring(config Config) {
-	// Initial check
-	fmt.Println("--- Initial Check ---")
-	var wg sync.WaitGroup
-	for _, site := range config.Websites {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-			checkWebsite(url, config.Email)
-		}(site)
-	}
-	wg.Wait()
-
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			fmt.Println("\n--- New Check Cycle ---")
-			var wg sync.WaitGroup
-			for _, site := range config.Websites {
-				wg.Add(1)
-				go func(url string) {
-					defer wg.Done()
-					checkWebsite(url, config.Email)
-				}(site)
-			}
-			wg.Wait()
+	result.Detail = resp.Status
+	if target.Expect != "" {
+		ok, err := evalCondition(target.Expect, checkEnv(resp.StatusCode, time.Duration(result.Latency), string(body), resp.Header))
+		switch {
+		case err != nil:
+			result.Detail += ": expect: " + err.Error()
+			result.Failure = failureAssertion
+		case ok:
+			result.Status = "up"
+		default:
+			result.Detail += ": expectation not met"
+			result.Failure = failureAssertion
 		}
+	} else if target.statusExpected(resp.StatusCode) {
+		result.Status = "up"
+	} else {
+		result.Failure = failureStatus
 	}
+	if result.Status == "up" {
+		if failure := checkResponseHeaders(target.ExpectHeaders, resp.Header); failure != "" {
+			result.Status = "down"
+			result.Detail += ": " + failure
+			result.Failure = failureAssertion
+		}
+	}
+	var failure string
+	result.Captures, failure = checkBody(target, body)
+	if failure != "" && result.Status == "up" {
+		result.Status = "down"
+		result.Detail += ": " + failure
+		result.Failure = failureAssertion
+	}
+	return result
 }
 
-type StatusEntry struct {
-	URL    string `json:"url"`
-	Status string `json:"status"`
-}
-
-type PaginatedStatusResponse struct {
-	TotalPages  int           `json:"totalPages"`
-	CurrentPage int           `json:"currentPage"`
-	Data        []StatusEntry `json:"data"`
-}
-
-func statusHandler(w http.ResponseWriter, r *http.Request) {
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+// statusExpected reports whether code counts as up for target.
+func (t Target) statusExpected(code int) bool {
+	if len(t.ExpectedStatus) == 0 {
+		return code >= 200 && code <= 299
 	}
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		limit = 10
+	for _, c := range t.ExpectedStatus {
+		if c == code {
+			return true
+		}
 	}
+	return false
+}
 
-	statusMutex.Lock()
-	// Convert map to slice for sorting and pagination
-	var statuses []StatusEntry
-	for url, status := range statusMap {
-		statuses = append(statuses, StatusEntry{URL: url, Status: status})
+func checkWebsite(url string) {
+	// A target removed while its check was queued has nothing to check.
+	target, ok := targets.get(url)
+	if !ok {
+		return
 	}
-	statusMutex.Unlock()
-
-	// Sort by URL for consistent ordering
-	sort.Slice(statuses, func(i, j int) bool {
-		return statuses[i].URL < statuses[j].URL
-	})
-
-	totalItems := len(statuses)
-	totalPages := (totalItems + limit - 1) / limit
-
-	start := (page - 1) * limit
-	end := start + limit
-	if start > totalItems {
-		start = totalItems
+	if target.Type == pushType {
+		pushes.checkOverdue(target)
+		return
 	}
-	if end > totalItems {
-		end = totalItems
+	if calendars.skipping(target, time.Now()) {
+		return
 	}
-
-	paginatedData := statuses[start:end]
-
-	response := PaginatedStatusResponse{
-		TotalPages:  totalPages,
-		CurrentPage: page,
-		Data:        paginatedData,
+	result := probeTarget(target)
+	if result.Status == "up" {
+		fmt.Printf("Website %s is up. Status: %s\n", url, result.Detail)
+	} else {
+		fmt.Printf("Website %s is down: %s\n", url, result.Detail)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*") // For development, allow any origin
-	json.NewEncoder(w).Encode(response)
+	// Observed first, so the result is weighed by the interval it leads to.
+	adaptive.observe(target, result.Status)
+	recordResult(localLocation, result)
 }
 
-func startAPIServer() {
-	http.HandleFunc("/status", statusHandler)
-	fmt.Println("API server listening on :8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		fmt.Println("Error starting API server:", err)
+func startMonitoring(config Config) {
+	sched := newScheduler(time.Duration(config.Interval), config.Workers)
+	if config.Interval > 0 {
+		pushes.interval = time.Duration(config.Interval)
 	}
+	loadConfigMonitors(config)
+	targets.attach(sched, loadSavedState(config.Restart))
+	startDiscovery(config.Discovery)
+	attachSystemd(sched)
+	diag.mu.Lock()
+	diag.sched = sched
+	diag.mu.Unlock()
+	sched.run(func(url string) {
+		if isLeader() {
+			checkWebsite(url)
+		}
+	})
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "agent":
+			runAgent(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "apply":
+			runApply(os.Args[2:])
+			return
+		case "migrate-config":
+			runMigrateConfig(os.Args[2:])
+			return
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "install":
+			installService(os.Args[2:])
+			return
+		case "uninstall":
+			uninstallService(os.Args[2:])
+			return
+		case "run-as-service":
+			runAsService(os.Args[2:])
+			return
+		case "--nagios", "-nagios":
+			runNagios(os.Args[2:])
+			return
+		}
+	}
+	flag.BoolVar(&dryRun, "dry-run", false, "run checks and render notifications, but log them instead of sending")
+	flag.BoolVar(&readOnly, "read-only", false, "refuse every API request that would change the instance")
+	flag.Parse()
+	runMonitor()
+}
+
+// runMonitor loads config.json from the working directory and monitors
+// until the process exits.
+func runMonitor() {
 	fmt.Println("Uptime Monitor Starting...")
+	takeHandover()
+	if dryRun {
+		fmt.Println("Dry run: notifications will be logged, not sent")
+	}
+	if readOnly {
+		fmt.Println("Read-only: the API will refuse changes")
+	}
 	config, err := loadConfiguration("config.json")
 	if err != nil {
 		fmt.Println("Error loading configuration:", err)
 		return
 	}
+	warnDeprecated(config)
+	watchSignals(config.Restart)
 
-	go startAPIServer()
+	limiter = newHostLimiter(config.RateLimit)
+	policy = newQuorumPolicy(config)
+	holds = newAlertHolds(config)
+	if holds.grace > 0 || holds.confirmations > 1 {
+		fmt.Println("Holding back first alerts:", holds.describe())
+	}
+	// A dry run must not take leadership away from the real instances.
+	if dryRun && config.HA.LeaseFile != "" {
+		fmt.Println("Dry run: ignoring HA and acting as leader")
+	} else if elector = newLeaderElector(config); elector != nil {
+		fmt.Printf("HA enabled as node %s, lease TTL %s\n", elector.node, elector.ttl)
+		elector.step()
+		go elector.run()
+	}
+	if config.Anomaly != nil {
+		anomalies = newAnomalyDetector(*config.Anomaly)
+	}
+	tenancy = newProjectRegistry(config)
+	if config.Chaos != nil {
+		chaos = newChaosStore(*config.Chaos)
+	}
+	if config.Deploys != nil {
+		deploys = newDeployStore(*config.Deploys)
+	}
+	if config.DNSCache != nil {
+		if dnsCache, err = newResolverCache(*config.DNSCache); err != nil {
+			fmt.Println("Error configuring the DNS cache:", err)
+		}
+	}
+	if config.OIDC != nil {
+		if oidc, err = newOIDCProvider(*config.OIDC); err != nil {
+			fmt.Println("Error configuring OIDC login:", err)
+		}
+	}
+	if config.Tokens != nil {
+		if apiTokens, err = newTokenStore(*config.Tokens, len(config.AdminKeys) > 0 || oidc != nil); err != nil {
+			fmt.Println("Error configuring API tokens:", err)
+		}
+	}
+	setupLocales(config)
+	setupTimezone(config)
+	setupBusinessHours(config)
+	startCalendars(config.Calendars)
+	setupOnCall(config)
+	startAudit(config.Audit)
+	startNotifiers(config)
+	startReminders(config.Reminders)
+	startMetricsExport(config.Metrics)
+	startHistory(config.History)
+	if config.Browser != nil {
+		if browser, err = newBrowserRunner(*config.Browser); err != nil {
+			fmt.Println("Error configuring browser checks:", err)
+		}
+	}
+	maintenanceWindows = config.Maintenance
+	setDefaultHeaders(config)
+	if config.CertPinFile != "" {
+		if err := certPins.load(config.CertPinFile); err != nil {
+			fmt.Println("Error loading certificate fingerprints:", err)
+		}
+	}
+	if config.ContentBaselineFile != "" {
+		if err := contentBaselines.load(config.ContentBaselineFile); err != nil {
+			fmt.Println("Error loading content baselines:", err)
+		}
+	}
+	startReports(config)
+	startSLOTracking()
+	startTLSGrading()
+	go startAPIServer(config)
 	startMonitoring(config)
 }
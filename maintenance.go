@@ -0,0 +1,32 @@
+package main
+
+import "time"
+
+// MaintenanceWindow is a planned period during which changes to a monitor,
+// such as a certificate rotation, are expected.
+type MaintenanceWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Monitors lists the names or URLs covered. Empty covers every monitor.
+	Monitors []string `json:"monitors,omitempty"`
+}
+
+var maintenanceWindows []MaintenanceWindow
+
+// inMaintenance reports whether t is inside a maintenance window at now.
+func inMaintenance(t Target, now time.Time) bool {
+	for _, w := range maintenanceWindows {
+		if now.Before(w.Start) || !now.Before(w.End) {
+			continue
+		}
+		if len(w.Monitors) == 0 {
+			return true
+		}
+		for _, m := range w.Monitors {
+			if m == t.URL || (t.Name != "" && m == t.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MetricsConfig pushes per-monitor availability and latency to external
+// monitoring services.
+type MetricsConfig struct {
+	// Interval is how often metrics are pushed. Defaults to one minute.
+	Interval   Duration          `json:"interval"`
+	CloudWatch *CloudWatchConfig `json:"cloudwatch"`
+	GCP        *GCPMetricsConfig `json:"gcp"`
+}
+
+// metricSample is the latest observation for one monitor.
+type metricSample struct {
+	Target  Target
+	Up      bool
+	Latency time.Duration
+	Time    time.Time
+}
+
+// metricSink receives a batch of samples on every push.
+type metricSink interface {
+	name() string
+	push(samples []metricSample) error
+}
+
+type metricsRecorder struct {
+	mu     sync.Mutex
+	latest map[string]metricSample
+}
+
+var metrics = &metricsRecorder{latest: make(map[string]metricSample)}
+
+func (m *metricsRecorder) observe(target Target, status string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latest[target.URL] = metricSample{Target: target, Up: status == "up", Latency: latency, Time: time.Now().UTC()}
+}
+
+// samples returns the latest sample for every monitor still being checked.
+func (m *metricsRecorder) samples() []metricSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]metricSample, 0, len(m.latest))
+	for url, s := range m.latest {
+		if !targets.has(url) {
+			delete(m.latest, url)
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Target.URL < out[j].Target.URL })
+	return out
+}
+
+func startMetricsExport(config MetricsConfig) {
+	var sinks []metricSink
+	if config.CloudWatch != nil {
+		sinks = append(sinks, newCloudWatchSink(*config.CloudWatch))
+	}
+	if config.GCP != nil {
+		sink, err := newGCPSink(*config.GCP)
+		if err != nil {
+			fmt.Println("Error configuring Google Cloud Monitoring export:", err)
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+	if len(sinks) == 0 {
+		return
+	}
+
+	interval := time.Duration(config.Interval)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if !isLeader() {
+				continue
+			}
+			samples := metrics.samples()
+			if len(samples) == 0 {
+				continue
+			}
+			for _, sink := range sinks {
+				if dryRunSkip(sink.name()+" metrics", sink.name(), []byte(fmt.Sprintf("%d samples", len(samples)))) {
+					continue
+				}
+				if err := sink.push(samples); err != nil {
+					fmt.Printf("Error pushing metrics to %s: %s\n", sink.name(), err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CloudWatchConfig exports metrics with PutMetricData.
+type CloudWatchConfig struct {
+	Region string `json:"region"`
+	// Namespace defaults to "UptimeMonitor".
+	Namespace string `json:"namespace"`
+	// Dimensions are added to every metric alongside Monitor and URL.
+	Dimensions map[string]string `json:"dimensions"`
+	awsCredentials
+	// Endpoint overrides https://monitoring.<region>.amazonaws.com.
+	Endpoint string `json:"endpoint"`
+}
+
+// cloudWatchBatch stays well under PutMetricData's per-request limits.
+const cloudWatchBatch = 500
+
+type cloudWatchSink struct {
+	config CloudWatchConfig
+}
+
+func newCloudWatchSink(config CloudWatchConfig) *cloudWatchSink {
+	if config.Namespace == "" {
+		config.Namespace = "UptimeMonitor"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://monitoring." + config.Region + ".amazonaws.com"
+	}
+	return &cloudWatchSink{config: config}
+}
+
+func (c *cloudWatchSink) name() string { return "cloudwatch" }
+
+func (c *cloudWatchSink) push(samples []metricSample) error {
+	for start := 0; start < len(samples); start += cloudWatchBatch / 2 {
+		end := min(start+cloudWatchBatch/2, len(samples))
+		if err := c.put(samples[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cloudWatchSink) put(samples []metricSample) error {
+	form := url.Values{
+		"Action":    {"PutMetricData"},
+		"Version":   {"2010-08-01"},
+		"Namespace": {c.config.Namespace},
+	}
+	static := make([]string, 0, len(c.config.Dimensions))
+	for k := range c.config.Dimensions {
+		static = append(static, k)
+	}
+	sort.Strings(static)
+
+	member := 0
+	add := func(s metricSample, metric, unit string, value float64) {
+		member++
+		prefix := "MetricData.member." + strconv.Itoa(member) + "."
+		form.Set(prefix+"MetricName", metric)
+		form.Set(prefix+"Unit", unit)
+		form.Set(prefix+"Value", strconv.FormatFloat(value, 'f', -1, 64))
+		form.Set(prefix+"Timestamp", s.Time.Format(time.RFC3339))
+		dims := [][2]string{{"Monitor", s.Target.displayName()}, {"URL", s.Target.URL}}
+		for _, k := range static {
+			dims = append(dims, [2]string{k, c.config.Dimensions[k]})
+		}
+		for i, d := range dims {
+			dp := prefix + "Dimensions.member." + strconv.Itoa(i+1) + "."
+			form.Set(dp+"Name", d[0])
+			form.Set(dp+"Value", d[1])
+		}
+	}
+	for _, s := range samples {
+		up := 0.0
+		if s.Up {
+			up = 1
+		}
+		add(s, "Up", "None", up)
+		add(s, "Latency", "Milliseconds", float64(s.Latency)/float64(time.Millisecond))
+	}
+
+	body := []byte(form.Encode())
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(c.config.Endpoint, "/")+"/", strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, body, c.config.awsCredentials.resolve(), c.config.Region, "monitoring", time.Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("PutMetricData returned %s: %s", resp.Status, msg)
+	}
+	return nil
+}
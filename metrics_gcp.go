@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GCPMetricsConfig exports metrics to Google Cloud Monitoring as custom
+// metrics.
+type GCPMetricsConfig struct {
+	ProjectID string `json:"project_id"`
+	// MetricPrefix is the path under custom.googleapis.com/. Defaults to
+	// "uptime_monitor".
+	MetricPrefix string `json:"metric_prefix"`
+	// Labels are added to every time series alongside monitor and url.
+	Labels map[string]string `json:"labels"`
+	// CredentialsFile is a service account JSON key. Without it the token
+	// comes from the GCE/GKE metadata server.
+	CredentialsFile string `json:"credentials_file"`
+}
+
+const (
+	gcpMonitoringScope = "https://www.googleapis.com/auth/monitoring.write"
+	gcpMetadataToken   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	// gcpBatch is the per-request time series limit of timeSeries.create.
+	gcpBatch = 200
+)
+
+type gcpServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+type gcpSink struct {
+	config  GCPMetricsConfig
+	account *gcpServiceAccount
+	key     *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	// pushed is the time of the last sample written for each monitor.
+	pushed map[string]time.Time
+}
+
+func newGCPSink(config GCPMetricsConfig) (*gcpSink, error) {
+	if config.ProjectID == "" {
+		return nil, fmt.Errorf("project_id is required")
+	}
+	if config.MetricPrefix == "" {
+		config.MetricPrefix = "uptime_monitor"
+	}
+	g := &gcpSink{config: config, pushed: make(map[string]time.Time)}
+	if config.CredentialsFile != "" {
+		b, err := os.ReadFile(config.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		var account gcpServiceAccount
+		if err := json.Unmarshal(b, &account); err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode([]byte(account.PrivateKey))
+		if block == nil {
+			return nil, fmt.Errorf("no private key in %s", config.CredentialsFile)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("service account key is not RSA")
+		}
+		if account.TokenURI == "" {
+			account.TokenURI = "https://oauth2.googleapis.com/token"
+		}
+		g.account, g.key = &account, key
+	}
+	return g, nil
+}
+
+func (g *gcpSink) name() string { return "google cloud monitoring" }
+
+type gcpTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// accessToken returns a cached OAuth token, refreshing it shortly before it
+// expires.
+func (g *gcpSink) accessToken() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.token != "" && time.Now().Before(g.expires) {
+		return g.token, nil
+	}
+
+	var resp *http.Response
+	var err error
+	if g.account != nil {
+		assertion, err := g.signedAssertion()
+		if err != nil {
+			return "", err
+		}
+		resp, err = http.PostForm(g.account.TokenURI, url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		})
+		if err != nil {
+			return "", err
+		}
+	} else {
+		req, _ := http.NewRequest(http.MethodGet, gcpMetadataToken, nil)
+		req.Header.Set("Metadata-Flavor", "Google")
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned %s", resp.Status)
+	}
+	var tok gcpTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", err
+	}
+	g.token = tok.AccessToken
+	g.expires = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return g.token, nil
+}
+
+// signedAssertion builds the RS256 JWT exchanged for an access token.
+func (g *gcpSink) signedAssertion() (string, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   g.account.ClientEmail,
+		"scope": gcpMonitoringScope,
+		"aud":   g.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, g.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+type gcpTimeSeries struct {
+	Metric struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metric"`
+	Resource struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels"`
+	} `json:"resource"`
+	Points []gcpPoint `json:"points"`
+}
+
+type gcpPoint struct {
+	Interval struct {
+		EndTime string `json:"endTime"`
+	} `json:"interval"`
+	Value map[string]any `json:"value"`
+}
+
+func (g *gcpSink) series(s metricSample, metric string, value map[string]any) gcpTimeSeries {
+	var ts gcpTimeSeries
+	ts.Metric.Type = "custom.googleapis.com/" + g.config.MetricPrefix + "/" + metric
+	ts.Metric.Labels = map[string]string{"monitor": s.Target.displayName(), "url": s.Target.URL}
+	for k, v := range g.config.Labels {
+		ts.Metric.Labels[k] = v
+	}
+	ts.Resource.Type = "global"
+	ts.Resource.Labels = map[string]string{"project_id": g.config.ProjectID}
+	var p gcpPoint
+	p.Interval.EndTime = s.Time.Format(time.RFC3339Nano)
+	p.Value = value
+	ts.Points = []gcpPoint{p}
+	return ts
+}
+
+// push writes the samples taken since the last push. Cloud Monitoring
+// rejects a point that is not newer than the last one of its series, and
+// the whole request with it, so monitors not checked since are left out.
+func (g *gcpSink) push(samples []metricSample) error {
+	g.mu.Lock()
+	var fresh []metricSample
+	for _, s := range samples {
+		if s.Time.After(g.pushed[s.Target.URL]) {
+			fresh = append(fresh, s)
+		}
+	}
+	g.mu.Unlock()
+	// Each sample makes two time series.
+	for start := 0; start < len(fresh); start += gcpBatch / 2 {
+		batch := fresh[start:min(start+gcpBatch/2, len(fresh))]
+		var series []gcpTimeSeries
+		for _, s := range batch {
+			up := "0"
+			if s.Up {
+				up = "1"
+			}
+			series = append(series,
+				g.series(s, "up", map[string]any{"int64Value": up}),
+				g.series(s, "latency_ms", map[string]any{"doubleValue": float64(s.Latency) / float64(time.Millisecond)}),
+			)
+		}
+		if err := g.create(series); err != nil {
+			return err
+		}
+		g.mu.Lock()
+		for _, s := range batch {
+			g.pushed[s.Target.URL] = s.Time
+		}
+		g.mu.Unlock()
+	}
+	return nil
+}
+
+func (g *gcpSink) create(series []gcpTimeSeries) error {
+	token, err := g.accessToken()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{"timeSeries": series})
+	if err != nil {
+		return err
+	}
+	endpoint := "https://monitoring.googleapis.com/v3/projects/" + url.PathEscape(g.config.ProjectID) + "/timeSeries"
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("timeSeries.create returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// configSchemaVersion is the config schema this build reads and
+// migrate-config writes. Files without a version are version 1.
+const configSchemaVersion = 2
+
+// configMigration upgrades a config document to version to, returning the
+// changes it made for the user.
+type configMigration struct {
+	to    int
+	apply func(doc []yamlPair) ([]yamlPair, []string)
+}
+
+// configMigrations are applied in order to bring a file up to
+// configSchemaVersion.
+var configMigrations = []configMigration{
+	{to: 2, apply: migrateWebsites},
+}
+
+// deprecatedFields are settings that still work but have a replacement
+// migrate-config moves them to.
+var deprecatedFields = []struct {
+	name, replacement string
+	used              func(Config) bool
+}{
+	{"websites", "monitors", func(c Config) bool { return len(c.Websites) > 0 }},
+}
+
+// warnDeprecated prints a warning at startup for each deprecated setting
+// config uses, and for files written for a newer build.
+func warnDeprecated(config Config) {
+	if config.Version > configSchemaVersion {
+		fmt.Printf("Warning: config.json is schema version %d, but this build only knows version %d; newer settings are ignored\n",
+			config.Version, configSchemaVersion)
+	}
+	for _, d := range deprecatedFields {
+		if d.used(config) {
+			fmt.Printf("Warning: %s is deprecated in favour of %s; run \"uptime-monitor migrate-config\" to upgrade config.json\n",
+				d.name, d.replacement)
+		}
+	}
+}
+
+// migrateWebsites turns each URL in websites into a monitor, ahead of the
+// existing monitors as they are checked in that order.
+func migrateWebsites(doc []yamlPair) ([]yamlPair, []string) {
+	i := pairIndex(doc, "websites")
+	if i < 0 {
+		return doc, nil
+	}
+	urls, _ := doc[i].value.([]any)
+	doc = append(doc[:i], doc[i+1:]...)
+	if len(urls) == 0 {
+		return doc, []string{"removed the empty websites list"}
+	}
+	var moved []any
+	for _, u := range urls {
+		moved = append(moved, []yamlPair{{key: "url", value: u}})
+	}
+	if j := pairIndex(doc, "monitors"); j >= 0 {
+		existing, _ := doc[j].value.([]any)
+		doc[j].value = append(moved, existing...)
+	} else {
+		// Where websites was, so the file reads as before.
+		doc = append(doc[:i], append([]yamlPair{{key: "monitors", value: moved}}, doc[i:]...)...)
+	}
+	return doc, []string{fmt.Sprintf("moved %d websites into monitors", len(urls))}
+}
+
+func pairIndex(doc []yamlPair, key string) int {
+	for i, p := range doc {
+		if p.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// migrateConfig upgrades the config document data to configSchemaVersion,
+// keeping its keys in order. It returns the upgraded file and the changes
+// made, none when it was current already.
+func migrateConfig(data []byte) ([]byte, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := readOrderedJSON(dec)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, ok := v.([]yamlPair)
+	if !ok {
+		return nil, nil, fmt.Errorf("the config must be a JSON object")
+	}
+	version := 1
+	if i := pairIndex(doc, "version"); i >= 0 {
+		n, err := doc[i].value.(json.Number).Int64()
+		if err != nil {
+			return nil, nil, fmt.Errorf("version must be an integer")
+		}
+		version = int(n)
+	}
+	if version > configSchemaVersion {
+		return nil, nil, fmt.Errorf("the config is schema version %d, newer than this build's %d", version, configSchemaVersion)
+	}
+	var changes []string
+	for _, m := range configMigrations {
+		if m.to <= version {
+			continue
+		}
+		var done []string
+		doc, done = m.apply(doc)
+		changes = append(changes, done...)
+		version = m.to
+	}
+	if len(changes) == 0 && pairIndex(doc, "version") >= 0 {
+		return data, nil, nil
+	}
+	if i := pairIndex(doc, "version"); i >= 0 {
+		doc[i].value = json.Number(fmt.Sprint(version))
+	} else {
+		doc = append([]yamlPair{{key: "version", value: json.Number(fmt.Sprint(version))}}, doc...)
+		changes = append(changes, fmt.Sprintf("set version to %d", version))
+	}
+	var out strings.Builder
+	writeOrderedJSON(&out, doc, "")
+	out.WriteString("\n")
+	return []byte(out.String()), changes, nil
+}
+
+// writeOrderedJSON encodes a document read by readOrderedJSON, indented by
+// two spaces. Objects and lists of scalars that fit stay on one line.
+func writeOrderedJSON(out *strings.Builder, v any, indent string) {
+	if s, ok := compactJSON(v); ok && len(indent)+len(s) <= 100 {
+		out.WriteString(s)
+		return
+	}
+	inner := indent + "  "
+	switch v := v.(type) {
+	case []yamlPair:
+		out.WriteString("{\n")
+		for i, p := range v {
+			key, _ := json.Marshal(p.key)
+			out.WriteString(inner + string(key) + ": ")
+			writeOrderedJSON(out, p.value, inner)
+			if i < len(v)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "}")
+	case []any:
+		out.WriteString("[\n")
+		for i, item := range v {
+			out.WriteString(inner)
+			writeOrderedJSON(out, item, inner)
+			if i < len(v)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "]")
+	}
+}
+
+// compactJSON renders v on one line when it holds no nested objects or
+// lists, reporting false otherwise.
+func compactJSON(v any) (string, bool) {
+	switch v := v.(type) {
+	case []yamlPair:
+		parts := make([]string, len(v))
+		for i, p := range v {
+			key, _ := json.Marshal(p.key)
+			s, ok := compactJSON(p.value)
+			if !ok || isContainer(p.value) {
+				return "", false
+			}
+			parts[i] = string(key) + ": " + s
+		}
+		if len(parts) == 0 {
+			return "{}", true
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", true
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, ok := compactJSON(item)
+			if !ok || isContainer(item) {
+				return "", false
+			}
+			parts[i] = s
+		}
+		return "[" + strings.Join(parts, ", ") + "]", true
+	}
+	b, err := json.Marshal(v)
+	return string(b), err == nil
+}
+
+func isContainer(v any) bool {
+	switch v.(type) {
+	case []yamlPair, []any:
+		return true
+	}
+	return false
+}
+
+// runMigrateConfig upgrades a config file in place, keeping the original
+// next to it with a .bak suffix.
+func runMigrateConfig(args []string) {
+	fs := flag.NewFlagSet("migrate-config", flag.ExitOnError)
+	file := fs.String("f", "config.json", "config file to upgrade")
+	check := fs.Bool("check", false, "only report whether the file needs upgrading, exiting 1 if it does")
+	fs.Parse(args)
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading config:", err)
+		os.Exit(1)
+	}
+	out, changes, err := migrateConfig(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error migrating %s: %s\n", *file, err)
+		os.Exit(1)
+	}
+	if len(changes) == 0 {
+		fmt.Printf("%s is already at schema version %d.\n", *file, configSchemaVersion)
+		return
+	}
+	for _, c := range changes {
+		fmt.Println("  -", c)
+	}
+	if *check {
+		fmt.Printf("%s needs upgrading to schema version %d.\n", *file, configSchemaVersion)
+		os.Exit(1)
+	}
+	// Check the result still loads before touching the original.
+	var config Config
+	if err := json.Unmarshal(out, &config); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: the upgraded config does not load (%s); %s is unchanged\n", err, *file)
+		os.Exit(1)
+	}
+	info, err := os.Stat(*file)
+	if err == nil {
+		err = os.WriteFile(*file+".bak", data, info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.WriteFile(*file, out, info.Mode().Perm())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing config:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Upgraded %s to schema version %d; the original is in %s.bak.\n", *file, configSchemaVersion, *file)
+}
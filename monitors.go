@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MonitorList is the body of /monitors/import and /monitors/export.
+type MonitorList struct {
+	Monitors []MonitorConfig `json:"monitors"`
+}
+
+// ImportResult lists the monitors an import added, changed and removed,
+// by URL, or would have with dry_run.
+type ImportResult struct {
+	Added   []string `json:"added"`
+	Updated []string `json:"updated"`
+	// Changes lists the settings that differ for each updated monitor.
+	Changes   map[string][]string `json:"changes,omitempty"`
+	Removed   []string            `json:"removed"`
+	Unchanged int                 `json:"unchanged"`
+	DryRun    bool                `json:"dryRun,omitempty"`
+}
+
+// configMonitors is the monitor list the "config" target source was last
+// built from: config.json's at startup, or the last import. config keeps
+// the defaults and templates monitors are resolved with.
+var configMonitors = struct {
+	sync.Mutex
+	config Config
+	list   []MonitorConfig
+}{}
+
+// loadConfigMonitors builds the "config" targets from config, with each
+// of its websites standing for a monitor with only a url.
+func loadConfigMonitors(config Config) {
+	list := make([]MonitorConfig, 0, len(config.Websites)+len(config.Monitors))
+	for _, url := range config.Websites {
+		list = append(list, MonitorConfig{URL: url})
+	}
+	list = append(list, config.Monitors...)
+	configMonitors.Lock()
+	defer configMonitors.Unlock()
+	configMonitors.config = config
+	configMonitors.list = list
+	targets.set("config", configTargets(config))
+}
+
+// monitorsRevision identifies list, so an import can be made conditional
+// on the list a plan was made against.
+func monitorsRevision(list []MonitorConfig) string {
+	b, _ := json.Marshal(list)
+	h := fnv.New64a()
+	h.Write(b)
+	return `"` + strconv.FormatUint(h.Sum64(), 36) + `"`
+}
+
+// errStaleRevision is returned by replaceConfigMonitors when the monitors
+// changed since the revision the caller expected.
+var errStaleRevision = errors.New("the monitors changed since the plan was made")
+
+// replaceConfigMonitors makes list the configured monitors, unless dryRun,
+// and reports how that changed them. When ifMatch is set, the current
+// list must still be at that revision. The revision after the call is
+// returned too.
+func replaceConfigMonitors(list []MonitorConfig, ifMatch string, dryRun bool) (ImportResult, string, error) {
+	configMonitors.Lock()
+	defer configMonitors.Unlock()
+	revision := monitorsRevision(configMonitors.list)
+	if ifMatch != "" && !etagMatches(ifMatch, revision) {
+		return ImportResult{}, revision, errStaleRevision
+	}
+	result := diffMonitors(configMonitors.list, list)
+	if dryRun {
+		result.DryRun = true
+		return result, revision, nil
+	}
+	config := configMonitors.config
+	config.Websites = nil
+	config.Monitors = list
+	configMonitors.config = config
+	configMonitors.list = list
+	targets.set("config", configTargets(config))
+	return result, monitorsRevision(list), nil
+}
+
+func diffMonitors(current, desired []MonitorConfig) ImportResult {
+	result := ImportResult{Added: []string{}, Updated: []string{}, Removed: []string{}}
+	have := make(map[string]MonitorConfig, len(current))
+	for _, m := range current {
+		have[m.URL] = m
+	}
+	for _, m := range desired {
+		old, ok := have[m.URL]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, m.URL)
+		default:
+			changed := changedSettings(old, m)
+			if len(changed) == 0 {
+				result.Unchanged++
+				break
+			}
+			result.Updated = append(result.Updated, m.URL)
+			if result.Changes == nil {
+				result.Changes = make(map[string][]string)
+			}
+			result.Changes[m.URL] = changed
+		}
+		delete(have, m.URL)
+	}
+	for url := range have {
+		result.Removed = append(result.Removed, url)
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Removed)
+	return result
+}
+
+// changedSettings returns the names of the settings that differ between a
+// and b. They are compared as they encode, since validation fills in
+// unexported fields of check settings.
+func changedSettings(a, b MonitorConfig) []string {
+	var ma, mb map[string]json.RawMessage
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	json.Unmarshal(ja, &ma)
+	json.Unmarshal(jb, &mb)
+	var changed []string
+	for k, v := range ma {
+		if w, ok := mb[k]; !ok || !bytes.Equal(v, w) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range mb {
+		if _, ok := ma[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// validateMonitorList checks that every monitor has a url and that no url
+// is listed twice.
+func validateMonitorList(list []MonitorConfig) error {
+	seen := make(map[string]bool, len(list))
+	for i, m := range list {
+		if m.URL == "" {
+			return fmt.Errorf("monitor %d has no url", i+1)
+		}
+		if seen[m.URL] {
+			return fmt.Errorf("%s is listed twice", m.URL)
+		}
+		seen[m.URL] = true
+	}
+	return nil
+}
+
+// wantsYAML reports whether header, a Content-Type or Accept value, names
+// a YAML media type.
+func wantsYAML(header string) bool {
+	return strings.Contains(header, "yaml")
+}
+
+// readMonitorList decodes a MonitorList from r's body, as JSON or, with a
+// YAML Content-Type, YAML. Unknown settings are rejected so that typos
+// don't silently drop a setting from every monitor.
+func readMonitorList(w http.ResponseWriter, r *http.Request) ([]MonitorConfig, bool) {
+	data, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, problemBodyTooLarge, fmt.Sprintf("request bodies are limited to %d bytes", tooLarge.Limit))
+		return nil, false
+	}
+	if err == nil && wantsYAML(r.Header.Get("Content-Type")) {
+		var doc any
+		if doc, err = parseYAML(data); err == nil {
+			data, err = json.Marshal(doc)
+		}
+	}
+	var list MonitorList
+	if err == nil {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&list)
+	}
+	if err == nil {
+		err = validateMonitorList(list.Monitors)
+	}
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, "invalid monitor list: "+err.Error())
+		return nil, false
+	}
+	return list.Monitors, true
+}
+
+// monitorsImportHandler serves POST /monitors/import, replacing every
+// configured monitor with the posted list. With dry_run it only reports
+// the plan. The response's ETag is the revision of the monitors, which
+// If-Match can require to be unchanged.
+func monitorsImportHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodPost) {
+		return
+	}
+	if !requireAdmin(w, r, "importing monitors requires an admin key") {
+		return
+	}
+	list, ok := readMonitorList(w, r)
+	if !ok {
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	result, revision, err := replaceConfigMonitors(list, r.Header.Get("If-Match"), dryRun)
+	w.Header().Set("ETag", revision)
+	if err != nil {
+		writeProblem(w, r, http.StatusPreconditionFailed, problemConflict, err.Error())
+		return
+	}
+	if dryRun {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	fmt.Printf("Imported %d monitors: %d added, %d updated, %d removed\n", len(list), len(result.Added), len(result.Updated), len(result.Removed))
+	audit.admin(r, "monitors.import", "", fmt.Sprintf("%d added, %d updated, %d removed", len(result.Added), len(result.Updated), len(result.Removed)))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// monitorsExportHandler serves GET /monitors/export, the configured
+// monitors as JSON or, when the client accepts it, YAML. Monitors found by
+// discovery are not included.
+func monitorsExportHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	if !requireAdmin(w, r, "exporting monitors requires an admin key") {
+		return
+	}
+	configMonitors.Lock()
+	list := MonitorList{Monitors: append([]MonitorConfig{}, configMonitors.list...)}
+	configMonitors.Unlock()
+	if wantsYAML(r.Header.Get("Accept")) || r.URL.Query().Get("format") == "yaml" {
+		body, _ := marshalYAML(list)
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(body)
+		return
+	}
+	writeJSONCached(w, r, list)
+}
+
+// monitorRoutes are the per-monitor routes under /monitors/{monitor}/.
+var monitorRoutes = map[string]func(http.ResponseWriter, *http.Request, Target){
+	"latency": latencyHandler,
+	"regions": regionsHandler,
+	"uptime":  dailyUptimeHandler,
+	"silence": silenceHandler,
+}
+
+// monitorOwnMethods lists the routes that check the request method
+// themselves; the others only answer GET.
+var monitorOwnMethods = map[string]bool{"silence": true}
+
+// monitorPathHandler serves /monitors/{monitor}/..., which name the
+// monitor by name or URL-escaped URL, handing the monitor to its route.
+func monitorPathHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), "/monitors/")
+	i := strings.LastIndex(rest, "/")
+	if i < 0 || monitorRoutes[rest[i+1:]] == nil {
+		notFoundHandler(w, r)
+		return
+	}
+	if !monitorOwnMethods[rest[i+1:]] && methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	name, err := url.PathUnescape(rest[:i])
+	if err != nil || name == "" {
+		writeProblem(w, r, http.StatusNotFound, problemUnknownMonitor, "a monitor name or URL is required")
+		return
+	}
+	target, ok := targets.find(name)
+	if !ok || !requestScope(r).canSee(target.URL) {
+		writeProblem(w, r, http.StatusNotFound, problemUnknownMonitor, "no monitor is named "+name)
+		return
+	}
+	monitorRoutes[rest[i+1:]](w, r, target)
+}
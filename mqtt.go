@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTTConfig publishes state changes and periodic status snapshots to an
+// MQTT broker, e.g. for Home Assistant or Node-RED.
+type MQTTConfig struct {
+	// Broker is tcp://host:1883 or tls://host:8883.
+	Broker   string `json:"broker"`
+	ClientID string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// CAFile verifies the broker's certificate for tls:// brokers.
+	CAFile string `json:"ca_file"`
+	// TopicPrefix defaults to "uptime-monitor".
+	TopicPrefix string `json:"topic_prefix"`
+	// QoS is 0 or 1.
+	QoS    int  `json:"qos"`
+	Retain bool `json:"retain"`
+	// SnapshotInterval is how often the full status list is published.
+	// Defaults to one minute.
+	SnapshotInterval Duration `json:"snapshot_interval"`
+}
+
+const (
+	mqttKeepAlive  = 60 * time.Second
+	mqttAckTimeout = 10 * time.Second
+	// mqttWriteTimeout bounds each write, so a stalled broker does not hold
+	// m.mu, and every notifier worker waiting on it, indefinitely.
+	mqttWriteTimeout = 10 * time.Second
+)
+
+type mqttEvent struct {
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	Severity string    `json:"severity"`
+	Status   string    `json:"status"`
+	Detail   string    `json:"detail"`
+	Failure  string    `json:"failure,omitempty"`
+	Time     time.Time `json:"time"`
+	// Downtime is set on recoveries to how long the monitor was down.
+	Downtime Duration          `json:"downtime,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// mqttPublisher is a minimal MQTT 3.1.1 client that only publishes.
+type mqttPublisher struct {
+	config MQTTConfig
+
+	mu     sync.Mutex
+	conn   net.Conn
+	nextID uint16
+	acks   map[uint16]chan struct{}
+}
+
+func newMQTTPublisher(config MQTTConfig) (*mqttPublisher, error) {
+	if _, err := url.Parse(config.Broker); err != nil {
+		return nil, err
+	}
+	if config.QoS < 0 || config.QoS > 1 {
+		return nil, fmt.Errorf("mqtt qos must be 0 or 1")
+	}
+	if config.TopicPrefix == "" {
+		config.TopicPrefix = "uptime-monitor"
+	}
+	if config.ClientID == "" {
+		host, _ := os.Hostname()
+		config.ClientID = "uptime-monitor-" + host
+	}
+	m := &mqttPublisher{config: config, acks: make(map[uint16]chan struct{})}
+	go m.snapshotLoop()
+	return m, nil
+}
+
+func (m *mqttPublisher) name() string { return "mqtt" }
+
+var mqttTopicUnsafe = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// topicSlug makes a monitor name safe to use as a topic level.
+func topicSlug(name string) string {
+	return strings.Trim(mqttTopicUnsafe.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+func (m *mqttPublisher) notify(n notification) error {
+	if n.Reminder {
+		// State topics are retained; subscribers already have it.
+		return errNotApplicable
+	}
+	payload, err := json.Marshal(mqttEvent{
+		Name:     n.Target.displayName(),
+		URL:      n.Target.URL,
+		Severity: n.Target.severity(),
+		Status:   n.Status,
+		Detail:   n.Detail,
+		Failure:  n.Failure,
+		Time:     n.Time,
+		Downtime: Duration(n.Downtime.Round(time.Second)),
+		Metadata: n.Target.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	topic := "/state"
+	if n.Kind != notifyState {
+		topic = "/" + n.Kind
+	}
+	return m.publish(m.config.TopicPrefix+"/monitors/"+topicSlug(n.Target.displayName())+topic, payload)
+}
+
+func (m *mqttPublisher) snapshotLoop() {
+	interval := time.Duration(m.config.SnapshotInterval)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		if !isLeader() {
+			continue
+		}
+		entries, _, _ := statuses.page(0, math.MaxInt)
+		payload, err := json.Marshal(entries)
+		if err != nil {
+			continue
+		}
+		if err := m.publish(m.config.TopicPrefix+"/status", payload); err != nil {
+			fmt.Println("Error publishing MQTT status snapshot:", err)
+		}
+	}
+}
+
+func (m *mqttPublisher) publish(topic string, payload []byte) error {
+	if dryRunSkip("mqtt", m.config.Broker+" "+topic, payload) {
+		return nil
+	}
+	m.mu.Lock()
+	if m.conn == nil {
+		if err := m.connect(); err != nil {
+			m.mu.Unlock()
+			return err
+		}
+	}
+	flags := byte(0x30 | m.config.QoS<<1)
+	if m.config.Retain {
+		flags |= 0x01
+	}
+	body := mqttString(topic)
+	var ack chan struct{}
+	var id uint16
+	if m.config.QoS == 1 {
+		m.nextID++
+		if m.nextID == 0 {
+			m.nextID = 1
+		}
+		id = m.nextID
+		body = binary.BigEndian.AppendUint16(body, id)
+		ack = make(chan struct{})
+		m.acks[id] = ack
+	}
+	body = append(body, payload...)
+	m.conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+	_, err := m.conn.Write(mqttPacket(flags, body))
+	if err != nil {
+		delete(m.acks, id)
+		m.dropLocked()
+	}
+	m.mu.Unlock()
+	if err != nil || ack == nil {
+		return err
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-time.After(mqttAckTimeout):
+		m.mu.Lock()
+		delete(m.acks, id)
+		m.mu.Unlock()
+		return fmt.Errorf("no PUBACK for %s", topic)
+	}
+}
+
+// connect dials the broker and completes the CONNECT handshake. m.mu must be
+// held.
+func (m *mqttPublisher) connect() error {
+	u, _ := url.Parse(m.config.Broker)
+	var conn net.Conn
+	var err error
+	switch u.Scheme {
+	case "tcp", "mqtt", "":
+		conn, err = net.DialTimeout("tcp", u.Host, 10*time.Second)
+	case "tls", "ssl", "mqtts":
+		cfg := &tls.Config{ServerName: u.Hostname()}
+		if m.config.CAFile != "" {
+			pem, err := os.ReadFile(m.config.CAFile)
+			if err != nil {
+				return err
+			}
+			cfg.RootCAs = x509.NewCertPool()
+			cfg.RootCAs.AppendCertsFromPEM(pem)
+		}
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", u.Host, cfg)
+	default:
+		return fmt.Errorf("unsupported mqtt scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return err
+	}
+
+	flags := byte(0x02) // clean session
+	if m.config.Username != "" {
+		flags |= 0x80
+	}
+	if m.config.Password != "" {
+		flags |= 0x40
+	}
+	body := mqttString("MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	body = append(body, mqttString(m.config.ClientID)...)
+	if m.config.Username != "" {
+		body = append(body, mqttString(m.config.Username)...)
+	}
+	if m.config.Password != "" {
+		body = append(body, mqttString(m.config.Password)...)
+	}
+	conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+	if _, err := conn.Write(mqttPacket(0x10, body)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+	kind, ack, err := readMQTTPacket(r)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if kind != 0x20 || len(ack) != 2 {
+		conn.Close()
+		return fmt.Errorf("unexpected reply to CONNECT")
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return fmt.Errorf("broker refused connection (code %d)", ack[1])
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	m.conn = conn
+	go m.readLoop(conn, r)
+	go m.pingLoop(conn)
+	return nil
+}
+
+// dropLocked forgets the current connection. m.mu must be held.
+func (m *mqttPublisher) dropLocked() {
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn = nil
+	}
+}
+
+func (m *mqttPublisher) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		kind, body, err := readMQTTPacket(r)
+		if err != nil {
+			m.mu.Lock()
+			if m.conn == conn {
+				m.dropLocked()
+			}
+			m.mu.Unlock()
+			return
+		}
+		if kind&0xF0 == 0x40 && len(body) == 2 {
+			id := binary.BigEndian.Uint16(body)
+			m.mu.Lock()
+			if ch, ok := m.acks[id]; ok {
+				close(ch)
+				delete(m.acks, id)
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (m *mqttPublisher) pingLoop(conn net.Conn) {
+	for range time.Tick(mqttKeepAlive / 2) {
+		m.mu.Lock()
+		if m.conn != conn {
+			m.mu.Unlock()
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+		if _, err := conn.Write([]byte{0xC0, 0x00}); err != nil {
+			m.dropLocked()
+		}
+		m.mu.Unlock()
+	}
+}
+
+func mqttString(s string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(s)))
+	return append(b, s...)
+}
+
+// mqttPacket prefixes body with a fixed header and remaining length.
+func mqttPacket(header byte, body []byte) []byte {
+	out := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed mqtt remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Nagios plugin states, which are also the exit codes of --nagios.
+const (
+	nagiosOK = iota
+	nagiosWarning
+	nagiosCritical
+	nagiosUnknown
+)
+
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// textStatus is one monitor's line in /status.txt, and its part in
+// /summary.
+type textStatus struct {
+	url   string
+	name  string
+	state string
+	since time.Time
+	// latency is the latest check's, and error its failure detail.
+	latency time.Duration
+	error   string
+}
+
+// monitorTextStatus classifies a monitor for /status.txt and /summary. A down monitor in
+// a maintenance window or silenced by a calendar or the API is
+// "maintenance" rather than down, and an up one that some location or health component reports
+// as failing is "degraded".
+func monitorTextStatus(t Target, now time.Time) textStatus {
+	st, ok := statuses.get(t.URL)
+	if !ok {
+		return textStatus{url: t.URL, name: t.displayName(), state: "unknown"}
+	}
+	s := textStatus{url: t.URL, name: t.displayName(), state: st.Status.String(), since: st.Since, latency: time.Duration(st.LastLatency)}
+	switch st.Status {
+	case StatusDown:
+		s.error = st.LastError
+		if inMaintenance(t, now) || calendars.silencing(t.URL, now) || silenced(t.URL, now) {
+			s.state = "maintenance"
+		}
+	case StatusUp:
+		for _, l := range st.Locations {
+			if l.Status == StatusDown {
+				s.state = "degraded"
+				s.error = "down from " + l.Location
+			}
+		}
+		for _, c := range st.Components {
+			if c.Status != componentUp {
+				s.state = "degraded"
+				s.error = "component " + c.Name + " is " + c.Status
+			}
+		}
+	}
+	return s
+}
+
+// statusTextHandler serves GET /status.txt: a Nagios plugin style summary
+// line with perfdata, then one "<state> <url> <since> <latency>" line per
+// monitor, for shell scripts and monitoring systems that don't parse JSON.
+func statusTextHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	var list []textStatus
+	u := r.URL.Query().Get("url")
+	if u != "" {
+		if !knownMonitor(w, r, u) {
+			return
+		}
+		t, _ := targets.get(u)
+		list = append(list, monitorTextStatus(t, now))
+	} else {
+		list = textStatuses(r, now)
+	}
+
+	counts := map[string]int{}
+	for _, s := range list {
+		counts[s.state]++
+	}
+	state := nagiosOK
+	switch {
+	case counts["down"] > 0:
+		state = nagiosCritical
+	case counts["degraded"] > 0:
+		state = nagiosWarning
+	case len(list) == 0 || counts["unknown"] == len(list):
+		state = nagiosUnknown
+	}
+
+	var b strings.Builder
+	b.WriteString(nagiosStates[state] + " - ")
+	if u != "" {
+		s := list[0]
+		fmt.Fprintf(&b, "%s is %s", s.url, s.state)
+		if s.error != "" {
+			b.WriteString(": " + strings.ReplaceAll(s.error, "|", "/"))
+		}
+		fmt.Fprintf(&b, " | time=%.3fs;;;0\n", s.latency.Seconds())
+	} else {
+		switch {
+		case len(list) == 0:
+			b.WriteString("no monitors")
+		case counts["down"] > 0:
+			fmt.Fprintf(&b, "%d of %d monitors down: %s", counts["down"], len(list), strings.Join(textURLs(list, "down"), ", "))
+		case counts["degraded"] > 0:
+			fmt.Fprintf(&b, "%d of %d monitors degraded: %s", counts["degraded"], len(list), strings.Join(textURLs(list, "degraded"), ", "))
+		default:
+			fmt.Fprintf(&b, "%d of %d monitors up", counts["up"], len(list))
+		}
+		b.WriteString(" |")
+		for _, name := range []string{"up", "down", "degraded", "maintenance", "unknown"} {
+			fmt.Fprintf(&b, " %s=%d;;;0;%d", name, counts[name], len(list))
+		}
+		b.WriteString("\n")
+	}
+	for _, s := range list {
+		since := "-"
+		if !s.since.IsZero() {
+			since = s.since.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(&b, "%s %s %s %dms\n", s.state, s.url, since, s.latency.Milliseconds())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	io.WriteString(w, b.String())
+}
+
+// textStatuses classifies every monitor r may see, in the group named by
+// its group parameter if there is one.
+func textStatuses(r *http.Request, now time.Time) []textStatus {
+	scope := requestScope(r)
+	group := r.URL.Query().Get("group")
+	var list []textStatus
+	for _, url := range targets.urls() {
+		t, ok := targets.get(url)
+		if !ok || !scope.allows(t.Project) || group != "" && t.Group != group {
+			continue
+		}
+		list = append(list, monitorTextStatus(t, now))
+	}
+	return list
+}
+
+// textURLs returns the URLs of the monitors in list that are in state.
+func textURLs(list []textStatus, state string) []string {
+	var out []string
+	for _, s := range list {
+		if s.state == state {
+			out = append(out, s.url)
+		}
+	}
+	return out
+}
+
+// runNagios is a Nagios and Icinga check plugin: it prints a running
+// instance's /status.txt and exits with the state of its first line.
+func runNagios(args []string) {
+	fs := flag.NewFlagSet("nagios", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8080", "base URL of the instance")
+	key := fs.String("key", "", "API key, when projects are configured")
+	monitor := fs.String("url", "", "check only the monitor with this URL")
+	group := fs.String("group", "", "check only the monitors in this group")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for the instance")
+	fs.Parse(args)
+
+	q := url.Values{}
+	if *monitor != "" {
+		q.Set("url", *monitor)
+	}
+	if *group != "" {
+		q.Set("group", *group)
+	}
+	endpoint := strings.TrimRight(*server, "/") + "/status.txt"
+	if len(q) > 0 {
+		endpoint += "?" + q.Encode()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err == nil {
+		var body []byte
+		if body, err = callAPI(req, *key); err == nil {
+			exitWithStatus(body)
+		}
+	}
+	fmt.Println("UNKNOWN - querying the instance:", err)
+	os.Exit(nagiosUnknown)
+}
+
+// exitWithStatus prints body, a /status.txt, and exits with its state.
+func exitWithStatus(body []byte) {
+	fmt.Print(string(body))
+	first, _, _ := strings.Cut(string(body), " ")
+	for code, name := range nagiosStates {
+		if first == name {
+			os.Exit(code)
+		}
+	}
+	os.Exit(nagiosUnknown)
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// notifyWorkers is the number of goroutines draining notifyQueue.
+const notifyWorkers = 4
+
+// Notification kinds. Besides up/down state changes, a monitor can raise
+// alerts that are not outages; for those, Status is "ok" once resolved.
+const (
+	notifyState   = ""
+	notifySLO     = "slo"
+	notifyAnomaly = "anomaly"
+	notifyTLS     = "tls"
+	notifyCert    = "cert"
+	notifyCluster = "cluster"
+	notifyRenewal = "renewal"
+	notifyHealth  = "health"
+	notifyChannel = "channel"
+
+	alertResolved = "ok"
+)
+
+// notification describes a target changing state.
+type notification struct {
+	Kind   string
+	Target Target
+	// Status is the new state: "down" or "up" for state changes, otherwise
+	// a kind-specific alert state or alertResolved.
+	Status string
+	Detail string
+	// Failure is the failure class of the check behind a down alert.
+	Failure string
+	Time    time.Time
+	// Captures are the body pattern groups captured by the check that
+	// caused a state change.
+	Captures map[string]string
+	// Reminder marks a repeat of a down notification for a monitor that is
+	// still down; Time is then when it went down.
+	Reminder bool
+	// Downtime is how long the monitor has been down, for reminders, or
+	// was down, for recoveries.
+	Downtime time.Duration
+	// Deploy is the deploy an outage is attributed to, on down alerts.
+	Deploy *DeployEvent
+	// Location is the location an alert was raised for, on alerts that are
+	// tracked per location, such as anomalies.
+	Location string
+}
+
+// alertKey identifies the alert n raises or resolves among the monitor's
+// alerts.
+func (n notification) alertKey() string {
+	if n.Location == "" {
+		return n.Kind
+	}
+	return n.Kind + "@" + n.Location
+}
+
+// errNotApplicable is returned by notifiers that have nothing to send for
+// a notification, so it is neither logged as an error nor audited.
+var errNotApplicable = errors.New("notification not applicable")
+
+// errDeferred is returned by notifiers that hold a notification back to
+// send it later with others. They audit it themselves once it is sent.
+var errDeferred = errors.New("notification deferred")
+
+// notifier delivers notifications to one channel.
+type notifier interface {
+	name() string
+	notify(n notification) error
+}
+
+// notifyQueue decouples checks from delivery so a slow SMTP server never
+// holds up a check cycle.
+var notifyQueue = make(chan notification, 256)
+
+// stateQueue carries up and down notifications apart from notifyQueue, so
+// a burst of other alerts never crowds out a state change. Workers take
+// from it first.
+var stateQueue = make(chan notification, 4096)
+
+// stateOverflowMax bounds how many monitors' state changes wait in
+// stateSpill while stateQueue is full.
+const stateOverflowMax = 4096
+
+// stateOverflow keeps the state changes that find stateQueue full until it
+// has room, only the latest for each monitor, so that checks never wait on
+// slow channels.
+type stateOverflow struct {
+	mu     sync.Mutex
+	order  []string
+	latest map[string]notification
+	ready  chan struct{}
+}
+
+var stateSpill = &stateOverflow{latest: make(map[string]notification), ready: make(chan struct{}, 1)}
+
+// add keeps n, replacing an earlier state change of its monitor that is
+// still waiting. It reports false if n had to be dropped.
+func (s *stateOverflow) add(n notification) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	url := n.Target.URL
+	if _, ok := s.latest[url]; ok {
+		s.latest[url] = n
+		// The replaced notification is no longer pending.
+		notifyPending.Add(-1)
+		return true
+	}
+	if len(s.order) >= stateOverflowMax {
+		return false
+	}
+	s.latest[url] = n
+	s.order = append(s.order, url)
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// len returns how many state changes are waiting.
+func (s *stateOverflow) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.order)
+}
+
+// run moves waiting state changes to stateQueue, oldest first, as it
+// makes room.
+func (s *stateOverflow) run() {
+	for range s.ready {
+		for {
+			s.mu.Lock()
+			if len(s.order) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			url := s.order[0]
+			n := s.latest[url]
+			s.order = s.order[1:]
+			delete(s.latest, url)
+			s.mu.Unlock()
+			stateQueue <- n
+		}
+	}
+}
+
+// notifyPending counts notifications queued or being delivered, so a
+// shutdown can wait for them.
+var notifyPending atomic.Int32
+
+// builtinChannels are the names of the channels configured outside
+// channels, which routes may also send to.
+var builtinChannels = map[string]bool{"email": true, "alertmanager": true, "syslog": true, "mqtt": true, "pubsub": true, "subscription": true, "subscribers": true}
+
+// namedChannels are the channels configured under channels.
+var namedChannels = make(map[string]bool)
+
+func startNotifiers(config Config) {
+	var notifiers []notifier
+	if config.Alertmanager == nil || !config.Alertmanager.Exclusive {
+		notifiers = append(notifiers, emailNotifier{config: config.Email})
+	}
+	if config.Alertmanager != nil {
+		notifiers = append(notifiers, newAlertmanagerNotifier(*config.Alertmanager))
+	}
+	if config.Syslog != nil {
+		w, err := newSyslogWriter(*config.Syslog)
+		if err != nil {
+			fmt.Println("Error configuring syslog:", err)
+		} else {
+			eventLog = w
+			notifiers = append(notifiers, w)
+		}
+	}
+	if config.MQTT != nil {
+		m, err := newMQTTPublisher(*config.MQTT)
+		if err != nil {
+			fmt.Println("Error configuring MQTT:", err)
+		} else {
+			notifiers = append(notifiers, m)
+		}
+	}
+	if config.PubSub != nil {
+		p, err := newPubSubPublisher(*config.PubSub)
+		if err != nil {
+			fmt.Println("Error configuring pubsub:", err)
+		} else {
+			pubsub = p
+			notifiers = append(notifiers, p)
+		}
+	}
+	if config.Subscriptions != nil {
+		s, err := newSubscriptionStore(*config.Subscriptions)
+		if err != nil {
+			fmt.Println("Error loading subscriptions:", err)
+		} else {
+			subscriptions = s
+			notifiers = append(notifiers, s)
+		}
+	}
+	if config.StatusSubscribers != nil {
+		s, err := newSubscriberStore(*config.StatusSubscribers, config.Email)
+		if err != nil {
+			fmt.Println("Error configuring status subscribers:", err)
+		} else {
+			statusSubscribers = s
+			notifiers = append(notifiers, s)
+		}
+	}
+	for _, sp := range config.StatusPages {
+		nf, err := newStatusPageNotifier(sp)
+		if err != nil {
+			fmt.Println("Error configuring status page:", err)
+			continue
+		}
+		notifiers = append(notifiers, nf)
+	}
+	for _, tc := range config.Tickets {
+		nf, err := newTicketNotifier(tc)
+		if err != nil {
+			fmt.Println("Error configuring tickets:", err)
+			continue
+		}
+		notifiers = append(notifiers, nf)
+	}
+	names := make([]string, 0, len(config.Channels))
+	for name := range config.Channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if builtinChannels[name] {
+			fmt.Printf("Error configuring channel %s: the name is taken by a built-in channel\n", name)
+			continue
+		}
+		nf, err := newChannelNotifier(name, config.Channels[name])
+		if err != nil {
+			fmt.Printf("Error configuring channel %s: %s\n", name, err)
+			continue
+		}
+		namedChannels[name] = true
+		notifiers = append(notifiers, nf)
+	}
+	if len(config.Routes) > 0 {
+		known := make(map[string]bool)
+		for name := range builtinChannels {
+			known[name] = true
+		}
+		for _, nf := range notifiers {
+			known[nf.name()] = true
+		}
+		routes = newRouter(config.Routes, known)
+	}
+	byName := make(map[string]notifier)
+	for _, nf := range notifiers {
+		byName[nf.name()] = nf
+	}
+	channelHealth = newChannelMonitor(config.ChannelHealth, byName)
+
+	go stateSpill.run()
+	for i := 0; i < notifyWorkers; i++ {
+		go func() {
+			for {
+				var n notification
+				select {
+				case n = <-stateQueue:
+				default:
+					select {
+					case n = <-stateQueue:
+					case n = <-notifyQueue:
+					}
+				}
+				for _, nf := range notifiers {
+					if !routes.allows(nf.name(), n) {
+						continue
+					}
+					backup := byName[channelHealth.backup(nf.name())]
+					if backup != nil && routes.allows(backup.name(), n) {
+						// The backup gets n anyway.
+						backup = nil
+					}
+					if n.Kind == notifyChannel && n.Target.URL == channelTarget(nf.name()).URL {
+						// A broken channel is not told about itself.
+						if backup != nil {
+							deliver(backup, n)
+						}
+						continue
+					}
+					if deliver(nf, n) != nil {
+						channelHealth.failOver(nf.name(), n)
+					}
+				}
+				notifyPending.Add(-1)
+			}
+		}()
+	}
+}
+
+// deliver sends n through nf, recording the outcome. It returns the error
+// of a failed delivery.
+func deliver(nf notifier, n notification) error {
+	err := nf.notify(n)
+	if errors.Is(err, errNotApplicable) || errors.Is(err, errDeferred) {
+		return nil
+	}
+	audit.notification(nf.name(), n, err)
+	diag.delivery(nf.name(), err)
+	channelHealth.delivered(nf.name(), err)
+	if err != nil {
+		fmt.Printf("Error sending %s notification for %s: %s\n", nf.name(), n.Target.URL, err)
+	}
+	return err
+}
+
+// enqueueNotification hands n to the sender workers without blocking. State
+// changes that find stateQueue full wait in stateSpill; anything else is
+// dropped and logged if notifyQueue is full. Alerts for a silenced monitor
+// are held until the silence ends. Standby instances never send
+// notifications.
+func enqueueNotification(n notification) {
+	if !isLeader() {
+		return
+	}
+	if silencedHeld.hold(n, time.Now()) {
+		return
+	}
+	notifyPending.Add(1)
+	if n.Kind == notifyState && !n.Reminder {
+		// Once state changes spill over, later ones follow them so that
+		// each monitor's changes stay in order.
+		if stateSpill.len() == 0 {
+			select {
+			case stateQueue <- n:
+				return
+			default:
+			}
+		}
+		if stateSpill.add(n) {
+			return
+		}
+	} else {
+		select {
+		case notifyQueue <- n:
+			return
+		default:
+		}
+	}
+	notifyPending.Add(-1)
+	diag.droppedNotification()
+	fmt.Printf("Notification queue full, dropping notification for %s\n", n.Target.URL)
+}
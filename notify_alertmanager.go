@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertmanagerConfig forwards state changes to a Prometheus Alertmanager so
+// its routing, grouping and silencing apply.
+type AlertmanagerConfig struct {
+	// URL is the Alertmanager base URL, e.g. http://alertmanager:9093.
+	URL string `json:"url"`
+	// Exclusive disables the built-in email notifications.
+	Exclusive bool `json:"exclusive"`
+	// Labels are added to every alert.
+	Labels map[string]string `json:"labels"`
+	// GeneratorURL links alerts back to a dashboard.
+	GeneratorURL string `json:"generator_url"`
+	// Locale selects the language of alert summaries. Defaults to the
+	// top-level locale.
+	Locale string `json:"locale"`
+}
+
+// amResendInterval keeps firing alerts alive; Alertmanager resolves alerts
+// that are not re-sent within its resolve_timeout (5m by default).
+const amResendInterval = time.Minute
+
+// amAlertNames maps notification kinds other than state changes to alert
+// names.
+var amAlertNames = map[string]string{
+	notifySLO:     "ErrorBudget",
+	notifyAnomaly: "LatencyAnomaly",
+	notifyTLS:     "TLSGradeLow",
+	notifyCert:    "CertificateChanged",
+	notifyCluster: "ClusterDegraded",
+	notifyRenewal: "CertificateRenewalOverdue",
+	notifyHealth:  "ServiceDegraded",
+	notifyChannel: "NotificationChannelFailing",
+}
+
+type amAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       *time.Time        `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+type alertmanagerNotifier struct {
+	config AlertmanagerConfig
+
+	mu     sync.Mutex
+	firing map[string]amAlert
+}
+
+func newAlertmanagerNotifier(config AlertmanagerConfig) *alertmanagerNotifier {
+	a := &alertmanagerNotifier{config: config, firing: make(map[string]amAlert)}
+	go a.resendLoop()
+	return a
+}
+
+func (a *alertmanagerNotifier) name() string { return "alertmanager" }
+
+func (a *alertmanagerNotifier) notify(n notification) error {
+	if n.Reminder {
+		// Firing alerts are re-sent anyway; Alertmanager's repeat_interval
+		// decides when receivers hear about them again.
+		return errNotApplicable
+	}
+	key, alertname := n.Target.URL, "WebsiteDown"
+	summary := localize(a.config.Locale, displayZone, "down.summary", n)
+	firing := n.Status == "down"
+	if n.Kind != notifyState {
+		key, alertname = n.Target.URL+"#"+n.alertKey(), amAlertNames[n.Kind]
+		summary = n.Detail
+		firing = n.Status != alertResolved
+	}
+
+	a.mu.Lock()
+	alert, wasFiring := a.firing[key]
+	if firing {
+		labels := a.labels(n.Target)
+		labels["alertname"] = alertname
+		if n.Kind != notifyState {
+			labels[n.Kind+"_state"] = n.Status
+		}
+		if n.Location != "" {
+			labels["location"] = n.Location
+		}
+		annotations := map[string]string{
+			"summary":     summary,
+			"description": n.Detail,
+		}
+		if n.Failure != "" {
+			annotations["failure"] = n.Failure
+		}
+		// Metadata such as runbook_url becomes annotations, where
+		// Alertmanager templates expect runbooks.
+		for k, v := range n.Target.Metadata {
+			if _, ok := annotations[k]; !ok {
+				annotations[k] = v
+			}
+		}
+		alert = amAlert{
+			Labels:       labels,
+			Annotations:  annotations,
+			StartsAt:     n.Time,
+			GeneratorURL: a.config.GeneratorURL,
+		}
+		a.firing[key] = alert
+	} else {
+		delete(a.firing, key)
+		if !wasFiring {
+			a.mu.Unlock()
+			return nil
+		}
+		ended := n.Time
+		alert.EndsAt = &ended
+	}
+	a.mu.Unlock()
+	return a.post([]amAlert{alert})
+}
+
+func (a *alertmanagerNotifier) resendLoop() {
+	for range time.Tick(amResendInterval) {
+		a.mu.Lock()
+		alerts := make([]amAlert, 0, len(a.firing))
+		for _, alert := range a.firing {
+			alerts = append(alerts, alert)
+		}
+		a.mu.Unlock()
+		if len(alerts) == 0 {
+			continue
+		}
+		if err := a.post(alerts); err != nil {
+			fmt.Println("Error re-sending alerts to Alertmanager:", err)
+		}
+	}
+}
+
+var amLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// labels builds an alert's label set. Tags of the form key=value become
+// labels of their own; plain tags are joined into a "tags" label.
+func (a *alertmanagerNotifier) labels(t Target) map[string]string {
+	labels := map[string]string{
+		"alertname": "WebsiteDown",
+		"instance":  t.URL,
+		"monitor":   t.displayName(),
+		"severity":  t.severity(),
+	}
+	for k, v := range a.config.Labels {
+		labels[k] = v
+	}
+	var plain []string
+	for _, tag := range t.Tags {
+		if k, v, ok := strings.Cut(tag, "="); ok && amLabelName.MatchString(k) {
+			labels[k] = v
+		} else {
+			plain = append(plain, tag)
+		}
+	}
+	if len(plain) > 0 {
+		sort.Strings(plain)
+		labels["tags"] = strings.Join(plain, ",")
+	}
+	return labels
+}
+
+func (a *alertmanagerNotifier) post(alerts []amAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(a.config.URL, "/") + "/api/v2/alerts"
+	if dryRunSkip("alertmanager", url, body) {
+		return nil
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("alertmanager returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnomalyAlertsPerLocation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	a := newAlertmanagerNotifier(AlertmanagerConfig{URL: server.URL})
+
+	target := Target{URL: "https://example.com/"}
+	now := time.Now()
+	for _, n := range []notification{
+		{Kind: notifyAnomaly, Target: target, Status: "slow", Location: "eu-west", Time: now},
+		{Kind: notifyAnomaly, Target: target, Status: "slow", Location: "us-east", Time: now},
+		{Kind: notifyAnomaly, Target: target, Status: alertResolved, Location: "eu-west", Time: now},
+	} {
+		if err := a.notify(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.firing) != 1 {
+		t.Fatalf("%d anomaly alerts firing, want us-east only", len(a.firing))
+	}
+	for _, alert := range a.firing {
+		if alert.Labels["location"] != "us-east" {
+			t.Errorf("firing alert is for %q, want us-east", alert.Labels["location"])
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// appriseRequest is one HTTP request an Apprise URL turns into.
+type appriseRequest struct {
+	method   string
+	endpoint string
+	body     []byte
+	headers  map[string]string
+}
+
+// appriseHandlers deliver the Apprise URL schemes handled without an
+// Apprise server. Each is passed the URL without its scheme.
+var appriseHandlers = map[string]func(scheme, rest string, n notification) (appriseRequest, error){
+	"json":    appriseJSON,
+	"jsons":   appriseJSON,
+	"slack":   appriseSlack,
+	"discord": appriseDiscord,
+	"tgram":   appriseTelegram,
+	"gotify":  appriseGotify,
+	"gotifys": appriseGotify,
+	"ntfy":    appriseNtfy,
+	"ntfys":   appriseNtfy,
+}
+
+// appriseScheme splits an Apprise URL into its scheme and the rest.
+func appriseScheme(raw string) (string, string, error) {
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || scheme == "" {
+		return "", "", fmt.Errorf("%q is not an Apprise URL", raw)
+	}
+	return strings.ToLower(scheme), rest, nil
+}
+
+// appriseParts splits the rest of an Apprise URL into its path segments,
+// dropping the query and empty segments.
+func appriseParts(rest string) []string {
+	rest, _, _ = strings.Cut(rest, "?")
+	var parts []string
+	for _, p := range strings.Split(rest, "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// appriseType is the Apprise notification type for n.
+func appriseType(n notification) string {
+	switch {
+	case n.Status == "up" || n.Status == alertResolved:
+		return "success"
+	case n.Kind == notifyState:
+		return "failure"
+	}
+	return "warning"
+}
+
+func appriseJSON(scheme, rest string, n notification) (appriseRequest, error) {
+	u, err := url.Parse("http://" + rest)
+	if err != nil {
+		return appriseRequest{}, err
+	}
+	if scheme == "jsons" {
+		u.Scheme = "https"
+	}
+	body, _ := json.Marshal(map[string]string{
+		"version": "1.0", "title": notificationTitle(n), "message": notificationText(n), "type": appriseType(n),
+	})
+	return appriseRequest{method: http.MethodPost, endpoint: u.String(), body: body}, nil
+}
+
+// appriseSlack handles slack://TokenA/TokenB/TokenC, the parts of an
+// incoming webhook URL.
+func appriseSlack(scheme, rest string, n notification) (appriseRequest, error) {
+	parts := appriseParts(rest)
+	if len(parts) < 3 {
+		return appriseRequest{}, fmt.Errorf("slack URLs need three tokens")
+	}
+	if _, host, ok := strings.Cut(parts[0], "@"); ok {
+		parts[0] = host
+	}
+	body, _ := json.Marshal(map[string]string{"text": notificationText(n)})
+	return appriseRequest{
+		method:   http.MethodPost,
+		endpoint: "https://hooks.slack.com/services/" + strings.Join(parts[:3], "/"),
+		body:     body,
+	}, nil
+}
+
+// appriseDiscord handles discord://WebhookID/WebhookToken.
+func appriseDiscord(scheme, rest string, n notification) (appriseRequest, error) {
+	parts := appriseParts(rest)
+	if len(parts) < 2 {
+		return appriseRequest{}, fmt.Errorf("discord URLs need a webhook ID and token")
+	}
+	body, _ := json.Marshal(map[string]string{"content": notificationText(n)})
+	return appriseRequest{
+		method:   http.MethodPost,
+		endpoint: "https://discord.com/api/webhooks/" + parts[0] + "/" + parts[1],
+		body:     body,
+	}, nil
+}
+
+// appriseTelegram handles tgram://BotToken/ChatID, sending to the first
+// chat.
+func appriseTelegram(scheme, rest string, n notification) (appriseRequest, error) {
+	parts := appriseParts(rest)
+	if len(parts) < 2 {
+		return appriseRequest{}, fmt.Errorf("tgram URLs need a bot token and chat ID")
+	}
+	body, _ := json.Marshal(map[string]string{"chat_id": parts[1], "text": notificationText(n)})
+	return appriseRequest{
+		method:   http.MethodPost,
+		endpoint: "https://api.telegram.org/bot" + parts[0] + "/sendMessage",
+		body:     body,
+	}, nil
+}
+
+// appriseGotify handles gotify://host[/path]/token.
+func appriseGotify(scheme, rest string, n notification) (appriseRequest, error) {
+	parts := appriseParts(rest)
+	if len(parts) < 2 {
+		return appriseRequest{}, fmt.Errorf("gotify URLs need a host and token")
+	}
+	base := "http://"
+	if scheme == "gotifys" {
+		base = "https://"
+	}
+	token := parts[len(parts)-1]
+	priority := 8
+	if appriseType(n) == "success" {
+		priority = 4
+	}
+	body, _ := json.Marshal(map[string]any{"title": notificationTitle(n), "message": notificationText(n), "priority": priority})
+	return appriseRequest{
+		method:   http.MethodPost,
+		endpoint: base + strings.Join(parts[:len(parts)-1], "/") + "/message",
+		body:     body,
+		headers:  map[string]string{"X-Gotify-Key": token},
+	}, nil
+}
+
+// appriseNtfy handles ntfy://topic on ntfy.sh, and ntfy://host/topic or
+// ntfys://host/topic on another server.
+func appriseNtfy(scheme, rest string, n notification) (appriseRequest, error) {
+	parts := appriseParts(rest)
+	base := "https://ntfy.sh"
+	switch {
+	case len(parts) == 1:
+	case len(parts) >= 2 && scheme == "ntfys":
+		base = "https://" + parts[0]
+		parts = parts[1:]
+	case len(parts) >= 2:
+		base = "http://" + parts[0]
+		parts = parts[1:]
+	default:
+		return appriseRequest{}, fmt.Errorf("ntfy URLs need a topic")
+	}
+	priority := 5
+	if appriseType(n) == "success" {
+		priority = 3
+	}
+	body, _ := json.Marshal(map[string]any{
+		"topic": parts[0], "title": notificationTitle(n), "message": notificationText(n), "priority": priority,
+	})
+	return appriseRequest{method: http.MethodPost, endpoint: base, body: body}, nil
+}
+
+// postApprise delivers n to each of the channel's Apprise URLs, handling
+// the schemes it knows itself and passing the others to the Apprise API
+// server in one request.
+func (c *channelNotifier) postApprise(n notification) error {
+	var delegated, failed []string
+	for _, raw := range c.config.URLs {
+		scheme, rest, _ := appriseScheme(raw)
+		handler, ok := appriseHandlers[scheme]
+		if !ok {
+			delegated = append(delegated, raw)
+			continue
+		}
+		req, err := handler(scheme, rest, n)
+		if err == nil {
+			err = c.send(req.method, req.endpoint, req.body, req.headers)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", scheme, err))
+		}
+	}
+	if len(delegated) > 0 {
+		body, _ := json.Marshal(map[string]string{
+			"urls": strings.Join(delegated, ","), "title": notificationTitle(n), "body": notificationText(n), "type": appriseType(n),
+		})
+		if err := c.send(http.MethodPost, c.config.URL, body, c.config.Headers); err != nil {
+			failed = append(failed, fmt.Sprintf("apprise server: %s", err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
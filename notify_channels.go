@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ChannelConfig is a named notification destination that routes can send
+// to, in addition to the built-in channels.
+type ChannelConfig struct {
+	// Type is "email", "slack", "webhook", "matrix", "gotify" or "apprise".
+	Type string `json:"type"`
+	// Email configures "email" channels.
+	Email *EmailConfig `json:"email,omitempty"`
+	// URL is the Slack incoming webhook, the URL webhook channels POST
+	// each event to as JSON, the Matrix homeserver or Gotify server, or
+	// the Apprise API endpoint, e.g. "http://apprise:8000/notify".
+	URL string `json:"url,omitempty"`
+	// URLs are the Apprise notification URLs of "apprise" channels. Those
+	// with a scheme not handled here are sent through the Apprise API at
+	// URL.
+	URLs []string `json:"urls,omitempty"`
+	// Token is the Matrix access token or the Gotify application token.
+	Token string `json:"token,omitempty"`
+	// Room is the Matrix room ID, e.g. "!abc123:example.com".
+	Room string `json:"room,omitempty"`
+	// Headers are sent with webhook requests, e.g. an Authorization header.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Template is a Go template rendering the body of webhook requests
+	// from a webhookTemplateData, instead of the event as JSON.
+	Template string `json:"template,omitempty"`
+	// JWT signs webhook requests with a short-lived token.
+	JWT *JWTConfig `json:"jwt,omitempty"`
+}
+
+// webhookTemplateData is what webhook templates are executed with: the
+// event, plus the title and one-line text chat channels would send.
+type webhookTemplateData struct {
+	Event
+	Title string
+	Text  string
+}
+
+// webhookTemplateFuncs are available in webhook templates. json quotes a
+// value for use inside a JSON body.
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func (c ChannelConfig) validate() error {
+	if c.Template != "" && c.Type != "webhook" {
+		return fmt.Errorf("only webhook channels take a template")
+	}
+	if c.JWT != nil && c.Type != "webhook" {
+		return fmt.Errorf("only webhook channels take jwt")
+	}
+	switch c.Type {
+	case "email":
+		if c.Email == nil || (c.Email.Recipient == "" && c.Email.OnCall == "") {
+			return fmt.Errorf("email channels need email.recipient or email.oncall")
+		}
+	case "slack", "webhook":
+		if c.URL == "" {
+			return fmt.Errorf("%s channels need a url", c.Type)
+		}
+	case "matrix":
+		if c.URL == "" || c.Token == "" || c.Room == "" {
+			return fmt.Errorf("matrix channels need a url, token and room")
+		}
+	case "gotify":
+		if c.URL == "" || c.Token == "" {
+			return fmt.Errorf("gotify channels need a url and token")
+		}
+	case "apprise":
+		if len(c.URLs) == 0 {
+			return fmt.Errorf("apprise channels need urls")
+		}
+		for _, raw := range c.URLs {
+			scheme, _, err := appriseScheme(raw)
+			if err != nil {
+				return err
+			}
+			if appriseHandlers[scheme] == nil && c.URL == "" {
+				return fmt.Errorf("apprise URLs with scheme %q need the url of an Apprise API server", scheme)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown channel type %q", c.Type)
+	}
+	return nil
+}
+
+// channelNotifier delivers to one configured channel.
+type channelNotifier struct {
+	channel string
+	config  ChannelConfig
+	client  *http.Client
+	// template renders webhook bodies when config.Template is set.
+	template *template.Template
+	// signer signs webhook requests when config.JWT is set.
+	signer *jwtSigner
+}
+
+func newChannelNotifier(name string, config ChannelConfig) (*channelNotifier, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	c := &channelNotifier{channel: name, config: config, client: &http.Client{Timeout: 10 * time.Second}}
+	if config.Template != "" {
+		t, err := template.New(name).Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		c.template = t
+	}
+	if config.JWT != nil {
+		s, err := newJWTSigner(*config.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %w", err)
+		}
+		c.signer = s
+	}
+	return c, nil
+}
+
+func (c *channelNotifier) name() string { return c.channel }
+
+func (c *channelNotifier) notify(n notification) error {
+	switch c.config.Type {
+	case "email":
+		return mailNotification(c.channel, *c.config.Email, n)
+	case "slack":
+		return postSlack(c.config.URL, notificationText(n))
+	case "matrix":
+		return c.postMatrix(n)
+	case "gotify":
+		return c.postGotify(n)
+	case "apprise":
+		return c.postApprise(n)
+	}
+	body, err := c.webhookBody(n)
+	if err != nil {
+		return err
+	}
+	headers, err := c.signer.withJWT(c.config.Headers, body)
+	if err != nil {
+		return err
+	}
+	return c.send(http.MethodPost, c.config.URL, body, headers)
+}
+
+// webhookBody is n as JSON, or rendered by the channel's template.
+func (c *channelNotifier) webhookBody(n notification) ([]byte, error) {
+	if c.template == nil {
+		return json.Marshal(newEvent(n))
+	}
+	var b bytes.Buffer
+	data := webhookTemplateData{Event: newEvent(n), Title: notificationTitle(n), Text: notificationText(n)}
+	if err := c.template.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// postMatrix sends n as a text message to the configured room.
+func (c *channelNotifier) postMatrix(n notification) error {
+	body, _ := json.Marshal(map[string]string{"msgtype": "m.text", "body": notificationText(n)})
+	// The transaction ID only has to be unique per access token.
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/uptime-monitor-%d",
+		strings.TrimRight(c.config.URL, "/"), url.PathEscape(c.config.Room), time.Now().UnixNano())
+	return c.send(http.MethodPut, endpoint, body, map[string]string{"Authorization": "Bearer " + c.config.Token})
+}
+
+// postGotify sends n as a message, at a high priority unless it reports
+// a recovery.
+func (c *channelNotifier) postGotify(n notification) error {
+	priority := 8
+	if n.Status == "up" || n.Status == alertResolved {
+		priority = 4
+	}
+	body, _ := json.Marshal(map[string]any{"title": notificationTitle(n), "message": notificationText(n), "priority": priority})
+	endpoint := strings.TrimRight(c.config.URL, "/") + "/message"
+	return c.send(http.MethodPost, endpoint, body, map[string]string{"X-Gotify-Key": c.config.Token})
+}
+
+// send makes a JSON request to the channel, failing unless it gets a 2xx
+// response.
+func (c *channelNotifier) send(method, endpoint string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", defaultUserAgent)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	// Only the host, as paths of chat webhooks hold their tokens.
+	if dryRunSkip(c.config.Type+" "+c.channel, req.URL.Host, body) {
+		return nil
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", c.config.Type, resp.Status)
+	}
+	return nil
+}
+
+// notificationTitle is the monitor name for state changes, otherwise the
+// kind of alert.
+func notificationTitle(n notification) string {
+	if n.Kind != notifyState {
+		return message(defaultLocale, "title."+n.Kind)
+	}
+	return n.Target.displayName()
+}
+
+// notificationText is a one-line description of n for chat channels.
+func notificationText(n notification) string {
+	if n.Kind != notifyState {
+		return fmt.Sprintf("%s for %s: %s", message(defaultLocale, "title."+n.Kind), n.Target.displayName(), n.Detail)
+	}
+	text := fmt.Sprintf("%s is %s", n.Target.displayName(), n.Status)
+	if n.Reminder {
+		text = n.Target.displayName() + " is still down"
+	}
+	if n.Downtime > 0 {
+		verb := "down for"
+		if n.Reminder {
+			verb = "for"
+		}
+		text += fmt.Sprintf(" (%s %s)", verb, formatDuration(n.Downtime))
+	}
+	if n.Detail != "" {
+		text += ": " + describeFailure(n.Failure, n.Detail)
+	}
+	if n.Deploy != nil {
+		text += " (" + n.Deploy.describe(n.Time) + ")"
+	}
+	return text
+}
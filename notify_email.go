@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emailNotifier mails the configured recipient when a website goes down or
+// raises an alert.
+type emailNotifier struct {
+	config EmailConfig
+}
+
+func (e emailNotifier) name() string { return "email" }
+
+func (e emailNotifier) notify(n notification) error {
+	return mailNotification(e.name(), projectEmail(n.Target, e.config), n)
+}
+
+// mailNotification emails n to config's recipient on behalf of channel.
+func mailNotification(channel string, config EmailConfig, n notification) error {
+	if !severityAtLeast(n.Target.severity(), config.MinSeverity) {
+		return errNotApplicable
+	}
+	if n.Kind != notifyState {
+		if n.Status == alertResolved {
+			return errNotApplicable
+		}
+		zone := zoneOrDefault(config.Timezone)
+		return sendMail(config, localize(config.Locale, zone, "alert.subject", n),
+			n.Detail+"\n\n"+localize(config.Locale, zone, "detected", n)+"\n")
+	}
+	if n.Status != "down" {
+		return errNotApplicable
+	}
+	if config.CorrelationWindow > 0 {
+		digests.add(channel, config, n)
+		return errDeferred
+	}
+	return sendEmail(config, n)
+}
+
+// emailDigests holds down notifications back for an email's correlation
+// window, so that monitors failing together, say behind a shared
+// dependency, are reported in one message.
+type emailDigests struct {
+	mu      sync.Mutex
+	pending map[digestKey][]notification
+}
+
+// digestKey separates digests by sending channel and email settings, so
+// each recipient gets only its own monitors.
+type digestKey struct {
+	channel string
+	config  EmailConfig
+}
+
+var digests = &emailDigests{pending: make(map[digestKey][]notification)}
+
+// add queues n, starting the window when it is the first of a digest. n
+// counts in notifyPending until its digest is sent.
+func (d *emailDigests) add(channel string, config EmailConfig, n notification) {
+	key := digestKey{channel, config}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending[key]) == 0 {
+		time.AfterFunc(time.Duration(config.CorrelationWindow), func() { d.flush(key) })
+	}
+	d.pending[key] = append(d.pending[key], n)
+	notifyPending.Add(1)
+}
+
+// flushAll sends every pending digest without waiting for its window to
+// end, for a shutdown.
+func (d *emailDigests) flushAll() {
+	d.mu.Lock()
+	keys := make([]digestKey, 0, len(d.pending))
+	for key := range d.pending {
+		keys = append(keys, key)
+	}
+	d.mu.Unlock()
+	for _, key := range keys {
+		d.flush(key)
+	}
+}
+
+// flush sends the notifications queued under key: a single one as usual,
+// several as one digest. If that fails, each goes to the channel's backup.
+func (d *emailDigests) flush(key digestKey) {
+	d.mu.Lock()
+	batch := d.pending[key]
+	delete(d.pending, key)
+	d.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	var err error
+	if len(batch) == 1 {
+		err = sendEmail(key.config, batch[0])
+	} else {
+		err = sendDigest(key.config, batch)
+	}
+	for _, n := range batch {
+		audit.notification(key.channel, n, err)
+	}
+	diag.delivery(key.channel, err)
+	channelHealth.delivered(key.channel, err)
+	if err != nil {
+		fmt.Printf("Error sending %s notification for %d monitors: %s\n", key.channel, len(batch), err)
+		for _, n := range batch {
+			channelHealth.failOver(key.channel, n)
+		}
+	}
+	notifyPending.Add(-int32(len(batch)))
+}
+
+// sendDigest mails one message listing every monitor in batch.
+func sendDigest(emailConfig EmailConfig, batch []notification) error {
+	locale, zone := emailConfig.Locale, zoneOrDefault(emailConfig.Timezone)
+	count := strings.NewReplacer("{count}", strconv.Itoa(len(batch)))
+	var body strings.Builder
+	body.WriteString(count.Replace(message(locale, "digest.body")) + "\n\n")
+	for _, n := range batch {
+		body.WriteString(localize(locale, zone, "digest.item", n) + "\n")
+	}
+	body.WriteString("\n" + localize(locale, zone, "detected", batch[0]) + "\n")
+	err := sendMail(emailConfig, count.Replace(message(locale, "digest.subject")), body.String())
+	if err == nil && !dryRun {
+		fmt.Printf("Email digest sent for %d monitors\n", len(batch))
+	}
+	return err
+}
+
+func sendEmail(emailConfig EmailConfig, n notification) error {
+	locale, zone := emailConfig.Locale, zoneOrDefault(emailConfig.Timezone)
+	subject := "down.subject"
+	if n.Reminder {
+		subject = "reminder.subject"
+	}
+	body := localize(locale, zone, "down.body", n) + "\n"
+	if n.Downtime > 0 {
+		body += localize(locale, zone, "downtime", n) + "\n"
+	}
+	if _, ok := failureMessages[n.Failure]; ok {
+		body += localize(locale, zone, "cause", n) + "\n"
+	}
+	if n.Deploy != nil {
+		body += localize(locale, zone, "deploy", n) + "\n"
+	}
+	body += localize(locale, zone, "detected", n) + "\n"
+	if len(n.Target.Metadata) > 0 {
+		keys := make([]string, 0, len(n.Target.Metadata))
+		for k := range n.Target.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		body += "\n"
+		for _, k := range keys {
+			body += k + ": " + n.Target.Metadata[k] + "\n"
+		}
+	}
+	err := sendMail(emailConfig, localize(locale, zone, subject, n), body)
+	if err != nil {
+		fmt.Println("Please ensure your email settings in config.json are correct.")
+		return err
+	}
+	if !dryRun {
+		fmt.Printf("Email notification sent for %s\n", n.Target.URL)
+	}
+	return nil
+}
+
+// sendMail sends a plain-text message to the configured recipient.
+func sendMail(emailConfig EmailConfig, subject, body string) error {
+	return sendMailHeaders(emailConfig, subject, body, nil)
+}
+
+// sendMailHeaders is sendMail with extra headers, such as List-Unsubscribe.
+func sendMailHeaders(emailConfig EmailConfig, subject, body string, headers map[string]string) error {
+	return deliverMail(emailConfig, subject, headers, "text/plain; charset=utf-8", strings.ReplaceAll(body, "\n", "\r\n"))
+}
+
+// mailAttachment is a file attached to an email.
+type mailAttachment struct {
+	name        string
+	contentType string
+	data        []byte
+}
+
+// sendMailAttachment is sendMail with a file attached.
+func sendMailAttachment(emailConfig EmailConfig, subject, body string, a mailAttachment) error {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return err
+	}
+	part.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {a.contentType},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.name})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(a.data)
+	for len(encoded) > 76 {
+		part.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	part.Write([]byte(encoded + "\r\n"))
+	mw.Close()
+	return deliverMail(emailConfig, subject, nil, "multipart/mixed; boundary="+mw.Boundary(), buf.String())
+}
+
+// deliverMail sends content, already in CRLF form, to the configured
+// recipient.
+func deliverMail(emailConfig EmailConfig, subject string, headers map[string]string, contentType, content string) error {
+	username := emailConfig.Username
+	if username == "" {
+		username = emailConfig.Sender
+	}
+	auth := smtp.PlainAuth("", username, emailConfig.Password, emailConfig.SMTPHost)
+	recipient := emailConfig.recipient()
+	to := []string{recipient}
+	var extra strings.Builder
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		extra.WriteString(k + ": " + headers[k] + "\r\n")
+	}
+	msg := []byte("To: " + recipient + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		extra.String() +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"\r\n" +
+		content)
+
+	addr := fmt.Sprintf("%s:%d", emailConfig.SMTPHost, emailConfig.SMTPPort)
+	if dryRunSkip("email", recipient+" via "+addr, msg) {
+		return nil
+	}
+	return smtp.SendMail(addr, auth, emailConfig.Sender, to, msg)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestsCountAsPendingUntilFlushed(t *testing.T) {
+	saved := channelHealth
+	channelHealth = newChannelMonitor(ChannelHealthConfig{Failures: 1}, nil)
+	defer func() { channelHealth = saved }()
+	defer drainNotifications()
+
+	// Nothing listens on port 1, so the digest fails to send.
+	config := EmailConfig{SMTPHost: "127.0.0.1", SMTPPort: 1, Recipient: "ops@example.com", CorrelationWindow: Duration(time.Hour)}
+	n := notification{Target: Target{URL: "https://example.com/"}, Status: "down", Time: time.Now()}
+	if err := mailNotification("email", config, n); err != errDeferred {
+		t.Fatalf("mailNotification returned %v, want the notification deferred", err)
+	}
+	if got := notifyPending.Load(); got != 1 {
+		t.Fatalf("%d notifications pending with a digest waiting, want 1", got)
+	}
+	digests.flushAll()
+	// What remains pending is the channel alert about the failed digest.
+	if got := notifyPending.Load(); got != 1 || len(notifyQueue) != 1 {
+		t.Fatalf("%d notifications pending after flushing the digests, want the channel alert only", got)
+	}
+	if alert := <-notifyQueue; alert.Kind != notifyChannel || alert.Status != "failing" {
+		t.Errorf("failed digest not reported to channel health, queued %+v", alert)
+	}
+}
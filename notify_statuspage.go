@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// StatusPageConfig keeps components on a hosted status page in step with
+// monitor state.
+type StatusPageConfig struct {
+	// Provider is "statuspage" (Atlassian Statuspage) or "instatus".
+	Provider string `json:"provider"`
+	APIKey   string `json:"api_key"`
+	PageID   string `json:"page_id"`
+	// Components maps a monitor name or URL to the component ID it drives.
+	Components map[string]string `json:"components"`
+	// BaseURL overrides the provider's API endpoint.
+	BaseURL string `json:"base_url"`
+}
+
+type statusPageNotifier struct {
+	config StatusPageConfig
+}
+
+func newStatusPageNotifier(config StatusPageConfig) (*statusPageNotifier, error) {
+	switch config.Provider {
+	case "statuspage":
+		if config.BaseURL == "" {
+			config.BaseURL = "https://api.statuspage.io/v1"
+		}
+	case "instatus":
+		if config.BaseURL == "" {
+			config.BaseURL = "https://api.instatus.com/v1"
+		}
+	default:
+		return nil, fmt.Errorf("unknown status page provider %q", config.Provider)
+	}
+	return &statusPageNotifier{config: config}, nil
+}
+
+func (s *statusPageNotifier) name() string { return s.config.Provider }
+
+func (s *statusPageNotifier) notify(n notification) error {
+	if n.Kind != notifyState || n.Reminder {
+		return errNotApplicable
+	}
+	component, ok := s.config.Components[n.Target.Name]
+	if !ok {
+		component, ok = s.config.Components[n.Target.URL]
+	}
+	if !ok {
+		return errNotApplicable
+	}
+
+	var method, url, auth string
+	var payload any
+	switch s.config.Provider {
+	case "statuspage":
+		status := "operational"
+		if n.Status == "down" {
+			status = "major_outage"
+		}
+		method = http.MethodPatch
+		url = fmt.Sprintf("%s/pages/%s/components/%s", s.config.BaseURL, s.config.PageID, component)
+		auth = "OAuth " + s.config.APIKey
+		payload = map[string]any{"component": map[string]string{"status": status}}
+	case "instatus":
+		status := "OPERATIONAL"
+		if n.Status == "down" {
+			status = "MAJOROUTAGE"
+		}
+		method = http.MethodPut
+		url = fmt.Sprintf("%s/%s/components/%s", s.config.BaseURL, s.config.PageID, component)
+		auth = "Bearer " + s.config.APIKey
+		payload = map[string]string{"status": status}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if dryRunSkip(s.config.Provider+" component "+n.Status, method+" "+url, body) {
+		return nil
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("component %s update returned %s", component, resp.Status)
+	}
+	fmt.Printf("Set %s component %s to %s\n", s.config.Provider, component, n.Status)
+	return nil
+}
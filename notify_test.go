@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFullQueueKeepsStateChanges(t *testing.T) {
+	for len(notifyQueue) < cap(notifyQueue) {
+		notifyQueue <- notification{}
+	}
+	for len(stateQueue) < cap(stateQueue) {
+		stateQueue <- notification{}
+	}
+	defer drainNotifications()
+	defer func() {
+		stateSpill.mu.Lock()
+		stateSpill.order, stateSpill.latest = nil, make(map[string]notification)
+		stateSpill.mu.Unlock()
+	}()
+
+	a, b := Target{URL: "https://a.example.com/"}, Target{URL: "https://b.example.com/"}
+	done := make(chan struct{})
+	go func() {
+		enqueueNotification(notification{Kind: notifySLO, Target: a, Status: "burning"})
+		enqueueNotification(notification{Target: a, Status: "down", Reminder: true})
+		enqueueNotification(notification{Target: a, Status: "down"})
+		enqueueNotification(notification{Target: b, Status: "down"})
+		enqueueNotification(notification{Target: a, Status: "up"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueueing a state change blocked on a full queue")
+	}
+
+	stateSpill.mu.Lock()
+	defer stateSpill.mu.Unlock()
+	if len(stateSpill.order) != 2 || stateSpill.order[0] != a.URL || stateSpill.order[1] != b.URL {
+		t.Fatalf("waiting state changes are for %v, want a then b", stateSpill.order)
+	}
+	if n := stateSpill.latest[a.URL]; n.Status != "up" {
+		t.Errorf("waiting state change of a is %q, want the latest, up", n.Status)
+	}
+}
+
+// drainNotifications empties the queues after a test.
+func drainNotifications() {
+	for len(notifyQueue) > 0 {
+		<-notifyQueue
+	}
+	for len(stateQueue) > 0 {
+		<-stateQueue
+	}
+	notifyPending.Store(0)
+}
+
+func TestSilenceHoldsEveryAlert(t *testing.T) {
+	target := Target{URL: "https://silenced.example.com/"}
+	now := time.Now()
+	history.addSilence(target.URL, Silence{ID: "s1", Reason: "migration", Start: now.Add(-time.Minute), End: now.Add(time.Hour)})
+	defer history.endSilences(target.URL, time.Now())
+	defer drainNotifications()
+
+	for _, kind := range []string{notifySLO, notifyAnomaly, notifyTLS, notifyRenewal, notifyCert} {
+		enqueueNotification(notification{Kind: kind, Target: target, Status: "firing", Time: now})
+	}
+	enqueueNotification(notification{Target: target, Status: "down", Reminder: true, Time: now})
+	if len(notifyQueue) != 0 || len(stateQueue) != 0 {
+		t.Fatalf("silenced monitor queued %d alerts", len(notifyQueue)+len(stateQueue))
+	}
+	enqueueNotification(notification{Kind: notifySLO, Target: target, Status: alertResolved, Time: now})
+	if len(notifyQueue) != 0 {
+		t.Error("recovery sent for an alert that was held back")
+	}
+	enqueueNotification(notification{Kind: notifyHealth, Target: target, Status: alertResolved, Time: now})
+	if len(notifyQueue) != 1 {
+		t.Error("recovery of an alert raised before the silence was dropped")
+	}
+}
+
+func TestSilenceEndsWhileFiring(t *testing.T) {
+	target := Target{URL: "https://firing.example.com/"}
+	targets.set("test", []Target{target})
+	defer targets.set("test", nil)
+	now := time.Now()
+	history.addSilence(target.URL, Silence{ID: "s2", Reason: "migration", Start: now.Add(-time.Minute), End: now.Add(50 * time.Millisecond)})
+	defer drainNotifications()
+
+	enqueueNotification(notification{Kind: notifySLO, Target: target, Status: "burning", Time: now})
+	enqueueNotification(notification{Kind: notifyAnomaly, Target: target, Status: "slow", Time: now})
+	enqueueNotification(notification{Kind: notifyAnomaly, Target: target, Status: alertResolved, Time: now})
+	if len(notifyQueue) != 0 {
+		t.Fatalf("silenced monitor queued %d alerts", len(notifyQueue))
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(notifyQueue) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(notifyQueue) != 1 {
+		t.Fatalf("%d alerts sent when the silence ended, want the SLO alert still firing", len(notifyQueue))
+	}
+	if n := <-notifyQueue; n.Kind != notifySLO || n.Status != "burning" {
+		t.Errorf("sent %+v, want the SLO alert", n)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TicketConfig opens an issue in GitHub, GitLab or Jira for every outage
+// that lasts longer than After, and closes it when the monitor recovers.
+type TicketConfig struct {
+	// Provider is "github", "gitlab" or "jira".
+	Provider string `json:"provider"`
+	// BaseURL is the API endpoint. It defaults to https://api.github.com
+	// and https://gitlab.com, and is required for Jira, e.g.
+	// https://example.atlassian.net.
+	BaseURL string `json:"base_url"`
+	// Token is a GitHub or GitLab access token, or a Jira API token.
+	Token string `json:"token"`
+	// Username is the Jira account the API token belongs to. Without it the
+	// token is sent as a bearer token, as Jira Data Center expects.
+	Username string `json:"username"`
+	// Project is "owner/repo" on GitHub, the project path or ID on GitLab,
+	// and the project key in Jira.
+	Project string `json:"project"`
+	// After is how long an outage lasts before a ticket is opened.
+	// Defaults to 15m.
+	After Duration `json:"after"`
+	// Match limits tickets to the monitors it matches, in the syntax of
+	// routes.
+	Match  string   `json:"match"`
+	Labels []string `json:"labels"`
+	// IssueType is the Jira issue type. Defaults to "Bug".
+	IssueType string `json:"issue_type"`
+	// CloseTransition is the Jira transition that closes an issue.
+	// Defaults to "Done".
+	CloseTransition string `json:"close_transition"`
+	// KeepOpen only comments on recovery instead of closing the ticket,
+	// for teams that close tickets after their post-mortem.
+	KeepOpen bool `json:"keep_open"`
+	// PublicURL is where this instance's API is reachable, for links to
+	// the monitor's state in tickets.
+	PublicURL string `json:"public_url"`
+	// StateFile keeps the open tickets across restarts, so they are still
+	// closed on recovery.
+	StateFile string `json:"state_file"`
+}
+
+// OpenTicket is a ticket opened for an ongoing outage.
+type OpenTicket struct {
+	// ID is the GitHub or GitLab issue number, or the Jira issue key.
+	ID     string    `json:"id"`
+	Link   string    `json:"link"`
+	Opened time.Time `json:"opened"`
+}
+
+// ticketPoll is how often outages are checked against After.
+const ticketPoll = time.Minute
+
+type ticketNotifier struct {
+	config TicketConfig
+	match  route
+	client *http.Client
+
+	mu sync.Mutex
+	// open maps monitor URLs to their tickets.
+	open map[string]OpenTicket
+}
+
+func newTicketNotifier(config TicketConfig) (*ticketNotifier, error) {
+	switch config.Provider {
+	case "github":
+		if config.BaseURL == "" {
+			config.BaseURL = "https://api.github.com"
+		}
+	case "gitlab":
+		if config.BaseURL == "" {
+			config.BaseURL = "https://gitlab.com"
+		}
+	case "jira":
+		if config.BaseURL == "" {
+			return nil, fmt.Errorf("jira tickets need a base_url")
+		}
+		if config.IssueType == "" {
+			config.IssueType = "Bug"
+		}
+		if config.CloseTransition == "" {
+			config.CloseTransition = "Done"
+		}
+	default:
+		return nil, fmt.Errorf("unknown ticket provider %q", config.Provider)
+	}
+	if config.Project == "" || config.Token == "" {
+		return nil, fmt.Errorf("%s tickets need a project and token", config.Provider)
+	}
+	if config.After <= 0 {
+		config.After = Duration(15 * time.Minute)
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	conds, err := parseRouteMatch(config.Match)
+	if err != nil {
+		return nil, err
+	}
+	t := &ticketNotifier{
+		config: config,
+		match:  route{conditions: conds},
+		client: &http.Client{Timeout: 15 * time.Second},
+		open:   make(map[string]OpenTicket),
+	}
+	if config.StateFile != "" {
+		b, err := os.ReadFile(config.StateFile)
+		if err == nil {
+			err = json.Unmarshal(b, &t.open)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("reading %s: %w", config.StateFile, err)
+		}
+	}
+	go t.watch()
+	return t, nil
+}
+
+func (t *ticketNotifier) name() string { return t.config.Provider }
+
+// watch opens tickets for outages that have lasted longer than After.
+func (t *ticketNotifier) watch() {
+	for range time.Tick(ticketPoll) {
+		if !isLeader() {
+			continue
+		}
+		now := time.Now().UTC()
+		entries, _, _ := statuses.page(0, math.MaxInt)
+		for _, e := range entries {
+			if e.Status != StatusDown || now.Sub(e.Since) < time.Duration(t.config.After) || holds.isHeld(e.URL) {
+				continue
+			}
+			t.mu.Lock()
+			_, ok := t.open[e.URL]
+			t.mu.Unlock()
+			if ok {
+				continue
+			}
+			target, ok := targets.get(e.URL)
+			if !ok || inMaintenance(target, now) || !t.match.matches(notification{Target: target, Status: "down"}) {
+				continue
+			}
+			detail := ""
+			if state, ok := statuses.get(e.URL); ok {
+				detail = state.LastError
+			}
+			if err := t.openTicket(target, e.Since, detail); err != nil {
+				fmt.Printf("Error opening %s ticket for %s: %s\n", t.config.Provider, e.URL, err)
+			}
+		}
+	}
+}
+
+// link is the URL of target's state in this instance's API, if known.
+func (t *ticketNotifier) link(target Target) string {
+	if t.config.PublicURL == "" {
+		return ""
+	}
+	return strings.TrimRight(t.config.PublicURL, "/") + "/status/monitor?url=" + url.QueryEscape(target.URL)
+}
+
+func (t *ticketNotifier) openTicket(target Target, since time.Time, detail string) error {
+	title := fmt.Sprintf("%s is down", target.displayName())
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s (%s) has been down since %s.\n\n", target.displayName(), target.URL, formatTime(since, displayZone))
+	if detail != "" {
+		fmt.Fprintf(&body, "Last error: %s\n\n", detail)
+	}
+	fmt.Fprintf(&body, "Severity: %s\n", target.severity())
+	if target.Group != "" {
+		fmt.Fprintf(&body, "Group: %s\n", target.Group)
+	}
+	if len(target.Tags) > 0 {
+		fmt.Fprintf(&body, "Tags: %s\n", strings.Join(target.Tags, ", "))
+	}
+	keys := make([]string, 0, len(target.Metadata))
+	for k := range target.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&body, "%s: %s\n", k, target.Metadata[k])
+	}
+	if incident, ok := history.openIncident(target.URL); ok && incident.Deploy != nil {
+		fmt.Fprintf(&body, "Deploy: %s\n", incident.Deploy.describe(since))
+	}
+	if link := t.link(target); link != "" {
+		fmt.Fprintf(&body, "\nCurrent state: %s\n", link)
+	}
+
+	var ticket OpenTicket
+	var err error
+	switch t.config.Provider {
+	case "github":
+		var resp struct {
+			Number  int    `json:"number"`
+			HTMLURL string `json:"html_url"`
+		}
+		issue := map[string]any{"title": title, "body": body.String()}
+		if len(t.config.Labels) > 0 {
+			issue["labels"] = t.config.Labels
+		}
+		err = t.call(http.MethodPost, "/repos/"+t.config.Project+"/issues", issue, &resp)
+		ticket = OpenTicket{ID: fmt.Sprint(resp.Number), Link: resp.HTMLURL}
+	case "gitlab":
+		var resp struct {
+			IID    int    `json:"iid"`
+			WebURL string `json:"web_url"`
+		}
+		err = t.call(http.MethodPost, t.gitlabProject()+"/issues",
+			map[string]any{"title": title, "description": body.String(), "labels": strings.Join(t.config.Labels, ",")}, &resp)
+		ticket = OpenTicket{ID: fmt.Sprint(resp.IID), Link: resp.WebURL}
+	case "jira":
+		var resp struct {
+			Key string `json:"key"`
+		}
+		fields := map[string]any{
+			"project":     map[string]string{"key": t.config.Project},
+			"summary":     title,
+			"description": body.String(),
+			"issuetype":   map[string]string{"name": t.config.IssueType},
+		}
+		if len(t.config.Labels) > 0 {
+			fields["labels"] = t.config.Labels
+		}
+		err = t.call(http.MethodPost, "/rest/api/2/issue", map[string]any{"fields": fields}, &resp)
+		ticket = OpenTicket{ID: resp.Key, Link: t.config.BaseURL + "/browse/" + resp.Key}
+	}
+	if err != nil {
+		return err
+	}
+	ticket.Opened = time.Now().UTC()
+	t.mu.Lock()
+	t.open[target.URL] = ticket
+	t.saveLocked()
+	t.mu.Unlock()
+	fmt.Printf("Opened %s ticket %s for %s\n", t.config.Provider, ticket.ID, target.URL)
+	return nil
+}
+
+// notify comments on a monitor's ticket when it is reminded of, and
+// closes the ticket when the monitor recovers.
+func (t *ticketNotifier) notify(n notification) error {
+	if n.Kind != notifyState {
+		return errNotApplicable
+	}
+	t.mu.Lock()
+	ticket, ok := t.open[n.Target.URL]
+	t.mu.Unlock()
+	if !ok {
+		return errNotApplicable
+	}
+	switch {
+	case n.Reminder:
+		return t.comment(ticket, fmt.Sprintf("Still down after %s: %s", formatDuration(n.Downtime), n.Detail))
+	case n.Status != "up":
+		return errNotApplicable
+	}
+	if err := t.comment(ticket, fmt.Sprintf("Recovered at %s after %s down.", formatTime(n.Time, displayZone), formatDuration(n.Downtime))); err != nil {
+		return err
+	}
+	if !t.config.KeepOpen {
+		if err := t.close(ticket); err != nil {
+			return err
+		}
+	}
+	t.mu.Lock()
+	delete(t.open, n.Target.URL)
+	t.saveLocked()
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *ticketNotifier) comment(ticket OpenTicket, text string) error {
+	switch t.config.Provider {
+	case "github":
+		return t.call(http.MethodPost, "/repos/"+t.config.Project+"/issues/"+ticket.ID+"/comments", map[string]string{"body": text}, nil)
+	case "gitlab":
+		return t.call(http.MethodPost, t.gitlabProject()+"/issues/"+ticket.ID+"/notes", map[string]string{"body": text}, nil)
+	}
+	return t.call(http.MethodPost, "/rest/api/2/issue/"+ticket.ID+"/comment", map[string]string{"body": text}, nil)
+}
+
+func (t *ticketNotifier) close(ticket OpenTicket) error {
+	switch t.config.Provider {
+	case "github":
+		return t.call(http.MethodPatch, "/repos/"+t.config.Project+"/issues/"+ticket.ID, map[string]string{"state": "closed"}, nil)
+	case "gitlab":
+		return t.call(http.MethodPut, t.gitlabProject()+"/issues/"+ticket.ID, map[string]string{"state_event": "close"}, nil)
+	}
+	// Jira workflows differ, so the transition is looked up by name.
+	var resp struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"transitions"`
+	}
+	if err := t.call(http.MethodGet, "/rest/api/2/issue/"+ticket.ID+"/transitions", nil, &resp); err != nil {
+		return err
+	}
+	for _, tr := range resp.Transitions {
+		if strings.EqualFold(tr.Name, t.config.CloseTransition) {
+			return t.call(http.MethodPost, "/rest/api/2/issue/"+ticket.ID+"/transitions",
+				map[string]any{"transition": map[string]string{"id": tr.ID}}, nil)
+		}
+	}
+	return fmt.Errorf("issue %s has no transition %q", ticket.ID, t.config.CloseTransition)
+}
+
+func (t *ticketNotifier) gitlabProject() string {
+	return "/api/v4/projects/" + url.PathEscape(t.config.Project)
+}
+
+// call sends payload as JSON to path on the provider's API and decodes the
+// response into out, if given.
+func (t *ticketNotifier) call(method, path string, payload, out any) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	endpoint := t.config.BaseURL + path
+	if method != http.MethodGet && dryRunSkip(t.config.Provider+" ticket", method+" "+endpoint, body) {
+		return nil
+	}
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", defaultUserAgent)
+	switch {
+	case t.config.Provider == "github":
+		req.Header.Set("Authorization", "Bearer "+t.config.Token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	case t.config.Provider == "gitlab":
+		req.Header.Set("PRIVATE-TOKEN", t.config.Token)
+	case t.config.Username != "":
+		req.SetBasicAuth(t.config.Username, t.config.Token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+t.config.Token)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// saveLocked writes the open tickets to the state file. t.mu must be held.
+func (t *ticketNotifier) saveLocked() {
+	if t.config.StateFile == "" {
+		return
+	}
+	b, err := json.Marshal(t.open)
+	if err == nil {
+		tmp := t.config.StateFile + ".tmp"
+		if err = os.WriteFile(tmp, b, 0o600); err == nil {
+			err = os.Rename(tmp, t.config.StateFile)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error saving open tickets:", err)
+	}
+}
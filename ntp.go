@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NTPCheckConfig configures "ntp" monitors, whose url is ntp://host[:port].
+type NTPCheckConfig struct {
+	// MaxOffset is how far the server's clock may be from ours. Defaults
+	// to 100ms.
+	MaxOffset Duration `json:"max_offset,omitempty"`
+	// MaxStratum fails servers further than this from a reference clock.
+	// Zero accepts any synchronized server.
+	MaxStratum int `json:"max_stratum,omitempty"`
+	// Timeout is how long to wait for a reply. Defaults to 2s.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+const ntpType = "ntp"
+
+// ntpEpochOffset is the number of seconds from 1900, the NTP epoch, to
+// 1970.
+const ntpEpochOffset = 2208988800
+
+func ntpTime(b []byte) time.Time {
+	secs := binary.BigEndian.Uint32(b)
+	frac := binary.BigEndian.Uint32(b[4:])
+	nanos := (int64(frac) * 1e9) >> 32
+	return time.Unix(int64(secs)-ntpEpochOffset, nanos)
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:], uint32((int64(t.Nanosecond())<<32)/1e9))
+}
+
+// probeNTP queries the server once with SNTP (RFC 4330) and checks its
+// clock offset.
+func probeNTP(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	cfg := target.NTP
+	if cfg == nil {
+		cfg = &NTPCheckConfig{}
+	}
+	u, err := url.Parse(target.URL)
+	if err != nil || u.Scheme != "ntp" || u.Hostname() == "" {
+		result.Detail = "ntp monitors need a ntp://host[:port] url"
+		return result
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "123")
+	}
+	if target.dialAddr != "" {
+		addr = target.dialAddr
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(strings.Trim(addr, "[]"), "123")
+		}
+	}
+	maxOffset, timeout := time.Duration(cfg.MaxOffset), time.Duration(cfg.Timeout)
+	if maxOffset <= 0 {
+		maxOffset = 100 * time.Millisecond
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	conn, err := dialCheck(target, "udp", addr, timeout)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	defer conn.Close()
+	req := make([]byte, 48)
+	req[0] = 0x23 // no leap warning, version 4, client mode
+	sent := time.Now()
+	putNTPTime(req[40:], sent)
+	conn.SetDeadline(sent.Add(timeout))
+	if _, err := conn.Write(req); err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	received := time.Now()
+	result.Latency = Duration(received.Sub(sent))
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	if n < 48 || resp[0]&0x07 != 4 {
+		result.Detail = "malformed NTP response"
+		return result
+	}
+	leap, stratum := resp[0]>>6, int(resp[1])
+	if stratum == 0 {
+		result.Detail = fmt.Sprintf("server sent kiss code %q", strings.TrimRight(string(resp[12:16]), "\x00"))
+		return result
+	}
+	if leap == 3 || stratum >= 16 {
+		result.Detail = fmt.Sprintf("server is not synchronized (stratum %d)", stratum)
+		return result
+	}
+	if string(resp[24:32]) != string(req[40:48]) {
+		result.Detail = "NTP response does not match the request"
+		return result
+	}
+
+	serverReceive, serverTransmit := ntpTime(resp[32:]), ntpTime(resp[40:])
+	offset := (serverReceive.Sub(sent) + serverTransmit.Sub(received)) / 2
+	result.Detail = fmt.Sprintf("offset %s, stratum %d", offset.Round(time.Microsecond), stratum)
+	switch {
+	case offset > maxOffset || offset < -maxOffset:
+		result.Detail += fmt.Sprintf(": offset exceeds %s", maxOffset)
+	case cfg.MaxStratum > 0 && stratum > cfg.MaxStratum:
+		result.Detail += fmt.Sprintf(": stratum exceeds %d", cfg.MaxStratum)
+	default:
+		result.Status = "up"
+	}
+	return result
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCConfig enables browser login to the API through an OpenID Connect
+// provider such as Google, Azure AD or Keycloak.
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL; its discovery document is read
+	// from Issuer + "/.well-known/openid-configuration".
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// RedirectURL must be this server's /auth/callback as registered with
+	// the provider, e.g. "https://uptime.example.com/auth/callback".
+	RedirectURL string `json:"redirect_url"`
+	// Scopes are requested in addition to "openid". Defaults to email and
+	// profile.
+	Scopes []string `json:"scopes"`
+	// RoleClaim is the ID token claim holding the user's groups or roles.
+	// Defaults to "groups".
+	RoleClaim string `json:"role_claim"`
+	// Roles maps RoleClaim values to a role: "admin", "viewer" (read-only,
+	// everything) or "project:<name>". Users with no mapped role are
+	// refused.
+	Roles map[string]string `json:"roles"`
+	// SessionTTL defaults to 12h.
+	SessionTTL Duration `json:"session_ttl"`
+}
+
+const (
+	sessionCookie = "uptime_session"
+	loginCookie   = "uptime_login"
+)
+
+type oidcProvider struct {
+	config        OIDCConfig
+	authEndpoint  string
+	tokenEndpoint string
+	jwksURI       string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	logins  map[string]oidcLogin
+	session map[string]userSession
+}
+
+// oidcLogin is a login in progress, keyed by its state parameter.
+type oidcLogin struct {
+	nonce, verifier, next string
+	expires               time.Time
+}
+
+// userSession is a logged-in dashboard user.
+type userSession struct {
+	User    string
+	Scope   apiScope
+	Expires time.Time
+}
+
+// oidc is nil unless OIDC login is configured.
+var oidc *oidcProvider
+
+func newOIDCProvider(config OIDCConfig) (*oidcProvider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc needs issuer, client_id and redirect_url")
+	}
+	if config.RoleClaim == "" {
+		config.RoleClaim = "groups"
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"email", "profile"}
+	}
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = Duration(12 * time.Hour)
+	}
+	for value, role := range config.Roles {
+		if _, err := parseRole(role); err != nil {
+			return nil, fmt.Errorf("role for %q: %w", value, err)
+		}
+	}
+	var doc struct {
+		Issuer        string `json:"issuer"`
+		Authorization string `json:"authorization_endpoint"`
+		Token         string `json:"token_endpoint"`
+		JWKS          string `json:"jwks_uri"`
+	}
+	if err := getJSON(strings.TrimSuffix(config.Issuer, "/")+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("reading discovery document: %w", err)
+	}
+	if doc.Authorization == "" || doc.Token == "" || doc.JWKS == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	if doc.Issuer != "" {
+		config.Issuer = doc.Issuer
+	}
+	return &oidcProvider{
+		config:        config,
+		authEndpoint:  doc.Authorization,
+		tokenEndpoint: doc.Token,
+		jwksURI:       doc.JWKS,
+		keys:          make(map[string]crypto.PublicKey),
+		logins:        make(map[string]oidcLogin),
+		session:       make(map[string]userSession),
+	}, nil
+}
+
+func parseRole(role string) (apiScope, error) {
+	switch {
+	case role == "admin":
+		return apiScope{all: true}, nil
+	case role == "viewer":
+		return apiScope{all: true, readOnly: true}, nil
+	case strings.HasPrefix(role, "project:") && len(role) > len("project:"):
+		return apiScope{project: strings.TrimPrefix(role, "project:")}, nil
+	}
+	return apiScope{}, fmt.Errorf(`unknown role %q; use "admin", "viewer" or "project:<name>"`, role)
+}
+
+func getJSON(u string, v any) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// sessionScope returns the scope of the session cookie on r, if any.
+func (o *oidcProvider) sessionScope(r *http.Request) (userSession, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return userSession{}, false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s, ok := o.session[c.Value]
+	if !ok || time.Now().After(s.Expires) {
+		delete(o.session, c.Value)
+		return userSession{}, false
+	}
+	return s, true
+}
+
+func (o *oidcProvider) secureCookies() bool {
+	return strings.HasPrefix(o.config.RedirectURL, "https://")
+}
+
+// loginHandler serves GET /auth/login?next=/path, sending the browser to the
+// provider.
+func (o *oidcProvider) loginHandler(w http.ResponseWriter, r *http.Request) {
+	next := r.URL.Query().Get("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		next = "/"
+	}
+	state, nonce, verifier := randomID(16), randomID(16), randomID(32)
+	now := time.Now()
+	o.mu.Lock()
+	for k, l := range o.logins {
+		if now.After(l.expires) {
+			delete(o.logins, k)
+		}
+	}
+	o.logins[state] = oidcLogin{nonce: nonce, verifier: verifier, next: next, expires: now.Add(10 * time.Minute)}
+	o.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.config.ClientID},
+		"redirect_uri":          {o.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, o.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {b64(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	// The state is also bound to this browser, so a login started elsewhere
+	// cannot be completed here.
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Value: state, Path: "/auth/", MaxAge: 600,
+		HttpOnly: true, Secure: o.secureCookies(), SameSite: http.SameSiteLaxMode})
+	sep := "?"
+	if strings.Contains(o.authEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, o.authEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// callbackHandler serves GET /auth/callback, completing the login.
+func (o *oidcProvider) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		writeProblem(w, r, http.StatusUnauthorized, problemLoginFailed, strings.TrimSpace(e+" "+q.Get("error_description")))
+		return
+	}
+	state := q.Get("state")
+	c, err := r.Cookie(loginCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) != 1 {
+		writeProblem(w, r, http.StatusBadRequest, problemLoginFailed, "login state mismatch; start again at /auth/login")
+		return
+	}
+	o.mu.Lock()
+	login, ok := o.logins[state]
+	delete(o.logins, state)
+	o.mu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		writeProblem(w, r, http.StatusBadRequest, problemLoginFailed, "login expired; start again at /auth/login")
+		return
+	}
+
+	claims, err := o.exchange(q.Get("code"), login)
+	if err != nil {
+		fmt.Println("OIDC login failed:", err)
+		writeProblem(w, r, http.StatusUnauthorized, problemLoginFailed, err.Error())
+		return
+	}
+	user, _ := claims["email"].(string)
+	if user == "" {
+		user, _ = claims["sub"].(string)
+	}
+	scope, ok := o.scopeFor(claims)
+	if !ok {
+		fmt.Printf("OIDC login refused for %s: no mapped role\n", user)
+		writeProblem(w, r, http.StatusForbidden, problemForbidden, "your account has no role in this uptime monitor")
+		return
+	}
+	id := randomID(32)
+	ttl := time.Duration(o.config.SessionTTL)
+	o.mu.Lock()
+	now := time.Now()
+	for k, s := range o.session {
+		if now.After(s.Expires) {
+			delete(o.session, k)
+		}
+	}
+	o.session[id] = userSession{User: user, Scope: scope, Expires: now.Add(ttl)}
+	o.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: "/auth/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/", MaxAge: int(ttl.Seconds()),
+		HttpOnly: true, Secure: o.secureCookies(), SameSite: http.SameSiteLaxMode})
+	audit.record(AuditEntry{Type: "admin", Action: "login", Actor: user, Outcome: "ok"})
+	fmt.Printf("%s logged in\n", user)
+	http.Redirect(w, r, login.next, http.StatusFound)
+}
+
+// scopeFor picks the broadest scope among the roles claims map to.
+func (o *oidcProvider) scopeFor(claims map[string]any) (apiScope, bool) {
+	var values []string
+	switch v := claims[o.config.RoleClaim].(type) {
+	case string:
+		values = strings.Fields(v)
+	case []any:
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	var best apiScope
+	found := false
+	for _, v := range values {
+		role, ok := o.config.Roles[v]
+		if !ok {
+			continue
+		}
+		scope, _ := parseRole(role)
+		if !found || scope.all && (!best.all || best.readOnly && !scope.readOnly) {
+			best, found = scope, true
+		}
+	}
+	return best, found
+}
+
+// exchange redeems code for tokens and returns the verified ID token claims.
+func (o *oidcProvider) exchange(code string, login oidcLogin) (map[string]any, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.config.RedirectURL},
+		"client_id":     {o.config.ClientID},
+		"code_verifier": {login.verifier},
+	}
+	if o.config.ClientSecret != "" {
+		form.Set("client_secret", o.config.ClientSecret)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.PostForm(o.tokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+		Desc    string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+	if tok.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s %s", tok.Error, tok.Desc)
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("token endpoint returned no id_token")
+	}
+	claims, err := o.verify(tok.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != login.nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// verify checks the ID token's signature, issuer, audience and expiry.
+func (o *oidcProvider) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed id token signature")
+	}
+	key, err := o.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(o.config.Issuer, "/") {
+		return nil, fmt.Errorf("id token issuer %q is not %q", iss, o.config.Issuer)
+	}
+	audOK := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audOK = aud == o.config.ClientID
+	case []any:
+		for _, a := range aud {
+			audOK = audOK || a == o.config.ClientID
+		}
+	}
+	if !audOK {
+		return nil, errors.New("id token is not for this client")
+	}
+	exp, _ := claims["exp"].(float64)
+	if time.Now().After(time.Unix(int64(exp), 0).Add(time.Minute)) {
+		return nil, errors.New("id token has expired")
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("malformed id token")
+	}
+	return json.Unmarshal(b, v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported id token algorithm %q", alg)
+	}
+	var h crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h = crypto.SHA256
+	case "384":
+		h = crypto.SHA384
+	case "512":
+		h = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported id token algorithm %q", alg)
+	}
+	hasher := h.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			if rsa.VerifyPKCS1v15(k, h, digest, sig) == nil {
+				return nil
+			}
+		case "PS":
+			if rsa.VerifyPSS(k, h, digest, sig, nil) == nil {
+				return nil
+			}
+		}
+	case *ecdsa.PublicKey:
+		n := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] == "ES" && len(sig) == 2*n {
+			r, s := new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:])
+			if ecdsa.Verify(k, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("invalid %s id token signature", alg)
+}
+
+// key returns the provider's signing key kid, refreshing the key set when
+// it is not known yet.
+func (o *oidcProvider) key(kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	k, ok := o.keys[kid]
+	o.mu.Unlock()
+	if ok {
+		return k, nil
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(o.jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching signing keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		switch jwk.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err1 == nil && err2 == nil {
+				keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if err1 == nil && err2 == nil {
+				keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			}
+		}
+	}
+	o.mu.Lock()
+	o.keys = keys
+	o.mu.Unlock()
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown id token signing key %q", kid)
+}
+
+// logoutHandler serves POST /auth/logout.
+func (o *oidcProvider) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodPost) {
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		o.mu.Lock()
+		delete(o.session, c.Value)
+		o.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// meHandler serves GET /auth/me with the logged-in user and role.
+func (o *oidcProvider) meHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := o.sessionScope(r)
+	if !ok {
+		writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "not logged in")
+		return
+	}
+	role := "project:" + s.Scope.project
+	if s.Scope.all {
+		role = "admin"
+		if s.Scope.readOnly {
+			role = "viewer"
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"user": s.User, "role": role, "expires": s.Expires})
+}
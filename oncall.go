@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// OnCallSchedule rotates a team's members through shifts of equal length.
+type OnCallSchedule struct {
+	// Members take shifts in this order, e.g. email addresses.
+	Members []string `json:"members"`
+	// Start is when the first member's first shift began, e.g. a Monday
+	// at 09:00 for weekly handovers then.
+	Start time.Time `json:"start"`
+	// Shift is how long each member is on call. Defaults to a week.
+	Shift Duration `json:"shift"`
+	// Overrides put someone else on call for a while, e.g. to swap shifts.
+	Overrides []OnCallOverride `json:"overrides"`
+}
+
+type OnCallOverride struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Member string    `json:"member"`
+}
+
+// OnCallShift is one member's turn on call.
+type OnCallShift struct {
+	Member string    `json:"member"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// OnCallStatus is who is on call for a team now and next.
+type OnCallStatus struct {
+	Team    string      `json:"team"`
+	Current OnCallShift `json:"current"`
+	Next    OnCallShift `json:"next"`
+}
+
+// onCall holds the configured schedules by team.
+var onCall map[string]OnCallSchedule
+
+func (s OnCallSchedule) validate() error {
+	if len(s.Members) == 0 {
+		return fmt.Errorf("no members")
+	}
+	if s.Start.IsZero() {
+		return fmt.Errorf("no start")
+	}
+	if s.Shift < 0 {
+		return fmt.Errorf("negative shift")
+	}
+	for _, o := range s.Overrides {
+		if o.Member == "" || !o.End.After(o.Start) {
+			return fmt.Errorf("override needs a member and an end after its start")
+		}
+	}
+	return nil
+}
+
+func (s OnCallSchedule) shiftLength() time.Duration {
+	if s.Shift <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(s.Shift)
+}
+
+// shift returns the shift in effect at t. Overrides take precedence over
+// the rotation, and cut the rotation's shift short.
+func (s OnCallSchedule) shift(t time.Time) OnCallShift {
+	for _, o := range s.Overrides {
+		if !t.Before(o.Start) && t.Before(o.End) {
+			return OnCallShift{Member: o.Member, Start: o.Start, End: o.End}
+		}
+	}
+	length := s.shiftLength()
+	n := int64(t.Sub(s.Start) / length)
+	if t.Before(s.Start) {
+		n--
+	}
+	start := s.Start.Add(time.Duration(n) * length)
+	i := n % int64(len(s.Members))
+	if i < 0 {
+		i += int64(len(s.Members))
+	}
+	sh := OnCallShift{Member: s.Members[i], Start: start, End: start.Add(length)}
+	for _, o := range s.Overrides {
+		if o.Start.After(t) && o.Start.Before(sh.End) {
+			sh.End = o.Start
+		}
+		if !o.End.After(t) && o.End.After(sh.Start) {
+			sh.Start = o.End
+		}
+	}
+	return sh
+}
+
+func (s OnCallSchedule) status(team string, now time.Time) OnCallStatus {
+	current := s.shift(now)
+	return OnCallStatus{Team: team, Current: current, Next: s.shift(current.End)}
+}
+
+func setupOnCall(config Config) {
+	onCall = make(map[string]OnCallSchedule)
+	for team, s := range config.OnCall {
+		if err := s.validate(); err != nil {
+			fmt.Printf("Ignoring on-call schedule %s: %s\n", team, err)
+			continue
+		}
+		onCall[team] = s
+	}
+}
+
+// recipient is who email to this configuration goes to: whoever is on call
+// for OnCall, if set, else Recipient.
+func (c EmailConfig) recipient() string {
+	if c.OnCall == "" {
+		return c.Recipient
+	}
+	s, ok := onCall[c.OnCall]
+	if !ok {
+		fmt.Printf("Unknown on-call schedule %q; emailing %s\n", c.OnCall, c.Recipient)
+		return c.Recipient
+	}
+	return s.shift(time.Now()).Member
+}
+
+// onCallHandler serves GET /oncall, who is on call for each team.
+func onCallHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	now := time.Now().UTC()
+	out := []OnCallStatus{}
+	for team, s := range onCall {
+		out = append(out, s.status(team, now))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Team < out[j].Team })
+	writeJSON(w, http.StatusOK, out)
+}
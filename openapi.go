@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The OpenAPI document is assembled from the routes as they are registered
+// with handle, and its schemas are derived from the Go types the handlers
+// encode, so it cannot drift from what the server actually does.
+
+// apiOp documents one operation of a route.
+type apiOp struct {
+	method  string
+	summary string
+	// path overrides the registered pattern, for routes such as
+	// "/subscriptions/" that serve several paths.
+	path   string
+	params []apiParam
+	// body and result are zero values of the request and response types.
+	// A nil result means 204 No Content.
+	body   any
+	result any
+	// status is the success code; it defaults to 200, or 204 without a
+	// result.
+	status int
+	// text marks operations that can also answer text/plain. A string
+	// result marks ones that answer only text/plain, or only media when
+	// it is set, such as application/pdf.
+	text  bool
+	media string
+}
+
+type apiParam struct {
+	name, in, doc string
+	// kind is the JSON schema type; it defaults to "string".
+	kind     string
+	required bool
+}
+
+func query(name, doc string) apiParam { return apiParam{name: name, in: "query", doc: doc} }
+func queryInt(name, doc string) apiParam {
+	return apiParam{name: name, in: "query", doc: doc, kind: "integer"}
+}
+func pathParam(name, doc string) apiParam {
+	return apiParam{name: name, in: "path", doc: doc, required: true}
+}
+
+var (
+	openAPIMu    sync.Mutex
+	openAPIPaths = map[string]map[string]any{}
+	openAPITypes = map[string]any{}
+)
+
+// handle registers h for pattern and documents its operations.
+func handle(pattern string, h http.HandlerFunc, ops ...apiOp) {
+	http.HandleFunc(pattern, h)
+	openAPIMu.Lock()
+	defer openAPIMu.Unlock()
+	for _, op := range ops {
+		path := op.path
+		if path == "" {
+			path = strings.TrimSuffix(pattern, "/")
+		}
+		if openAPIPaths[path] == nil {
+			openAPIPaths[path] = map[string]any{}
+		}
+		openAPIPaths[path][strings.ToLower(op.method)] = op.document()
+	}
+}
+
+// document must be called with openAPIMu held.
+func (op apiOp) document() map[string]any {
+	doc := map[string]any{"summary": op.summary}
+	var params []any
+	for _, p := range op.params {
+		kind := p.kind
+		if kind == "" {
+			kind = "string"
+		}
+		params = append(params, map[string]any{
+			"name": p.name, "in": p.in, "description": p.doc, "required": p.required,
+			"schema": map[string]any{"type": kind},
+		})
+	}
+	if params != nil {
+		doc["parameters"] = params
+	}
+	if op.body != nil {
+		doc["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": schemaOf(reflect.TypeOf(op.body))}},
+		}
+	}
+	responses := map[string]any{
+		"default": map[string]any{
+			"description": "Error",
+			"content":     map[string]any{"application/problem+json": map[string]any{"schema": schemaOf(reflect.TypeOf(Problem{}))}},
+		},
+	}
+	status := op.status
+	if op.result == nil {
+		if status == 0 {
+			status = http.StatusNoContent
+		}
+		responses[strconv.Itoa(status)] = map[string]any{"description": http.StatusText(status)}
+	} else {
+		if status == 0 {
+			status = http.StatusOK
+		}
+		content := map[string]any{}
+		_, plain := op.result.(string)
+		if !plain {
+			content["application/json"] = map[string]any{"schema": schemaOf(reflect.TypeOf(op.result))}
+		}
+		switch {
+		case plain && op.media != "":
+			content[op.media] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+		case op.text || plain:
+			content["text/plain"] = map[string]any{"schema": map[string]any{"type": "string"}}
+		}
+		responses[strconv.Itoa(status)] = map[string]any{"description": http.StatusText(status), "content": content}
+	}
+	doc["responses"] = responses
+	return doc
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(Duration(0))
+)
+
+// schemaOf returns the JSON schema of t as encoding/json would encode it,
+// adding named structs to the document's components. It must be called
+// with openAPIMu held.
+func schemaOf(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]any{"type": "string", "description": `Go duration, e.g. "1m30s"`}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t)
+		}
+		if _, ok := openAPITypes[t.Name()]; !ok {
+			openAPITypes[t.Name()] = nil // placeholder for recursive types
+			openAPITypes[t.Name()] = structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+func structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				walk(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = schemaOf(f.Type)
+			if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+	}
+	walk(t)
+	s := map[string]any{"type": "object", "properties": props}
+	if required != nil {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+// openAPIHandler serves GET /openapi.json.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	openAPIMu.Lock()
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Uptime Monitor API",
+			"version": "1.0",
+		},
+		"paths": openAPIPaths,
+		"components": map[string]any{
+			"schemas": openAPITypes,
+			"securitySchemes": map[string]any{
+				"apiKey":  map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer":  map[string]any{"type": "http", "scheme": "bearer"},
+				"session": map[string]any{"type": "apiKey", "in": "cookie", "name": sessionCookie},
+			},
+		},
+	}
+	if tenancy != nil || oidc != nil {
+		doc["security"] = []any{
+			map[string]any{"apiKey": []string{}},
+			map[string]any{"bearer": []string{}},
+			map[string]any{"session": []string{}},
+		}
+	}
+	b, _ := json.MarshalIndent(doc, "", "  ")
+	openAPIMu.Unlock()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// OriginConfig pairs an HTTP monitor, fetched through the CDN edge, with
+// the same content fetched directly from origin.
+type OriginConfig struct {
+	// URL is the origin's url for the same content, e.g.
+	// https://origin.example.com/index.html.
+	URL string `json:"url,omitempty"`
+	// Address instead connects to the origin at host[:port] while keeping
+	// the monitor's url, Host header and TLS name.
+	Address string `json:"address,omitempty"`
+	// Headers are added to origin requests only, e.g. a secret the origin
+	// requires from the CDN.
+	Headers map[string]string `json:"headers,omitempty"`
+	// StatusOnly compares only the status codes, for pages whose body
+	// legitimately differs on every request.
+	StatusOnly bool `json:"status_only,omitempty"`
+	// MaxStale is how long the edge may keep serving different content
+	// than origin before the monitor is down, allowing for cache TTLs and
+	// purges after a deploy. Defaults to 10m.
+	MaxStale Duration `json:"max_stale,omitempty"`
+}
+
+func (c *OriginConfig) validate() error {
+	if (c.URL == "") == (c.Address == "") {
+		return fmt.Errorf("set url or address")
+	}
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil || u.Host == "" {
+			return fmt.Errorf("url must be an http(s) url, got %q", c.URL)
+		}
+	}
+	return nil
+}
+
+func (c *OriginConfig) maxStale() time.Duration {
+	if c.MaxStale > 0 {
+		return time.Duration(c.MaxStale)
+	}
+	return 10 * time.Minute
+}
+
+// originTarget is target as fetched from origin.
+func originTarget(target Target) Target {
+	t := target
+	t.Origin = nil
+	t.CertPin = nil
+	t.CertRenewal = nil
+	if target.Origin.URL != "" {
+		t.URL = target.Origin.URL
+	} else {
+		t.dialAddr = target.Origin.Address
+	}
+	t.Headers = mergeHeaders(target.Headers, target.Origin.Headers)
+	return t
+}
+
+// originFetch is one side of a paired check.
+type originFetch struct {
+	result CheckResult
+	hash   string
+}
+
+func fetchForCompare(target Target) originFetch {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	start := time.Now()
+	resp, err := checkGet(target)
+	if err != nil {
+		result.Latency = Duration(time.Since(start))
+		result.Detail, result.Failure = err.Error(), classifyError(err)
+		return originFetch{result: result}
+	}
+	body, err := readBody(resp, target.bodyLimit(expectMaxBody))
+	result.Latency = Duration(time.Since(start))
+	if err != nil {
+		result.Detail, result.Failure = err.Error(), classifyError(err)
+		return originFetch{result: result}
+	}
+	result.Detail = resp.Status
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		result.Status = "up"
+	} else {
+		result.Failure = failureStatus
+	}
+	sum := sha256.Sum256(body)
+	return originFetch{result: result, hash: hex.EncodeToString(sum[:])}
+}
+
+// staleSince records when each monitor's edge content was first seen
+// differing from origin.
+var staleSince = struct {
+	sync.Mutex
+	m map[string]time.Time
+}{m: make(map[string]time.Time)}
+
+// probeOrigin fetches target from the edge and from origin in parallel.
+// The monitor is down when either side fails while the other serves, as
+// when the edge errors for a healthy origin or a cache hides an origin
+// outage, and when the edge serves content that has differed from origin
+// for longer than MaxStale.
+func probeOrigin(target Target) CheckResult {
+	var edge, origin originFetch
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		edge = fetchForCompare(target)
+	}()
+	go func() {
+		defer wg.Done()
+		origin = fetchForCompare(originTarget(target))
+	}()
+	wg.Wait()
+
+	result := CheckResult{URL: target.URL, Status: "down", Latency: edge.result.Latency, CheckedAt: edge.result.CheckedAt}
+	edgeUp, originUp := edge.result.Status == "up", origin.result.Status == "up"
+	stale := !target.Origin.StatusOnly && edgeUp && originUp && edge.hash != origin.hash
+	now := time.Now()
+	staleSince.Lock()
+	since, wasStale := staleSince.m[target.URL]
+	if stale && !wasStale {
+		since = now
+		staleSince.m[target.URL] = now
+	} else if !stale {
+		delete(staleSince.m, target.URL)
+	}
+	staleSince.Unlock()
+
+	switch {
+	case edgeUp && !originUp:
+		result.Detail = fmt.Sprintf("origin is down (%s) while the edge serves %s", origin.result.Detail, edge.result.Detail)
+		result.Failure = origin.result.Failure
+	case !edgeUp && originUp:
+		result.Detail = fmt.Sprintf("edge serves %s while origin serves %s", edge.result.Detail, origin.result.Detail)
+		result.Failure = edge.result.Failure
+	case !edgeUp:
+		result.Detail = fmt.Sprintf("edge: %s; origin: %s", edge.result.Detail, origin.result.Detail)
+		result.Failure = edge.result.Failure
+	case stale:
+		age := now.Sub(since).Round(time.Second)
+		result.Detail = fmt.Sprintf("edge content differs from origin for %s (edge %s, origin %s)", age, shortHash(edge.hash), shortHash(origin.hash))
+		if age <= target.Origin.maxStale() {
+			result.Status = "up"
+			result.Detail += fmt.Sprintf(", within max_stale %s", target.Origin.maxStale())
+		} else {
+			result.Failure = failureAssertion
+		}
+	default:
+		result.Status = "up"
+		result.Detail = "edge matches origin: " + edge.result.Detail
+		if !target.Origin.StatusOnly {
+			result.Detail += ", sha256 " + shortHash(edge.hash)
+		}
+	}
+	return result
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
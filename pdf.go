@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// pdfWriter draws text, lines and rectangles onto A4 pages and encodes them
+// as a PDF 1.4 file. It uses the standard Helvetica fonts, which every PDF
+// reader has, so nothing needs embedding. Coordinates are in points from
+// the top left corner of the page.
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+}
+
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+)
+
+// pdfColor is an RGB color with components from 0 to 1.
+type pdfColor struct{ r, g, b float64 }
+
+var (
+	pdfBlack = pdfColor{0, 0, 0}
+	pdfGray  = pdfColor{0.45, 0.45, 0.45}
+	pdfLight = pdfColor{0.88, 0.88, 0.88}
+	pdfGreen = pdfColor{0.18, 0.62, 0.33}
+	pdfAmber = pdfColor{0.93, 0.62, 0.1}
+	pdfRed   = pdfColor{0.82, 0.2, 0.18}
+	pdfBlue  = pdfColor{0.2, 0.4, 0.75}
+)
+
+// helveticaWidths are the widths of the printable ASCII characters in
+// Helvetica, in thousandths of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth estimates the width of s set in Helvetica at size. Bold text
+// runs about a tenth wider.
+func textWidth(s string, size float64, bold bool) float64 {
+	var w int
+	for _, r := range s {
+		if r >= 32 && r < 127 {
+			w += helveticaWidths[r-32]
+		} else {
+			w += 556
+		}
+	}
+	width := float64(w) * size / 1000
+	if bold {
+		width *= 1.1
+	}
+	return width
+}
+
+// fitText shortens s with an ellipsis until it fits width.
+func fitText(s string, size, width float64, bold bool) string {
+	if textWidth(s, size, bold) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes)+"...", size, bold) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+func (p *pdfWriter) newPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+}
+
+// text writes s with its baseline at y.
+func (p *pdfWriter) text(x, y, size float64, bold bool, c pdfColor, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.page, "%.3f %.3f %.3f rg BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+		c.r, c.g, c.b, font, size, x, pdfPageHeight-y, pdfString(s))
+}
+
+// textRight writes s ending at x.
+func (p *pdfWriter) textRight(x, y, size float64, bold bool, c pdfColor, s string) {
+	p.text(x-textWidth(s, size, bold), y, size, bold, c, s)
+}
+
+func (p *pdfWriter) rect(x, y, w, h float64, c pdfColor) {
+	fmt.Fprintf(p.page, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n",
+		c.r, c.g, c.b, x, pdfPageHeight-y-h, w, h)
+}
+
+func (p *pdfWriter) line(x1, y1, x2, y2, width float64, c pdfColor) {
+	p.polyline([][2]float64{{x1, y1}, {x2, y2}}, width, c)
+}
+
+func (p *pdfWriter) polyline(points [][2]float64, width float64, c pdfColor) {
+	if len(points) < 2 {
+		return
+	}
+	fmt.Fprintf(p.page, "%.3f %.3f %.3f RG %.2f w", c.r, c.g, c.b, width)
+	for i, pt := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(p.page, " %.2f %.2f %s", pt[0], pdfPageHeight-pt[1], op)
+	}
+	p.page.WriteString(" S\n")
+}
+
+// pdfString escapes s for a PDF string literal in WinAnsiEncoding, which
+// covers Latin-1; other characters become '?'.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '–' || r == '—':
+			b.WriteByte(0x96)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// bytes encodes the pages as a PDF file.
+func (p *pdfWriter) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 4 are the catalog, the page tree and the two fonts;
+	// each page is then a page object followed by its content stream.
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
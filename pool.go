@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// validateEndpoint checks one entry of a monitor's endpoints: either a URL
+// or an address (IP or host, optionally with a port) to send url to.
+func validateEndpoint(endpoint string) error {
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return err
+		}
+		if u.Host == "" {
+			return fmt.Errorf("%q has no host", endpoint)
+		}
+		return nil
+	}
+	host := endpoint
+	if h, _, err := net.SplitHostPort(endpoint); err == nil {
+		host = h
+	}
+	if host == "" || strings.ContainsAny(host, "/?#") {
+		return fmt.Errorf("%q is neither a URL nor an address", endpoint)
+	}
+	return nil
+}
+
+// endpointTarget returns the target that checks one endpoint of target.
+func endpointTarget(target Target, endpoint string) Target {
+	t := target
+	t.Endpoints = nil
+	if strings.Contains(endpoint, "://") {
+		t.URL = endpoint
+		// Pins are keyed by the monitor's URL, so they only make sense when
+		// every endpoint is reached through it.
+		t.CertPin = nil
+		return t
+	}
+	t.dialAddr = endpoint
+	return t
+}
+
+// dialAddress returns the host:port to connect to instead of resolving
+// rawURL's host, keeping rawURL's port when addr has none.
+func dialAddress(rawURL, addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	port := "80"
+	if u, err := url.Parse(rawURL); err == nil {
+		if p := u.Port(); p != "" {
+			port = p
+		} else if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+}
+
+// checkTransport sends every request for target to its dialAddr, when it
+// has one, and from its source address, resolving through the DNS cache
+// when it is enabled. TLS still verifies against the URL's host name.
+func checkTransport(target Target) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	var pinned string
+	if target.dialAddr != "" {
+		pinned = dialAddress(target.URL, target.dialAddr)
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialer, err := checkDialer(target, network, 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		dialer.KeepAlive = 30 * time.Second
+		if pinned != "" {
+			addr = pinned
+		}
+		if dnsCache != nil {
+			return dnsCache.dial(ctx, dialer, target, network, addr)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	transport.DisableKeepAlives = true
+	return transport
+}
+
+// probeEndpoints checks every endpoint of target in parallel with check.
+// The monitor is down once more than AllowedFailures endpoints fail, and
+// reports a partial outage while some fail within that tolerance.
+func probeEndpoints(target Target, check func(Target) CheckResult) CheckResult {
+	results := make([]CheckResult, len(target.Endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range target.Endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			results[i] = check(endpointTarget(target, endpoint))
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	result := CheckResult{URL: target.URL, Status: "up", CheckedAt: time.Now().UTC()}
+	var failed []string
+	var firstFailure string
+	for i, r := range results {
+		if r.Latency > result.Latency {
+			result.Latency = r.Latency
+		}
+		if r.Status != "up" {
+			failed = append(failed, fmt.Sprintf("%s: %s", target.Endpoints[i], r.Detail))
+			if firstFailure == "" {
+				firstFailure = r.Failure
+			}
+		}
+	}
+	total := len(results)
+	switch {
+	case len(failed) > target.AllowedFailures:
+		result.Status, result.Failure = "down", firstFailure
+		result.Detail = fmt.Sprintf("%d of %d endpoints down (%s)", len(failed), total, strings.Join(failed, "; "))
+	case len(failed) > 0:
+		result.Detail = fmt.Sprintf("partial outage: %d of %d endpoints down (%s)", len(failed), total, strings.Join(failed, "; "))
+	default:
+		result.Detail = fmt.Sprintf("all %d endpoints up", total)
+	}
+	return result
+}
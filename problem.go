@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Problem is an RFC 7807 error response. Code is a stable, machine-readable
+// identifier such as "unknown_monitor"; Type is derived from it.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+// Problem codes.
+const (
+	problemMethodNotAllowed = "method_not_allowed"
+	problemUnauthorized     = "unauthorized"
+	problemForbidden        = "forbidden"
+	problemReadOnly         = "read_only"
+	problemInvalidParameter = "invalid_parameter"
+	problemInvalidBody      = "invalid_body"
+	problemBodyTooLarge     = "body_too_large"
+	problemRateLimited      = "rate_limited"
+	problemNotFound         = "not_found"
+	problemUnknownMonitor   = "unknown_monitor"
+	problemNoPendingChange  = "no_pending_change"
+	problemPageOutOfRange   = "page_out_of_range"
+	problemConflict         = "conflict"
+	problemLoginFailed      = "login_failed"
+	problemDeliveryFailed   = "delivery_failed"
+)
+
+// writeProblem sends an application/problem+json error.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:     "/problems/" + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	})
+}
+
+// methodNotAllowed rejects r unless it uses method, and reports whether it
+// did.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return false
+	}
+	w.Header().Set("Allow", method)
+	writeProblem(w, r, http.StatusMethodNotAllowed, problemMethodNotAllowed, r.Method+" is not supported here; use "+method)
+	return true
+}
+
+// knownMonitor reports whether url is a monitor the caller may see, and
+// sends unknown_monitor otherwise.
+func knownMonitor(w http.ResponseWriter, r *http.Request, url string) bool {
+	if url == "" {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter, "the url parameter is required")
+		return false
+	}
+	if !targets.has(url) || !requestScope(r).canSee(url) {
+		writeProblem(w, r, http.StatusNotFound, problemUnknownMonitor, "no monitor has the URL "+url)
+		return false
+	}
+	return true
+}
+
+// decodeBody decodes r's JSON body into v, sending invalid_body or
+// body_too_large on failure.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any, what string) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, problemBodyTooLarge, fmt.Sprintf("request bodies are limited to %d bytes", tooLarge.Limit))
+		return false
+	}
+	writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, "invalid "+what+": "+err.Error())
+	return false
+}
+
+// notFoundHandler answers requests for paths the API does not serve.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusNotFound, problemNotFound, "no such endpoint")
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProjectConfig is one tenant of a shared deployment. Once any project is
+// configured, every API request must carry a project or admin API key, and
+// sees only its own project's monitors.
+type ProjectConfig struct {
+	Name    string   `json:"name"`
+	APIKeys []string `json:"api_keys"`
+	// Email, when set, replaces the global email settings for this
+	// project's monitors.
+	Email *EmailConfig `json:"email,omitempty"`
+}
+
+// projectRegistry resolves API keys to projects. It is nil unless projects
+// or admin keys are configured.
+type projectRegistry struct {
+	projects  map[string]ProjectConfig
+	adminKeys []string
+}
+
+var tenancy *projectRegistry
+
+func newProjectRegistry(config Config) *projectRegistry {
+	if len(config.Projects) == 0 && len(config.AdminKeys) == 0 {
+		return nil
+	}
+	reg := &projectRegistry{projects: make(map[string]ProjectConfig), adminKeys: config.AdminKeys}
+	for _, p := range config.Projects {
+		if p.Name == "" {
+			fmt.Println("Ignoring project without a name")
+			continue
+		}
+		reg.projects[p.Name] = p
+	}
+	return reg
+}
+
+// apiScope is what an API request may see: every project for admins and
+// when the API is open, otherwise a single project.
+type apiScope struct {
+	all     bool
+	project string
+	// readOnly scopes may only make GET and HEAD requests.
+	readOnly bool
+	// user is the logged-in user, if the request came from a session.
+	user string
+}
+
+func (s apiScope) allows(project string) bool {
+	return s.all || project == s.project
+}
+
+// canSee reports whether the scope may see the monitor at url.
+func (s apiScope) canSee(url string) bool {
+	if s.all {
+		return true
+	}
+	target, ok := targets.get(url)
+	return ok && target.Project == s.project
+}
+
+// projectFilter returns the project a listing should be limited to, or ""
+// for all of them.
+func (s apiScope) projectFilter() string {
+	if s.all {
+		return ""
+	}
+	return s.project
+}
+
+type scopeKey struct{}
+
+// requestScope returns the scope withAPIAuth attached to r.
+func requestScope(r *http.Request) apiScope {
+	if s, ok := r.Context().Value(scopeKey{}).(apiScope); ok {
+		return s
+	}
+	return apiScope{all: tenancy == nil && oidc == nil}
+}
+
+// resolve returns the scope granted to key.
+func (reg *projectRegistry) resolve(key string) (apiScope, bool) {
+	if key == "" {
+		return apiScope{}, false
+	}
+	for _, k := range reg.adminKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			return apiScope{all: true}, true
+		}
+	}
+	for name, p := range reg.projects {
+		for _, k := range p.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+				return apiScope{project: name}, true
+			}
+		}
+	}
+	return apiScope{}, false
+}
+
+// authExempt lists API paths that authenticate with their own tokens, are
+// part of logging in, serve status page visitors, or describe the API
+// itself.
+var authExempt = []string{"/agent/", "/results/", "/auth/", "/updates/", "/openapi.json"}
+
+// requestKey returns the API key r carries in X-API-Key or as a bearer
+// token.
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	key, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return key
+}
+
+// withAPIAuth requires an API key, API token or login session on every
+// request once projects, admin keys or OIDC are configured, and records the
+// caller's scope for the handlers.
+func withAPIAuth(next http.Handler) http.Handler {
+	if tenancy == nil && oidc == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range authExempt {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		key := requestKey(r)
+		scope, ok := apiScope{}, false
+		if tenancy != nil {
+			scope, ok = tenancy.resolve(key)
+		}
+		if !ok && apiTokens != nil {
+			scope, ok = apiTokens.resolve(key)
+		}
+		if !ok && oidc != nil {
+			var s userSession
+			if s, ok = oidc.sessionScope(r); ok {
+				scope = s.Scope
+				scope.user = s.User
+				noteAccessUser(r, s.User)
+			}
+		}
+		if !ok {
+			if oidc != nil && r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="uptime-monitor"`)
+			writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "an API key or login session is required")
+			return
+		}
+		if scope.readOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeProblem(w, r, http.StatusForbidden, problemReadOnly, "your role is read-only")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeKey{}, scope)))
+	})
+}
+
+// projectEmail returns the email settings for target's project, falling
+// back to the global ones.
+func projectEmail(target Target, global EmailConfig) EmailConfig {
+	if tenancy != nil {
+		if p, ok := tenancy.projects[target.Project]; ok && p.Email != nil {
+			return *p.Email
+		}
+	}
+	return global
+}
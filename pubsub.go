@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PubSubConfig publishes every check result and state change to Redis
+// pub/sub or NATS, so other services can react without polling the API.
+type PubSubConfig struct {
+	// URL is redis://[user:password@]host:6379 or rediss:// for TLS, or
+	// nats://[user:password@]host:4222 or tls:// for TLS. A NATS URL with
+	// only a user authenticates with it as a token.
+	URL string `json:"url"`
+	// CAFile verifies the server's certificate for TLS URLs.
+	CAFile string `json:"ca_file"`
+	// Prefix starts every channel or subject. Defaults to "uptime-monitor".
+	Prefix string `json:"prefix"`
+	// Results also publishes every check, not just state changes.
+	Results bool `json:"results"`
+}
+
+// pubsubQueueSize bounds the check results waiting to be published; more
+// are dropped so a slow server never holds up checks.
+const pubsubQueueSize = 1024
+
+type pubsubEvent struct {
+	Event    string    `json:"event"`
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	Severity string    `json:"severity"`
+	Status   string    `json:"status"`
+	Detail   string    `json:"detail"`
+	Failure  string    `json:"failure,omitempty"`
+	Time     time.Time `json:"time"`
+	// Location and LatencyMS are set on check results.
+	Location  string `json:"location,omitempty"`
+	LatencyMS int64  `json:"latency_ms,omitempty"`
+	// Downtime is set on recoveries to how long the monitor was down.
+	Downtime Duration          `json:"downtime,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type pubsubMessage struct {
+	subject string
+	payload []byte
+}
+
+// pubsubPublisher is a minimal Redis or NATS client that only publishes.
+type pubsubPublisher struct {
+	config PubSubConfig
+	url    *url.URL
+	redis  bool
+	queue  chan pubsubMessage
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// pubsub is the configured publisher, which check results are handed to.
+var pubsub *pubsubPublisher
+
+func newPubSubPublisher(config PubSubConfig) (*pubsubPublisher, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	p := &pubsubPublisher{config: config, url: u}
+	switch u.Scheme {
+	case "redis", "rediss":
+		p.redis = true
+	case "nats", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported pubsub scheme %q", u.Scheme)
+	}
+	if p.config.Prefix == "" {
+		p.config.Prefix = "uptime-monitor"
+	}
+	if config.Results {
+		p.queue = make(chan pubsubMessage, pubsubQueueSize)
+		go p.drain()
+	}
+	return p, nil
+}
+
+func (p *pubsubPublisher) name() string { return "pubsub" }
+
+// subject names a monitor's channel for event, such as
+// uptime-monitor.monitors.api.state.
+func (p *pubsubPublisher) subject(target Target, event string) string {
+	return p.config.Prefix + ".monitors." + topicSlug(target.displayName()) + "." + event
+}
+
+func (p *pubsubPublisher) notify(n notification) error {
+	if n.Reminder {
+		// Not a change; consumers already know the monitor is down.
+		return errNotApplicable
+	}
+	event := "state"
+	if n.Kind != notifyState {
+		event = n.Kind
+	}
+	payload, err := json.Marshal(pubsubEvent{
+		Event:    event,
+		Name:     n.Target.displayName(),
+		URL:      n.Target.URL,
+		Severity: n.Target.severity(),
+		Status:   n.Status,
+		Detail:   n.Detail,
+		Failure:  n.Failure,
+		Time:     n.Time,
+		Downtime: Duration(n.Downtime.Round(time.Second)),
+		Metadata: n.Target.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	return p.publish(p.subject(n.Target, event), payload)
+}
+
+// checkResult queues a single check from location for publishing.
+func (p *pubsubPublisher) checkResult(target Target, location string, r CheckResult) {
+	if p.queue == nil || !isLeader() {
+		return
+	}
+	payload, err := json.Marshal(pubsubEvent{
+		Event:     "check",
+		Name:      target.displayName(),
+		URL:       target.URL,
+		Severity:  target.severity(),
+		Status:    r.Status,
+		Detail:    r.Detail,
+		Failure:   r.Failure,
+		Time:      r.CheckedAt,
+		Location:  location,
+		LatencyMS: time.Duration(r.Latency).Milliseconds(),
+	})
+	if err != nil {
+		return
+	}
+	select {
+	case p.queue <- pubsubMessage{p.subject(target, "check"), payload}:
+	default:
+	}
+}
+
+func (p *pubsubPublisher) drain() {
+	for m := range p.queue {
+		if err := p.publish(m.subject, m.payload); err != nil {
+			fmt.Println("Error publishing check result:", err)
+		}
+	}
+}
+
+func (p *pubsubPublisher) publish(subject string, payload []byte) error {
+	if dryRunSkip("pubsub", p.url.Redacted()+" "+subject, payload) {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Retry once on a fresh connection, e.g. after the server restarted.
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if p.conn == nil {
+			if err = p.connect(); err != nil {
+				return err
+			}
+		}
+		if p.redis {
+			_, err = p.redisCommand("PUBLISH", subject, string(payload))
+		} else {
+			_, err = fmt.Fprintf(p.conn, "PUB %s %d\r\n%s\r\n", subject, len(payload), payload)
+		}
+		if err == nil {
+			return nil
+		}
+		p.dropLocked()
+	}
+	return err
+}
+
+// connect dials the server and authenticates. p.mu must be held.
+func (p *pubsubPublisher) connect() error {
+	host := p.url.Host
+	if p.url.Port() == "" {
+		port := "4222"
+		if p.redis {
+			port = "6379"
+		}
+		host = net.JoinHostPort(p.url.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	if p.url.Scheme == "rediss" {
+		if conn, err = p.startTLS(conn); err != nil {
+			return err
+		}
+	}
+	p.conn, p.r = conn, bufio.NewReader(conn)
+	if p.redis {
+		err = p.redisAuth()
+	} else {
+		err = p.natsConnect()
+	}
+	if err != nil {
+		p.dropLocked()
+	}
+	return err
+}
+
+func (p *pubsubPublisher) startTLS(conn net.Conn) (net.Conn, error) {
+	cfg := &tls.Config{ServerName: p.url.Hostname()}
+	if p.config.CAFile != "" {
+		pem, err := os.ReadFile(p.config.CAFile)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		cfg.RootCAs.AppendCertsFromPEM(pem)
+	}
+	tc := tls.Client(conn, cfg)
+	tc.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := tc.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tc.SetDeadline(time.Time{})
+	return tc, nil
+}
+
+// dropLocked forgets the current connection. p.mu must be held.
+func (p *pubsubPublisher) dropLocked() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.r = nil, nil
+	}
+}
+
+func (p *pubsubPublisher) redisAuth() error {
+	if p.url.User == nil {
+		return nil
+	}
+	password, ok := p.url.User.Password()
+	if !ok {
+		return nil
+	}
+	args := []string{"AUTH", password}
+	if user := p.url.User.Username(); user != "" {
+		args = []string{"AUTH", user, password}
+	}
+	_, err := p.redisCommand(args...)
+	return err
+}
+
+// redisCommand sends a command and reads its reply, which must be a simple
+// string or an integer. p.mu must be held.
+func (p *pubsubPublisher) redisCommand(args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	p.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer p.conn.SetDeadline(time.Time{})
+	if _, err := p.conn.Write([]byte(b.String())); err != nil {
+		return "", err
+	}
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch {
+	case strings.HasPrefix(line, "-"):
+		return "", fmt.Errorf("redis: %s", line[1:])
+	case strings.HasPrefix(line, "+"), strings.HasPrefix(line, ":"):
+		return line[1:], nil
+	}
+	return "", fmt.Errorf("unexpected redis reply %q", line)
+}
+
+// natsConnect reads the server's INFO, upgrades to TLS if asked to and
+// sends CONNECT, waiting for the PONG that confirms it. p.mu must be held.
+func (p *pubsubPublisher) natsConnect() error {
+	p.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected nats greeting %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(line[5:]), &info)
+	if p.url.Scheme == "tls" || info.TLSRequired {
+		conn, err := p.startTLS(p.conn)
+		if err != nil {
+			p.conn = nil
+			return err
+		}
+		p.conn, p.r = conn, bufio.NewReader(conn)
+		p.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	}
+
+	host, _ := os.Hostname()
+	opts := map[string]any{
+		"verbose": false, "pedantic": false, "lang": "go", "version": "1.0",
+		"name": "uptime-monitor-" + host, "tls_required": p.url.Scheme == "tls",
+	}
+	if u := p.url.User; u != nil {
+		if password, ok := u.Password(); ok {
+			opts["user"], opts["pass"] = u.Username(), password
+		} else {
+			opts["auth_token"] = u.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	if _, err := fmt.Fprintf(p.conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		return err
+	}
+	for {
+		line, err := p.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+	p.conn.SetDeadline(time.Time{})
+	go p.natsReadLoop(p.conn, p.r)
+	return nil
+}
+
+// natsReadLoop answers the server's keep-alive PINGs and drops the
+// connection when the server reports an error or closes it.
+func (p *pubsubPublisher) natsReadLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if err == nil && line == "PING" {
+			p.mu.Lock()
+			_, err = conn.Write([]byte("PONG\r\n"))
+			p.mu.Unlock()
+		}
+		if err == nil && strings.HasPrefix(line, "-ERR") {
+			fmt.Println("Error from NATS server:", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+			err = fmt.Errorf("nats error")
+		}
+		if err != nil {
+			p.mu.Lock()
+			if p.conn == conn {
+				p.dropLocked()
+			}
+			p.mu.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pushType is the monitor type for monitors that are never checked here and
+// only receive results through POST /results/{monitor}.
+const pushType = "push"
+
+// pushLocation names pushed results that do not give a source.
+const pushLocation = "push"
+
+// PushedResult is the body of POST /results/{monitor}.
+type PushedResult struct {
+	// Status is "up" or "down".
+	Status  string   `json:"status"`
+	Detail  string   `json:"detail,omitempty"`
+	Latency Duration `json:"latency,omitempty"`
+	// Source names the system reporting, e.g. "ci". It is used as the
+	// result's location.
+	Source string `json:"source,omitempty"`
+}
+
+// pushStore tracks when each push monitor last received a result so
+// monitors whose reporter has gone quiet are marked down.
+type pushStore struct {
+	mu       sync.Mutex
+	last     map[string]pushReceipt
+	interval time.Duration
+}
+
+type pushReceipt struct {
+	at       time.Time
+	location string
+}
+
+var pushes = &pushStore{last: make(map[string]pushReceipt), interval: time.Minute}
+
+func (p *pushStore) received(url, location string, t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last[url] = pushReceipt{at: t, location: location}
+}
+
+// checkOverdue runs on each scheduled check of a push monitor and records it
+// as down once no result has arrived for two intervals.
+func (p *pushStore) checkOverdue(target Target) {
+	interval := target.Interval
+	if interval <= 0 {
+		interval = p.interval
+	}
+	now := time.Now()
+	p.mu.Lock()
+	last, ok := p.last[target.URL]
+	if !ok {
+		// Give the reporter a full grace period after startup.
+		last = pushReceipt{at: now, location: pushLocation}
+		p.last[target.URL] = last
+	}
+	p.mu.Unlock()
+	if now.Sub(last.at) < 2*interval {
+		return
+	}
+	r := CheckResult{
+		URL:       target.URL,
+		Status:    "down",
+		Detail:    fmt.Sprintf("no result received since %s", last.at.UTC().Format(time.RFC3339)),
+		CheckedAt: now.UTC(),
+	}
+	fmt.Printf("Website %s is down: %s\n", target.URL, r.Detail)
+	// Record under the reporter's location so its next result replaces this.
+	recordResult(last.location, r)
+}
+
+// resultsHandler serves POST /results/{monitor}, where monitor is a
+// monitor's name or its URL (path-escaped). The request must carry the
+// monitor's push_token as a bearer token.
+func resultsHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodPost) {
+		return
+	}
+	name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/results/"))
+	if err != nil || name == "" {
+		writeProblem(w, r, http.StatusNotFound, problemUnknownMonitor, "a monitor name or URL is required")
+		return
+	}
+	target, ok := targets.find(name)
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, problemUnknownMonitor, "no monitor is named "+name)
+		return
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if target.PushToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(target.PushToken)) != 1 {
+		writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "the monitor's push_token is required")
+		return
+	}
+	var pushed PushedResult
+	if !decodeBody(w, r, &pushed, "result") {
+		return
+	}
+	if pushed.Status != "up" && pushed.Status != "down" {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, `status must be "up" or "down"`)
+		return
+	}
+	location := pushed.Source
+	if location == "" {
+		location = pushLocation
+	}
+	now := time.Now().UTC()
+	res := CheckResult{URL: target.URL, Status: pushed.Status, Detail: pushed.Detail, Latency: pushed.Latency, CheckedAt: now}
+	pushes.received(target.URL, location, now)
+	if res.Status == "down" {
+		fmt.Printf("Website %s is down from %s: %s\n", res.URL, location, res.Detail)
+	}
+	recordResult(location, res)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+// hostLimiter spaces out and caps concurrent requests per host so many
+// monitors pointed at one origin don't all fire at once.
+type hostLimiter struct {
+	spacing       time.Duration
+	maxConcurrent int
+
+	mu   sync.Mutex
+	next map[string]time.Time
+	sems map[string]chan struct{}
+}
+
+func newHostLimiter(cfg RateLimitConfig) *hostLimiter {
+	return &hostLimiter{
+		spacing:       time.Duration(cfg.MinSpacing),
+		maxConcurrent: cfg.MaxConcurrent,
+		next:          make(map[string]time.Time),
+		sems:          make(map[string]chan struct{}),
+	}
+}
+
+// acquire blocks until a request to rawURL's host may start and returns a
+// function that must be called once the request has finished.
+func (l *hostLimiter) acquire(rawURL string) func() {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	var sem chan struct{}
+	l.mu.Lock()
+	if l.maxConcurrent > 0 {
+		sem = l.sems[host]
+		if sem == nil {
+			sem = make(chan struct{}, l.maxConcurrent)
+			l.sems[host] = sem
+		}
+	}
+	l.mu.Unlock()
+
+	if sem != nil {
+		sem <- struct{}{}
+	}
+
+	if l.spacing > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		start := l.next[host]
+		if start.Before(now) {
+			start = now
+		}
+		l.next[host] = start.Add(l.spacing)
+		l.mu.Unlock()
+		time.Sleep(time.Until(start))
+	}
+
+	return func() {
+		if sem != nil {
+			<-sem
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// readOnly is set by --read-only. The API then refuses every request that
+// could change the instance, whatever key or session it carries.
+var readOnly bool
+
+// readOnlyExempt lists the API paths that feed in check results, log
+// users in and out, or subscribe status page visitors. Read-only instances
+// still accept them, and admin_allow doesn't cover them, since none of
+// them changes how the instance is configured.
+var readOnlyExempt = []string{"/agent/", "/results/", "/auth/", "/updates/"}
+
+// changesInstance reports whether r could change the instance: any
+// request but GET, HEAD and OPTIONS outside readOnlyExempt.
+func changesInstance(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	for _, prefix := range readOnlyExempt {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// withReadOnly answers read_only to mutating requests when readOnly is set.
+func withReadOnly(next http.Handler) http.Handler {
+	if !readOnly {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if changesInstance(r) {
+			writeProblem(w, r, http.StatusForbidden, problemReadOnly, "this instance is read-only")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// RegionSeries is a monitor's availability and latency from each location
+// over a window.
+type RegionSeries struct {
+	URL        string          `json:"url"`
+	Window     Duration        `json:"window"`
+	Resolution Duration        `json:"resolution"`
+	Regions    []RegionHistory `json:"regions"`
+}
+
+// RegionHistory is one location's points, oldest first.
+type RegionHistory struct {
+	Location string        `json:"location"`
+	Points   []RegionPoint `json:"points"`
+}
+
+// RegionPoint covers Resolution from Time. The figures are omitted when
+// no check ran in it.
+type RegionPoint struct {
+	Time   time.Time `json:"time"`
+	Checks int       `json:"checks"`
+	Uptime *float64  `json:"uptime,omitempty"`
+	AvgMs  *float64  `json:"avgMs,omitempty"`
+}
+
+// RegionReport compares a monitor's locations over a window.
+type RegionReport struct {
+	URL     string          `json:"url"`
+	Name    string          `json:"name,omitempty"`
+	Regions []RegionSummary `json:"regions"`
+	// Fastest is the location with the lowest average latency.
+	Fastest string `json:"fastest,omitempty"`
+}
+
+// RegionSummary is one location's figures over the window. Slowdown is its
+// average latency relative to the median of the monitor's locations, and
+// Degraded is set when that reaches regionSlowFactor or its uptime trails
+// the best location's by more than regionUptimeGap points.
+type RegionSummary struct {
+	Location string   `json:"location"`
+	Checks   int      `json:"checks"`
+	Uptime   *float64 `json:"uptime,omitempty"`
+	AvgMs    *float64 `json:"avgMs,omitempty"`
+	Slowdown *float64 `json:"slowdown,omitempty"`
+	Degraded bool     `json:"degraded,omitempty"`
+}
+
+const (
+	regionSlowFactor = 1.5
+	regionUptimeGap  = 1.0
+)
+
+// mergeBuckets sums list into one bucket.
+func mergeBuckets(list []historyBucket) historyBucket {
+	var m historyBucket
+	for _, b := range list {
+		m.merge(b)
+	}
+	return m
+}
+
+// regionFigures returns the uptime percentage and average latency of b,
+// both nil when it holds no checks.
+func regionFigures(b historyBucket) (*float64, *float64) {
+	if b.Checks == 0 {
+		return nil, nil
+	}
+	total, up := b.weights()
+	uptime := math.Round(10000*up/total) / 100
+	avg := roundMs(b.LatencySum / float64(b.Checks))
+	return &uptime, &avg
+}
+
+// sortedLocations returns the keys of byLocation with this instance first
+// and the agents after it by name.
+func sortedLocations(byLocation map[string][]historyBucket) []string {
+	locations := make([]string, 0, len(byLocation))
+	for location := range byLocation {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if (locations[i] == localLocation) != (locations[j] == localLocation) {
+			return locations[i] == localLocation
+		}
+		return locations[i] < locations[j]
+	})
+	return locations
+}
+
+// regionSeries merges url's location buckets in [from, to) into points of
+// resolution, one for every step of the window whether or not it has data.
+func regionSeries(url string, from, to time.Time, resolution time.Duration) []RegionHistory {
+	from = from.Truncate(resolution)
+	byLocation := history.locationBuckets(url, from, to)
+	out := []RegionHistory{}
+	for _, location := range sortedLocations(byLocation) {
+		merged := make([]historyBucket, 0, int(to.Sub(from)/resolution)+1)
+		for t := from; t.Before(to); t = t.Add(resolution) {
+			merged = append(merged, historyBucket{Start: t.Unix()})
+		}
+		for _, b := range byLocation[location] {
+			i := int(time.Unix(b.Start, 0).Sub(from) / resolution)
+			if i < 0 || i >= len(merged) {
+				continue
+			}
+			merged[i].merge(b)
+		}
+		points := make([]RegionPoint, len(merged))
+		for i, m := range merged {
+			points[i] = RegionPoint{Time: time.Unix(m.Start, 0).UTC(), Checks: m.Checks}
+			points[i].Uptime, points[i].AvgMs = regionFigures(m)
+		}
+		out = append(out, RegionHistory{Location: location, Points: points})
+	}
+	return out
+}
+
+// regionReport compares target's locations over [from, to).
+func regionReport(target Target, from, to time.Time) RegionReport {
+	report := RegionReport{URL: target.URL, Name: target.Name, Regions: []RegionSummary{}}
+	byLocation := history.locationBuckets(target.URL, from, to)
+	var latencies []float64
+	bestUptime, fastest := -1.0, 0.0
+	for _, location := range sortedLocations(byLocation) {
+		s := RegionSummary{Location: location}
+		m := mergeBuckets(byLocation[location])
+		s.Checks = m.Checks
+		s.Uptime, s.AvgMs = regionFigures(m)
+		if s.Uptime != nil && *s.Uptime > bestUptime {
+			bestUptime = *s.Uptime
+		}
+		if s.AvgMs != nil {
+			latencies = append(latencies, *s.AvgMs)
+			if report.Fastest == "" || *s.AvgMs < fastest {
+				report.Fastest, fastest = location, *s.AvgMs
+			}
+		}
+		report.Regions = append(report.Regions, s)
+	}
+	median := medianOf(latencies)
+	for i := range report.Regions {
+		s := &report.Regions[i]
+		if s.AvgMs != nil && median > 0 {
+			slowdown := math.Round(*s.AvgMs/median*100) / 100
+			s.Slowdown = &slowdown
+			s.Degraded = slowdown >= regionSlowFactor
+		}
+		if s.Uptime != nil && bestUptime-*s.Uptime > regionUptimeGap {
+			s.Degraded = true
+		}
+	}
+	return report
+}
+
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// regionsHandler serves GET /monitors/{monitor}/regions?window=168h&resolution=1h.
+func regionsHandler(w http.ResponseWriter, r *http.Request, target Target) {
+	window, ok := durationParam(w, r, "window", 7*24*time.Hour, historyCoarseStep, history.retention)
+	if !ok {
+		return
+	}
+	resolution, ok := durationParam(w, r, "resolution", historyCoarseStep, historyCoarseStep, window)
+	if !ok {
+		return
+	}
+	if resolution%historyCoarseStep != 0 {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter,
+			fmt.Sprintf("resolution must be a multiple of %s", formatDuration(historyCoarseStep)))
+		return
+	}
+	if window/resolution > latencyMaxPoints {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter,
+			fmt.Sprintf("window/resolution must not exceed %d points", latencyMaxPoints))
+		return
+	}
+	now := time.Now()
+	writeJSONCached(w, r, RegionSeries{
+		URL:        target.URL,
+		Window:     Duration(window),
+		Resolution: Duration(resolution),
+		Regions:    regionSeries(target.URL, now.Add(-window), now, resolution),
+	})
+}
+
+// regionsReportHandler serves GET /regions?window=24h, comparing every
+// visible monitor's locations.
+func regionsReportHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodGet) {
+		return
+	}
+	window, ok := durationParam(w, r, "window", 24*time.Hour, historyCoarseStep, history.retention)
+	if !ok {
+		return
+	}
+	scope := requestScope(r)
+	now := time.Now()
+	urls := targets.urls()
+	sort.Strings(urls)
+	out := []RegionReport{}
+	for _, url := range urls {
+		target, ok := targets.get(url)
+		if !ok || !scope.canSee(url) {
+			continue
+		}
+		out = append(out, regionReport(target, now.Add(-window), now))
+	}
+	writeJSONCached(w, r, out)
+}
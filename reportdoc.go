@@ -0,0 +1,727 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportDocument is a report laid out for reading and printing: monitors
+// ordered by group, each with its uptime and latency day by day, and the
+// period's incidents in order.
+type reportDocument struct {
+	Report
+	// Heading names the period, such as "September 2026".
+	Heading   string
+	Scope     string
+	Generated time.Time
+	// Downtime is the downtime of all monitors added together.
+	Downtime Duration
+	Days     []time.Time
+	// Groups is empty when no monitor has a group.
+	Groups   []groupReport
+	Rows     []reportRow
+	Timeline []timelineEntry
+}
+
+type groupReport struct {
+	Name          string
+	Monitors      int
+	Incidents     int
+	UptimePercent float64
+	weight, up    float64
+}
+
+type reportRow struct {
+	MonitorReport
+	// Uptime and Latency are the uptime percentage and average latency of
+	// each day, or -1 for days without checks.
+	Uptime  []float64
+	Latency []float64
+	// Down are the spans the monitor was down, as fractions of the period.
+	Down [][2]float64
+}
+
+type timelineEntry struct {
+	Monitor  string
+	Start    time.Time
+	Duration Duration
+	Ongoing  bool
+	Detail   string
+	// Note tells of a deploy before the incident or a silence it fell in.
+	Note string
+}
+
+// newReportDocument gathers the series and incidents behind report.
+func newReportDocument(report Report, now time.Time) reportDocument {
+	from, to := report.From, report.To
+	zone := from.Location()
+	doc := reportDocument{Report: report, Scope: report.scope(), Generated: now.In(zone)}
+	switch {
+	case report.Period == "monthly" && from.Day() == 1 && to.Equal(from.AddDate(0, 1, 0)):
+		doc.Heading = from.Format("January 2006")
+	case report.Period == "monthly" && from.Day() == 1:
+		doc.Heading = from.Format("January 2006") + " to date"
+	default:
+		doc.Heading = from.Format("2 January 2006") + " – " + to.Add(-time.Second).Format("2 January 2006")
+	}
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		doc.Days = append(doc.Days, d)
+	}
+	days := len(doc.Days)
+	// day returns the index of the day t falls on.
+	day := func(t time.Time) int {
+		return sort.Search(days, func(i int) bool { return i == days-1 || doc.Days[i+1].After(t) })
+	}
+	period := to.Sub(from).Seconds()
+
+	groups := map[string]*groupReport{}
+	for _, m := range report.Monitors {
+		row := reportRow{MonitorReport: m, Uptime: make([]float64, days), Latency: make([]float64, days)}
+		checks := make([]int, days)
+		weight, up := make([]float64, days), make([]float64, days)
+		latency := make([]float64, days)
+		var totalWeight, totalUp float64
+		for _, b := range history.buckets(m.URL, from, to) {
+			i := day(time.Unix(b.Start, 0))
+			total, ups := b.weights()
+			checks[i] += b.Checks
+			weight[i] += total
+			up[i] += ups
+			latency[i] += b.LatencySum
+			totalWeight += total
+			totalUp += ups
+		}
+		for i := range checks {
+			row.Uptime[i], row.Latency[i] = -1, -1
+			if checks[i] > 0 {
+				row.Uptime[i] = 100 * up[i] / weight[i]
+				row.Latency[i] = latency[i] / float64(checks[i])
+			}
+		}
+
+		for _, inc := range history.incidents(m.URL, from, to) {
+			start, end := inc.Start, to
+			if inc.End != nil && inc.End.Before(to) {
+				end = *inc.End
+			}
+			if start.Before(from) {
+				start = from
+			}
+			row.Down = append(row.Down, [2]float64{start.Sub(from).Seconds() / period, end.Sub(from).Seconds() / period})
+			entry := timelineEntry{Monitor: m.Name, Start: inc.Start.In(zone), Duration: Duration(inc.duration(now)),
+				Ongoing: inc.End == nil, Detail: inc.Detail}
+			if inc.Deploy != nil {
+				entry.Note = "after deploy of " + strings.TrimSpace(inc.Deploy.Service+" "+inc.Deploy.Version)
+			}
+			if inc.Silence != nil {
+				entry.Note = "silenced: " + inc.Silence.Reason
+			}
+			doc.Timeline = append(doc.Timeline, entry)
+		}
+		doc.Downtime += m.Downtime
+		doc.Rows = append(doc.Rows, row)
+
+		g := groups[m.Group]
+		if g == nil {
+			g = &groupReport{Name: m.Group}
+			groups[m.Group] = g
+		}
+		g.Monitors++
+		g.Incidents += m.Incidents
+		g.weight += totalWeight
+		g.up += totalUp
+	}
+
+	// Grouped monitors come first, by group; ungrouped ones last.
+	sort.SliceStable(doc.Rows, func(i, j int) bool {
+		gi, gj := doc.Rows[i].Group, doc.Rows[j].Group
+		if (gi == "") != (gj == "") {
+			return gj == ""
+		}
+		return gi < gj
+	})
+	if _, ungrouped := groups[""]; len(groups) > 1 || !ungrouped {
+		for _, g := range groups {
+			if g.weight > 0 {
+				g.UptimePercent = 100 * g.up / g.weight
+			}
+			if g.Name == "" {
+				g.Name = "Ungrouped"
+			}
+			doc.Groups = append(doc.Groups, *g)
+		}
+		sort.Slice(doc.Groups, func(i, j int) bool {
+			gi, gj := doc.Groups[i].Name, doc.Groups[j].Name
+			if (gi == "Ungrouped") != (gj == "Ungrouped") {
+				return gj == "Ungrouped"
+			}
+			return gi < gj
+		})
+	}
+	sort.SliceStable(doc.Timeline, func(i, j int) bool { return doc.Timeline[i].Start.Before(doc.Timeline[j].Start) })
+	return doc
+}
+
+// fileName names the document's file, such as uptime-report-2026-09-shop.pdf.
+func (d reportDocument) fileName(ext string) string {
+	name := "uptime-report-" + d.From.Format("2006-01-02")
+	if d.Period == "monthly" && d.From.Day() == 1 {
+		name = "uptime-report-" + d.From.Format("2006-01")
+	}
+	if d.Group != "" {
+		name += "-" + strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+				return r
+			}
+			return '-'
+		}, d.Group)
+	}
+	return name + "." + ext
+}
+
+// reportAttachment renders report as a "pdf" or "html" file.
+func reportAttachment(report Report, format string) mailAttachment {
+	doc := newReportDocument(report, time.Now())
+	if format == "html" {
+		return mailAttachment{name: doc.fileName("html"), contentType: "text/html; charset=utf-8", data: doc.html()}
+	}
+	return mailAttachment{name: doc.fileName("pdf"), contentType: "application/pdf", data: doc.pdf()}
+}
+
+// uptimeColor is green from 99.9%, amber from 99% and red below, and gray
+// for days without checks.
+func uptimeColor(percent float64) pdfColor {
+	switch {
+	case percent < 0:
+		return pdfLight
+	case percent >= 99.9:
+		return pdfGreen
+	case percent >= 99:
+		return pdfAmber
+	}
+	return pdfRed
+}
+
+func (c pdfColor) hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", int(c.r*255+0.5), int(c.g*255+0.5), int(c.b*255+0.5))
+}
+
+// dayLabels returns the indexes of the days whose dates label a chart: every
+// day of a week, every seventh of a month.
+func dayLabels(days int) []int {
+	step := 1
+	if days > 14 {
+		step = 7
+	}
+	var out []int
+	for i := 0; i < days; i += step {
+		out = append(out, i)
+	}
+	return out
+}
+
+// latencyScale rounds the largest daily latency up to a value that reads
+// well at the top of a chart.
+func latencyScale(latency []float64) float64 {
+	max := 0.0
+	for _, v := range latency {
+		max = math.Max(max, v)
+	}
+	if max <= 0 {
+		return 1
+	}
+	unit := math.Pow(10, math.Floor(math.Log10(max)))
+	for _, f := range []float64{1, 2, 5, 10} {
+		if f*unit >= max {
+			return f * unit
+		}
+	}
+	return 10 * unit
+}
+
+// latencyPaths returns the runs of consecutive days with checks, as points
+// on a chart of the given size; days without checks break the line.
+func latencyPaths(latency []float64, width, height float64) [][][2]float64 {
+	scale := latencyScale(latency)
+	step := width / float64(len(latency))
+	var paths [][][2]float64
+	var run [][2]float64
+	for i, v := range latency {
+		if v < 0 {
+			if len(run) > 0 {
+				paths = append(paths, run)
+			}
+			run = nil
+			continue
+		}
+		run = append(run, [2]float64{(float64(i) + 0.5) * step, height - v/scale*height})
+	}
+	if len(run) > 0 {
+		paths = append(paths, run)
+	}
+	return paths
+}
+
+const (
+	pdfMargin = 40.0
+	// pdfBottom is where the page footer starts.
+	pdfBottom = pdfPageHeight - 50
+	// reportLabelWidth is the width of the monitor names beside bars.
+	reportLabelWidth = 130.0
+)
+
+var pdfTile = pdfColor{0.95, 0.95, 0.95}
+
+type pdfColumn struct {
+	title string
+	width float64
+	right bool
+}
+
+type pdfCell struct {
+	text  string
+	bold  bool
+	color *pdfColor
+}
+
+// reportLayout tracks the position down the page as a report is drawn.
+type reportLayout struct {
+	*pdfWriter
+	y float64
+}
+
+// need starts a new page unless h more points fit on this one, and
+// reports whether it did.
+func (l *reportLayout) need(h float64) bool {
+	if l.y+h <= pdfBottom {
+		return false
+	}
+	l.newPage()
+	l.y = pdfMargin
+	return true
+}
+
+// section starts a section, keeping its title with the first h points of
+// its content.
+func (l *reportLayout) section(title string, h float64) {
+	l.need(34 + h)
+	l.y += 26
+	l.text(pdfMargin, l.y, 13, true, pdfBlack, title)
+	l.y += 8
+}
+
+// table draws rows under a header, repeating the header on each page.
+func (l *reportLayout) table(cols []pdfColumn, rows [][]pdfCell) {
+	const rowHeight = 16
+	header := func() {
+		cells := make([]pdfCell, len(cols))
+		for i, c := range cols {
+			cells[i] = pdfCell{text: c.title, color: &pdfGray}
+		}
+		l.tableRow(cols, cells, rowHeight)
+	}
+	header()
+	for _, row := range rows {
+		if l.need(rowHeight) {
+			header()
+		}
+		l.tableRow(cols, row, rowHeight)
+	}
+}
+
+func (l *reportLayout) tableRow(cols []pdfColumn, cells []pdfCell, height float64) {
+	const size, pad = 8.5, 4
+	x := pdfMargin
+	baseline := l.y + height - 5
+	for i, c := range cols {
+		if i < len(cells) && cells[i].text != "" {
+			cell := cells[i]
+			color := pdfBlack
+			if cell.color != nil {
+				color = *cell.color
+			}
+			text := fitText(cell.text, size, c.width-2*pad, cell.bold)
+			if c.right {
+				l.textRight(x+c.width-pad, baseline, size, cell.bold, color, text)
+			} else {
+				l.text(x+pad, baseline, size, cell.bold, color, text)
+			}
+		}
+		x += c.width
+	}
+	l.y += height
+	l.line(pdfMargin, l.y, pdfPageWidth-pdfMargin, l.y, 0.5, pdfLight)
+}
+
+// pdf renders the document on A4 pages.
+func (d reportDocument) pdf() []byte {
+	l := &reportLayout{pdfWriter: &pdfWriter{}, y: pdfMargin}
+	l.newPage()
+	width := pdfPageWidth - 2*pdfMargin
+	days := len(d.Days)
+
+	l.y += 16
+	l.text(pdfMargin, l.y, 20, true, pdfBlack, "Uptime report: "+d.Heading)
+	l.y += 18
+	l.text(pdfMargin, l.y, 9, false, pdfGray, fmt.Sprintf("Covers %s. Times are in %s. Generated %s.",
+		d.Scope, d.Timezone, d.Generated.Format("2006-01-02 15:04")))
+	l.y += 16
+
+	uptime := uptimeColor(d.UptimePercent)
+	tiles := []struct {
+		label, value string
+		color        pdfColor
+	}{
+		{"Uptime", fmt.Sprintf("%.3f%%", d.UptimePercent), uptime},
+		{"Incidents", strconv.Itoa(d.Incidents), pdfBlack},
+		{"Total downtime", formatDuration(time.Duration(d.Downtime)), pdfBlack},
+		{"Mean time to recovery", formatDuration(time.Duration(d.MTTR)), pdfBlack},
+	}
+	tileWidth := (width - 30) / 4
+	for i, t := range tiles {
+		x := pdfMargin + float64(i)*(tileWidth+10)
+		l.rect(x, l.y, tileWidth, 46, pdfTile)
+		l.text(x+8, l.y+15, 8, false, pdfGray, t.label)
+		l.text(x+8, l.y+36, 15, true, t.color, t.value)
+	}
+	l.y += 46
+
+	if len(d.Groups) > 0 {
+		l.section("Availability by group", 32)
+		cols := []pdfColumn{{"Group", 235, false}, {"Monitors", 90, true}, {"Uptime", 100, true}, {"Incidents", 90, true}}
+		var rows [][]pdfCell
+		for _, g := range d.Groups {
+			color := uptimeColor(g.UptimePercent)
+			rows = append(rows, []pdfCell{{text: g.Name}, {text: strconv.Itoa(g.Monitors)},
+				{text: fmt.Sprintf("%.3f%%", g.UptimePercent), color: &color}, {text: strconv.Itoa(g.Incidents)}})
+		}
+		l.table(cols, rows)
+	}
+
+	l.section("Availability by monitor", 32)
+	cols := []pdfColumn{{"Monitor", 175, false}, {"Uptime", 65, true}, {"Incidents", 55, true},
+		{"Downtime", 75, true}, {"MTTR", 65, true}, {"Avg latency", 80, true}}
+	var rows [][]pdfCell
+	group := "\x00"
+	for _, row := range d.Rows {
+		if len(d.Groups) > 0 && row.Group != group {
+			group = row.Group
+			name := group
+			if name == "" {
+				name = "Ungrouped"
+			}
+			rows = append(rows, []pdfCell{{text: name, bold: true}})
+		}
+		color := uptimeColor(row.UptimePercent)
+		latency := "-"
+		if row.Checks > 0 {
+			latency = fmt.Sprintf("%.0f ms", row.AvgLatencyMs)
+		}
+		rows = append(rows, []pdfCell{{text: row.Name}, {text: fmt.Sprintf("%.3f%%", row.UptimePercent), color: &color},
+			{text: strconv.Itoa(row.Incidents)}, {text: formatDuration(time.Duration(row.Downtime))},
+			{text: formatDuration(time.Duration(row.MTTR))}, {text: latency}})
+	}
+	l.table(cols, rows)
+
+	barsX := pdfMargin + reportLabelWidth
+	barsWidth := width - reportLabelWidth
+	dayAxis := func() {
+		for _, i := range dayLabels(days) {
+			l.text(barsX+float64(i)*barsWidth/float64(days), l.y+9, 7, false, pdfGray, d.Days[i].Format("Jan 2"))
+		}
+		l.y += 12
+	}
+
+	if days > 0 && len(d.Rows) > 0 {
+		l.section("Daily uptime", 14)
+		cell := barsWidth / float64(days)
+		for _, row := range d.Rows {
+			l.need(14)
+			l.text(pdfMargin, l.y+9, 8, false, pdfBlack, fitText(row.Name, 8, reportLabelWidth-8, false))
+			for i, u := range row.Uptime {
+				l.rect(barsX+float64(i)*cell, l.y+1, math.Max(cell-1, 0.5), 10, uptimeColor(u))
+			}
+			l.y += 13
+		}
+		l.need(28)
+		dayAxis()
+		x := barsX
+		for _, key := range []struct {
+			label string
+			color pdfColor
+		}{{"99.9% and over", pdfGreen}, {"99% and over", pdfAmber}, {"under 99%", pdfRed}, {"no checks", pdfLight}} {
+			l.rect(x, l.y+2, 8, 8, key.color)
+			l.text(x+11, l.y+9, 7.5, false, pdfGray, key.label)
+			x += 20 + textWidth(key.label, 7.5, false)
+		}
+		l.y += 12
+	}
+
+	l.section("Incident timeline", 14)
+	if len(d.Timeline) == 0 {
+		l.y += 14
+		l.text(pdfMargin, l.y, 9, false, pdfGray, "No incidents in this period.")
+	} else {
+		for _, row := range d.Rows {
+			if len(row.Down) == 0 {
+				continue
+			}
+			l.need(14)
+			l.text(pdfMargin, l.y+9, 8, false, pdfBlack, fitText(row.Name, 8, reportLabelWidth-8, false))
+			l.rect(barsX, l.y+2, barsWidth, 8, pdfTile)
+			for _, span := range row.Down {
+				l.rect(barsX+span[0]*barsWidth, l.y+2, math.Max((span[1]-span[0])*barsWidth, 1), 8, pdfRed)
+			}
+			l.y += 13
+		}
+		l.need(12)
+		dayAxis()
+		l.y += 6
+		var rows [][]pdfCell
+		for _, e := range d.Timeline {
+			duration := formatDuration(time.Duration(e.Duration))
+			if e.Ongoing {
+				duration += " (ongoing)"
+			}
+			detail := e.Detail
+			if e.Note != "" {
+				detail += " (" + e.Note + ")"
+			}
+			rows = append(rows, []pdfCell{{text: e.Start.Format("Jan 2 15:04")}, {text: e.Monitor}, {text: duration}, {text: detail}})
+		}
+		l.table([]pdfColumn{{"Started", 75, false}, {"Monitor", 130, false}, {"Duration", 85, false}, {"Detail", 225, false}}, rows)
+	}
+
+	if days > 0 && len(d.Rows) > 0 {
+		const chartHeight, plotHeight = 104.0, 60.0
+		l.section("Average latency per day", chartHeight)
+		chartWidth := (width - 20) / 2
+		for i, row := range d.Rows {
+			x := pdfMargin + float64(i%2)*(chartWidth+20)
+			if i%2 == 0 {
+				if i > 0 {
+					l.y += chartHeight
+				}
+				l.need(chartHeight)
+			}
+			top := l.y + 14
+			l.text(x, top, 9, true, pdfBlack, fitText(row.Name, 9, chartWidth-70, true))
+			if row.Checks > 0 {
+				l.textRight(x+chartWidth, top, 8, false, pdfGray, fmt.Sprintf("avg %.0f ms", row.AvgLatencyMs))
+			}
+			plot := top + 8
+			scale := latencyScale(row.Latency)
+			l.line(x, plot, x+chartWidth, plot, 0.5, pdfLight)
+			l.line(x, plot+plotHeight/2, x+chartWidth, plot+plotHeight/2, 0.5, pdfLight)
+			l.line(x, plot+plotHeight, x+chartWidth, plot+plotHeight, 0.5, pdfGray)
+			l.text(x+2, plot+8, 6.5, false, pdfGray, fmt.Sprintf("%g ms", scale))
+			for _, run := range latencyPaths(row.Latency, chartWidth, plotHeight) {
+				for j := range run {
+					run[j][0] += x
+					run[j][1] += plot
+				}
+				if len(run) == 1 {
+					l.rect(run[0][0]-1, run[0][1]-1, 2, 2, pdfBlue)
+				}
+				l.polyline(run, 1.2, pdfBlue)
+			}
+			if row.Checks == 0 {
+				l.text(x+chartWidth/2-20, plot+plotHeight/2+3, 8, false, pdfGray, "No checks")
+			}
+			for _, j := range dayLabels(days) {
+				l.text(x+float64(j)*chartWidth/float64(days), plot+plotHeight+10, 6.5, false, pdfGray, d.Days[j].Format("2"))
+			}
+		}
+	}
+
+	for i, page := range l.pages {
+		l.page = page
+		l.text(pdfMargin, pdfPageHeight-25, 7.5, false, pdfGray, "Uptime report: "+d.Heading+", "+d.Scope)
+		l.textRight(pdfPageWidth-pdfMargin, pdfPageHeight-25, 7.5, false, pdfGray, fmt.Sprintf("Page %d of %d", i+1, len(l.pages)))
+	}
+	return l.bytes()
+}
+
+// html renders the document as a standalone page that prints on A4.
+func (d reportDocument) html() []byte {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, d); err != nil {
+		fmt.Println("Error rendering report:", err)
+	}
+	return buf.Bytes()
+}
+
+// The charts are drawn as inline SVG built from numbers only; names and
+// details stay in the template, which escapes them.
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent":  func(p float64) string { return fmt.Sprintf("%.3f%%", p) },
+	"duration": func(d Duration) string { return formatDuration(time.Duration(d)) },
+	"color":    func(p float64) template.CSS { return template.CSS(uptimeColor(p).hex()) },
+	"dayBars": func(d reportDocument, row reportRow) template.HTML {
+		var b strings.Builder
+		fmt.Fprintf(&b, `<svg viewBox="0 0 %d 12" preserveAspectRatio="none" height="12">`, len(row.Uptime)*10)
+		for i, u := range row.Uptime {
+			fmt.Fprintf(&b, `<rect x="%d" y="1" width="9" height="10" fill="%s"><title>%s: %s</title></rect>`,
+				i*10, uptimeColor(u).hex(), d.Days[i].Format("Jan 2"), dayPercent(u))
+		}
+		b.WriteString(`</svg>`)
+		return template.HTML(b.String())
+	},
+	"downBar": func(row reportRow) template.HTML {
+		var b strings.Builder
+		b.WriteString(`<svg viewBox="0 0 1000 10" preserveAspectRatio="none" height="10">`)
+		fmt.Fprintf(&b, `<rect width="1000" height="10" fill="%s"/>`, pdfTile.hex())
+		for _, span := range row.Down {
+			fmt.Fprintf(&b, `<rect x="%.1f" width="%.1f" height="10" fill="%s"/>`,
+				span[0]*1000, math.Max((span[1]-span[0])*1000, 2), pdfRed.hex())
+		}
+		b.WriteString(`</svg>`)
+		return template.HTML(b.String())
+	},
+	"latencyChart": func(row reportRow) template.HTML {
+		const width, height = 360.0, 80.0
+		var b strings.Builder
+		fmt.Fprintf(&b, `<svg viewBox="0 0 %g %g" height="%g">`, width, height+2, height+2)
+		fmt.Fprintf(&b, `<line x1="0" x2="%g" y1="1" y2="1" stroke="%s"/>`, width, pdfLight.hex())
+		fmt.Fprintf(&b, `<line x1="0" x2="%g" y1="%g" y2="%g" stroke="%s"/>`, width, height/2+1, height/2+1, pdfLight.hex())
+		fmt.Fprintf(&b, `<line x1="0" x2="%g" y1="%g" y2="%g" stroke="%s"/>`, width, height+1, height+1, pdfGray.hex())
+		fmt.Fprintf(&b, `<text x="2" y="11" font-size="9" fill="%s">%g ms</text>`, pdfGray.hex(), latencyScale(row.Latency))
+		for _, run := range latencyPaths(row.Latency, width, height) {
+			points := make([]string, len(run))
+			for i, p := range run {
+				points[i] = fmt.Sprintf("%.1f,%.1f", p[0], p[1]+1)
+			}
+			fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, strings.Join(points, " "), pdfBlue.hex())
+			if len(run) == 1 {
+				fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="1.5" fill="%s"/>`, run[0][0], run[0][1]+1, pdfBlue.hex())
+			}
+		}
+		b.WriteString(`</svg>`)
+		return template.HTML(b.String())
+	},
+	"lastDay": func(d reportDocument) string { return d.To.Add(-time.Second).Format("Jan 2") },
+	"showGroup": func(d reportDocument, i int) bool {
+		return len(d.Groups) > 0 && (i == 0 || d.Rows[i-1].Group != d.Rows[i].Group)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Uptime report: {{.Heading}}</title>
+<style>
+@page { size: A4; margin: 14mm; }
+body { font: 13px/1.45 -apple-system, "Helvetica Neue", Helvetica, Arial, sans-serif; color: #222; max-width: 820px; margin: 2em auto; padding: 0 1em; }
+h1 { font-size: 24px; margin: 0; }
+h2 { font-size: 16px; margin: 28px 0 8px; break-after: avoid; }
+.muted { color: #737373; }
+.tiles { display: flex; gap: 10px; margin: 16px 0; }
+.tile { flex: 1; background: #f2f2f2; padding: 8px 10px; }
+.tile b { display: block; font-size: 20px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 3px 6px; border-bottom: 1px solid #e0e0e0; }
+th { color: #737373; font-weight: normal; }
+.num { text-align: right; white-space: nowrap; }
+tr { break-inside: avoid; }
+tr.group td { font-weight: bold; }
+.bars td { border: 0; padding: 1px 6px; }
+.bars td:first-child { width: 150px; max-width: 150px; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+.bars svg { width: 100%; display: block; }
+.charts { display: grid; grid-template-columns: 1fr 1fr; gap: 16px; }
+.chart { break-inside: avoid; }
+.chart svg { width: 100%; display: block; }
+.key span { display: inline-block; width: 9px; height: 9px; margin: 0 4px 0 12px; }
+@media print { body { margin: 0; max-width: none; padding: 0; } }
+</style>
+</head>
+<body>
+<h1>Uptime report: {{.Heading}}</h1>
+<p class="muted">Covers {{.Scope}}. Times are in {{.Timezone}}. Generated {{.Generated.Format "2006-01-02 15:04"}}.</p>
+<div class="tiles">
+<div class="tile"><span class="muted">Uptime</span><b style="color: {{color .UptimePercent}}">{{percent .UptimePercent}}</b></div>
+<div class="tile"><span class="muted">Incidents</span><b>{{.Incidents}}</b></div>
+<div class="tile"><span class="muted">Total downtime</span><b>{{duration .Downtime}}</b></div>
+<div class="tile"><span class="muted">Mean time to recovery</span><b>{{duration .MTTR}}</b></div>
+</div>
+{{if .Groups}}
+<h2>Availability by group</h2>
+<table>
+<tr><th>Group</th><th class="num">Monitors</th><th class="num">Uptime</th><th class="num">Incidents</th></tr>
+{{range .Groups}}<tr><td>{{.Name}}</td><td class="num">{{.Monitors}}</td><td class="num" style="color: {{color .UptimePercent}}">{{percent .UptimePercent}}</td><td class="num">{{.Incidents}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Availability by monitor</h2>
+<table>
+<tr><th>Monitor</th><th class="num">Uptime</th><th class="num">Incidents</th><th class="num">Downtime</th><th class="num">MTTR</th><th class="num">Avg latency</th></tr>
+{{range $i, $row := .Rows}}{{if showGroup $ $i}}<tr class="group"><td colspan="6">{{with .Group}}{{.}}{{else}}Ungrouped{{end}}</td></tr>
+{{end}}<tr><td>{{.Name}}</td><td class="num" style="color: {{color .UptimePercent}}">{{percent .UptimePercent}}</td><td class="num">{{.Incidents}}</td><td class="num">{{duration .Downtime}}</td><td class="num">{{duration .MTTR}}</td><td class="num">{{if .Checks}}{{printf "%.0f" .AvgLatencyMs}} ms{{else}}-{{end}}</td></tr>
+{{end}}</table>
+{{if .Days}}
+<h2>Daily uptime</h2>
+<table class="bars">
+{{range .Rows}}<tr><td>{{.Name}}</td><td>{{dayBars $ .}}</td></tr>
+{{end}}</table>
+<p class="muted key"><span style="background: #2e9e54"></span>99.9% and over<span style="background: #ed9e1a"></span>99% and over<span style="background: #d1332e"></span>under 99%<span style="background: #e0e0e0"></span>no checks</p>
+{{end}}
+<h2>Incident timeline</h2>
+{{if .Timeline}}
+<table class="bars">
+{{range .Rows}}{{if .Down}}<tr><td>{{.Name}}</td><td>{{downBar .}}</td></tr>
+{{end}}{{end}}</table>
+<p class="muted">{{.From.Format "Jan 2"}} to {{lastDay .}}</p>
+<table>
+<tr><th>Started</th><th>Monitor</th><th>Duration</th><th>Detail</th></tr>
+{{range .Timeline}}<tr><td class="num">{{.Start.Format "Jan 2 15:04"}}</td><td>{{.Monitor}}</td><td>{{duration .Duration}}{{if .Ongoing}} (ongoing){{end}}</td><td>{{.Detail}}{{with .Note}} ({{.}}){{end}}</td></tr>
+{{end}}</table>
+{{else}}
+<p class="muted">No incidents in this period.</p>
+{{end}}
+{{if .Days}}
+<h2>Average latency per day</h2>
+<div class="charts">
+{{range .Rows}}<div class="chart"><b>{{.Name}}</b>{{if .Checks}} <span class="muted">avg {{printf "%.0f" .AvgLatencyMs}} ms</span>{{end}}{{latencyChart .}}</div>
+{{end}}</div>
+{{end}}
+</body>
+</html>
+`))
+
+// dayPercent formats a day's uptime for a tooltip.
+func dayPercent(u float64) string {
+	if u < 0 {
+		return "no checks"
+	}
+	return fmt.Sprintf("%.2f%%", u)
+}
+
+// reportFileHandler serves GET /reports/{month}.pdf and /reports/{month}.html,
+// the printable report for a calendar month, such as 2026-09, in the
+// display timezone or tz. The current month is covered to date.
+func reportFileHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/reports/")
+	ext := path.Ext(name)
+	if ext != ".pdf" && ext != ".html" {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "reports are served as /reports/{month}.pdf or /reports/{month}.html")
+		return
+	}
+	zone, ok := zoneParam(w, r)
+	if !ok {
+		return
+	}
+	report, err := monthReport(strings.TrimSuffix(name, ext), r.URL.Query().Get("group"), requestScope(r).projectFilter(), time.Now().In(zone))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter, err.Error())
+		return
+	}
+	file := reportAttachment(report, ext[1:])
+	w.Header().Set("Content-Type", file.contentType)
+	w.Header().Set("Content-Disposition", `inline; filename="`+file.name+`"`)
+	w.Write(file.data)
+}
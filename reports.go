@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ReportsConfig schedules uptime digests.
+type ReportsConfig struct {
+	Schedules []ReportSchedule `json:"schedules"`
+	// SlackWebhookURL is a Slack incoming webhook used by schedules with
+	// slack enabled.
+	SlackWebhookURL string `json:"slack_webhook_url"`
+}
+
+// ReportSchedule sends one report each time a period completes.
+type ReportSchedule struct {
+	// Period is "daily", "weekly" (Monday to Sunday) or "monthly".
+	Period string `json:"period"`
+	// Group limits the report to monitors in that group. Empty means all.
+	Group string `json:"group"`
+	Email bool   `json:"email"`
+	Slack bool   `json:"slack"`
+	// Attach is "pdf" or "html" to attach the report, with its charts and
+	// incident timeline, to the email.
+	Attach string `json:"attach"`
+}
+
+// reportSlowest is how many of the slowest monitors a report lists.
+const reportSlowest = 5
+
+type MonitorReport struct {
+	Name          string   `json:"name"`
+	URL           string   `json:"url"`
+	Group         string   `json:"group,omitempty"`
+	UptimePercent float64  `json:"uptimePercent"`
+	Checks        int      `json:"checks"`
+	Incidents     int      `json:"incidents"`
+	Downtime      Duration `json:"downtime"`
+	MTTR          Duration `json:"mttr"`
+	AvgLatencyMs  float64  `json:"avgLatencyMs"`
+}
+
+type Report struct {
+	Period string `json:"period"`
+	// Timezone is the zone the period boundaries are aligned to.
+	Timezone      string          `json:"timezone"`
+	Group         string          `json:"group,omitempty"`
+	Project       string          `json:"project,omitempty"`
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"`
+	UptimePercent float64         `json:"uptimePercent"`
+	Incidents     int             `json:"incidents"`
+	MTTR          Duration        `json:"mttr"`
+	Monitors      []MonitorReport `json:"monitors"`
+	Slowest       []MonitorReport `json:"slowest"`
+}
+
+// reportWindow returns the last complete period before ref.
+func reportWindow(period string, ref time.Time) (from, to time.Time, err error) {
+	day := time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, ref.Location())
+	switch period {
+	case "daily":
+		return day.AddDate(0, 0, -1), day, nil
+	case "weekly":
+		monday := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return monday.AddDate(0, 0, -7), monday, nil
+	case "monthly":
+		first := time.Date(ref.Year(), ref.Month(), 1, 0, 0, 0, 0, ref.Location())
+		return first.AddDate(0, -1, 0), first, nil
+	}
+	return from, to, fmt.Errorf("unknown report period %q", period)
+}
+
+func buildReport(period, group, project string, ref time.Time) (Report, error) {
+	from, to, err := reportWindow(period, ref)
+	if err != nil {
+		return Report{}, err
+	}
+	return buildReportWindow(period, group, project, from, to), nil
+}
+
+// monthReport reports on month, given as "2006-01", in now's timezone. The
+// current month is covered up to now.
+func monthReport(month, group, project string, now time.Time) (Report, error) {
+	from, err := time.ParseInLocation("2006-01", month, now.Location())
+	if err != nil {
+		return Report{}, fmt.Errorf("%q is not a month such as 2006-01", month)
+	}
+	if from.After(now) {
+		return Report{}, fmt.Errorf("%s has not started yet", month)
+	}
+	to := from.AddDate(0, 1, 0)
+	if to.After(now) {
+		to = now
+	}
+	return buildReportWindow("monthly", group, project, from, to), nil
+}
+
+// buildReportWindow reports on [from, to), in from's timezone.
+func buildReportWindow(period, group, project string, from, to time.Time) Report {
+	report := Report{Period: period, Timezone: from.Location().String(), Group: group, Project: project, From: from, To: to, Monitors: []MonitorReport{}}
+
+	var totalWeight, totalUp float64
+	var totalRepair time.Duration
+	var resolved int
+	for _, url := range targets.urls() {
+		target, _ := targets.get(url)
+		if group != "" && target.Group != group {
+			continue
+		}
+		if project != "" && target.Project != project {
+			continue
+		}
+		mr := MonitorReport{Name: target.displayName(), URL: url, Group: target.Group}
+
+		var weight, up, latencySum float64
+		for _, b := range history.buckets(url, from, to) {
+			total, ups := b.weights()
+			mr.Checks += b.Checks
+			weight += total
+			up += ups
+			latencySum += b.LatencySum
+		}
+		if mr.Checks > 0 {
+			mr.UptimePercent = 100 * up / weight
+			mr.AvgLatencyMs = latencySum / float64(mr.Checks)
+		}
+
+		var repair time.Duration
+		var fixed int
+		for _, inc := range history.incidents(url, from, to) {
+			mr.Incidents++
+			start, end := inc.Start, to
+			if inc.End != nil && inc.End.Before(to) {
+				end = *inc.End
+			}
+			if start.Before(from) {
+				start = from
+			}
+			mr.Downtime += Duration(end.Sub(start))
+			if inc.End != nil {
+				repair += inc.duration(to)
+				fixed++
+			}
+		}
+		if fixed > 0 {
+			mr.MTTR = Duration(repair / time.Duration(fixed))
+		}
+
+		totalWeight += weight
+		totalUp += up
+		totalRepair += repair
+		resolved += fixed
+		report.Incidents += mr.Incidents
+		report.Monitors = append(report.Monitors, mr)
+	}
+	if totalWeight > 0 {
+		report.UptimePercent = 100 * totalUp / totalWeight
+	}
+	if resolved > 0 {
+		report.MTTR = Duration(totalRepair / time.Duration(resolved))
+	}
+
+	slowest := append([]MonitorReport{}, report.Monitors...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].AvgLatencyMs > slowest[j].AvgLatencyMs })
+	if len(slowest) > reportSlowest {
+		slowest = slowest[:reportSlowest]
+	}
+	report.Slowest = slowest
+	return report
+}
+
+func (r Report) title() string {
+	period := strings.ToUpper(r.Period[:1]) + r.Period[1:]
+	return fmt.Sprintf("%s uptime report for %s, %s to %s", period, r.scope(),
+		r.From.Format("2006-01-02"), r.To.Add(-time.Second).Format("2006-01-02"))
+}
+
+// scope describes the monitors the report covers.
+func (r Report) scope() string {
+	scope := "all monitors"
+	if r.Group != "" {
+		scope = "group " + r.Group
+	}
+	if r.Project != "" {
+		scope = "project " + r.Project
+		if r.Group != "" {
+			scope += ", group " + r.Group
+		}
+	}
+	return scope
+}
+
+// text renders the report as a plain-text table.
+func (r Report) text() string {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, r.title())
+	fmt.Fprintf(&buf, "Times are in %s.\n", r.Timezone)
+	fmt.Fprintln(&buf)
+	fmt.Fprintf(&buf, "Overall uptime: %.3f%%\n", r.UptimePercent)
+	fmt.Fprintf(&buf, "Incidents: %d\n", r.Incidents)
+	fmt.Fprintf(&buf, "Mean time to recovery: %s\n", formatDuration(time.Duration(r.MTTR)))
+	fmt.Fprintln(&buf)
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MONITOR\tUPTIME\tINCIDENTS\tDOWNTIME\tMTTR\tAVG LATENCY")
+	for _, m := range r.Monitors {
+		fmt.Fprintf(tw, "%s\t%.3f%%\t%d\t%s\t%s\t%.0fms\n", m.Name, m.UptimePercent, m.Incidents,
+			formatDuration(time.Duration(m.Downtime)), formatDuration(time.Duration(m.MTTR)), m.AvgLatencyMs)
+	}
+	tw.Flush()
+
+	if len(r.Slowest) > 0 {
+		fmt.Fprintln(&buf)
+		fmt.Fprintln(&buf, "Slowest endpoints:")
+		for i, m := range r.Slowest {
+			fmt.Fprintf(&buf, "%d. %s (%.0fms)\n", i+1, m.Name, m.AvgLatencyMs)
+		}
+	}
+	return buf.String()
+}
+
+// formatDuration renders d as e.g. "2h 13m" for humans.
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "0s"
+	}
+	d = d.Round(time.Second)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	seconds := (d - minutes*time.Minute) / time.Second
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes > 0 && days == 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	if seconds > 0 && days == 0 && hours == 0 {
+		parts = append(parts, fmt.Sprintf("%ds", seconds))
+	}
+	return strings.Join(parts, " ")
+}
+
+// startReports sends each scheduled report once its period has completed.
+func startReports(config Config) {
+	if len(config.Reports.Schedules) == 0 {
+		return
+	}
+	last := make([]time.Time, len(config.Reports.Schedules))
+	now := time.Now().In(displayZone)
+	for i, s := range config.Reports.Schedules {
+		from, _, err := reportWindow(s.Period, now)
+		if err != nil {
+			fmt.Println("Error in report schedule:", err)
+		}
+		if s.Attach != "" && s.Attach != "pdf" && s.Attach != "html" {
+			fmt.Printf("Error in report schedule: attach must be \"pdf\" or \"html\", not %q\n", s.Attach)
+		}
+		last[i] = from
+	}
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			now := time.Now().In(displayZone)
+			for i, s := range config.Reports.Schedules {
+				from, _, err := reportWindow(s.Period, now)
+				if err != nil || !from.After(last[i]) {
+					continue
+				}
+				last[i] = from
+				if !isLeader() {
+					continue
+				}
+				report, _ := buildReport(s.Period, s.Group, "", now)
+				deliverReport(config, s, report)
+			}
+		}
+	}()
+}
+
+func deliverReport(config Config, s ReportSchedule, report Report) {
+	body := report.text()
+	if s.Email {
+		var err error
+		if s.Attach == "pdf" || s.Attach == "html" {
+			err = sendMailAttachment(config.Email, report.title(), body, reportAttachment(report, s.Attach))
+		} else {
+			err = sendMail(config.Email, report.title(), body)
+		}
+		if err != nil {
+			fmt.Println("Error emailing report:", err)
+		} else {
+			fmt.Println("Emailed", report.title())
+		}
+	}
+	if s.Slack && config.Reports.SlackWebhookURL != "" {
+		if err := postSlack(config.Reports.SlackWebhookURL, "```\n"+body+"```"); err != nil {
+			fmt.Println("Error posting report to Slack:", err)
+		} else {
+			fmt.Println("Posted", report.title(), "to Slack")
+		}
+	}
+}
+
+func postSlack(webhookURL, text string) error {
+	payload, _ := json.Marshal(map[string]string{"text": text})
+	if dryRunSkip("slack", "webhook", payload) {
+		return nil
+	}
+	resp, err := http.Post(webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack returned %s", resp.Status)
+	}
+	return nil
+}
+
+// reportsHandler serves GET /reports?period=weekly&group=&tz=&format=json|text,
+// covering the last complete period in the display timezone or tz.
+func reportsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	period := q.Get("period")
+	if period == "" {
+		period = "daily"
+	}
+	zone, ok := zoneParam(w, r)
+	if !ok {
+		return
+	}
+	report, err := buildReport(period, q.Get("group"), requestScope(r).projectFilter(), time.Now().In(zone))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemInvalidParameter, err.Error())
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if q.Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(report.text()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
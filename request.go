@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// defaultUserAgent replaces Go's "Go-http-client/1.1", which some WAFs
+// block outright.
+const defaultUserAgent = "uptime-monitor/1.0"
+
+// defaultHeaders are sent with every check request unless a monitor
+// overrides them. They are set from the configuration at startup.
+var defaultHeaders = map[string]string{"User-Agent": defaultUserAgent}
+
+// setDefaultHeaders applies the configured user agent and header defaults.
+func setDefaultHeaders(config Config) {
+	headers := map[string]string{"User-Agent": defaultUserAgent}
+	if config.UserAgent != "" {
+		headers["User-Agent"] = config.UserAgent
+	}
+	for k, v := range config.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+	defaultHeaders = headers
+}
+
+// checkHeaders merges target's headers over the defaults. A monitor header
+// with an empty value removes the default.
+func checkHeaders(target Target) map[string]string {
+	headers := make(map[string]string, len(defaultHeaders)+len(target.Headers))
+	for k, v := range defaultHeaders {
+		headers[k] = v
+	}
+	for k, v := range target.Headers {
+		k = http.CanonicalHeaderKey(k)
+		if v == "" {
+			delete(headers, k)
+		} else {
+			headers[k] = v
+		}
+	}
+	return headers
+}
+
+// newCheckRequest builds a request to target carrying its headers.
+func newCheckRequest(method string, target Target, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, target.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range checkHeaders(target) {
+		if k == "Host" {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// An empty value stops net/http from adding its own user agent.
+		req.Header.Set("User-Agent", "")
+	}
+	return req, nil
+}
+
+// bodyLimit is how much of a response body checks of t read: its
+// max_body_bytes, or def when it sets none.
+func (t Target) bodyLimit(def int64) int64 {
+	if t.MaxBodyBytes > 0 {
+		return t.MaxBodyBytes
+	}
+	return def
+}
+
+// readBody reads at most limit bytes of resp's body and closes it. Closing
+// the body early drops the connection, so the rest is never downloaded.
+func readBody(resp *http.Response, limit int64) ([]byte, error) {
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// checkGet performs a GET of target with its headers, after running any
+// steps it has.
+func checkGet(target Target) (*http.Response, error) {
+	client := checkClient(target)
+	if failure := runSteps(client, target); failure != "" {
+		return nil, errors.New(failure)
+	}
+	req, err := newCheckRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RouteConfig sends notifications matching a rule to some channels, e.g.
+//
+//	{"match": "tag=db AND severity=critical", "notify": ["pagerduty-db"]}
+//
+// Match is a list of conditions joined by AND. A condition compares a field
+// with =, != or, for severity, >= and <=. Fields are tag, severity, group,
+// project, type, kind ("state", "slo", "anomaly", "tls" or "cert"),
+// status and hours ("business" or "after", see business_hours); any other
+// name matches a key=value tag, so team=payments matches monitors tagged
+// "team=payments". An empty match matches everything.
+type RouteConfig struct {
+	Match string `json:"match"`
+	// Notify names the channels to send to: those under channels, or the
+	// built-in "email", "alertmanager", "syslog", "mqtt", "pubsub" and
+	// "subscription".
+	Notify []string `json:"notify"`
+	// Stop skips the routes after this one when it matches.
+	Stop bool `json:"stop"`
+}
+
+type routeCondition struct {
+	field, op, value string
+}
+
+type route struct {
+	conditions []routeCondition
+	notify     map[string]bool
+	stop       bool
+}
+
+// router decides which channels a notification goes to. Channels no route
+// names are not routed and receive every notification.
+type router struct {
+	routes []route
+	routed map[string]bool
+}
+
+// routes is nil when no routing rules are configured.
+var routes *router
+
+func parseRouteMatch(src string) ([]routeCondition, error) {
+	var conds []routeCondition
+	src = strings.TrimSpace(src)
+	if src == "" {
+		return nil, nil
+	}
+	for _, part := range splitAnd(src) {
+		part = strings.TrimSpace(part)
+		var c routeCondition
+		for _, op := range []string{"!=", ">=", "<=", "="} {
+			if field, value, ok := strings.Cut(part, op); ok {
+				c = routeCondition{field: strings.ToLower(strings.TrimSpace(field)), op: op, value: strings.TrimSpace(value)}
+				break
+			}
+		}
+		if c.op == "" || c.field == "" || c.value == "" {
+			return nil, fmt.Errorf("cannot parse condition %q", part)
+		}
+		if c.field == "severity" {
+			if err := validateSeverity(c.value); err != nil {
+				return nil, err
+			}
+		} else if c.op == ">=" || c.op == "<=" {
+			return nil, fmt.Errorf("%s only works with severity", c.op)
+		}
+		if c.field == "hours" {
+			if c.value != "business" && c.value != "after" {
+				return nil, fmt.Errorf(`hours must be "business" or "after"`)
+			}
+			if businessHours == nil {
+				fmt.Println("Routes use hours but business_hours is not configured; it is always business hours")
+			}
+		}
+		conds = append(conds, c)
+	}
+	return conds, nil
+}
+
+// splitAnd splits src on the word AND, in any case.
+func splitAnd(src string) []string {
+	var parts []string
+	var cur []string
+	for _, word := range strings.Fields(src) {
+		if strings.EqualFold(word, "and") {
+			parts = append(parts, strings.Join(cur, " "))
+			cur = nil
+			continue
+		}
+		cur = append(cur, word)
+	}
+	return append(parts, strings.Join(cur, " "))
+}
+
+func newRouter(configs []RouteConfig, channels map[string]bool) *router {
+	r := &router{routed: make(map[string]bool)}
+	for i, c := range configs {
+		conds, err := parseRouteMatch(c.Match)
+		if err != nil {
+			fmt.Printf("Ignoring route %d: %s\n", i+1, err)
+			continue
+		}
+		rt := route{conditions: conds, notify: make(map[string]bool), stop: c.Stop}
+		for _, name := range c.Notify {
+			if !channels[name] {
+				fmt.Printf("Route %d sends to unknown channel %q\n", i+1, name)
+			}
+			rt.notify[name] = true
+			r.routed[name] = true
+		}
+		r.routes = append(r.routes, rt)
+	}
+	return r
+}
+
+// allows reports whether channel should receive n. A monitor that names
+// its channels only notifies those, whatever the routes say.
+func (r *router) allows(channel string, n notification) bool {
+	if len(n.Target.Notify) > 0 && (builtinChannels[channel] || namedChannels[channel]) {
+		for _, name := range n.Target.Notify {
+			if name == channel {
+				return true
+			}
+		}
+		return false
+	}
+	if r == nil || !r.routed[channel] {
+		return true
+	}
+	for _, rt := range r.routes {
+		if !rt.matches(n) {
+			continue
+		}
+		if rt.notify[channel] {
+			return true
+		}
+		if rt.stop {
+			return false
+		}
+	}
+	return false
+}
+
+func (rt route) matches(n notification) bool {
+	for _, c := range rt.conditions {
+		if !c.matches(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c routeCondition) matches(n notification) bool {
+	t := n.Target
+	var ok bool
+	switch c.field {
+	case "severity":
+		diff := severityRanks[t.severity()] - severityRanks[c.value]
+		switch c.op {
+		case ">=":
+			return diff >= 0
+		case "<=":
+			return diff <= 0
+		}
+		ok = diff == 0
+	case "tag":
+		ok = hasTag(t, c.value)
+	case "group":
+		ok = t.Group == c.value
+	case "project":
+		ok = t.Project == c.value
+	case "type":
+		typ := t.Type
+		if typ == "" {
+			typ = "http"
+		}
+		ok = typ == c.value
+	case "kind":
+		kind := n.Kind
+		if kind == notifyState {
+			kind = "state"
+		}
+		ok = kind == c.value
+	case "status":
+		ok = n.Status == c.value
+	case "hours":
+		open := businessHours == nil || businessHours.open(time.Now())
+		ok = open == (c.value == "business")
+	default:
+		ok = hasTag(t, c.field+"="+c.value)
+	}
+	if c.op == "!=" {
+		return !ok
+	}
+	return ok
+}
+
+func hasTag(t Target, tag string) bool {
+	for _, have := range t.Tags {
+		if have == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3CheckConfig configures "s3" monitors, whose url is s3://bucket or
+// s3://bucket/key. A bucket alone is checked with HeadBucket, an object
+// with HEAD or a small ranged GET.
+type S3CheckConfig struct {
+	// Region defaults to us-east-1.
+	Region string `json:"region,omitempty"`
+	awsCredentials
+	// Endpoint is the base url of an S3-compatible service such as MinIO,
+	// addressed path-style. Empty uses AWS with virtual-hosted buckets.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Method is "HEAD" (the default) or "GET", which reads the first
+	// Bytes of the object to prove it is readable, not just listed.
+	Method string `json:"method,omitempty"`
+	// Bytes is how much a GET reads. Defaults to 1024.
+	Bytes int64 `json:"bytes,omitempty"`
+	// Timeout bounds the request. Defaults to 10s.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+const s3Type = "s3"
+
+func (c *S3CheckConfig) validate() error {
+	c.Method = strings.ToUpper(c.Method)
+	if c.Method != "" && c.Method != http.MethodHead && c.Method != http.MethodGet {
+		return fmt.Errorf("method must be HEAD or GET, got %q", c.Method)
+	}
+	if c.Bytes < 0 {
+		return fmt.Errorf("bytes must be positive")
+	}
+	if c.Endpoint != "" {
+		if u, err := url.Parse(c.Endpoint); err != nil || u.Host == "" {
+			return fmt.Errorf("endpoint must be an http(s) url, got %q", c.Endpoint)
+		}
+	}
+	return nil
+}
+
+func (c *S3CheckConfig) region() string {
+	if c.Region == "" {
+		return "us-east-1"
+	}
+	return c.Region
+}
+
+// s3URL returns the http(s) url for an s3:// monitor url and the object key
+// it names, if any.
+func (c *S3CheckConfig) s3URL(monitorURL string) (*url.URL, string, error) {
+	u, err := url.Parse(monitorURL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, "", fmt.Errorf("s3 monitors need a s3://bucket[/key] url")
+	}
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if c.Endpoint == "" {
+		return &url.URL{Scheme: "https", Host: bucket + ".s3." + c.region() + ".amazonaws.com", Path: "/" + key}, key, nil
+	}
+	base, _ := url.Parse(c.Endpoint)
+	path := strings.TrimSuffix(base.Path, "/") + "/" + bucket
+	if key != "" {
+		path += "/" + key
+	}
+	return &url.URL{Scheme: base.Scheme, Host: base.Host, Path: path}, key, nil
+}
+
+// s3Error is the XML error body S3 sends with GET failures.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// probeS3 makes a signed request for the bucket or object, so it fails
+// when the endpoint is down and also when the credentials or bucket policy
+// no longer allow access.
+func probeS3(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	cfg := target.S3
+	if cfg == nil {
+		cfg = &S3CheckConfig{}
+	}
+	u, key, err := cfg.s3URL(target.URL)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	object := key != ""
+	method := http.MethodHead
+	if cfg.Method == http.MethodGet && object {
+		method = http.MethodGet
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	requestTarget := target
+	requestTarget.URL = u.String()
+	req, err := newCheckRequest(method, requestTarget, nil)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+	if method == http.MethodGet {
+		bytes := cfg.Bytes
+		if bytes == 0 {
+			bytes = 1024
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", bytes-1))
+	}
+	// Without credentials the request is anonymous, for public buckets.
+	if creds := cfg.awsCredentials.resolve(); creds.AccessKeyID != "" {
+		signV4(req, nil, creds, cfg.region(), "s3", time.Now())
+	}
+
+	start := time.Now()
+	resp, err := checkClient(requestTarget).Do(req)
+	if err != nil {
+		result.Latency = Duration(time.Since(start))
+		result.Detail = err.Error()
+		return result
+	}
+	body, err := readBody(resp, target.bodyLimit(expectMaxBody))
+	result.Latency = Duration(time.Since(start))
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	result.Detail = resp.Status
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		result.Status = "up"
+		if method == http.MethodGet {
+			result.Detail += fmt.Sprintf(", read %d bytes", len(body))
+		} else if object && resp.ContentLength >= 0 {
+			result.Detail += fmt.Sprintf(", %d bytes", resp.ContentLength)
+		}
+		return result
+	}
+	var s3err s3Error
+	if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+		result.Detail += ": " + s3err.Code
+		if s3err.Message != "" {
+			result.Detail += ": " + s3err.Message
+		}
+	} else if resp.StatusCode == http.StatusForbidden {
+		// HEAD responses have no body to say why.
+		result.Detail += ": check the credentials and bucket policy"
+	}
+	return result
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// job is a single target's slot in the scheduler's run queue.
+type job struct {
+	target  Target
+	next    time.Time
+	index   int
+	removed bool
+}
+
+type jobHeap []*job
+
+func (h jobHeap) Len() int           { return len(h) }
+func (h jobHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *jobHeap) Push(x any) {
+	j := x.(*job)
+	j.index = len(*h)
+	*h = append(*h, j)
+}
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	j.index = -1
+	*h = old[:n-1]
+	return j
+}
+
+// scheduler runs each job once per interval using a min-heap ordered by next
+// run time and a fixed pool of workers, so large fleets are checked at a
+// steady rate instead of in one goroutine burst per cycle.
+type scheduler struct {
+	interval time.Duration
+	workers  int
+
+	// ready, when set, is called once every job scheduled before run has
+	// been checked once.
+	ready func()
+	// tick, when set, is called from the dispatch loop at least every
+	// tickEvery.
+	tick      func()
+	tickEvery time.Duration
+	// busy counts workers running a check.
+	busy atomic.Int32
+
+	mu    sync.Mutex
+	queue jobHeap
+	jobs  map[string]*job
+	wake  chan struct{}
+	// firstCycle holds the jobs still to complete their first check.
+	firstCycle map[*job]bool
+	// paused stops dispatching, for a shutdown or upgrade.
+	paused bool
+}
+
+func newScheduler(interval time.Duration, workers int) *scheduler {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if workers <= 0 {
+		workers = 64
+	}
+	return &scheduler{
+		interval: interval,
+		workers:  workers,
+		jobs:     make(map[string]*job),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// pause stops dispatching jobs. Checks already running carry on; idle
+// reports when they have finished.
+func (s *scheduler) pause() {
+	s.mu.Lock()
+	s.paused = true
+	s.mu.Unlock()
+}
+
+// resume undoes pause.
+func (s *scheduler) resume() {
+	s.mu.Lock()
+	s.paused = false
+	s.mu.Unlock()
+	s.notify()
+}
+
+// idle reports whether no check is running: every job is back in the
+// queue, popped jobs being out of it until their check is done.
+func (s *scheduler) idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.index < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// nextRuns returns when each job is next due.
+func (s *scheduler) nextRuns() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]time.Time, len(s.jobs))
+	for url, j := range s.jobs {
+		out[url] = j.next
+	}
+	return out
+}
+
+// add schedules target to first run at 'at'.
+func (s *scheduler) add(target Target, at time.Time) {
+	s.mu.Lock()
+	j := &job{target: target, next: at}
+	s.jobs[target.URL] = j
+	heap.Push(&s.queue, j)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// remove unschedules url. A check already in flight finishes but is not
+// rescheduled.
+func (s *scheduler) remove(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[url]
+	if !ok {
+		return
+	}
+	delete(s.jobs, url)
+	j.removed = true
+	s.finishFirst(j)
+	if j.index >= 0 {
+		heap.Remove(&s.queue, j.index)
+	}
+}
+
+// finishFirst must be called with s.mu held.
+func (s *scheduler) finishFirst(j *job) {
+	if s.firstCycle == nil {
+		return
+	}
+	delete(s.firstCycle, j)
+	if len(s.firstCycle) == 0 {
+		s.firstCycle = nil
+		if s.ready != nil {
+			go s.ready()
+		}
+	}
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run dispatches due jobs to the worker pool and never returns.
+func (s *scheduler) run(check func(url string)) {
+	s.mu.Lock()
+	s.firstCycle = make(map[*job]bool, len(s.jobs))
+	for _, j := range s.jobs {
+		s.firstCycle[j] = true
+	}
+	if len(s.firstCycle) == 0 {
+		s.firstCycle = nil
+		if s.ready != nil {
+			go s.ready()
+		}
+	}
+	s.mu.Unlock()
+
+	due := make(chan *job)
+	for i := 0; i < s.workers; i++ {
+		go func() {
+			for j := range due {
+				s.mu.Lock()
+				removed := j.removed
+				s.mu.Unlock()
+				if removed {
+					continue
+				}
+				started := time.Now()
+				diag.schedulerLag.add(started.Sub(j.next))
+				s.busy.Add(1)
+				check(j.target.URL)
+				s.busy.Add(-1)
+				interval := j.target.Interval
+				if interval <= 0 {
+					interval = s.interval
+				}
+				interval = adaptive.interval(j.target, interval)
+				s.mu.Lock()
+				s.finishFirst(j)
+				if !j.removed {
+					j.next = started.Add(interval)
+					if j.next.Before(time.Now()) {
+						j.next = time.Now()
+					}
+					heap.Push(&s.queue, j)
+				}
+				s.mu.Unlock()
+				s.notify()
+			}
+		}()
+	}
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	var lastTick time.Time
+	for {
+		if s.tick != nil && time.Since(lastTick) >= s.tickEvery/2 {
+			s.tick()
+			lastTick = time.Now()
+		}
+		s.mu.Lock()
+		var wait time.Duration = time.Hour
+		var next *job
+		if len(s.queue) > 0 && !s.paused {
+			wait = time.Until(s.queue[0].next)
+			if wait <= 0 {
+				next = heap.Pop(&s.queue).(*job)
+			}
+		}
+		s.mu.Unlock()
+
+		if next != nil {
+			due <- next
+			continue
+		}
+		if s.tick != nil && wait > s.tickEvery {
+			wait = s.tickEvery
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// serviceOptions are shared by install, uninstall and run-as-service.
+type serviceOptions struct {
+	name string
+	// dir is the working directory holding config.json and state files.
+	dir string
+	// user runs the service on systemd and launchd; empty runs it as root.
+	user string
+	// print writes the generated unit instead of installing it.
+	print bool
+}
+
+func parseServiceFlags(cmd string, args []string) serviceOptions {
+	var opts serviceOptions
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.StringVar(&opts.name, "name", "uptime-monitor", "service name")
+	fs.StringVar(&opts.dir, "dir", "", "directory containing config.json (default the current directory)")
+	if cmd == "install" {
+		fs.StringVar(&opts.user, "user", "", "account to run as under systemd or launchd")
+		fs.BoolVar(&opts.print, "print", false, "print the service definition instead of installing it")
+	}
+	fs.Parse(args)
+	if opts.dir == "" {
+		opts.dir, _ = os.Getwd()
+	}
+	if abs, err := filepath.Abs(opts.dir); err == nil {
+		opts.dir = abs
+	}
+	return opts
+}
+
+// installService registers the monitor with the platform's service manager:
+// a systemd unit on Linux, a launchd daemon on macOS and an SCM service on
+// Windows. The service runs "run-as-service -dir <dir>".
+func installService(args []string) {
+	opts := parseServiceFlags("install", args)
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error locating the executable:", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(filepath.Join(opts.dir, "config.json")); err != nil && !opts.print {
+		fmt.Fprintf(os.Stderr, "Warning: %s has no config.json yet\n", opts.dir)
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		err = installSystemdUnit(opts, exe)
+	case "darwin":
+		err = installLaunchdDaemon(opts, exe)
+	case "windows":
+		err = installWindowsService(opts, exe)
+	default:
+		err = fmt.Errorf("service installation is not supported on %s", runtime.GOOS)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error installing service:", err)
+		os.Exit(1)
+	}
+	if !opts.print {
+		fmt.Printf("Installed and started service %s\n", opts.name)
+	}
+}
+
+// uninstallService stops and removes a service added by installService.
+func uninstallService(args []string) {
+	opts := parseServiceFlags("uninstall", args)
+	var err error
+	switch runtime.GOOS {
+	case "linux":
+		run("systemctl", "disable", "--now", opts.name)
+		if err = os.Remove(systemdUnitPath(opts)); err == nil {
+			err = run("systemctl", "daemon-reload")
+		}
+	case "darwin":
+		run("launchctl", "bootout", "system/"+launchdLabel(opts))
+		err = os.Remove(launchdPlistPath(opts))
+	case "windows":
+		run("sc.exe", "stop", opts.name)
+		err = run("sc.exe", "delete", opts.name)
+	default:
+		err = fmt.Errorf("service installation is not supported on %s", runtime.GOOS)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error uninstalling service:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Removed service %s\n", opts.name)
+}
+
+// runAsService is the service's entry point. It moves to -dir so
+// config.json and state files resolve as they would from a shell.
+func runAsService(args []string) {
+	opts := parseServiceFlags("run-as-service", args)
+	if err := os.Chdir(opts.dir); err != nil {
+		fmt.Fprintln(os.Stderr, "Error changing to the service directory:", err)
+		os.Exit(1)
+	}
+	runServiceMain(opts.name)
+}
+
+// run executes a service manager command, passing its output through.
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// unitData fills the service definition templates.
+type unitData struct {
+	Name, Dir, User, Exe, Label string
+}
+
+func newUnitData(opts serviceOptions, exe string) unitData {
+	return unitData{Name: opts.name, Dir: opts.dir, User: opts.user, Exe: exe, Label: launchdLabel(opts)}
+}
+
+var systemdUnit = template.Must(template.New("unit").Parse(`[Unit]
+Description=Uptime Monitor ({{.Name}})
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=all
+ExecStart="{{.Exe}}" run-as-service -name {{.Name}} -dir "{{.Dir}}"
+ExecReload=/bin/kill -USR2 $MAINPID
+WorkingDirectory={{.Dir}}
+{{if .User}}User={{.User}}
+{{end}}WatchdogSec=60
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+func systemdUnitPath(opts serviceOptions) string {
+	return "/etc/systemd/system/" + opts.name + ".service"
+}
+
+func installSystemdUnit(opts serviceOptions, exe string) error {
+	var buf bytes.Buffer
+	systemdUnit.Execute(&buf, newUnitData(opts, exe))
+	if opts.print {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(systemdUnitPath(opts), buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := run("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	return run("systemctl", "enable", "--now", opts.name)
+}
+
+var launchdPlist = template.Must(template.New("plist").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{.Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{.Exe}}</string>
+		<string>run-as-service</string>
+		<string>-name</string>
+		<string>{{.Name}}</string>
+		<string>-dir</string>
+		<string>{{.Dir}}</string>
+	</array>
+	<key>WorkingDirectory</key>
+	<string>{{.Dir}}</string>
+{{- if .User}}
+	<key>UserName</key>
+	<string>{{.User}}</string>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>StandardOutPath</key>
+	<string>/var/log/{{.Name}}.log</string>
+	<key>StandardErrorPath</key>
+	<string>/var/log/{{.Name}}.log</string>
+</dict>
+</plist>
+`))
+
+func launchdLabel(opts serviceOptions) string { return "com." + opts.name }
+
+func launchdPlistPath(opts serviceOptions) string {
+	return "/Library/LaunchDaemons/" + launchdLabel(opts) + ".plist"
+}
+
+func installLaunchdDaemon(opts serviceOptions, exe string) error {
+	var buf bytes.Buffer
+	launchdPlist.Execute(&buf, newUnitData(opts, exe))
+	if opts.print {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(launchdPlistPath(opts), buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return run("launchctl", "bootstrap", "system", launchdPlistPath(opts))
+}
+
+func installWindowsService(opts serviceOptions, exe string) error {
+	binPath := fmt.Sprintf(`"%s" run-as-service -name %s -dir "%s"`, exe, opts.name, opts.dir)
+	if opts.print {
+		fmt.Printf("sc.exe create %s binPath= %q start= auto DisplayName= \"Uptime Monitor\"\n", opts.name, binPath)
+		return nil
+	}
+	if err := run("sc.exe", "create", opts.name, "binPath=", binPath, "start=", "auto", "DisplayName=", "Uptime Monitor"); err != nil {
+		return err
+	}
+	run("sc.exe", "description", opts.name, "Checks websites and sends alerts when they go down.")
+	run("sc.exe", "failure", opts.name, "reset=", "86400", "actions=", "restart/5000")
+	return run("sc.exe", "start", opts.name)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// runServiceMain runs the monitor in the foreground; systemd and launchd
+// supervise ordinary processes.
+func runServiceMain(name string) {
+	runMonitor()
+}
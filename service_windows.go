@@ -0,0 +1,118 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// The Service Control Manager API, called directly so the binary needs
+// nothing beyond the standard library.
+var (
+	advapi32                         = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW  = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerEx = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus             = advapi32.NewProc("SetServiceStatus")
+)
+
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	serviceAcceptStop     = 0x1
+	serviceAcceptShutdown = 0x4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+)
+
+// serviceStatus is SERVICE_STATUS.
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry is SERVICE_TABLE_ENTRYW.
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+type windowsService struct {
+	handle uintptr
+	status serviceStatus
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func (s *windowsService) requestStop() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *windowsService) setState(state uint32) {
+	s.status.CurrentState = state
+	s.status.ControlsAccepted = 0
+	if state == serviceRunning {
+		s.status.ControlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+	}
+	procSetServiceStatus.Call(s.handle, uintptr(unsafe.Pointer(&s.status)))
+}
+
+// runServiceMain hands the process to the Service Control Manager. Run from
+// a console instead, it falls back to monitoring in the foreground.
+func runServiceMain(name string) {
+	svc := &windowsService{status: serviceStatus{ServiceType: serviceWin32OwnProcess}, stop: make(chan struct{})}
+	handler := syscall.NewCallback(func(control, eventType uint32, eventData, context uintptr) uintptr {
+		switch control {
+		case serviceControlStop, serviceControlShutdown:
+			svc.setState(serviceStopPending)
+			svc.requestStop()
+		case serviceControlInterrogate:
+			procSetServiceStatus.Call(svc.handle, uintptr(unsafe.Pointer(&svc.status)))
+		}
+		return 0
+	})
+	serviceMain := syscall.NewCallback(func(argc uint32, argv **uint16) uintptr {
+		namePtr, _ := syscall.UTF16PtrFromString(name)
+		svc.handle, _, _ = procRegisterServiceCtrlHandlerEx.Call(uintptr(unsafe.Pointer(namePtr)), handler, 0)
+		if svc.handle == 0 {
+			return 0
+		}
+		svc.setState(serviceStartPending)
+		go func() {
+			// runMonitor only returns when the configuration is unusable.
+			runMonitor()
+			svc.requestStop()
+		}()
+		svc.setState(serviceRunning)
+		<-svc.stop
+		svc.setState(serviceStopped)
+		return 0
+	})
+
+	namePtr, _ := syscall.UTF16PtrFromString(name)
+	table := []serviceTableEntry{{name: namePtr, proc: serviceMain}, {}}
+	if ok, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); ok == 0 {
+		// ERROR_FAILED_SERVICE_CONTROLLER_CONNECT: not started by the SCM.
+		if errno, isErrno := err.(syscall.Errno); isErrno && errno == 1063 {
+			runMonitor()
+			return
+		}
+		fmt.Fprintln(os.Stderr, "Error starting service dispatcher:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+)
+
+// CheckStep is one request made before a monitor's own URL is checked, such
+// as a login form post. Steps share the monitor's cookie jar.
+type CheckStep struct {
+	Name string `json:"name,omitempty"`
+	// Method defaults to GET.
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url"`
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// ExpectStatus is the required status code. Zero accepts any 2xx.
+	ExpectStatus int `json:"expect_status,omitempty"`
+}
+
+func (s CheckStep) label(i int) string {
+	if s.Name != "" {
+		return fmt.Sprintf("step %d (%s)", i+1, s.Name)
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+// sessionStore keeps cookie jars for monitors that carry their session
+// across check cycles.
+type sessionStore struct {
+	mu   sync.Mutex
+	jars map[string]http.CookieJar
+}
+
+var sessions = &sessionStore{jars: make(map[string]http.CookieJar)}
+
+// jar returns the cookie jar for one check of target, or nil if target does
+// not use cookies.
+func (s *sessionStore) jar(target Target) http.CookieJar {
+	if len(target.Steps) == 0 && !target.KeepSession {
+		return nil
+	}
+	if !target.KeepSession {
+		jar, _ := cookiejar.New(nil)
+		return jar
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jar := s.jars[target.URL]
+	if jar == nil {
+		jar, _ = cookiejar.New(nil)
+		s.jars[target.URL] = jar
+	}
+	return jar
+}
+
+// reset drops url's session. It reports whether there was one.
+func (s *sessionStore) reset(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.jars[url]
+	delete(s.jars, url)
+	return ok
+}
+
+// checkClient returns the HTTP client for one check of target.
+func checkClient(target Target) *http.Client {
+	jar := sessions.jar(target)
+	if jar == nil && target.dialAddr == "" && target.source() == "" && target.Timeout == 0 && dnsCache == nil {
+		return http.DefaultClient
+	}
+	client := &http.Client{Jar: jar, Timeout: target.Timeout}
+	if target.dialAddr != "" || target.source() != "" || dnsCache != nil {
+		client.Transport = checkTransport(target)
+	}
+	return client
+}
+
+// runSteps performs target's steps in order with client, returning a
+// description of the first failure or "".
+func runSteps(client *http.Client, target Target) string {
+	for i, step := range target.Steps {
+		method := step.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		var body io.Reader
+		if step.Body != "" {
+			body = strings.NewReader(step.Body)
+		}
+		stepTarget := target
+		stepTarget.URL = step.URL
+		stepTarget.Headers = mergeHeaders(target.Headers, step.Headers)
+		req, err := newCheckRequest(method, stepTarget, body)
+		if err != nil {
+			return fmt.Sprintf("%s: %s", step.label(i), err)
+		}
+		if step.Body != "" && req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Sprintf("%s: %s", step.label(i), err)
+		}
+		// Drain what the budget allows so the connection can be reused.
+		io.Copy(io.Discard, io.LimitReader(resp.Body, target.bodyLimit(1<<20)))
+		resp.Body.Close()
+		ok := resp.StatusCode >= 200 && resp.StatusCode <= 299
+		if step.ExpectStatus != 0 {
+			ok = resp.StatusCode == step.ExpectStatus
+		}
+		if !ok {
+			return fmt.Sprintf("%s: %s", step.label(i), resp.Status)
+		}
+	}
+	return ""
+}
+
+func mergeHeaders(base, over map[string]string) map[string]string {
+	if len(over) == 0 {
+		return base
+	}
+	out := make(map[string]string, len(base)+len(over))
+	for k, v := range base {
+		out[http.CanonicalHeaderKey(k)] = v
+	}
+	for k, v := range over {
+		out[http.CanonicalHeaderKey(k)] = v
+	}
+	return out
+}
+
+// sessionResetHandler serves POST /sessions/reset?url=..., discarding a
+// monitor's stored cookies so its next check starts a fresh session.
+func sessionResetHandler(w http.ResponseWriter, r *http.Request) {
+	if methodNotAllowed(w, r, http.MethodPost) {
+		return
+	}
+	url := r.URL.Query().Get("url")
+	if !knownMonitor(w, r, url) {
+		return
+	}
+	if !sessions.reset(url) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "no session stored for "+url)
+		return
+	}
+	fmt.Printf("Reset session for %s\n", url)
+	audit.admin(r, "session.reset", url, "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Monitor severities, from most to least urgent.
+const (
+	severityCritical = "critical"
+	severityHigh     = "high"
+	severityLow      = "low"
+	severityInfo     = "info"
+)
+
+var severityRanks = map[string]int{
+	severityInfo:     0,
+	severityLow:      1,
+	severityHigh:     2,
+	severityCritical: 3,
+}
+
+// defaultSeverity applies to monitors that do not set one.
+const defaultSeverity = severityHigh
+
+func validateSeverity(s string) error {
+	if _, ok := severityRanks[s]; !ok {
+		return fmt.Errorf("unknown severity %q; use critical, high, low or info", s)
+	}
+	return nil
+}
+
+// severity returns the monitor's severity, or defaultSeverity.
+func (t Target) severity() string {
+	if t.Severity == "" {
+		return defaultSeverity
+	}
+	return t.Severity
+}
+
+// severityAtLeast reports whether s is as urgent as threshold. An empty
+// threshold lets everything through.
+func severityAtLeast(s, threshold string) bool {
+	if threshold == "" {
+		return true
+	}
+	return severityRanks[s] >= severityRanks[threshold]
+}
+
+// reminderPoll is how often down monitors are checked for a due reminder.
+const reminderPoll = 30 * time.Second
+
+// startReminders re-sends down notifications for monitors that stay down,
+// every reminders[severity] for each severity that has an interval.
+func startReminders(reminders map[string]Duration) {
+	if len(reminders) == 0 {
+		return
+	}
+	for s := range reminders {
+		if err := validateSeverity(s); err != nil {
+			fmt.Println("Ignoring reminder:", err)
+		}
+	}
+	last := make(map[string]time.Time)
+	go func() {
+		for range time.Tick(reminderPoll) {
+			now := time.Now().UTC()
+			entries, _, _ := statuses.page(0, math.MaxInt)
+			down := make(map[string]bool)
+			for _, e := range entries {
+				if e.Status != StatusDown {
+					continue
+				}
+				down[e.URL] = true
+				if holds.isHeld(e.URL) {
+					continue
+				}
+				target, ok := targets.get(e.URL)
+				if !ok || inMaintenance(target, now) || calendars.excluding(target, calendarSilence, now) {
+					continue
+				}
+				every := time.Duration(reminders[target.severity()])
+				if every <= 0 {
+					continue
+				}
+				from := last[e.URL]
+				if from.Before(e.Since) {
+					from = e.Since
+				}
+				if now.Sub(from) < every {
+					continue
+				}
+				last[e.URL] = now
+				detail, failure := "still down", ""
+				if state, ok := statuses.get(e.URL); ok && state.LastError != "" {
+					detail, failure = state.LastError, state.LastFailure
+				}
+				enqueueNotification(notification{
+					Target:   target,
+					Status:   "down",
+					Detail:   detail,
+					Failure:  failure,
+					Time:     e.Since,
+					Reminder: true,
+					Downtime: now.Sub(e.Since),
+				})
+			}
+			for url := range last {
+				if !down[url] {
+					delete(last, url)
+				}
+			}
+		}
+	}()
+}
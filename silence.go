@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// silenceMax bounds how long a silence may last; longer planned work
+// belongs in a maintenance window.
+const silenceMax = 7 * 24 * time.Hour
+
+// Silence is a period of expected downtime of one monitor, set through the
+// API, during which its alerts are held back.
+type Silence struct {
+	ID     string    `json:"id"`
+	Reason string    `json:"reason"`
+	Start  time.Time `json:"start"`
+	// End is when the silence expires, or when it was ended early.
+	End time.Time `json:"end"`
+	// Actor is who set the silence. It is set by the server.
+	Actor string `json:"actor,omitempty"`
+}
+
+// SilenceRequest is the body of POST /monitors/{monitor}/silence.
+type SilenceRequest struct {
+	// Duration is how long the silence lasts, up to 168h.
+	Duration Duration `json:"duration"`
+	Reason   string   `json:"reason"`
+}
+
+func (s Silence) active(now time.Time) bool {
+	return !now.Before(s.Start) && now.Before(s.End)
+}
+
+// silenced reports whether url is in a silence set through the API.
+func silenced(url string, now time.Time) bool {
+	_, ok := history.silenced(url, now)
+	return ok
+}
+
+// silencedAlerts keeps the alerts raised while their monitor is silenced,
+// other than outages, which alertHolds keeps, and sends those still firing
+// once the silence is over.
+type silencedAlerts struct {
+	mu   sync.Mutex
+	held map[string]map[string]notification
+}
+
+var silencedHeld = &silencedAlerts{held: make(map[string]map[string]notification)}
+
+// hold reports whether n must be held back because its monitor is silenced
+// at now. An alert is kept to be sent when the silence ends, unless it is
+// resolved first, in which case neither is sent.
+func (s *silencedAlerts) hold(n notification, now time.Time) bool {
+	url := n.Target.URL
+	silence, ok := history.silenced(url, now)
+	if !ok {
+		return false
+	}
+	if n.Kind == notifyState {
+		// Reminders of a silenced outage are not made up for later.
+		return n.Status != "up"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byAlert := s.held[url]
+	if n.Status == alertResolved {
+		if _, ok := byAlert[n.alertKey()]; ok {
+			delete(byAlert, n.alertKey())
+			return true
+		}
+		return false
+	}
+	if byAlert == nil {
+		byAlert = make(map[string]notification)
+		s.held[url] = byAlert
+		time.AfterFunc(silence.End.Sub(now), func() { s.release(url) })
+	}
+	byAlert[n.alertKey()] = n
+	return true
+}
+
+// release sends the alerts held for url once it is no longer silenced.
+func (s *silencedAlerts) release(url string) {
+	now := time.Now()
+	if silence, ok := history.silenced(url, now); ok {
+		// The silence was replaced by a longer one.
+		time.AfterFunc(silence.End.Sub(now), func() { s.release(url) })
+		return
+	}
+	s.mu.Lock()
+	byAlert := s.held[url]
+	delete(s.held, url)
+	s.mu.Unlock()
+	if !targets.has(url) {
+		return
+	}
+	for _, n := range byAlert {
+		enqueueNotification(n)
+	}
+}
+
+// silenceHandler serves /monitors/{monitor}/silence:
+//
+//	GET    the monitor's silences, newest first
+//	POST   silence the monitor for a duration
+//	DELETE end the monitor's active silence early
+func silenceHandler(w http.ResponseWriter, r *http.Request, target Target) {
+	now := time.Now().UTC()
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, history.silences(target.URL))
+
+	case http.MethodPost:
+		var req SilenceRequest
+		if !decodeBody(w, r, &req, "silence") {
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, "a silence needs a reason")
+			return
+		}
+		if req.Duration <= 0 || time.Duration(req.Duration) > silenceMax {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidBody,
+				"duration must be a duration up to "+formatDuration(silenceMax))
+			return
+		}
+		s := Silence{
+			ID:     randomID(8),
+			Reason: req.Reason,
+			Start:  now,
+			End:    now.Add(time.Duration(req.Duration)),
+			Actor:  requestActor(r),
+		}
+		// A new silence replaces the one in force rather than stacking.
+		history.endSilences(target.URL, now)
+		history.addSilence(target.URL, s)
+		fmt.Printf("Silenced %s for %s by %s: %s\n", target.URL, formatDuration(time.Duration(req.Duration)), s.Actor, s.Reason)
+		audit.admin(r, "monitor.silence", target.URL, fmt.Sprintf("%s: %s", formatDuration(time.Duration(req.Duration)), s.Reason))
+		writeJSON(w, http.StatusCreated, s)
+
+	case http.MethodDelete:
+		ended := history.endSilences(target.URL, now)
+		if len(ended) == 0 {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, target.URL+" is not silenced")
+			return
+		}
+		fmt.Printf("Silence of %s ended early by %s\n", target.URL, requestActor(r))
+		silencedHeld.release(target.URL)
+		audit.admin(r, "monitor.unsilence", target.URL, "")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeProblem(w, r, http.StatusMethodNotAllowed, problemMethodNotAllowed, r.Method+" is not supported here")
+	}
+}
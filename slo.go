@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// SLOConfig is an availability objective for one monitor.
+type SLOConfig struct {
+	// Target is the objective in percent, e.g. 99.9.
+	Target float64 `json:"target"`
+	// Window is the rolling period the objective covers. Defaults to 30
+	// days and is capped by history retention.
+	Window Duration `json:"window,omitempty"`
+	// BurnRate alerts when the error budget is being spent this many times
+	// faster than the objective allows, measured over the last hour.
+	// Defaults to 14.4, which spends 2% of a 30-day budget in that hour.
+	BurnRate float64 `json:"burn_rate,omitempty"`
+}
+
+const (
+	defaultSLOWindow   = 30 * 24 * time.Hour
+	defaultSLOBurnRate = 14.4
+	sloBurnLookback    = time.Hour
+	sloEvaluateEvery   = time.Minute
+)
+
+func (c *SLOConfig) validate() error {
+	if c.Target <= 0 || c.Target >= 100 {
+		return fmt.Errorf("target must be between 0 and 100 exclusive, got %g", c.Target)
+	}
+	if c.BurnRate < 0 {
+		return fmt.Errorf("burn_rate must not be negative")
+	}
+	return nil
+}
+
+func (c *SLOConfig) window() time.Duration {
+	if c.Window > 0 {
+		return time.Duration(c.Window)
+	}
+	return defaultSLOWindow
+}
+
+func (c *SLOConfig) burnThreshold() float64 {
+	if c.BurnRate > 0 {
+		return c.BurnRate
+	}
+	return defaultSLOBurnRate
+}
+
+// SLO states. "burning" means the recent burn rate is above the alert
+// threshold; "exhausted" means no error budget is left in the window.
+const (
+	sloOK        = alertResolved
+	sloBurning   = "burning"
+	sloExhausted = "exhausted"
+)
+
+type SLOStatus struct {
+	Name          string   `json:"name"`
+	URL           string   `json:"url"`
+	Target        float64  `json:"target"`
+	Window        Duration `json:"window"`
+	UptimePercent float64  `json:"uptimePercent"`
+	// BudgetRemaining is the share of the error budget left, in percent. It
+	// goes negative once the objective has been missed.
+	BudgetRemaining float64 `json:"budgetRemaining"`
+	BurnRate        float64 `json:"burnRate"`
+	State           string  `json:"state"`
+}
+
+// evaluateSLO computes t's SLO status from history.
+func evaluateSLO(t Target, now time.Time) SLOStatus {
+	slo := t.SLO
+	s := SLOStatus{
+		Name:            t.displayName(),
+		URL:             t.URL,
+		Target:          slo.Target,
+		Window:          Duration(slo.window()),
+		UptimePercent:   100,
+		BudgetRemaining: 100,
+		State:           sloOK,
+	}
+	allowed := 1 - slo.Target/100
+
+	checks, up := countChecks(t.URL, now.Add(-slo.window()), now)
+	if checks > 0 {
+		s.UptimePercent = 100 * up / checks
+		s.BudgetRemaining = 100 * (1 - (checks-up)/(allowed*checks))
+	}
+	if checks, up := countChecks(t.URL, now.Add(-sloBurnLookback), now); checks > 0 {
+		s.BurnRate = (checks - up) / checks / allowed
+	}
+
+	switch {
+	case s.BudgetRemaining <= 0:
+		s.State = sloExhausted
+	case s.BurnRate >= slo.burnThreshold():
+		s.State = sloBurning
+	}
+	return s
+}
+
+// countChecks returns the weight of url's results in [from, to) and that
+// of its up results.
+func countChecks(url string, from, to time.Time) (checks, up float64) {
+	for _, b := range history.buckets(url, from, to) {
+		total, ups := b.weights()
+		checks += total
+		up += ups
+	}
+	return checks, up
+}
+
+// sloStatuses evaluates every target that has an SLO, sorted by URL.
+func sloStatuses(now time.Time) []SLOStatus {
+	out := []SLOStatus{}
+	for _, url := range targets.urls() {
+		if t, ok := targets.get(url); ok && t.SLO != nil {
+			out = append(out, evaluateSLO(t, now))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	return out
+}
+
+// startSLOTracking re-evaluates SLOs every minute and notifies when a
+// monitor's SLO state changes.
+func startSLOTracking() {
+	states := make(map[string]string)
+	go func() {
+		for range time.Tick(sloEvaluateEvery) {
+			for _, s := range sloStatuses(time.Now()) {
+				last, seen := states[s.URL]
+				states[s.URL] = s.State
+				if (!seen && s.State == sloOK) || s.State == last {
+					continue
+				}
+				t, _ := targets.get(s.URL)
+				enqueueNotification(notification{
+					Kind:   notifySLO,
+					Target: t,
+					Status: s.State,
+					Detail: s.summary(),
+					Time:   time.Now().UTC(),
+				})
+			}
+		}
+	}()
+}
+
+func (s SLOStatus) summary() string {
+	switch s.State {
+	case sloExhausted:
+		return fmt.Sprintf("Error budget for %s is exhausted: %.3f%% uptime against a %g%% objective over %s",
+			s.Name, s.UptimePercent, s.Target, time.Duration(s.Window))
+	case sloBurning:
+		return fmt.Sprintf("Error budget for %s is burning %.1fx faster than allowed, %.1f%% remaining",
+			s.Name, s.BurnRate, s.BudgetRemaining)
+	}
+	return fmt.Sprintf("Error budget for %s is back within limits, %.1f%% remaining", s.Name, s.BudgetRemaining)
+}
+
+// sloHandler serves GET /slo with the SLO status of every monitor that has
+// one.
+func sloHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	scope := requestScope(r)
+	out := []SLOStatus{}
+	for _, s := range sloStatuses(time.Now()) {
+		if scope.canSee(s.URL) {
+			out = append(out, s)
+		}
+	}
+	writeJSONCached(w, r, out)
+}
@@ -0,0 +1,681 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SNMPCheckConfig configures "snmp" monitors, whose url is
+// snmp://host[:port]. Each check reads one OID with a GET request.
+type SNMPCheckConfig struct {
+	// Version is "2c" (the default) or "3".
+	Version string `json:"version,omitempty"`
+	// Community authenticates version 2c requests. Defaults to "public".
+	Community string `json:"community,omitempty"`
+	// OID is the object to read, e.g. "1.3.6.1.2.1.33.1.2.4.0" for a UPS's
+	// remaining battery charge.
+	OID string `json:"oid"`
+	// Expect is a condition on the value, e.g. "value >= 50". Numeric
+	// values are numbers and everything else is a string. Without it, the
+	// check passes whenever the OID exists.
+	Expect string `json:"expect,omitempty"`
+	// Timeout is how long each attempt waits. Defaults to 2s.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Retries is how many times a request is re-sent after a timeout.
+	// Defaults to 1.
+	Retries int `json:"retries,omitempty"`
+
+	// User, AuthProtocol ("md5" or "sha") and AuthPassword authenticate
+	// version 3 requests, and PrivProtocol ("des" or "aes") with
+	// PrivPassword encrypts them. Leaving the protocols empty selects
+	// noAuthNoPriv or authNoPriv.
+	User         string `json:"user,omitempty"`
+	AuthProtocol string `json:"auth_protocol,omitempty"`
+	AuthPassword string `json:"auth_password,omitempty"`
+	PrivProtocol string `json:"priv_protocol,omitempty"`
+	PrivPassword string `json:"priv_password,omitempty"`
+}
+
+const snmpType = "snmp"
+
+func (c *SNMPCheckConfig) validate() error {
+	if _, err := berOID(c.OID); err != nil {
+		return err
+	}
+	if c.Expect != "" {
+		if _, err := compileExpr(c.Expect); err != nil {
+			return fmt.Errorf("expect: %w", err)
+		}
+	}
+	switch c.Version {
+	case "", "2c":
+		return nil
+	case "3":
+	default:
+		return fmt.Errorf("unknown SNMP version %q; use 2c or 3", c.Version)
+	}
+	if c.User == "" {
+		return fmt.Errorf("SNMP v3 needs a user")
+	}
+	switch c.AuthProtocol {
+	case "":
+		if c.PrivProtocol != "" {
+			return fmt.Errorf("priv_protocol needs an auth_protocol")
+		}
+	case "md5", "sha":
+		if len(c.AuthPassword) < 8 {
+			return fmt.Errorf("auth_password must be at least 8 characters")
+		}
+	default:
+		return fmt.Errorf("unknown auth_protocol %q; use md5 or sha", c.AuthProtocol)
+	}
+	switch c.PrivProtocol {
+	case "":
+	case "des", "aes":
+		if len(c.PrivPassword) < 8 {
+			return fmt.Errorf("priv_password must be at least 8 characters")
+		}
+	default:
+		return fmt.Errorf("unknown priv_protocol %q; use des or aes", c.PrivProtocol)
+	}
+	return nil
+}
+
+// probeSNMP reads the configured OID and checks its value.
+func probeSNMP(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	cfg := target.SNMP
+	if cfg == nil {
+		result.Detail = "snmp monitors need snmp settings"
+		return result
+	}
+	u, err := url.Parse(target.URL)
+	if err != nil || u.Scheme != "snmp" || u.Hostname() == "" {
+		result.Detail = "snmp monitors need a snmp://host[:port] url"
+		return result
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "161")
+	}
+	if target.dialAddr != "" {
+		addr = target.dialAddr
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(strings.Trim(addr, "[]"), "161")
+		}
+	}
+
+	start := time.Now()
+	value, err := snmpGet(target, addr, cfg)
+	result.Latency = Duration(time.Since(start))
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	result.Detail = fmt.Sprintf("%s = %v", strings.TrimPrefix(cfg.OID, "."), value)
+	if cfg.Expect == "" {
+		result.Status = "up"
+		return result
+	}
+	ok, err := evalCondition(cfg.Expect, exprEnv{"value": value, "latency": time.Duration(result.Latency)})
+	switch {
+	case err != nil:
+		result.Detail += ": expect: " + err.Error()
+	case ok:
+		result.Status = "up"
+	default:
+		result.Detail += ": expectation not met"
+	}
+	return result
+}
+
+// snmpGet reads oid from the agent at addr. Numeric values are returned as
+// float64 and everything else as a string.
+func snmpGet(target Target, addr string, cfg *SNMPCheckConfig) (any, error) {
+	conn, err := dialCheck(target, "udp", addr, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	s := &snmpSession{conn: conn, cfg: cfg}
+	oid, _ := berOID(cfg.OID)
+	var pdu berValue
+	if cfg.Version == "3" {
+		pdu, err = s.getV3(oid)
+	} else {
+		pdu, err = s.getV2c(oid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snmpResponseValue(pdu)
+}
+
+type snmpSession struct {
+	conn net.Conn
+	cfg  *SNMPCheckConfig
+
+	// Version 3 state learned from the agent.
+	engineID           []byte
+	boots, engineTime  int64
+	authKey, privKey   []byte
+	newHash            func() hash.Hash
+	authFlag, privFlag bool
+}
+
+// exchange sends req and returns the first reply, re-sending on timeouts.
+func (s *snmpSession) exchange(req []byte) ([]byte, error) {
+	timeout := time.Duration(s.cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	retries := s.cfg.Retries
+	if retries <= 0 {
+		retries = 1
+	}
+	buf := make([]byte, 65535)
+	var err error
+	for i := 0; i <= retries; i++ {
+		s.conn.SetDeadline(time.Now().Add(timeout))
+		if _, err = s.conn.Write(req); err != nil {
+			return nil, err
+		}
+		var n int
+		if n, err = s.conn.Read(buf); err == nil {
+			return buf[:n], nil
+		}
+		var ne net.Error
+		if !errors.As(err, &ne) || !ne.Timeout() {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("no SNMP response: %w", err)
+}
+
+func snmpGetPDU(requestID int64, oid []byte) []byte {
+	varbind := berTLV(0x30, berTLV(0x06, oid), []byte{0x05, 0x00})
+	return berTLV(0xa0, berInt(requestID), berInt(0), berInt(0), berTLV(0x30, varbind))
+}
+
+func snmpRequestID() int64 {
+	var b [4]byte
+	rand.Read(b[:])
+	return int64(binary.BigEndian.Uint32(b[:]) & 0x7fffffff)
+}
+
+func (s *snmpSession) getV2c(oid []byte) (berValue, error) {
+	community := s.cfg.Community
+	if community == "" {
+		community = "public"
+	}
+	msg := berTLV(0x30, berInt(1), berTLV(0x04, []byte(community)), snmpGetPDU(snmpRequestID(), oid))
+	reply, err := s.exchange(msg)
+	if err != nil {
+		return berValue{}, err
+	}
+	parts, err := berSequence(reply)
+	if err != nil || len(parts) != 3 {
+		return berValue{}, fmt.Errorf("malformed SNMP response")
+	}
+	return parts[2], nil
+}
+
+// USM statistics an agent reports instead of answering a v3 request.
+var snmpReports = map[string]string{
+	"1.3.6.1.6.3.15.1.1.1.0": "unsupported security level",
+	"1.3.6.1.6.3.15.1.1.2.0": "not in time window",
+	"1.3.6.1.6.3.15.1.1.3.0": "unknown user name",
+	"1.3.6.1.6.3.15.1.1.4.0": "unknown engine ID",
+	"1.3.6.1.6.3.15.1.1.5.0": "wrong digest, check auth_password",
+	"1.3.6.1.6.3.15.1.1.6.0": "decryption error, check priv_password",
+}
+
+func (s *snmpSession) getV3(oid []byte) (berValue, error) {
+	// Discover the agent's engine ID, boots and time.
+	if _, _, err := s.sendV3(nil); err != nil && s.engineID == nil {
+		return berValue{}, err
+	}
+	if len(s.engineID) == 0 {
+		return berValue{}, fmt.Errorf("SNMP agent did not report its engine ID")
+	}
+	if s.cfg.AuthProtocol != "" {
+		s.newHash, s.authFlag = md5.New, true
+		if s.cfg.AuthProtocol == "sha" {
+			s.newHash = sha1.New
+		}
+		s.authKey = snmpLocalizedKey(s.newHash, s.cfg.AuthPassword, s.engineID)
+		if s.cfg.PrivProtocol != "" {
+			s.privKey = snmpLocalizedKey(s.newHash, s.cfg.PrivPassword, s.engineID)
+			s.privFlag = true
+		}
+	}
+	// A report that the clock is off carries the agent's current time, so
+	// one retry is enough.
+	var pdu berValue
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var report string
+		pdu, report, err = s.sendV3(oid)
+		if err != nil {
+			return berValue{}, err
+		}
+		if report == "" {
+			return pdu, nil
+		}
+		err = fmt.Errorf("SNMP agent reported: %s", report)
+		if report != snmpReports["1.3.6.1.6.3.15.1.1.2.0"] {
+			break
+		}
+	}
+	return berValue{}, err
+}
+
+// sendV3 sends a v3 GET of oid, or a discovery request when oid is nil, and
+// returns the response PDU or the report the agent sent instead.
+func (s *snmpSession) sendV3(oid []byte) (berValue, string, error) {
+	msgID := snmpRequestID()
+	var pdu []byte
+	if oid == nil {
+		pdu = berTLV(0xa0, berInt(msgID), berInt(0), berInt(0), berTLV(0x30))
+	} else {
+		pdu = snmpGetPDU(msgID, oid)
+	}
+	flags := byte(0x04) // reportable
+	user := []byte(nil)
+	authParams, privParams := []byte(nil), []byte(nil)
+	scoped := berTLV(0x30, berTLV(0x04, s.engineID), berTLV(0x04, nil), pdu)
+	msgData := scoped
+	if oid != nil {
+		user = []byte(s.cfg.User)
+		if s.authFlag {
+			flags |= 0x01
+			authParams = make([]byte, 12)
+		}
+		if s.privFlag {
+			flags |= 0x02
+			var err error
+			var encrypted []byte
+			if encrypted, privParams, err = s.encrypt(scoped); err != nil {
+				return berValue{}, "", err
+			}
+			msgData = berTLV(0x04, encrypted)
+		}
+	}
+	secParams := berTLV(0x30, berTLV(0x04, s.engineID), berInt(s.boots), berInt(s.engineTime),
+		berTLV(0x04, user), berTLV(0x04, authParams), berTLV(0x04, privParams))
+	global := berTLV(0x30, berInt(msgID), berInt(65507), berTLV(0x04, []byte{flags}), berInt(3))
+	msg := berTLV(0x30, berInt(3), global, berTLV(0x04, secParams), msgData)
+	if authParams != nil {
+		i := bytes.Index(msg, append([]byte{0x04, 12}, authParams...)) + 2
+		copy(msg[i:i+12], s.mac(msg))
+	}
+
+	reply, err := s.exchange(msg)
+	if err != nil {
+		return berValue{}, "", err
+	}
+	return s.parseV3(reply)
+}
+
+func (s *snmpSession) parseV3(reply []byte) (berValue, string, error) {
+	malformed := fmt.Errorf("malformed SNMP v3 response")
+	parts, err := berSequence(reply)
+	if err != nil || len(parts) != 4 {
+		return berValue{}, "", malformed
+	}
+	global, err := berChildren(parts[1].content)
+	if err != nil || len(global) != 4 || len(global[2].content) != 1 {
+		return berValue{}, "", malformed
+	}
+	flags := global[2].content[0]
+	sec, err := berSequence(parts[2].content)
+	if err != nil || len(sec) != 6 {
+		return berValue{}, "", malformed
+	}
+	s.engineID = sec[0].content
+	s.boots, s.engineTime = berIntValue(sec[1].content), berIntValue(sec[2].content)
+
+	if flags&0x01 != 0 && s.authFlag {
+		got := sec[4].content
+		raw := append([]byte(nil), reply...)
+		i := bytes.Index(raw, append([]byte{0x04, 12}, got...))
+		if len(got) != 12 || i < 0 {
+			return berValue{}, "", malformed
+		}
+		copy(raw[i+2:i+14], make([]byte, 12))
+		if !hmac.Equal(got, s.mac(raw)) {
+			return berValue{}, "", fmt.Errorf("SNMP response failed authentication")
+		}
+	}
+	scopedRaw := parts[3]
+	if flags&0x02 != 0 {
+		if !s.privFlag || scopedRaw.tag != 0x04 {
+			return berValue{}, "", malformed
+		}
+		plain, err := s.decrypt(scopedRaw.content, sec[5].content)
+		if err != nil {
+			return berValue{}, "", err
+		}
+		if scopedRaw, _, err = berRead(plain); err != nil {
+			return berValue{}, "", malformed
+		}
+	}
+	scoped, err := berChildren(scopedRaw.content)
+	if err != nil || len(scoped) != 3 {
+		return berValue{}, "", malformed
+	}
+	pdu := scoped[2]
+	if pdu.tag == 0xa8 {
+		report := "unknown report"
+		if fields, err := berChildren(pdu.content); err == nil && len(fields) == 4 {
+			if vbs, err := berChildren(fields[3].content); err == nil && len(vbs) > 0 {
+				if vb, err := berChildren(vbs[0].content); err == nil && len(vb) == 2 {
+					oid := berOIDString(vb[0].content)
+					if r, ok := snmpReports[oid]; ok {
+						report = r
+					} else {
+						report = oid
+					}
+				}
+			}
+		}
+		return pdu, report, nil
+	}
+	return pdu, "", nil
+}
+
+func (s *snmpSession) mac(msg []byte) []byte {
+	m := hmac.New(s.newHash, s.authKey)
+	m.Write(msg)
+	return m.Sum(nil)[:12]
+}
+
+// snmpLocalizedKey derives a user's key for one engine (RFC 3414 A.2).
+func snmpLocalizedKey(newHash func() hash.Hash, password string, engineID []byte) []byte {
+	h := newHash()
+	buf := make([]byte, 64)
+	for i, n := 0, 0; n < 1<<20; n += len(buf) {
+		for j := range buf {
+			buf[j] = password[i%len(password)]
+			i++
+		}
+		h.Write(buf)
+	}
+	ku := h.Sum(nil)
+	h.Reset()
+	h.Write(ku)
+	h.Write(engineID)
+	h.Write(ku)
+	return h.Sum(nil)
+}
+
+// encrypt encrypts a scoped PDU with DES-CBC (RFC 3414) or AES-128-CFB
+// (RFC 3826), returning it with the salt that goes in privParams.
+func (s *snmpSession) encrypt(plain []byte) (ciphertext, salt []byte, err error) {
+	salt = make([]byte, 8)
+	if s.cfg.PrivProtocol == "aes" {
+		rand.Read(salt)
+		block, err := aes.NewCipher(s.privKey[:16])
+		if err != nil {
+			return nil, nil, err
+		}
+		ciphertext = make([]byte, len(plain))
+		cipher.NewCFBEncrypter(block, s.aesIV(s.boots, s.engineTime, salt)).XORKeyStream(ciphertext, plain)
+		return ciphertext, salt, nil
+	}
+	binary.BigEndian.PutUint32(salt, uint32(s.boots))
+	rand.Read(salt[4:])
+	block, err := des.NewCipher(s.privKey[:8])
+	if err != nil {
+		return nil, nil, err
+	}
+	padded := append([]byte(nil), plain...)
+	if r := len(padded) % 8; r != 0 {
+		padded = append(padded, make([]byte, 8-r)...)
+	}
+	ciphertext = make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, s.desIV(salt)).CryptBlocks(ciphertext, padded)
+	return ciphertext, salt, nil
+}
+
+func (s *snmpSession) decrypt(ciphertext, salt []byte) ([]byte, error) {
+	if len(salt) != 8 {
+		return nil, fmt.Errorf("malformed SNMP privacy parameters")
+	}
+	plain := make([]byte, len(ciphertext))
+	if s.cfg.PrivProtocol == "aes" {
+		block, err := aes.NewCipher(s.privKey[:16])
+		if err != nil {
+			return nil, err
+		}
+		cipher.NewCFBDecrypter(block, s.aesIV(s.boots, s.engineTime, salt)).XORKeyStream(plain, ciphertext)
+		return plain, nil
+	}
+	if len(ciphertext)%8 != 0 {
+		return nil, fmt.Errorf("malformed SNMP encrypted PDU")
+	}
+	block, err := des.NewCipher(s.privKey[:8])
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCBCDecrypter(block, s.desIV(salt)).CryptBlocks(plain, ciphertext)
+	return plain, nil
+}
+
+func (s *snmpSession) aesIV(boots, engineTime int64, salt []byte) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+	copy(iv[8:], salt)
+	return iv
+}
+
+func (s *snmpSession) desIV(salt []byte) []byte {
+	iv := make([]byte, 8)
+	for i := range iv {
+		iv[i] = s.privKey[8+i] ^ salt[i]
+	}
+	return iv
+}
+
+// snmpResponseValue extracts the value of the only variable in a response
+// PDU.
+func snmpResponseValue(pdu berValue) (any, error) {
+	fields, err := berChildren(pdu.content)
+	if pdu.tag != 0xa2 || err != nil || len(fields) != 4 {
+		return nil, fmt.Errorf("malformed SNMP response")
+	}
+	if status := berIntValue(fields[1].content); status != 0 {
+		return nil, fmt.Errorf("SNMP error status %d", status)
+	}
+	vbs, err := berChildren(fields[3].content)
+	if err != nil || len(vbs) != 1 {
+		return nil, fmt.Errorf("malformed SNMP response")
+	}
+	vb, err := berChildren(vbs[0].content)
+	if err != nil || len(vb) != 2 {
+		return nil, fmt.Errorf("malformed SNMP response")
+	}
+	v := vb[1]
+	switch v.tag {
+	case 0x02: // INTEGER
+		return float64(berIntValue(v.content)), nil
+	case 0x41, 0x42, 0x43, 0x46: // Counter32, Gauge32, TimeTicks, Counter64
+		var n uint64
+		for _, b := range v.content {
+			n = n<<8 | uint64(b)
+		}
+		return float64(n), nil
+	case 0x04, 0x44: // OCTET STRING, Opaque
+		return string(v.content), nil
+	case 0x06:
+		return berOIDString(v.content), nil
+	case 0x40: // IpAddress
+		return net.IP(v.content).String(), nil
+	case 0x80:
+		return nil, fmt.Errorf("no such object")
+	case 0x81:
+		return nil, fmt.Errorf("no such instance")
+	case 0x82:
+		return nil, fmt.Errorf("end of MIB view")
+	}
+	return nil, fmt.Errorf("unsupported SNMP value type 0x%02x", v.tag)
+}
+
+// Minimal BER encoding, enough for SNMP.
+
+type berValue struct {
+	tag     byte
+	content []byte
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berTLV(tag byte, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	out := append([]byte{tag}, berLength(len(body))...)
+	return append(out, body...)
+}
+
+func berInt(v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		if v >= -128 && v < 128 {
+			break
+		}
+		v >>= 8
+	}
+	return berTLV(0x02, b)
+}
+
+func berIntValue(b []byte) int64 {
+	if len(b) == 0 {
+		return 0
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// berOID encodes a dotted OID such as "1.3.6.1.2.1.1.3.0".
+func berOID(s string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		arcs[i] = n
+	}
+	if arcs[0] > 2 || arcs[1] >= 40 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	out := []byte{byte(arcs[0]*40 + arcs[1])}
+	for _, n := range arcs[2:] {
+		var enc []byte
+		enc = append(enc, byte(n&0x7f))
+		for n >>= 7; n > 0; n >>= 7 {
+			enc = append([]byte{byte(n&0x7f) | 0x80}, enc...)
+		}
+		out = append(out, enc...)
+	}
+	return out, nil
+}
+
+func berOIDString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	arcs := []string{strconv.Itoa(int(b[0]) / 40), strconv.Itoa(int(b[0]) % 40)}
+	var n uint64
+	for _, c := range b[1:] {
+		n = n<<7 | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			arcs = append(arcs, strconv.FormatUint(n, 10))
+			n = 0
+		}
+	}
+	return strings.Join(arcs, ".")
+}
+
+// berRead reads one TLV from b.
+func berRead(b []byte) (v berValue, rest []byte, err error) {
+	if len(b) < 2 {
+		return v, nil, errors.New("truncated BER value")
+	}
+	v.tag = b[0]
+	n, i := int(b[1]), 2
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 || len(b) < 2+size {
+			return v, nil, errors.New("invalid BER length")
+		}
+		n = 0
+		for _, c := range b[2 : 2+size] {
+			n = n<<8 | int(c)
+		}
+		i += size
+	}
+	if n < 0 || len(b) < i+n {
+		return v, nil, errors.New("truncated BER value")
+	}
+	v.content = b[i : i+n]
+	return v, b[i+n:], nil
+}
+
+// berChildren splits the content of a constructed value.
+func berChildren(b []byte) ([]berValue, error) {
+	var out []berValue
+	for len(b) > 0 {
+		v, rest, err := berRead(b)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		b = rest
+	}
+	return out, nil
+}
+
+// berSequence reads a SEQUENCE from b and returns its elements.
+func berSequence(b []byte) ([]berValue, error) {
+	v, _, err := berRead(b)
+	if err != nil {
+		return nil, err
+	}
+	if v.tag != 0x30 {
+		return nil, errors.New("expected a BER sequence")
+	}
+	return berChildren(v.content)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// defaultSource is the source address or interface for checks of monitors
+// that set none, from the agent's -source flag.
+var defaultSource string
+
+// source returns the local address or interface t's checks are sent from,
+// or "" for the system's choice.
+func (t Target) source() string {
+	if t.Source != "" {
+		return t.Source
+	}
+	return defaultSource
+}
+
+// sourceIP resolves a source setting: an IP address, or an interface name
+// standing for its first IPv4 address, or its first global IPv6 address
+// if it has no IPv4 one.
+func sourceIP(source string) (net.IP, error) {
+	if ip := net.ParseIP(source); ip != nil {
+		return ip, nil
+	}
+	iface, err := net.InterfaceByName(source)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither an IP address nor an interface", source)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var v6 net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP, nil
+		}
+		if v6 == nil && ipnet.IP.IsGlobalUnicast() {
+			v6 = ipnet.IP
+		}
+	}
+	if v6 == nil {
+		return nil, fmt.Errorf("interface %s has no usable address", source)
+	}
+	return v6, nil
+}
+
+// checkDialer returns a dialer for one of target's checks over network,
+// bound to its source address when it has one. Remote addresses of the
+// other IP family are then skipped.
+func checkDialer(target Target, network string, timeout time.Duration) (*net.Dialer, error) {
+	d := &net.Dialer{Timeout: timeout}
+	source := target.source()
+	if source == "" {
+		return d, nil
+	}
+	ip, err := sourceIP(source)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(network, "udp") {
+		d.LocalAddr = &net.UDPAddr{IP: ip}
+	} else {
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return d, nil
+}
+
+// dialCheck connects to addr over network for one of target's checks.
+func dialCheck(target Target, network, addr string, timeout time.Duration) (net.Conn, error) {
+	d, err := checkDialer(target, network, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if dnsCache != nil {
+		return dnsCache.dial(context.Background(), d, target, network, addr)
+	}
+	return d.Dial(network, addr)
+}
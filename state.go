@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// MonitorStatus is a monitor's overall status. It encodes as "up", "down"
+// or "unknown" in JSON.
+type MonitorStatus int
+
+const (
+	// StatusUnknown is a monitor that has not been checked yet.
+	StatusUnknown MonitorStatus = iota
+	StatusUp
+	StatusDown
+)
+
+func (s MonitorStatus) String() string {
+	switch s {
+	case StatusUp:
+		return "up"
+	case StatusDown:
+		return "down"
+	}
+	return "unknown"
+}
+
+func (s MonitorStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *MonitorStatus) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "up":
+		*s = StatusUp
+	case "down":
+		*s = StatusDown
+	case "unknown", "":
+		*s = StatusUnknown
+	default:
+		return fmt.Errorf("unknown status %q", b)
+	}
+	return nil
+}
+
+// resultStatus is the status a single check result reports. Results keep
+// plain strings on the wire between agents and the coordinator.
+func resultStatus(r CheckResult) MonitorStatus {
+	switch r.Status {
+	case "up":
+		return StatusUp
+	case "down":
+		return StatusDown
+	}
+	return StatusUnknown
+}
+
+// MonitorState is everything the monitor currently knows about one
+// monitor's health.
+type MonitorState struct {
+	URL    string        `json:"url"`
+	Status MonitorStatus `json:"status"`
+	// Since is when the monitor entered Status, in UTC.
+	Since time.Time `json:"since"`
+	// LastChecked is when the latest check result arrived, in UTC.
+	LastChecked time.Time `json:"lastChecked"`
+	// LastError is the detail of the latest failed check. It is kept after
+	// the monitor recovers, as a hint of what went wrong last.
+	LastError string `json:"lastError,omitempty"`
+	// LastFailure is the failure class of that check, e.g. "tls".
+	LastFailure string   `json:"lastFailure,omitempty"`
+	LastLatency Duration `json:"lastLatency"`
+	// Components are the component statuses of a health monitor, as of
+	// its latest check.
+	Components []HealthComponent `json:"components,omitempty"`
+	// CheckCount is how many results have been recorded since startup,
+	// from every location.
+	CheckCount uint64 `json:"checkCount"`
+	// Locations is the latest status seen from each vantage point. It is
+	// only present when agents are configured.
+	Locations []LocationStatus `json:"locations,omitempty"`
+	// Metadata is the monitor's configured metadata. It is filled in by
+	// /status/monitor rather than kept in the store.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Interval is the current wait between checks of a monitor with an
+	// adaptive interval. It is filled in by /status/monitor too.
+	Interval Duration `json:"interval,omitempty"`
+}
+
+// entry is the part of s served by /status, which changes only when the
+// status does.
+func (s MonitorState) entry() StatusEntry {
+	return StatusEntry{URL: s.URL, Status: s.Status, Locations: s.Locations, Since: s.Since}
+}
+
+func monitorStateHandler(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+	if !knownMonitor(w, r, url) {
+		return
+	}
+	state, ok := statuses.get(url)
+	if !ok {
+		state = MonitorState{URL: url}
+	}
+	if t, ok := targets.get(url); ok {
+		state.Metadata = t.Metadata
+	}
+	state.Interval = Duration(adaptive.current(url))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSONCached(w, r, state)
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatusSubscribersConfig lets visitors of a public status page subscribe
+// by email to incidents of the groups they choose, through /updates.
+type StatusSubscribersConfig struct {
+	// File keeps subscribers across restarts.
+	File string `json:"file"`
+	// PublicURL is where visitors reach the API, e.g.
+	// "https://status.example.com/api". Confirm and unsubscribe links in
+	// emails point there.
+	PublicURL string `json:"public_url"`
+	// PageURL, when set, is where visitors are sent after following a
+	// confirm or unsubscribe link, with ?subscription=confirmed or
+	// unsubscribed. Otherwise a short text is shown.
+	PageURL string `json:"page_url"`
+	// Groups are the monitor groups visitors may subscribe to. Empty offers
+	// every group.
+	Groups []string `json:"groups"`
+	// Email sends the messages. Defaults to the global email settings; the
+	// recipient is ignored.
+	Email *EmailConfig `json:"email"`
+	// PendingFor is how long a subscription waits for its confirmation
+	// before it is dropped. Defaults to 48h.
+	PendingFor Duration `json:"pending_for"`
+}
+
+// StatusSubscriber is one visitor subscribed to incident emails.
+type StatusSubscriber struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	// Groups limits emails to incidents of those groups. Empty is every
+	// offered group.
+	Groups    []string  `json:"groups,omitempty"`
+	Confirmed bool      `json:"confirmed"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Token is the secret in the subscriber's confirm and unsubscribe
+	// links. It is never returned by the API.
+	Token string `json:"token,omitempty"`
+	// ConfirmSentAt is when the last confirmation email went out, while
+	// the subscription is pending.
+	ConfirmSentAt *time.Time `json:"confirmSentAt,omitempty"`
+}
+
+// confirmResendAfter is how long a pending subscription waits before
+// subscribing the address again sends another confirmation, so the
+// endpoint cannot be used to flood someone's inbox.
+const confirmResendAfter = 15 * time.Minute
+
+// unsubscribePage asks a visitor who followed an unsubscribe link to
+// confirm, since mail gateways follow links in emails to scan them.
+const unsubscribePage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body><form method="post" action="?token=%s"><p>Stop receiving status updates?</p><button type="submit">Unsubscribe</button></form></body></html>
+`
+
+func (s StatusSubscriber) wants(group string) bool {
+	if len(s.Groups) == 0 {
+		return true
+	}
+	for _, g := range s.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+type subscriberStore struct {
+	config     StatusSubscribersConfig
+	email      EmailConfig
+	pendingFor time.Duration
+
+	mu   sync.Mutex
+	subs map[string]*StatusSubscriber
+}
+
+// statusSubscribers is nil unless status_subscribers is configured.
+var statusSubscribers *subscriberStore
+
+func newSubscriberStore(config StatusSubscribersConfig, email EmailConfig) (*subscriberStore, error) {
+	if config.PublicURL == "" {
+		return nil, errors.New("public_url is required for the links in emails")
+	}
+	config.PublicURL = strings.TrimSuffix(config.PublicURL, "/")
+	if config.Email != nil {
+		email = *config.Email
+	}
+	email.OnCall, email.CorrelationWindow = "", 0
+	s := &subscriberStore{config: config, email: email, pendingFor: time.Duration(config.PendingFor), subs: make(map[string]*StatusSubscriber)}
+	if s.pendingFor <= 0 {
+		s.pendingFor = 48 * time.Hour
+	}
+	if config.File != "" {
+		b, err := os.ReadFile(config.File)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			var list []*StatusSubscriber
+			if err := json.Unmarshal(b, &list); err != nil {
+				return nil, err
+			}
+			for _, sub := range list {
+				s.subs[sub.ID] = sub
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *subscriberStore) name() string { return "subscribers" }
+
+// save must be called with s.mu held.
+func (s *subscriberStore) save() {
+	if s.config.File == "" {
+		return
+	}
+	b, err := json.Marshal(s.sorted())
+	if err == nil {
+		tmp := s.config.File + ".tmp"
+		if err = os.WriteFile(tmp, b, 0o600); err == nil {
+			err = os.Rename(tmp, s.config.File)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error saving status subscribers:", err)
+	}
+}
+
+// sorted must be called with s.mu held.
+func (s *subscriberStore) sorted() []*StatusSubscriber {
+	list := make([]*StatusSubscriber, 0, len(s.subs))
+	for _, sub := range s.subs {
+		list = append(list, sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// prune drops subscriptions left unconfirmed for pendingFor. It must be
+// called with s.mu held.
+func (s *subscriberStore) prune(now time.Time) {
+	for id, sub := range s.subs {
+		if !sub.Confirmed && now.Sub(sub.CreatedAt) > s.pendingFor {
+			delete(s.subs, id)
+		}
+	}
+}
+
+// groups returns the groups visitors may subscribe to.
+func (s *subscriberStore) groups() []string {
+	if len(s.config.Groups) > 0 {
+		return s.config.Groups
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for _, u := range targets.urls() {
+		if t, ok := targets.get(u); ok && t.Group != "" && !seen[t.Group] {
+			seen[t.Group] = true
+			out = append(out, t.Group)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *subscriberStore) offers(group string) bool {
+	for _, g := range s.groups() {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *subscriberStore) link(action, token string) string {
+	return s.config.PublicURL + "/updates/" + action + "?token=" + url.QueryEscape(token)
+}
+
+// send mails one subscriber, with an unsubscribe link unless the
+// subscription is still unconfirmed.
+func (s *subscriberStore) send(sub StatusSubscriber, subject, body string) error {
+	config := s.email
+	config.Recipient = sub.Email
+	var headers map[string]string
+	if sub.Confirmed {
+		unsubscribe := s.link("unsubscribe", sub.Token)
+		body += "\n" + message(config.Locale, "unsubscribe") + " " + unsubscribe + "\n"
+		headers = map[string]string{"List-Unsubscribe": "<" + unsubscribe + ">", "List-Unsubscribe-Post": "List-Unsubscribe=One-Click"}
+	}
+	return sendMailHeaders(config, subject, body, headers)
+}
+
+// notify emails confirmed subscribers when a monitor in a group they follow
+// goes down or comes back up. Public subscribers get no error details.
+func (s *subscriberStore) notify(n notification) error {
+	if n.Kind != notifyState || n.Reminder || n.Target.Group == "" || !s.offers(n.Target.Group) {
+		return errNotApplicable
+	}
+	locale, zone := s.email.Locale, zoneOrDefault(s.email.Timezone)
+	subject, body := "incident.opened", "incident.down"
+	if n.Status != "down" {
+		subject, body = "incident.closed", "incident.up"
+	}
+	subject, body = localize(locale, zone, subject, n), localize(locale, zone, body, n)+"\n"
+	s.mu.Lock()
+	var recipients []StatusSubscriber
+	for _, sub := range s.sorted() {
+		if sub.Confirmed && sub.wants(n.Target.Group) {
+			recipients = append(recipients, *sub)
+		}
+	}
+	s.mu.Unlock()
+	if len(recipients) == 0 {
+		return errNotApplicable
+	}
+	failed := 0
+	var lastErr error
+	for _, sub := range recipients {
+		if err := s.send(sub, subject, body); err != nil {
+			failed, lastErr = failed+1, err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d subscribers: %w", failed, len(recipients), lastErr)
+	}
+	if !dryRun {
+		fmt.Printf("Status update sent to %d subscribers for %s\n", len(recipients), n.Target.URL)
+	}
+	return nil
+}
+
+// subscribeRequest is the body of POST /updates/subscribe.
+type subscribeRequest struct {
+	Email  string   `json:"email"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// finish answers a visitor who followed a link from an email.
+func (s *subscriberStore) finish(w http.ResponseWriter, r *http.Request, result, text string) {
+	if s.config.PageURL != "" {
+		sep := "?"
+		if strings.Contains(s.config.PageURL, "?") {
+			sep = "&"
+		}
+		http.Redirect(w, r, s.config.PageURL+sep+"subscription="+result, http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, text)
+}
+
+// updatesHandler serves the public endpoints of status page subscriptions:
+//
+//	GET  /updates/groups
+//	POST /updates/subscribe
+//	GET  /updates/confirm?token=
+//	GET  /updates/unsubscribe?token=  (asks to confirm)
+//	POST /updates/unsubscribe?token=
+func updatesHandler(w http.ResponseWriter, r *http.Request) {
+	s := statusSubscribers
+	action := strings.TrimPrefix(r.URL.Path, "/updates/")
+	now := time.Now().UTC()
+	switch {
+	case action == "groups" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, append([]string{}, s.groups()...))
+
+	case action == "subscribe" && r.Method == http.MethodPost:
+		var req subscribeRequest
+		if !decodeBody(w, r, &req, "subscription") {
+			return
+		}
+		addr, err := mail.ParseAddress(req.Email)
+		if err != nil || addr.Address != strings.TrimSpace(req.Email) {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, "email must be a plain email address")
+			return
+		}
+		for _, g := range req.Groups {
+			if !s.offers(g) {
+				writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, "no group "+g)
+				return
+			}
+		}
+		s.mu.Lock()
+		s.prune(now)
+		// A known address gets a new pending subscription, which replaces
+		// the confirmed one once confirmed, so nobody but the owner of the
+		// address can change what it receives.
+		var sub *StatusSubscriber
+		for _, existing := range s.subs {
+			if !existing.Confirmed && strings.EqualFold(existing.Email, addr.Address) {
+				sub = existing
+			}
+		}
+		if sub == nil {
+			sub = &StatusSubscriber{ID: randomID(8), Email: addr.Address, CreatedAt: now, Token: randomID(16)}
+			s.subs[sub.ID] = sub
+		}
+		sub.Groups = req.Groups
+		resend := sub.ConfirmSentAt == nil || now.Sub(*sub.ConfirmSentAt) >= confirmResendAfter
+		if resend {
+			sub.ConfirmSentAt = &now
+		}
+		s.save()
+		pending := *sub
+		s.mu.Unlock()
+		if !resend {
+			// The confirmation sent a moment ago is still good.
+			writeJSON(w, http.StatusAccepted, map[string]string{"status": "confirmation sent"})
+			return
+		}
+		locale := s.email.Locale
+		body := message(locale, "confirm.body") + "\n" + s.link("confirm", pending.Token) + "\n"
+		if err := s.send(pending, message(locale, "confirm.subject"), body); err != nil {
+			fmt.Printf("Error sending status subscription confirmation to %s: %s\n", addr.Address, err)
+			// A confirmation that never went out may be retried at once.
+			s.mu.Lock()
+			sub.ConfirmSentAt = nil
+			s.mu.Unlock()
+			writeProblem(w, r, http.StatusBadGateway, problemDeliveryFailed, "the confirmation email could not be sent")
+			return
+		}
+		// The answer is the same for new and known addresses, so it doesn't
+		// tell who is subscribed.
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "confirmation sent"})
+
+	case action == "confirm" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		s.prune(now)
+		sub := s.byToken(r.URL.Query().Get("token"))
+		if sub != nil && !sub.Confirmed {
+			sub.Confirmed, sub.ConfirmSentAt = true, nil
+			for id, other := range s.subs {
+				if other != sub && strings.EqualFold(other.Email, sub.Email) {
+					delete(s.subs, id)
+				}
+			}
+			s.save()
+		}
+		s.mu.Unlock()
+		if sub == nil {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "the link has expired or was already used to unsubscribe")
+			return
+		}
+		fmt.Printf("Status subscriber %s confirmed\n", sub.ID)
+		s.finish(w, r, "confirmed", "Your subscription is confirmed.")
+
+	case action == "unsubscribe" && r.Method == http.MethodGet:
+		// Only a POST, from the page's button or a mail client's one-click
+		// unsubscribe (RFC 8058), unsubscribes.
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, unsubscribePage, html.EscapeString(url.QueryEscape(r.URL.Query().Get("token"))))
+
+	case action == "unsubscribe" && r.Method == http.MethodPost:
+		s.mu.Lock()
+		sub := s.byToken(r.URL.Query().Get("token"))
+		if sub != nil {
+			delete(s.subs, sub.ID)
+			s.save()
+		}
+		s.mu.Unlock()
+		if sub != nil {
+			fmt.Printf("Status subscriber %s unsubscribed\n", sub.ID)
+		}
+		// Unsubscribing twice is not an error.
+		s.finish(w, r, "unsubscribed", "You are unsubscribed.")
+
+	default:
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "no such endpoint")
+	}
+}
+
+// byToken must be called with s.mu held.
+func (s *subscriberStore) byToken(token string) *StatusSubscriber {
+	if token == "" {
+		return nil
+	}
+	for _, sub := range s.subs {
+		if sub.Token == token {
+			return sub
+		}
+	}
+	return nil
+}
+
+// subscribersHandler serves the admin endpoints of status page
+// subscriptions:
+//
+//	GET    /subscribers
+//	DELETE /subscribers/{id}
+func subscribersHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, "status subscribers require an admin key") {
+		return
+	}
+	s := statusSubscribers
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/subscribers"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		s.prune(time.Now())
+		out := []StatusSubscriber{}
+		for _, sub := range s.sorted() {
+			view := *sub
+			view.Token = ""
+			out = append(out, view)
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, out)
+
+	case id != "" && r.Method == http.MethodDelete:
+		s.mu.Lock()
+		sub, ok := s.subs[id]
+		if ok {
+			delete(s.subs, id)
+			s.save()
+		}
+		s.mu.Unlock()
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "no subscriber "+id)
+			return
+		}
+		audit.admin(r, "subscriber.delete", "", "id "+sub.ID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "no such endpoint")
+	}
+}
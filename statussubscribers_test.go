@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscribeThrottlesConfirmations(t *testing.T) {
+	s, err := newSubscriberStore(StatusSubscribersConfig{PublicURL: "https://status.example.com/api"}, EmailConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := statusSubscribers
+	statusSubscribers, dryRun = s, true
+	defer func() { statusSubscribers, dryRun = saved, false }()
+
+	subscribe := func() {
+		w := httptest.NewRecorder()
+		updatesHandler(w, httptest.NewRequest(http.MethodPost, "/updates/subscribe", strings.NewReader(`{"email":"visitor@example.com"}`)))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("subscribe answered %d: %s", w.Code, w.Body)
+		}
+	}
+	subscribe()
+	if len(s.subs) != 1 {
+		t.Fatalf("%d subscriptions, want 1", len(s.subs))
+	}
+	var sub *StatusSubscriber
+	for _, sub = range s.subs {
+		break
+	}
+	first := *sub.ConfirmSentAt
+	subscribe()
+	if !sub.ConfirmSentAt.Equal(first) {
+		t.Error("a second confirmation was sent right after the first")
+	}
+	earlier := first.Add(-confirmResendAfter)
+	sub.ConfirmSentAt = &earlier
+	subscribe()
+	if sub.ConfirmSentAt.Equal(earlier) {
+		t.Error("no new confirmation after the cooldown")
+	}
+}
+
+func TestUnsubscribeNeedsPost(t *testing.T) {
+	s, err := newSubscriberStore(StatusSubscribersConfig{PublicURL: "https://status.example.com/api"}, EmailConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := statusSubscribers
+	statusSubscribers = s
+	defer func() { statusSubscribers = saved }()
+	s.subs["a"] = &StatusSubscriber{ID: "a", Email: "visitor@example.com", Confirmed: true, CreatedAt: time.Now(), Token: "secret"}
+
+	w := httptest.NewRecorder()
+	updatesHandler(w, httptest.NewRequest(http.MethodGet, "/updates/unsubscribe?token=secret", nil))
+	if _, ok := s.subs["a"]; !ok {
+		t.Fatal("following the unsubscribe link unsubscribed without confirmation")
+	}
+	if !strings.Contains(w.Body.String(), `method="post"`) {
+		t.Errorf("unsubscribe page has no form: %s", w.Body)
+	}
+	updatesHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/updates/unsubscribe?token=secret", nil))
+	if _, ok := s.subs["a"]; ok {
+		t.Error("one-click unsubscribe did not unsubscribe")
+	}
+}
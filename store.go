@@ -0,0 +1,200 @@
+package main
+
+import (
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const storeShards = 64
+
+type storeShard struct {
+	mu sync.RWMutex
+	m  map[string]*MonitorState
+}
+
+// statusStore holds the MonitorState of every URL. State is split across
+// shards so concurrent checks don't contend on a single lock. Alongside the
+// shards it keeps a URL-sorted snapshot of every entry, patched in place on
+// each state change and stamped with a version, so the API can serve pages
+// without copying or sorting the whole set.
+type statusStore struct {
+	shards [storeShards]storeShard
+
+	snapMu  sync.RWMutex
+	entries []StatusEntry
+	stamp   snapshotStamp
+}
+
+// snapshotStamp identifies a snapshot and when it was taken, for ETag and
+// Last-Modified.
+type snapshotStamp struct {
+	version  uint64
+	modified time.Time
+}
+
+// bump must be called with snapMu held.
+func (s *statusStore) bump() {
+	s.stamp = snapshotStamp{version: s.stamp.version + 1, modified: time.Now()}
+}
+
+func newStatusStore() *statusStore {
+	s := &statusStore{}
+	for i := range s.shards {
+		s.shards[i].m = make(map[string]*MonitorState)
+	}
+	return s
+}
+
+func (s *statusStore) shard(url string) *storeShard {
+	h := fnv.New32a()
+	h.Write([]byte(url))
+	return &s.shards[h.Sum32()%storeShards]
+}
+
+// record folds r, from which the monitor's overall status across
+// locations was judged to be status, into the state of r.URL and returns
+// the state before it, zero if there was none. The snapshot version only
+// moves when something /status serves has changed.
+func (s *statusStore) record(r CheckResult, status MonitorStatus, locations []LocationStatus) MonitorState {
+	url := r.URL
+	sh := s.shard(url)
+	sh.mu.Lock()
+	var prev MonitorState
+	if st, ok := sh.m[url]; ok {
+		prev = *st
+	}
+	next := prev
+	next.URL = url
+	next.Status = status
+	if status != prev.Status {
+		next.Since = time.Now().UTC()
+	}
+	next.LastChecked = r.CheckedAt
+	if next.LastChecked.IsZero() {
+		next.LastChecked = time.Now().UTC()
+	}
+	if r.Status == "down" {
+		next.LastError, next.LastFailure = r.Detail, r.Failure
+	}
+	next.LastLatency = r.Latency
+	next.Components = r.Components
+	next.CheckCount++
+	next.Locations = locations
+	sh.m[url] = &next
+	sh.mu.Unlock()
+
+	s.patch(next.entry())
+	return prev
+}
+
+// patch puts e into the snapshot, bumping the version if it changed.
+func (s *statusStore) patch(e StatusEntry) {
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+	i := sort.Search(len(s.entries), func(i int) bool { return s.entries[i].URL >= e.URL })
+	if i < len(s.entries) && s.entries[i].URL == e.URL {
+		if reflect.DeepEqual(s.entries[i], e) {
+			return
+		}
+		s.entries[i] = e
+	} else {
+		s.entries = append(s.entries, StatusEntry{})
+		copy(s.entries[i+1:], s.entries[i:])
+		s.entries[i] = e
+	}
+	s.bump()
+}
+
+// restore sets the state of st.URL as if its results had been recorded
+// here, e.g. from a backup.
+func (s *statusStore) restore(st MonitorState) {
+	sh := s.shard(st.URL)
+	sh.mu.Lock()
+	sh.m[st.URL] = &st
+	sh.mu.Unlock()
+	s.patch(st.entry())
+}
+
+// states returns a copy of every state, sorted by URL.
+func (s *statusStore) states() []MonitorState {
+	var out []MonitorState
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for _, st := range sh.m {
+			out = append(out, *st)
+		}
+		sh.mu.RUnlock()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	return out
+}
+
+// get returns the state of url, and false if it has no result yet.
+func (s *statusStore) get(url string) (MonitorState, bool) {
+	sh := s.shard(url)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	st, ok := sh.m[url]
+	if !ok {
+		return MonitorState{}, false
+	}
+	return *st, true
+}
+
+// remove forgets url entirely.
+func (s *statusStore) remove(url string) {
+	sh := s.shard(url)
+	sh.mu.Lock()
+	delete(sh.m, url)
+	sh.mu.Unlock()
+
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+	i := sort.Search(len(s.entries), func(i int) bool { return s.entries[i].URL >= url })
+	if i < len(s.entries) && s.entries[i].URL == url {
+		s.entries = append(s.entries[:i], s.entries[i+1:]...)
+		s.bump()
+	}
+}
+
+// page returns a copy of the sorted entries in [start, end) together with
+// the total entry count and the snapshot they were taken from.
+func (s *statusStore) page(start, end int) (entries []StatusEntry, total int, stamp snapshotStamp) {
+	s.snapMu.RLock()
+	defer s.snapMu.RUnlock()
+	total = len(s.entries)
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	return append([]StatusEntry{}, s.entries[start:end]...), total, s.stamp
+}
+
+// pageWhere is page over only the entries keep accepts.
+func (s *statusStore) pageWhere(start, end int, keep func(StatusEntry) bool) (entries []StatusEntry, total int, stamp snapshotStamp) {
+	s.snapMu.RLock()
+	defer s.snapMu.RUnlock()
+	for _, e := range s.entries {
+		if !keep(e) {
+			continue
+		}
+		if total >= start && total < end {
+			entries = append(entries, e)
+		}
+		total++
+	}
+	return entries, total, s.stamp
+}
+
+// currentStamp returns the snapshot stamp without copying any entries.
+func (s *statusStore) currentStamp() snapshotStamp {
+	s.snapMu.RLock()
+	defer s.snapMu.RUnlock()
+	return s.stamp
+}
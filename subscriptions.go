@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubscriptionsConfig enables the /subscriptions API, through which clients
+// register callback URLs that receive every event as a signed JSON POST.
+type SubscriptionsConfig struct {
+	// File keeps subscriptions across restarts.
+	File string `json:"file"`
+	// MaxAttempts is how many times a delivery is tried before it is marked
+	// failed. Defaults to 6.
+	MaxAttempts int `json:"max_attempts"`
+	// JWT also signs every delivery with a short-lived token, besides the
+	// subscription's secret.
+	JWT *JWTConfig `json:"jwt"`
+}
+
+// Subscription is one registered callback.
+type Subscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Events filters which events are sent, e.g. "monitor.down" or "slo.*".
+	// Empty sends everything.
+	Events []string `json:"events,omitempty"`
+	// Secret signs each delivery. It is generated when not given and only
+	// returned when the subscription is created.
+	Secret string `json:"secret,omitempty"`
+	// Project limits events to that project's monitors. It is set from
+	// the API key the subscription was created with.
+	Project   string    `json:"project,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s Subscription) wants(event string, target Target) bool {
+	if s.Project != "" && target.Project != s.Project {
+		return false
+	}
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, pattern := range s.Events {
+		if pattern == "*" || pattern == event {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(event, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the JSON body of a delivery.
+type Event struct {
+	ID      string       `json:"id"`
+	Type    string       `json:"type"`
+	Monitor EventMonitor `json:"monitor"`
+	Status  string       `json:"status"`
+	Detail  string       `json:"detail,omitempty"`
+	// Failure classifies a monitor.down, e.g. "dns", "timeout" or
+	// "http_status".
+	Failure string    `json:"failure,omitempty"`
+	Time    time.Time `json:"time"`
+	// Reminder marks a repeated monitor.down for a monitor still down.
+	Reminder bool `json:"reminder,omitempty"`
+	// Downtime is how long the monitor has been down, on reminders, or was
+	// down, on monitor.up.
+	Downtime Duration `json:"downtime,omitempty"`
+	// Captures are the groups captured by the monitor's body pattern.
+	Captures map[string]string `json:"captures,omitempty"`
+	// Deploy is the deploy of the monitor's service shortly before it went
+	// down, on monitor.down.
+	Deploy *DeployEvent `json:"deploy,omitempty"`
+}
+
+type EventMonitor struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Group    string   `json:"group,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Severity string   `json:"severity"`
+	// Metadata is the monitor's metadata, such as its runbook.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// eventType names n as "monitor.down", "monitor.up" or "<kind>.<status>",
+// e.g. "slo.burning" or "cert.ok".
+func eventType(n notification) string {
+	if n.Kind == notifyState {
+		return "monitor." + n.Status
+	}
+	return n.Kind + "." + n.Status
+}
+
+// Delivery records sending one event to a subscription.
+type Delivery struct {
+	ID     string `json:"id"`
+	Event  string `json:"event"`
+	Status string `json:"status"` // pending, delivered or failed
+	// Attempts so far, and the outcome of the last one.
+	Attempts     int        `json:"attempts"`
+	ResponseCode int        `json:"responseCode,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	NextAttempt  *time.Time `json:"nextAttempt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	DeliveredAt  *time.Time `json:"deliveredAt,omitempty"`
+
+	subscription string
+	body         []byte
+	inFlight     bool
+}
+
+// deliveryLogSize bounds the deliveries kept per subscription.
+const deliveryLogSize = 100
+
+type subscriptionStore struct {
+	mu          sync.Mutex
+	file        string
+	maxAttempts int
+	subs        map[string]*Subscription
+	deliveries  map[string][]*Delivery
+	client      *http.Client
+	signer      *jwtSigner
+}
+
+var subscriptions *subscriptionStore
+
+func newSubscriptionStore(config SubscriptionsConfig) (*subscriptionStore, error) {
+	s := &subscriptionStore{
+		file:        config.File,
+		maxAttempts: config.MaxAttempts,
+		subs:        make(map[string]*Subscription),
+		deliveries:  make(map[string][]*Delivery),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	if s.maxAttempts <= 0 {
+		s.maxAttempts = 6
+	}
+	if config.JWT != nil {
+		signer, err := newJWTSigner(*config.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %w", err)
+		}
+		s.signer = signer
+	}
+	if s.file != "" {
+		b, err := os.ReadFile(s.file)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			var list []*Subscription
+			if err := json.Unmarshal(b, &list); err != nil {
+				return nil, err
+			}
+			for _, sub := range list {
+				s.subs[sub.ID] = sub
+			}
+		}
+	}
+	go s.retryLoop()
+	return s, nil
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// save must be called with s.mu held.
+func (s *subscriptionStore) save() {
+	if s.file == "" {
+		return
+	}
+	b, err := json.Marshal(s.sorted())
+	if err == nil {
+		tmp := s.file + ".tmp"
+		if err = os.WriteFile(tmp, b, 0o600); err == nil {
+			err = os.Rename(tmp, s.file)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error saving subscriptions:", err)
+	}
+}
+
+// sorted must be called with s.mu held.
+func (s *subscriptionStore) sorted() []*Subscription {
+	list := make([]*Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		list = append(list, sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+func (s *subscriptionStore) name() string { return "subscription" }
+
+// newEvent builds the payload n is delivered to callbacks as.
+func newEvent(n notification) Event {
+	return Event{
+		ID:   randomID(8),
+		Type: eventType(n),
+		Monitor: EventMonitor{
+			Name:     n.Target.displayName(),
+			URL:      n.Target.URL,
+			Group:    n.Target.Group,
+			Tags:     n.Target.Tags,
+			Severity: n.Target.severity(),
+			Metadata: n.Target.Metadata,
+		},
+		Status:   n.Status,
+		Detail:   n.Detail,
+		Failure:  n.Failure,
+		Time:     n.Time,
+		Reminder: n.Reminder,
+		Downtime: Duration(n.Downtime.Round(time.Second)),
+		Captures: n.Captures,
+		Deploy:   n.Deploy,
+	}
+}
+
+// notify queues a delivery of n to every subscription that wants it.
+func (s *subscriptionStore) notify(n notification) error {
+	event := newEvent(n)
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	var due []*Delivery
+	for id, sub := range s.subs {
+		if !sub.wants(event.Type, n.Target) {
+			continue
+		}
+		d := &Delivery{
+			ID:           randomID(8),
+			Event:        event.Type,
+			Status:       "pending",
+			CreatedAt:    time.Now().UTC(),
+			subscription: id,
+			body:         body,
+			inFlight:     true,
+		}
+		log := append(s.deliveries[id], d)
+		if len(log) > deliveryLogSize {
+			log = log[len(log)-deliveryLogSize:]
+		}
+		s.deliveries[id] = log
+		due = append(due, d)
+	}
+	s.mu.Unlock()
+	if len(due) == 0 {
+		return errNotApplicable
+	}
+	for _, d := range due {
+		go s.attempt(d)
+	}
+	return nil
+}
+
+// attempt sends d once. The caller must have set d.inFlight.
+func (s *subscriptionStore) attempt(d *Delivery) {
+	s.mu.Lock()
+	sub, ok := s.subs[d.subscription]
+	if !ok {
+		d.inFlight = false
+		d.Status = "failed"
+		d.LastError = "subscription deleted"
+		s.mu.Unlock()
+		return
+	}
+	callback, secret := sub.URL, sub.Secret
+	s.mu.Unlock()
+
+	code, err := s.post(callback, secret, d)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.inFlight = false
+	d.Attempts++
+	d.ResponseCode = code
+	if err == nil {
+		d.Status = "delivered"
+		d.LastError = ""
+		d.NextAttempt = nil
+		now := time.Now().UTC()
+		d.DeliveredAt = &now
+		return
+	}
+	d.LastError = err.Error()
+	if d.Attempts >= s.maxAttempts {
+		d.Status = "failed"
+		d.NextAttempt = nil
+		fmt.Printf("Giving up delivering %s to %s after %d attempts: %s\n", d.Event, callback, d.Attempts, err)
+		return
+	}
+	// Back off 30s, 1m, 2m, ... between attempts.
+	d.Status = "pending"
+	next := time.Now().UTC().Add(30 * time.Second << (d.Attempts - 1))
+	d.NextAttempt = &next
+}
+
+func (s *subscriptionStore) post(callback, secret string, d *Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, callback, bytes.NewReader(d.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(d.body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", defaultUserAgent)
+	req.Header.Set("X-Uptime-Event", d.Event)
+	req.Header.Set("X-Uptime-Delivery", d.ID)
+	req.Header.Set("X-Uptime-Timestamp", timestamp)
+	req.Header.Set("X-Uptime-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	if s.signer != nil {
+		token, err := s.signer.token(d.body, time.Now())
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("X-Uptime-JWT", token)
+	}
+	if dryRunSkip("webhook "+d.Event, callback, d.body) {
+		return 0, nil
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryLoop re-attempts pending deliveries once their backoff has passed.
+func (s *subscriptionStore) retryLoop() {
+	for range time.Tick(5 * time.Second) {
+		now := time.Now()
+		s.mu.Lock()
+		var due []*Delivery
+		for _, log := range s.deliveries {
+			for _, d := range log {
+				if d.Status == "pending" && !d.inFlight && d.NextAttempt != nil && !now.Before(*d.NextAttempt) {
+					d.inFlight = true
+					due = append(due, d)
+				}
+			}
+		}
+		s.mu.Unlock()
+		for _, d := range due {
+			go s.attempt(d)
+		}
+	}
+}
+
+func validateCallback(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback must be an http or https URL")
+	}
+	return nil
+}
+
+// subscriptionsHandler serves the subscriptions API:
+//
+//	GET    /subscriptions
+//	POST   /subscriptions
+//	GET    /subscriptions/{id}
+//	DELETE /subscriptions/{id}
+//	GET    /subscriptions/{id}/deliveries
+//	POST   /subscriptions/{id}/deliveries/{delivery}/retry
+func subscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	s := subscriptions
+	scope := requestScope(r)
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/subscriptions"), "/"), "/")
+	if parts[0] == "" {
+		parts = nil
+	}
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		s.mu.Lock()
+		out := []Subscription{}
+		for _, sub := range s.sorted() {
+			if !scope.allows(sub.Project) {
+				continue
+			}
+			view := *sub
+			view.Secret = ""
+			out = append(out, view)
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, out)
+
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		var sub Subscription
+		if !decodeBody(w, r, &sub, "subscription") {
+			return
+		}
+		if err := validateCallback(sub.URL); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, err.Error())
+			return
+		}
+		sub.ID = randomID(8)
+		sub.Project = scope.projectFilter()
+		sub.CreatedAt = time.Now().UTC()
+		if sub.Secret == "" {
+			sub.Secret = randomID(24)
+		}
+		s.mu.Lock()
+		s.subs[sub.ID] = &sub
+		s.save()
+		s.mu.Unlock()
+		fmt.Printf("Added subscription %s for %s\n", sub.ID, sub.URL)
+		audit.admin(r, "subscription.create", sub.URL, "id "+sub.ID)
+		writeJSON(w, http.StatusCreated, sub)
+
+	case len(parts) == 1 && (r.Method == http.MethodGet || r.Method == http.MethodDelete):
+		s.mu.Lock()
+		sub, ok := s.subs[parts[0]]
+		ok = ok && scope.allows(sub.Project)
+		var view Subscription
+		if ok {
+			view = *sub
+			view.Secret = ""
+			if r.Method == http.MethodDelete {
+				delete(s.subs, parts[0])
+				delete(s.deliveries, parts[0])
+				s.save()
+			}
+		}
+		s.mu.Unlock()
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "no subscription "+parts[0])
+			return
+		}
+		if r.Method == http.MethodDelete {
+			fmt.Printf("Removed subscription %s for %s\n", view.ID, view.URL)
+			audit.admin(r, "subscription.delete", view.URL, "id "+view.ID)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, view)
+
+	case len(parts) == 2 && parts[1] == "deliveries" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		sub, ok := s.subs[parts[0]]
+		ok = ok && scope.allows(sub.Project)
+		log := s.deliveries[parts[0]]
+		out := make([]Delivery, 0, len(log))
+		for i := len(log) - 1; i >= 0; i-- {
+			out = append(out, *log[i])
+		}
+		s.mu.Unlock()
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "no subscription "+parts[0])
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+
+	case len(parts) == 4 && parts[1] == "deliveries" && parts[3] == "retry" && r.Method == http.MethodPost:
+		s.mu.Lock()
+		var found *Delivery
+		if sub, ok := s.subs[parts[0]]; ok && scope.allows(sub.Project) {
+			for _, d := range s.deliveries[parts[0]] {
+				if d.ID == parts[2] {
+					found = d
+				}
+			}
+		}
+		busy := found != nil && found.inFlight
+		if found != nil && !busy {
+			found.inFlight = true
+			found.Status = "pending"
+			found.NextAttempt = nil
+			// A manual retry gets a fresh set of attempts.
+			found.Attempts = 0
+		}
+		s.mu.Unlock()
+		switch {
+		case found == nil:
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "no delivery "+parts[2])
+		case busy:
+			writeProblem(w, r, http.StatusConflict, problemConflict, "delivery is already being attempted")
+		default:
+			audit.admin(r, "subscription.retry", parts[0], "delivery "+parts[2])
+			s.attempt(found)
+			s.mu.Lock()
+			view := *found
+			s.mu.Unlock()
+			writeJSON(w, http.StatusOK, view)
+		}
+
+	default:
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "no such endpoint")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
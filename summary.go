@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Summary is the aggregate status of every monitor, for load balancers and
+// outside uptime services watching this monitor.
+type Summary struct {
+	Total       int `json:"total"`
+	Up          int `json:"up"`
+	Down        int `json:"down"`
+	Degraded    int `json:"degraded"`
+	Maintenance int `json:"maintenance"`
+	Unknown     int `json:"unknown"`
+	// Worst is "down", "degraded", "up" or, when no monitor has been
+	// checked yet, "unknown". Monitors in maintenance count as up.
+	Worst string `json:"worst"`
+	// DownMonitors are the names of the monitors that are down.
+	DownMonitors []string  `json:"downMonitors"`
+	Time         time.Time `json:"time"`
+}
+
+// summaryHandler serves GET /summary, with the classification of
+// /status.txt. With fail_if_any_down it answers 503 while a monitor is
+// down, so a plain HTTP health check can watch it.
+func summaryHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	out := Summary{DownMonitors: []string{}, Time: now.UTC()}
+	for _, s := range textStatuses(r, now) {
+		out.Total++
+		switch s.state {
+		case "up":
+			out.Up++
+		case "down":
+			out.Down++
+			out.DownMonitors = append(out.DownMonitors, s.name)
+		case "degraded":
+			out.Degraded++
+		case "maintenance":
+			out.Maintenance++
+		default:
+			out.Unknown++
+		}
+	}
+	switch {
+	case out.Down > 0:
+		out.Worst = "down"
+	case out.Degraded > 0:
+		out.Worst = "degraded"
+	case out.Unknown == out.Total:
+		out.Worst = "unknown"
+	default:
+		out.Worst = "up"
+	}
+
+	status := http.StatusOK
+	if v, ok := r.URL.Query()["fail_if_any_down"]; ok && (v[0] == "" || v[0] == "true") && out.Down > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, status, out)
+}
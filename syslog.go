@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogConfig emits check results and state changes as RFC 5424 syslog
+// messages.
+type SyslogConfig struct {
+	// Network is "udp", "tcp" or "unixgram". With Network and Address both
+	// empty, messages go to the local syslog socket.
+	Network string `json:"network"`
+	Address string `json:"address"`
+	// Facility defaults to "local0".
+	Facility string `json:"facility"`
+	// AppName defaults to "uptime-monitor".
+	AppName string `json:"app_name"`
+	// Results also logs every individual check, not just state changes.
+	Results bool `json:"results"`
+	// Severity maps events to syslog severities. Keys are "down" and "up"
+	// for state changes, "down_critical", "down_high", "down_low" and
+	// "down_info" for monitors of that severity when "down" is not set,
+	// "check_down" and "check_up" for check results, and "slo_ok",
+	// "slo_burning", "slo_exhausted", "anomaly_ok", "anomaly_slow",
+	// "tls_ok", "tls_degraded", "cert_ok", "cert_changed", "cluster_ok",
+	// "cluster_degraded", "renewal_ok", "renewal_overdue", "health_ok",
+	// "health_degraded", "channel_ok" and "channel_failing" for other
+	// alerts, and "access" for API access log lines.
+	Severity map[string]string `json:"severity"`
+}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogSeverities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+var defaultSyslogSeverity = map[string]string{
+	"up":         "notice",
+	"check_down": "warning",
+	"check_up":   "info",
+
+	"down_critical": "crit",
+	"down_high":     "err",
+	"down_low":      "warning",
+	"down_info":     "notice",
+
+	"slo_ok":        "notice",
+	"slo_burning":   "warning",
+	"slo_exhausted": "err",
+
+	"anomaly_ok":   "notice",
+	"anomaly_slow": "warning",
+
+	"tls_ok":       "notice",
+	"tls_degraded": "warning",
+
+	"cert_ok":      "notice",
+	"cert_changed": "crit",
+
+	"cluster_ok":       "notice",
+	"cluster_degraded": "warning",
+
+	"renewal_ok":      "notice",
+	"renewal_overdue": "err",
+
+	"health_ok":       "notice",
+	"health_degraded": "warning",
+
+	"channel_ok":      "notice",
+	"channel_failing": "err",
+
+	"access": "info",
+}
+
+// syslogEnterpriseID is the IANA "example" number reserved for
+// documentation and private use in structured data IDs.
+const syslogEnterpriseID = "32473"
+
+type syslogWriter struct {
+	config   SyslogConfig
+	facility int
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// eventLog receives every check result when syslog result logging is on.
+var eventLog *syslogWriter
+
+func newSyslogWriter(config SyslogConfig) (*syslogWriter, error) {
+	if config.Facility == "" {
+		config.Facility = "local0"
+	}
+	facility, ok := syslogFacilities[config.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", config.Facility)
+	}
+	if config.AppName == "" {
+		config.AppName = "uptime-monitor"
+	}
+	for event, sev := range config.Severity {
+		if _, ok := syslogSeverities[sev]; !ok {
+			return nil, fmt.Errorf("unknown syslog severity %q for %s", sev, event)
+		}
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogWriter{config: config, facility: facility, hostname: hostname}, nil
+}
+
+func (s *syslogWriter) name() string { return "syslog" }
+
+func (s *syslogWriter) notify(n notification) error {
+	if n.Reminder {
+		return errNotApplicable
+	}
+	if n.Kind != notifyState {
+		return s.write(n.Kind+"_"+n.Status, strings.ToUpper(n.Kind), n.Time, n.Detail, [][2]string{
+			{"monitor", n.Target.displayName()},
+			{"url", n.Target.URL},
+			{n.Kind, n.Status},
+		})
+	}
+	msg := fmt.Sprintf("Website %s is %s: %s", n.Target.displayName(), n.Status, n.Detail)
+	params := [][2]string{
+		{"monitor", n.Target.displayName()},
+		{"url", n.Target.URL},
+		{"status", n.Status},
+		{"severity", n.Target.severity()},
+	}
+	if n.Downtime > 0 {
+		msg = fmt.Sprintf("Website %s is %s after %s down: %s", n.Target.displayName(), n.Status, formatDuration(n.Downtime), n.Detail)
+		params = append(params, [2]string{"downtime", n.Downtime.Round(time.Second).String()})
+	}
+	event := n.Status
+	if event == "down" && s.config.Severity["down"] == "" {
+		event = "down_" + n.Target.severity()
+	}
+	return s.write(event, "STATE", n.Time, msg, params)
+}
+
+// checkResult logs a single check from location.
+func (s *syslogWriter) checkResult(target Target, location string, r CheckResult) {
+	if !s.config.Results {
+		return
+	}
+	msg := fmt.Sprintf("Check of %s from %s: %s (%s)", target.displayName(), location, r.Status, r.Detail)
+	err := s.write("check_"+r.Status, "CHECK", r.CheckedAt, msg, [][2]string{
+		{"monitor", target.displayName()},
+		{"url", target.URL},
+		{"status", r.Status},
+		{"location", location},
+		{"latency_ms", fmt.Sprint(time.Duration(r.Latency).Milliseconds())},
+	})
+	if err != nil {
+		fmt.Println("Error writing to syslog:", err)
+	}
+}
+
+func (s *syslogWriter) severity(event string) int {
+	name := s.config.Severity[event]
+	if name == "" {
+		name = defaultSyslogSeverity[event]
+	}
+	if sev, ok := syslogSeverities[name]; ok {
+		return sev
+	}
+	return syslogSeverities["info"]
+}
+
+// format renders an RFC 5424 message.
+func (s *syslogWriter) format(event, msgID string, t time.Time, msg string, params [][2]string) string {
+	pri := s.facility*8 + s.severity(event)
+	var sd strings.Builder
+	sd.WriteString("[monitor@" + syslogEnterpriseID)
+	for _, p := range params {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(p[1])
+		sd.WriteString(" " + p[0] + `="` + v + `"`)
+	}
+	sd.WriteString("]")
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		pri, t.UTC().Format(time.RFC3339Nano), s.hostname, s.config.AppName, os.Getpid(), msgID, sd.String(), msg)
+}
+
+func (s *syslogWriter) write(event, msgID string, t time.Time, msg string, params [][2]string) error {
+	line := s.format(event, msgID, t, msg, params)
+	if dryRunSkip("syslog", s.config.Network+" "+s.config.Address, []byte(line)) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Retry once on a fresh connection, e.g. after the server restarted.
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = s.dial(); err != nil {
+				return err
+			}
+		}
+		frame := line
+		if s.config.Network == "tcp" {
+			// Octet-counting framing (RFC 6587).
+			frame = fmt.Sprintf("%d %s", len(line), line)
+		}
+		if _, err = s.conn.Write([]byte(frame)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *syslogWriter) dial() (net.Conn, error) {
+	if s.config.Network != "" || s.config.Address != "" {
+		network := s.config.Network
+		if network == "" {
+			network = "udp"
+		}
+		return net.DialTimeout(network, s.config.Address, 5*time.Second)
+	}
+	var err error
+	for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+		var conn net.Conn
+		if conn, err = net.Dial("unixgram", path); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("no local syslog socket: %w", err)
+}
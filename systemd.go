@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The systemd integration follows sd_listen_fds(3), sd_notify(3) and
+// sd_watchdog_enabled(3). Everything here is a no-op when the process was
+// not started by systemd with the matching unit settings.
+
+// sdListenFDStart is the first file descriptor passed by socket activation.
+const sdListenFDStart = 3
+
+// activatedListener returns the socket systemd passed in, or nil when the
+// process was not socket-activated.
+func activatedListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	// Children must not believe the sockets are theirs.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n > 1 {
+		fmt.Printf("systemd passed %d sockets; serving the API on the first\n", n)
+	}
+	f := os.NewFile(sdListenFDStart, "LISTEN_FD_3")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// sdNotify sends state, e.g. "READY=1", to the service manager.
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the unit's WatchdogSec, or zero when the
+// watchdog is off.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// attachSystemd reports readiness once sched has run every check once and
+// pets the watchdog from its dispatch loop, so a scheduler that stops
+// dispatching gets the service restarted.
+func attachSystemd(sched *scheduler) {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	sched.ready = func() {
+		if err := sdNotify("READY=1\nSTATUS=Monitoring"); err != nil {
+			fmt.Println("Error notifying systemd:", err)
+		}
+	}
+	if interval := watchdogInterval(); interval > 0 {
+		// Petting at half the timeout leaves room for one late tick.
+		sched.tickEvery = interval / 2
+		sched.tick = func() {
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				fmt.Println("Error petting systemd watchdog:", err)
+			}
+		}
+	}
+}
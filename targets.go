@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Target is a single website to check.
+type Target struct {
+	// Name is a display name; it defaults to the URL.
+	Name string
+	// Type selects the check function; empty means "http".
+	Type string
+	URL  string
+	// Interval overrides the global check interval when non-zero.
+	Interval      time.Duration
+	Adaptive      *AdaptiveConfig
+	Timeout       time.Duration
+	Retries       int
+	Tags          []string
+	Group         string
+	SLO           *SLOConfig
+	Content       *ContentCheckConfig
+	Browser       *BrowserCheckConfig
+	UDP           *UDPCheckConfig
+	SNMP          *SNMPCheckConfig
+	NTP           *NTPCheckConfig
+	Broker        *BrokerCheckConfig
+	Elasticsearch *ElasticsearchCheckConfig
+	Health        *HealthCheckConfig
+	S3            *S3CheckConfig
+	DNS           *DNSCheckConfig
+	DNSBL         *DNSBLCheckConfig
+	TLSGrade      *TLSGradeConfig
+	CertPin       *CertPinConfig
+	CertRenewal   *CertRenewalConfig
+	Headers       map[string]string
+	Steps         []CheckStep
+	// KeepSession reuses cookies across checks.
+	KeepSession    bool
+	ExpectedStatus []int
+	Expect         string
+	// ExpectHeaders are compiled header assertions.
+	ExpectHeaders []HeaderAssertion
+	// BodyMatches and BodyNotMatches are compiled body patterns.
+	BodyMatches    *regexp.Regexp
+	BodyNotMatches *regexp.Regexp
+	MaxBodyBytes   int64
+	// Endpoints are checked in place of URL; see MonitorConfig.
+	Endpoints       []string
+	Origin          *OriginConfig
+	Source          string
+	AllowedFailures int
+	PushToken       string
+	Project         string
+	Severity        string
+	Notify          []string
+	Metadata        map[string]string
+	// dialAddr, when set, is connected to instead of URL's host.
+	dialAddr string
+}
+
+func (t Target) displayName() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.URL
+}
+
+// targetSet merges the targets contributed by each source (the config file
+// and any discovery providers) and keeps the scheduler in step with it.
+type targetSet struct {
+	mu      sync.Mutex
+	sources map[string][]Target
+	active  map[string]Target
+	sched   *scheduler
+}
+
+var targets = &targetSet{
+	sources: make(map[string][]Target),
+	active:  make(map[string]Target),
+}
+
+// attach starts scheduling every current target on sched and any added
+// later. Targets in resume, the next check times a previous process
+// handed over, keep their place; the others are checked right away.
+func (t *targetSet) attach(sched *scheduler, resume map[string]time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sched = sched
+	now := time.Now()
+	for _, target := range t.active {
+		at := now
+		if next, ok := resume[target.URL]; ok && next.After(now) {
+			at = next
+		}
+		sched.add(target, at)
+	}
+}
+
+// set replaces the targets contributed by source. Targets no source lists
+// any more are unscheduled and dropped from the status API.
+func (t *targetSet) set(source string, list []Target) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sources[source] = list
+
+	merged := make(map[string]Target)
+	names := make([]string, 0, len(t.sources))
+	for name := range t.sources {
+		names = append(names, name)
+	}
+	// Merge in a fixed order with the config file last, so its settings win
+	// when a URL is also discovered.
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "config") != (names[j] == "config") {
+			return names[j] == "config"
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		for _, target := range t.sources[name] {
+			merged[target.URL] = target
+		}
+	}
+
+	now := time.Now()
+	for url, target := range merged {
+		old, ok := t.active[url]
+		if ok && reflect.DeepEqual(old, target) {
+			continue
+		}
+		if !ok {
+			fmt.Printf("Monitoring %s (from %s)\n", url, source)
+		}
+		if t.sched != nil {
+			t.sched.remove(url)
+			t.sched.add(target, now)
+		}
+	}
+	for url := range t.active {
+		if _, ok := merged[url]; !ok {
+			fmt.Printf("No longer monitoring %s\n", url)
+			if t.sched != nil {
+				t.sched.remove(url)
+			}
+			statuses.remove(url)
+			probeResults.remove(url)
+			if anomalies != nil {
+				anomalies.remove(url)
+			}
+			sessions.reset(url)
+			adaptive.remove(url)
+		}
+	}
+	t.active = merged
+}
+
+func (t *targetSet) has(url string) bool {
+	_, ok := t.get(url)
+	return ok
+}
+
+func (t *targetSet) get(url string) (Target, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	target, ok := t.active[url]
+	return target, ok
+}
+
+// urls returns every active target URL in sorted order.
+func (t *targetSet) urls() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]string, 0, len(t.active))
+	for url := range t.active {
+		out = append(out, url)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// find returns the target whose name or URL is monitor.
+func (t *targetSet) find(monitor string) (Target, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if target, ok := t.active[monitor]; ok {
+		return target, true
+	}
+	for _, target := range t.active {
+		if target.Name == monitor {
+			return target, true
+		}
+	}
+	return Target{}, false
+}
+
+// target validates m's settings and builds the target it describes. Invalid
+// settings are reported and left out rather than failing the monitor.
+func (m MonitorConfig) target() Target {
+	t := Target{
+		Name:         m.Name,
+		Type:         m.Type,
+		URL:          m.URL,
+		Interval:     time.Duration(m.Interval),
+		Adaptive:     m.Adaptive,
+		Timeout:      time.Duration(m.Timeout),
+		Tags:         m.Tags,
+		Group:        m.Group,
+		CertPin:      m.CertPin,
+		CertRenewal:  m.CertRenewal,
+		NTP:          m.NTP,
+		DNSBL:        m.DNSBL,
+		Broker:       m.Broker,
+		Headers:      m.Headers,
+		Steps:        m.Steps,
+		KeepSession:  m.KeepSession,
+		PushToken:    m.PushToken,
+		MaxBodyBytes: m.MaxBodyBytes,
+		Project:      m.Project,
+		Notify:       m.Notify,
+		Metadata:     m.Metadata,
+	}
+	if m.Retries < 0 {
+		fmt.Printf("Ignoring retries for %s: must not be negative\n", m.URL)
+	} else {
+		t.Retries = m.Retries
+	}
+	for _, code := range m.ExpectedStatus {
+		if code < 100 || code > 599 {
+			fmt.Printf("Ignoring expected_status %d for %s: not an HTTP status code\n", code, m.URL)
+			continue
+		}
+		t.ExpectedStatus = append(t.ExpectedStatus, code)
+	}
+	if m.Expect != "" {
+		if err := validateCondition(m.Expect); err != nil {
+			fmt.Printf("Ignoring expect for %s: %s\n", m.URL, err)
+		} else {
+			t.Expect = m.Expect
+		}
+	}
+	for _, a := range m.ExpectHeaders {
+		if err := a.compile(); err != nil {
+			fmt.Printf("Ignoring expect_headers for %s: %s\n", m.URL, err)
+			continue
+		}
+		t.ExpectHeaders = append(t.ExpectHeaders, a)
+	}
+	if m.MaxBodyBytes < 0 {
+		fmt.Printf("Ignoring max_body_bytes for %s: must not be negative\n", m.URL)
+		t.MaxBodyBytes = 0
+	}
+	var err error
+	if t.BodyMatches, err = compileBodyPattern("body_matches", m.BodyMatches); err != nil {
+		fmt.Printf("Ignoring body pattern for %s: %s\n", m.URL, err)
+	}
+	if t.BodyNotMatches, err = compileBodyPattern("body_not_matches", m.BodyNotMatches); err != nil {
+		fmt.Printf("Ignoring body pattern for %s: %s\n", m.URL, err)
+	}
+	for _, endpoint := range m.Endpoints {
+		if err := validateEndpoint(endpoint); err != nil {
+			fmt.Printf("Ignoring endpoint for %s: %s\n", m.URL, err)
+			continue
+		}
+		t.Endpoints = append(t.Endpoints, endpoint)
+	}
+	if len(t.Endpoints) > 0 {
+		t.AllowedFailures = m.AllowedFailures
+	}
+	if m.Severity != "" {
+		if err := validateSeverity(m.Severity); err != nil {
+			fmt.Printf("Ignoring severity for %s: %s\n", m.URL, err)
+		} else {
+			t.Severity = m.Severity
+		}
+	}
+	if tenancy != nil && t.Project != "" {
+		if _, ok := tenancy.projects[t.Project]; !ok {
+			fmt.Printf("Unknown project %q for %s; only admin keys will see it\n", t.Project, m.URL)
+		}
+	}
+	if t.Type == pushType && t.PushToken == "" {
+		fmt.Printf("Push monitor %s has no push_token; it cannot receive results\n", m.URL)
+	}
+	if _, ok := checkTypes[t.Type]; !ok && t.Type != "" && t.Type != pushType {
+		fmt.Printf("Unknown monitor type %q for %s; checking it over HTTP\n", t.Type, m.URL)
+		t.Type = ""
+	}
+	if m.Browser != nil && m.Browser.WaitFor != "" {
+		if _, err := parseSimpleSelector(m.Browser.WaitFor); err != nil {
+			fmt.Printf("Ignoring wait_for for %s: %s\n", m.URL, err)
+			m.Browser.WaitFor = ""
+		}
+	}
+	t.Browser = m.Browser
+	if m.UDP != nil {
+		if err := m.UDP.validate(); err != nil {
+			fmt.Printf("Ignoring udp settings for %s: %s\n", m.URL, err)
+		} else {
+			t.UDP = m.UDP
+		}
+	}
+	if m.SNMP != nil {
+		if err := m.SNMP.validate(); err != nil {
+			fmt.Printf("Ignoring snmp settings for %s: %s\n", m.URL, err)
+		} else {
+			t.SNMP = m.SNMP
+		}
+	}
+	if m.Source != "" {
+		if _, err := sourceIP(m.Source); err != nil {
+			fmt.Printf("Ignoring source for %s: %s\n", m.URL, err)
+		} else {
+			t.Source = m.Source
+		}
+	}
+	if m.Origin != nil {
+		switch err := m.Origin.validate(); {
+		case err != nil:
+			fmt.Printf("Ignoring origin for %s: %s\n", m.URL, err)
+		case m.Type != "" && m.Type != "http":
+			fmt.Printf("Ignoring origin for %s: only http monitors compare with origin\n", m.URL)
+		default:
+			t.Origin = m.Origin
+		}
+	}
+	if m.Elasticsearch != nil {
+		if err := m.Elasticsearch.validate(); err != nil {
+			fmt.Printf("Ignoring elasticsearch settings for %s: %s\n", m.URL, err)
+		} else {
+			t.Elasticsearch = m.Elasticsearch
+		}
+	}
+	if m.Health != nil {
+		if err := m.Health.validate(); err != nil {
+			fmt.Printf("Ignoring health settings for %s: %s\n", m.URL, err)
+		} else {
+			t.Health = m.Health
+		}
+	}
+	if m.S3 != nil {
+		if err := m.S3.validate(); err != nil {
+			fmt.Printf("Ignoring s3 settings for %s: %s\n", m.URL, err)
+		} else {
+			t.S3 = m.S3
+		}
+	}
+	if m.DNS != nil {
+		if err := m.DNS.validate(); err != nil {
+			fmt.Printf("Ignoring dns settings for %s: %s\n", m.URL, err)
+		} else {
+			t.DNS = m.DNS
+		}
+	}
+	if m.TLSGrade != nil {
+		if err := m.TLSGrade.validate(); err != nil {
+			fmt.Printf("Ignoring tls_grade for %s: %s\n", m.URL, err)
+		} else {
+			t.TLSGrade = m.TLSGrade
+		}
+	}
+	if m.Content != nil {
+		if err := m.Content.validate(); err != nil {
+			fmt.Printf("Ignoring content settings for %s: %s\n", m.URL, err)
+		} else {
+			t.Content = m.Content
+		}
+	}
+	if m.SLO != nil {
+		if err := m.SLO.validate(); err != nil {
+			fmt.Printf("Ignoring SLO for %s: %s\n", m.URL, err)
+		} else {
+			t.SLO = m.SLO
+		}
+	}
+	return t
+}
+
+// configTargets returns the targets listed in the config file.
+func configTargets(config Config) []Target {
+	list := make([]Target, 0, len(config.Websites)+len(config.Monitors))
+	for _, url := range config.Websites {
+		if config.Defaults != nil {
+			list = append(list, inheritDefaults(MonitorConfig{URL: url}, *config.Defaults).target())
+		} else {
+			list = append(list, Target{URL: url})
+		}
+	}
+	for _, m := range config.Monitors {
+		list = append(list, resolveMonitor(config, m).target())
+	}
+	return list
+}
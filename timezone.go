@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	// Embedded so zone names resolve on hosts and containers without a
+	// zoneinfo database.
+	_ "time/tzdata"
+)
+
+// displayZone is the timezone times are shown in. Timestamps are kept and
+// exchanged in UTC; only rendering uses it.
+var displayZone = time.Local
+
+func setupTimezone(config Config) {
+	if config.Timezone == "" {
+		return
+	}
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		fmt.Printf("Ignoring timezone %q: %s\n", config.Timezone, err)
+		return
+	}
+	displayZone = loc
+}
+
+// zoneOrDefault resolves a per-recipient timezone, falling back to
+// displayZone when it is empty or unknown.
+func zoneOrDefault(name string) *time.Location {
+	if name == "" {
+		return displayZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return displayZone
+	}
+	return loc
+}
+
+// formatTime renders t for people, e.g. "2024-05-01 14:03:07 CEST".
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02 15:04:05 MST")
+}
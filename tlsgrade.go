@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSGradeConfig enables periodic TLS configuration grading for an HTTPS
+// monitor.
+type TLSGradeConfig struct {
+	// MinGrade alerts when the grade falls below it: "A+", "A", "B" or "C".
+	// Defaults to "A".
+	MinGrade string `json:"min_grade,omitempty"`
+}
+
+// tlsGradeInterval is how often each monitor is graded. A full scan takes
+// several handshakes, so it runs far less often than checks.
+const (
+	tlsGradeInterval   = 6 * time.Hour
+	tlsGradeStartDelay = 10 * time.Second
+)
+
+// tlsGrades ranks grades from best to worst.
+var tlsGrades = []string{"A+", "A", "B", "C", "F"}
+
+func tlsGradeRank(g string) int {
+	for i, name := range tlsGrades {
+		if name == g {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *TLSGradeConfig) minGrade() string {
+	if c.MinGrade == "" {
+		return "A"
+	}
+	return c.MinGrade
+}
+
+func (c *TLSGradeConfig) validate() error {
+	if tlsGradeRank(c.minGrade()) < 0 || c.minGrade() == "F" {
+		return fmt.Errorf("min_grade must be one of A+, A, B or C, got %q", c.MinGrade)
+	}
+	return nil
+}
+
+type TLSReport struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Grade       string   `json:"grade"`
+	Versions    []string `json:"versions"`
+	WeakCiphers []string `json:"weakCiphers,omitempty"`
+	ChainValid  bool     `json:"chainValid"`
+	OCSPStapled bool     `json:"ocspStapled"`
+	// Issues explains everything that lowered the grade.
+	Issues    []string  `json:"issues,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+var tlsVersionNames = []struct {
+	version uint16
+	name    string
+}{
+	{tls.VersionTLS10, "TLS 1.0"},
+	{tls.VersionTLS11, "TLS 1.1"},
+	{tls.VersionTLS12, "TLS 1.2"},
+	{tls.VersionTLS13, "TLS 1.3"},
+}
+
+// weakCipherSuites are suites no modern server should accept.
+func weakCipherSuites() []uint16 {
+	var ids []uint16
+	for _, cs := range tls.InsecureCipherSuites() {
+		if strings.Contains(cs.Name, "RC4") || strings.Contains(cs.Name, "3DES") {
+			ids = append(ids, cs.ID)
+		}
+	}
+	return ids
+}
+
+// handshake connects to addr with config and returns the connection state.
+func tlsHandshake(addr string, config *tls.Config) (tls.ConnectionState, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, config)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), nil
+}
+
+// gradeTLS runs the handshakes needed to grade target's TLS setup.
+func gradeTLS(target Target) (TLSReport, error) {
+	report := TLSReport{Name: target.displayName(), URL: target.URL, CheckedAt: time.Now().UTC()}
+	u, err := neturl.Parse(target.URL)
+	if err != nil {
+		return report, err
+	}
+	if u.Scheme != "https" {
+		return report, errors.New("TLS grading needs an https URL")
+	}
+	host := u.Hostname()
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(host, "443")
+	}
+
+	offered := make(map[uint16]bool)
+	for _, v := range tlsVersionNames {
+		_, err := tlsHandshake(addr, &tls.Config{ServerName: host, MinVersion: v.version, MaxVersion: v.version, InsecureSkipVerify: true})
+		if err == nil {
+			offered[v.version] = true
+			report.Versions = append(report.Versions, v.name)
+		}
+	}
+	if len(offered) == 0 {
+		return report, fmt.Errorf("no TLS handshake succeeded with %s", addr)
+	}
+
+	for _, id := range weakCipherSuites() {
+		_, err := tlsHandshake(addr, &tls.Config{ServerName: host, MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{id}, InsecureSkipVerify: true})
+		if err == nil {
+			report.WeakCiphers = append(report.WeakCiphers, tls.CipherSuiteName(id))
+		}
+	}
+
+	state, err := tlsHandshake(addr, &tls.Config{ServerName: host})
+	var verr *tls.CertificateVerificationError
+	var herr x509.HostnameError
+	switch {
+	case err == nil:
+		report.ChainValid = true
+		report.OCSPStapled = len(state.OCSPResponse) > 0
+	case errors.As(err, &verr), errors.As(err, &herr):
+		report.Issues = append(report.Issues, "certificate: "+err.Error())
+	default:
+		return report, err
+	}
+
+	grade := 0
+	lower := func(to int, issue string) {
+		grade = max(grade, to)
+		report.Issues = append(report.Issues, issue)
+	}
+	if !report.ChainValid {
+		grade = tlsGradeRank("F")
+	}
+	if !offered[tls.VersionTLS12] && !offered[tls.VersionTLS13] {
+		lower(tlsGradeRank("F"), "neither TLS 1.2 nor TLS 1.3 is supported")
+	}
+	if len(report.WeakCiphers) > 0 {
+		lower(tlsGradeRank("C"), "weak cipher suites accepted")
+	}
+	if offered[tls.VersionTLS10] || offered[tls.VersionTLS11] {
+		lower(tlsGradeRank("B"), "legacy TLS 1.0/1.1 offered")
+	}
+	if !offered[tls.VersionTLS13] {
+		lower(tlsGradeRank("A"), "TLS 1.3 not supported")
+	}
+	if report.ChainValid && !report.OCSPStapled {
+		lower(tlsGradeRank("A"), "no OCSP response stapled")
+	}
+	report.Grade = tlsGrades[grade]
+	return report, nil
+}
+
+type tlsGrader struct {
+	mu      sync.Mutex
+	reports map[string]TLSReport
+	// below records which monitors are currently under their minimum grade.
+	below map[string]bool
+}
+
+var tlsGrading = &tlsGrader{reports: make(map[string]TLSReport), below: make(map[string]bool)}
+
+// grade grades target and alerts when it crosses its minimum grade.
+func (g *tlsGrader) grade(target Target) {
+	report, err := gradeTLS(target)
+	if err != nil {
+		fmt.Printf("Error grading TLS for %s: %s\n", target.URL, err)
+		return
+	}
+	minGrade := target.TLSGrade.minGrade()
+	isBelow := tlsGradeRank(report.Grade) > tlsGradeRank(minGrade)
+
+	g.mu.Lock()
+	g.reports[target.URL] = report
+	wasBelow := g.below[target.URL]
+	g.below[target.URL] = isBelow
+	g.mu.Unlock()
+
+	if isBelow == wasBelow {
+		return
+	}
+	n := notification{Kind: notifyTLS, Target: target, Time: report.CheckedAt}
+	if isBelow {
+		n.Status = "degraded"
+		n.Detail = fmt.Sprintf("TLS grade for %s is %s, below %s: %s", target.displayName(), report.Grade, minGrade, strings.Join(report.Issues, "; "))
+	} else {
+		n.Status = alertResolved
+		n.Detail = fmt.Sprintf("TLS grade for %s is back to %s", target.displayName(), report.Grade)
+	}
+	fmt.Println(n.Detail)
+	enqueueNotification(n)
+}
+
+// startTLSGrading grades every monitor with TLS grading enabled shortly
+// after startup, once targets are known, and then every tlsGradeInterval.
+func startTLSGrading() {
+	go func() {
+		time.Sleep(tlsGradeStartDelay)
+		for {
+			for _, url := range targets.urls() {
+				if t, ok := targets.get(url); ok && t.TLSGrade != nil && isLeader() {
+					tlsGrading.grade(t)
+				}
+			}
+			time.Sleep(tlsGradeInterval)
+		}
+	}()
+}
+
+// tlsHandler serves GET /tls with the latest grade of each graded monitor.
+func tlsHandler(w http.ResponseWriter, r *http.Request) {
+	scope := requestScope(r)
+	tlsGrading.mu.Lock()
+	out := make([]TLSReport, 0, len(tlsGrading.reports))
+	for url, report := range tlsGrading.reports {
+		if targets.has(url) && scope.canSee(url) {
+			out = append(out, report)
+		}
+	}
+	tlsGrading.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSONCached(w, r, out)
+}
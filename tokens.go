@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokensConfig enables the /tokens API, which issues API tokens with a role
+// and an expiry so credentials can be rotated without editing the config.
+// Tokens are created by admins, so admin_keys or OIDC must be configured.
+type TokensConfig struct {
+	// File keeps tokens across restarts. Only their hashes are stored.
+	File string `json:"file"`
+	// MaxExpiry is the longest a token may be valid for. When set, every
+	// token must expire.
+	MaxExpiry Duration `json:"max_expiry"`
+}
+
+// APIToken is one issued token.
+type APIToken struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Role is "admin", "viewer" or "project:<name>", as for OIDC roles.
+	Role string `json:"role"`
+	// ExpiresIn is the token's lifetime, renewed when it is rotated. Zero
+	// never expires.
+	ExpiresIn Duration   `json:"expiresIn,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	// LastUsedAt is kept in memory and only saved with other changes.
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	// KeyID identifies the token in the access log.
+	KeyID string `json:"keyId,omitempty"`
+	// Token is the secret, returned only when the token is created or
+	// rotated.
+	Token string `json:"token,omitempty"`
+}
+
+// storedToken is a token as kept in the file: the secret is replaced by its
+// SHA-256, and after a rotation the previous secret's hash is kept until
+// the grace period ends.
+type storedToken struct {
+	APIToken
+	Hash          string     `json:"hash"`
+	PrevHash      string     `json:"prevHash,omitempty"`
+	PrevExpiresAt *time.Time `json:"prevExpiresAt,omitempty"`
+}
+
+type tokenStore struct {
+	file      string
+	maxExpiry time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]*storedToken
+}
+
+// apiTokens is nil unless tokens are configured.
+var apiTokens *tokenStore
+
+func newTokenStore(config TokensConfig, admins bool) (*tokenStore, error) {
+	if !admins {
+		return nil, errors.New("admin_keys or oidc is needed to create tokens")
+	}
+	s := &tokenStore{file: config.File, maxExpiry: time.Duration(config.MaxExpiry), tokens: make(map[string]*storedToken)}
+	if s.file != "" {
+		b, err := os.ReadFile(s.file)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			var list []*storedToken
+			if err := json.Unmarshal(b, &list); err != nil {
+				return nil, err
+			}
+			for _, t := range list {
+				s.tokens[t.ID] = t
+			}
+		}
+	}
+	return s, nil
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// save must be called with s.mu held.
+func (s *tokenStore) save() {
+	if s.file == "" {
+		return
+	}
+	b, err := json.Marshal(s.sorted())
+	if err == nil {
+		tmp := s.file + ".tmp"
+		if err = os.WriteFile(tmp, b, 0o600); err == nil {
+			err = os.Rename(tmp, s.file)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error saving tokens:", err)
+	}
+}
+
+// sorted must be called with s.mu held.
+func (s *tokenStore) sorted() []*storedToken {
+	list := make([]*storedToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// resolve returns the scope granted to the token secret key.
+func (s *tokenStore) resolve(key string) (apiScope, bool) {
+	if key == "" {
+		return apiScope{}, false
+	}
+	hash := hashToken(key)
+	now := time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		current := hash == t.Hash && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+		previous := t.PrevHash != "" && hash == t.PrevHash && now.Before(*t.PrevExpiresAt)
+		if !current && !previous {
+			continue
+		}
+		scope, err := parseRole(t.Role)
+		if err != nil {
+			return apiScope{}, false
+		}
+		t.LastUsedAt = &now
+		return scope, true
+	}
+	return apiScope{}, false
+}
+
+// issue gives t a new secret, valid for its lifetime from now.
+func (s *tokenStore) issue(t *storedToken, now time.Time) {
+	t.Token = "umt_" + randomID(24)
+	t.Hash = hashToken(t.Token)
+	t.KeyID = apiKeyID(t.Token)
+	t.ExpiresAt = nil
+	if t.ExpiresIn > 0 {
+		expires := now.Add(time.Duration(t.ExpiresIn))
+		t.ExpiresAt = &expires
+	}
+}
+
+// view returns t without its secret.
+func (t *storedToken) view() APIToken {
+	v := t.APIToken
+	v.Token = ""
+	return v
+}
+
+// tokensHandler serves the tokens API, for admins only:
+//
+//	GET    /tokens
+//	POST   /tokens
+//	GET    /tokens/{id}
+//	DELETE /tokens/{id}
+//	POST   /tokens/{id}/rotate
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, "managing tokens requires an admin key") {
+		return
+	}
+	s := apiTokens
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/tokens"), "/"), "/")
+	if parts[0] == "" {
+		parts = nil
+	}
+	now := time.Now().UTC()
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		s.mu.Lock()
+		out := []APIToken{}
+		for _, t := range s.sorted() {
+			out = append(out, t.view())
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, out)
+
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		var t storedToken
+		if !decodeBody(w, r, &t.APIToken, "token") {
+			return
+		}
+		if t.Name == "" {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, "name is required")
+			return
+		}
+		if _, err := parseRole(t.Role); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidBody, err.Error())
+			return
+		}
+		if t.ExpiresIn < 0 || s.maxExpiry > 0 && (t.ExpiresIn == 0 || time.Duration(t.ExpiresIn) > s.maxExpiry) {
+			writeProblem(w, r, http.StatusBadRequest, problemInvalidBody,
+				"expiresIn must be a duration up to "+formatDuration(s.maxExpiry))
+			return
+		}
+		t.ID = randomID(8)
+		t.CreatedAt, t.RotatedAt, t.LastUsedAt = now, nil, nil
+		s.issue(&t, now)
+		out := t.APIToken
+		t.Token = ""
+		s.mu.Lock()
+		s.tokens[t.ID] = &t
+		s.save()
+		s.mu.Unlock()
+		fmt.Printf("Created API token %s (%s) with role %s\n", t.ID, t.Name, t.Role)
+		audit.admin(r, "token.create", "", fmt.Sprintf("id %s, role %s", t.ID, t.Role))
+		writeJSON(w, http.StatusCreated, out)
+
+	case len(parts) == 1 && (r.Method == http.MethodGet || r.Method == http.MethodDelete):
+		s.mu.Lock()
+		t, ok := s.tokens[parts[0]]
+		var view APIToken
+		if ok {
+			view = t.view()
+			if r.Method == http.MethodDelete {
+				delete(s.tokens, parts[0])
+				s.save()
+			}
+		}
+		s.mu.Unlock()
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "no token "+parts[0])
+			return
+		}
+		if r.Method == http.MethodDelete {
+			fmt.Printf("Revoked API token %s (%s)\n", view.ID, view.Name)
+			audit.admin(r, "token.revoke", "", "id "+view.ID)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, view)
+
+	case len(parts) == 2 && parts[1] == "rotate" && r.Method == http.MethodPost:
+		grace, ok := durationParam(w, r, "grace", 0, 0, 7*24*time.Hour)
+		if !ok {
+			return
+		}
+		s.mu.Lock()
+		t, ok := s.tokens[parts[0]]
+		var out APIToken
+		if ok {
+			t.PrevHash, t.PrevExpiresAt = "", nil
+			if grace > 0 {
+				until := now.Add(grace)
+				t.PrevHash, t.PrevExpiresAt = t.Hash, &until
+			}
+			t.RotatedAt = &now
+			s.issue(t, now)
+			out = t.APIToken
+			t.Token = ""
+			s.save()
+		}
+		s.mu.Unlock()
+		if !ok {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "no token "+parts[0])
+			return
+		}
+		fmt.Printf("Rotated API token %s (%s)\n", out.ID, out.Name)
+		audit.admin(r, "token.rotate", "", fmt.Sprintf("id %s, grace %s", out.ID, formatDuration(grace)))
+		writeJSON(w, http.StatusOK, out)
+
+	default:
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "no such endpoint")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// UDPCheckConfig configures "udp" monitors, whose url is udp://host:port.
+// Each attempt sends the payload and waits for a reply.
+type UDPCheckConfig struct {
+	// Send is the payload, or SendHex for binary payloads such as a DNS
+	// query.
+	Send    string `json:"send,omitempty"`
+	SendHex string `json:"send_hex,omitempty"`
+	// Expect must appear in a reply, or ExpectHex in binary. Empty accepts
+	// any reply.
+	Expect    string `json:"expect,omitempty"`
+	ExpectHex string `json:"expect_hex,omitempty"`
+	// Timeout is how long each attempt waits. Defaults to 2s.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Attempts is how many packets are sent per check. Defaults to 3.
+	Attempts int `json:"attempts,omitempty"`
+	// MaxLoss is the percentage of attempts that may go unanswered before
+	// the monitor is down. Zero means down only when nothing answers.
+	MaxLoss float64 `json:"max_loss,omitempty"`
+
+	payload, expect []byte
+}
+
+const udpType = "udp"
+
+func (c *UDPCheckConfig) validate() error {
+	if c.Send != "" && c.SendHex != "" {
+		return fmt.Errorf("set send or send_hex, not both")
+	}
+	if c.Expect != "" && c.ExpectHex != "" {
+		return fmt.Errorf("set expect or expect_hex, not both")
+	}
+	c.payload = []byte(c.Send)
+	if c.SendHex != "" {
+		b, err := hex.DecodeString(c.SendHex)
+		if err != nil {
+			return fmt.Errorf("send_hex: %w", err)
+		}
+		c.payload = b
+	}
+	c.expect = []byte(c.Expect)
+	if c.ExpectHex != "" {
+		b, err := hex.DecodeString(c.ExpectHex)
+		if err != nil {
+			return fmt.Errorf("expect_hex: %w", err)
+		}
+		c.expect = b
+	}
+	if c.Attempts < 0 || c.MaxLoss < 0 || c.MaxLoss > 100 {
+		return fmt.Errorf("attempts must be positive and max_loss between 0 and 100")
+	}
+	return nil
+}
+
+// udpAddress returns the host:port a udp monitor sends to.
+func udpAddress(target Target) (string, error) {
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "udp" || u.Port() == "" {
+		return "", fmt.Errorf("udp monitors need a udp://host:port url")
+	}
+	if target.dialAddr != "" {
+		return dialAddress(target.URL, target.dialAddr), nil
+	}
+	return u.Host, nil
+}
+
+// probeUDP sends the configured payload Attempts times and reports the
+// share of attempts answered with the expected reply.
+func probeUDP(target Target) CheckResult {
+	result := CheckResult{URL: target.URL, Status: "down", CheckedAt: time.Now().UTC()}
+	cfg := target.UDP
+	if cfg == nil {
+		cfg = &UDPCheckConfig{}
+	}
+	addr, err := udpAddress(target)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	attempts, timeout := cfg.Attempts, time.Duration(cfg.Timeout)
+	if attempts <= 0 {
+		attempts = 3
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	conn, err := dialCheck(target, "udp", addr, timeout)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	var replies int
+	var rtt time.Duration
+	var lastErr string
+	buf := make([]byte, 64<<10)
+	for i := 0; i < attempts; i++ {
+		start := time.Now()
+		conn.SetDeadline(start.Add(timeout))
+		if _, err := conn.Write(cfg.payload); err != nil {
+			lastErr = err.Error()
+			continue
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			lastErr = err.Error()
+			continue
+		}
+		if !bytes.Contains(buf[:n], cfg.expect) {
+			lastErr = fmt.Sprintf("unexpected reply %q", truncate(buf[:n], 64))
+			continue
+		}
+		replies++
+		rtt += time.Since(start)
+	}
+
+	loss := 100 * float64(attempts-replies) / float64(attempts)
+	if replies > 0 {
+		result.Latency = Duration(rtt / time.Duration(replies))
+	}
+	result.Detail = fmt.Sprintf("%d/%d replies, %.0f%% loss", replies, attempts, loss)
+	if lastErr != "" {
+		result.Detail += ": " + lastErr
+	}
+	if replies > 0 && (cfg.MaxLoss == 0 || loss <= cfg.MaxLoss) {
+		result.Status = "up"
+	}
+	return result
+}
+
+func truncate(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[:n]
+	}
+	return b
+}
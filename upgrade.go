@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RestartConfig controls how the monitor stops and restarts. On SIGTERM or
+// an interrupt it stops starting checks, lets those in flight and their
+// notifications finish, and saves its state; on SIGUSR2 (Unix only) it
+// does the same and hands the API socket and its state over to a fresh
+// copy of its binary, so upgrades leave no gap in checks or the API.
+type RestartConfig struct {
+	// StateFile keeps monitor states, held alerts and next check times
+	// across ordinary restarts too, so monitors that stay down are not
+	// alerted on again. Upgrades use a temporary file when it is unset.
+	StateFile string `json:"state_file"`
+	// DrainTimeout bounds the wait for checks and notifications in
+	// flight. Defaults to 30s.
+	DrainTimeout Duration `json:"drain_timeout"`
+}
+
+// savedState is what a stopping process leaves for the next one.
+type savedState struct {
+	SavedAt time.Time `json:"savedAt"`
+	// Started is when the first process of a chain of upgrades started,
+	// which the startup grace counts from.
+	Started    time.Time            `json:"started"`
+	Monitors   []MonitorState       `json:"monitors"`
+	Held       map[string]heldAlert `json:"held,omitempty"`
+	NextChecks map[string]time.Time `json:"nextChecks,omitempty"`
+}
+
+// upgradeEnv tells a process started by an upgrade where the state handed
+// over to it is. The listener and a pipe to report readiness on are its
+// file descriptors 3 and 4.
+const upgradeEnv = "UPTIME_UPGRADE_STATE"
+
+// handover is the state file an upgrade handed over, or "" when the
+// process was started normally.
+var handover string
+
+// serving is the running API server and its listener, once it has
+// started.
+var serving struct {
+	mu     sync.Mutex
+	server *http.Server
+	ln     net.Listener
+}
+
+func (c RestartConfig) drainTimeout() time.Duration {
+	if c.DrainTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(c.DrainTimeout)
+}
+
+// takeHandover notes whether an upgrade started this process and keeps
+// the variable from leaking into the processes it starts.
+func takeHandover() {
+	handover = os.Getenv(upgradeEnv)
+	os.Unsetenv(upgradeEnv)
+}
+
+// loadSavedState restores the state left by the previous process, from the
+// upgrade handover or config.StateFile, and returns the next check times it
+// saved. Only monitors that are still configured are restored.
+func loadSavedState(config RestartConfig) map[string]time.Time {
+	path := handover
+	if path == "" {
+		path = config.StateFile
+	}
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	var st savedState
+	if err == nil {
+		err = json.Unmarshal(b, &st)
+	}
+	if err != nil {
+		fmt.Println("Error loading saved state:", err)
+		return nil
+	}
+	if handover != "" && handover != config.StateFile {
+		os.Remove(handover)
+	}
+	restored := 0
+	for _, m := range st.Monitors {
+		if targets.has(m.URL) {
+			statuses.restore(m)
+			restored++
+		}
+	}
+	held := make(map[string]heldAlert)
+	for url, a := range st.Held {
+		if targets.has(url) {
+			held[url] = a
+		}
+	}
+	// An ordinary restart starts the grace afresh; an upgrade continues
+	// the previous process's.
+	started := st.Started
+	if handover == "" {
+		started = time.Time{}
+	}
+	holds.restore(held, started)
+	fmt.Printf("Restored the state of %d monitors saved %s ago\n", restored, formatDuration(time.Since(st.SavedAt).Round(time.Second)))
+	return st.NextChecks
+}
+
+// saveState writes the state of every monitor to path.
+func saveState(path string) error {
+	held, started := holds.snapshot()
+	st := savedState{
+		SavedAt:  time.Now().UTC(),
+		Started:  started.UTC(),
+		Monitors: statuses.states(),
+		Held:     held,
+	}
+	if sched := currentScheduler(); sched != nil {
+		st.NextChecks = sched.nextRuns()
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func currentScheduler() *scheduler {
+	diag.mu.Lock()
+	defer diag.mu.Unlock()
+	return diag.sched
+}
+
+// drain stops starting checks and waits, up to the drain timeout, for the
+// checks and notifications in flight.
+func drain(config RestartConfig) {
+	sched := currentScheduler()
+	if sched != nil {
+		sched.pause()
+	}
+	deadline := time.Now().Add(config.drainTimeout())
+	for (sched != nil && !sched.idle()) || notifyPending.Load() > 0 {
+		// Email digests would otherwise wait out their correlation window.
+		digests.flushAll()
+		if time.Now().After(deadline) {
+			fmt.Println("Drain timed out with checks or notifications still in flight")
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// saveHistory writes out the history, which is otherwise only saved every
+// historySaveEvery, so that a restart loses none of it. The other stores
+// are saved as they change.
+func saveHistory() {
+	if history.file == "" {
+		return
+	}
+	if err := history.save(); err != nil {
+		fmt.Println("Error saving history:", err)
+	}
+}
+
+// watchSignals stops the monitor cleanly on SIGTERM or an interrupt and
+// upgrades it on upgradeSignal.
+func watchSignals(config RestartConfig) {
+	signals := []os.Signal{os.Interrupt, syscall.SIGTERM}
+	if upgradeSignal != nil {
+		signals = append(signals, upgradeSignal)
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		for sig := range ch {
+			if sig == upgradeSignal {
+				if err := upgrade(config); err != nil {
+					fmt.Println("Error upgrading:", err)
+				}
+				continue
+			}
+			fmt.Println("Shutting down:", sig)
+			sdNotify("STOPPING=1")
+			drain(config)
+			saveHistory()
+			if config.StateFile != "" {
+				if err := saveState(config.StateFile); err != nil {
+					fmt.Println("Error saving state:", err)
+				}
+			}
+			stopAPIServer(config)
+			os.Exit(0)
+		}
+	}()
+}
+
+// stopAPIServer lets requests in flight finish, within the drain timeout.
+func stopAPIServer(config RestartConfig) {
+	serving.mu.Lock()
+	server := serving.server
+	serving.mu.Unlock()
+	if server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.drainTimeout())
+	defer cancel()
+	server.Shutdown(ctx)
+}
@@ -0,0 +1,139 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// upgradeSignal asks the monitor to upgrade itself to the binary now at
+// its path.
+var upgradeSignal os.Signal = syscall.SIGUSR2
+
+// upgradeReadyTimeout is how long the new process has to start serving.
+const upgradeReadyTimeout = 30 * time.Second
+
+// upgrade hands over to a new process running the binary at the path this
+// one was started from: it drains, saves its state, starts the process
+// with the API socket, and exits once that process is serving. If the new
+// process fails to start, this one resumes checking.
+func upgrade(config RestartConfig) error {
+	serving.mu.Lock()
+	ln := serving.ln
+	serving.mu.Unlock()
+	if ln == nil {
+		return errors.New("the API server is not running")
+	}
+	fl, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return fmt.Errorf("cannot hand over a %T", ln)
+	}
+	lnFile, err := fl.File()
+	if err != nil {
+		return err
+	}
+	defer lnFile.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Upgrading: draining checks and notifications")
+	drain(config)
+	sched := currentScheduler()
+	resume := func() {
+		if sched != nil {
+			sched.resume()
+		}
+	}
+	path := config.StateFile
+	if path == "" {
+		path = filepath.Join(os.TempDir(), fmt.Sprintf("uptime-monitor-%d.state", os.Getpid()))
+	}
+	if err := saveState(path); err != nil {
+		resume()
+		return fmt.Errorf("saving state: %w", err)
+	}
+	// The new process loads the history as it starts.
+	saveHistory()
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		resume()
+		return err
+	}
+	defer ready.Close()
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), upgradeEnv+"="+path)
+	cmd.ExtraFiles = []*os.File{lnFile, readyW}
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		resume()
+		return err
+	}
+
+	// The new process writes a byte once it serves the API; the pipe
+	// closes without one if it exits first.
+	done := make(chan bool, 1)
+	go func() {
+		b := make([]byte, 1)
+		n, _ := ready.Read(b)
+		done <- n == 1
+	}()
+	var served bool
+	select {
+	case served = <-done:
+	case <-time.After(upgradeReadyTimeout):
+	}
+	if !served {
+		cmd.Process.Kill()
+		cmd.Wait()
+		resume()
+		return errors.New("the new process did not start serving; carrying on with this one")
+	}
+
+	fmt.Printf("Upgrade handed over to process %d\n", cmd.Process.Pid)
+	if err := sdNotify(fmt.Sprintf("MAINPID=%d", cmd.Process.Pid)); err != nil {
+		fmt.Println("Error notifying systemd:", err)
+	}
+	// The new process serves the same socket, which must outlive this one.
+	if ul, ok := ln.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	stopAPIServer(config)
+	os.Exit(0)
+	return nil
+}
+
+// inheritedListener returns the API socket an upgrade handed over, or nil
+// when the process was started normally.
+func inheritedListener() (net.Listener, error) {
+	if handover == "" {
+		return nil, nil
+	}
+	f := os.NewFile(3, "upgrade-listener")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// upgradeReady tells the process that started this one, in an upgrade,
+// that the API is being served, so it can exit.
+func upgradeReady() {
+	if handover == "" {
+		return
+	}
+	f := os.NewFile(4, "upgrade-ready")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		fmt.Println("Error reporting the upgrade ready:", err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// Windows has no upgrade signal; services are upgraded by restarting them,
+// with the state file bridging the restart.
+var upgradeSignal os.Signal
+
+func upgrade(config RestartConfig) error {
+	return errors.New("upgrades without a restart are not supported on Windows")
+}
+
+func inheritedListener() (net.Listener, error) { return nil, nil }
+
+func upgradeReady() {}
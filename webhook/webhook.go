@@ -0,0 +1,237 @@
+// Package webhook verifies the JWT that the uptime monitor signs webhook
+// deliveries with when a channel or the subscriptions API has jwt set.
+//
+// A receiver keeps one Verifier and checks every request with it:
+//
+//	v := &webhook.Verifier{Secret: []byte(secret), Audience: "ops-bot"}
+//	http.HandleFunc("/uptime", func(w http.ResponseWriter, r *http.Request) {
+//		body, err := v.Verify(r)
+//		if err != nil {
+//			http.Error(w, err.Error(), http.StatusUnauthorized)
+//			return
+//		}
+//		// body is the event JSON.
+//	})
+//
+// Verify checks the signature, issuer, audience and expiry, that the token
+// was issued for this very body, and that its ID was not seen before, so a
+// captured delivery can't be replayed.
+package webhook
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the request header the token is sent in.
+const Header = "X-Uptime-JWT"
+
+// Errors returned by Verify, wrapped with details.
+var (
+	ErrMissing  = errors.New("webhook: no token")
+	ErrInvalid  = errors.New("webhook: invalid token")
+	ErrExpired  = errors.New("webhook: token expired")
+	ErrReplayed = errors.New("webhook: token already used")
+)
+
+// Claims are the verified claims of a delivery's token.
+type Claims struct {
+	Issuer   string
+	Audience string
+	IssuedAt time.Time
+	Expires  time.Time
+	// ID is the token's nonce. A retried delivery gets a new one; use the
+	// X-Uptime-Delivery header of subscriptions to spot retries.
+	ID string
+}
+
+// Verifier checks delivery tokens. Set Secret for HS256 tokens, or
+// PublicKey, an *rsa.PublicKey or *ecdsa.PublicKey, for RS256 or ES256
+// ones. Only the algorithm of the key given is accepted.
+type Verifier struct {
+	Secret    []byte
+	PublicKey crypto.PublicKey
+	// Issuer is the required "iss". Defaults to "uptime-monitor".
+	Issuer string
+	// Audience, when set, is the required "aud".
+	Audience string
+	// Leeway allows for clock skew between the monitor and the receiver.
+	// Defaults to 30s.
+	Leeway time.Duration
+	// MaxBody bounds the body Verify reads. Defaults to 10 MiB.
+	MaxBody int64
+
+	mu sync.Mutex
+	// seen holds the IDs of tokens verified so far, until they expire.
+	seen map[string]time.Time
+}
+
+// ParsePublicKey reads a PEM public key (PKIX or PKCS#1) or certificate,
+// for PublicKey.
+func ParsePublicKey(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("webhook: no PEM public key")
+	}
+	if k, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if c, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return c.PublicKey, nil
+	}
+	return nil, errors.New("webhook: unreadable public key")
+}
+
+// Verify checks the token of r and returns its body, which stays readable
+// from r.Body too.
+func (v *Verifier) Verify(r *http.Request) ([]byte, error) {
+	token := r.Header.Get(Header)
+	if token == "" {
+		return nil, ErrMissing
+	}
+	limit := v.MaxBody
+	if limit <= 0 {
+		limit = 10 << 20
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: body over %d bytes", ErrInvalid, limit)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if _, err := v.VerifyToken(token, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// VerifyToken checks token, received with body, and returns its claims.
+func (v *Verifier) VerifyToken(token string, body []byte) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a JWT", ErrInvalid)
+	}
+	enc := base64.RawURLEncoding
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var claims struct {
+		Iss        string `json:"iss"`
+		Aud        string `json:"aud"`
+		Iat        int64  `json:"iat"`
+		Exp        int64  `json:"exp"`
+		JTI        string `json:"jti"`
+		BodySHA256 string `json:"body_sha256"`
+	}
+	h, err1 := enc.DecodeString(parts[0])
+	c, err2 := enc.DecodeString(parts[1])
+	sig, err3 := enc.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil || json.Unmarshal(h, &header) != nil || json.Unmarshal(c, &claims) != nil {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalid)
+	}
+	if err := v.checkSignature(header.Alg, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	issuer := v.Issuer
+	if issuer == "" {
+		issuer = "uptime-monitor"
+	}
+	leeway := v.Leeway
+	if leeway <= 0 {
+		leeway = 30 * time.Second
+	}
+	now := time.Now()
+	iat, exp := time.Unix(claims.Iat, 0), time.Unix(claims.Exp, 0)
+	sum := sha256.Sum256(body)
+	switch {
+	case claims.Iss != issuer:
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalid, claims.Iss)
+	case v.Audience != "" && claims.Aud != v.Audience:
+		return nil, fmt.Errorf("%w: audience %q", ErrInvalid, claims.Aud)
+	case claims.Exp == 0 || now.After(exp.Add(leeway)):
+		return nil, ErrExpired
+	case iat.After(now.Add(leeway)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalid)
+	case claims.JTI == "":
+		return nil, fmt.Errorf("%w: no jti", ErrInvalid)
+	case !hmac.Equal([]byte(claims.BodySHA256), []byte(hex.EncodeToString(sum[:]))):
+		return nil, fmt.Errorf("%w: body does not match", ErrInvalid)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen == nil {
+		v.seen = make(map[string]time.Time)
+	}
+	for id, until := range v.seen {
+		if now.After(until) {
+			delete(v.seen, id)
+		}
+	}
+	if _, ok := v.seen[claims.JTI]; ok {
+		return nil, ErrReplayed
+	}
+	v.seen[claims.JTI] = exp.Add(leeway)
+	return &Claims{Issuer: claims.Iss, Audience: claims.Aud, IssuedAt: iat, Expires: exp, ID: claims.JTI}, nil
+}
+
+func (v *Verifier) checkSignature(alg string, input, sig []byte) error {
+	digest := sha256.Sum256(input)
+	var ok bool
+	switch k := v.PublicKey.(type) {
+	case nil:
+		if len(v.Secret) == 0 {
+			return errors.New("webhook: the verifier has no key")
+		}
+		if alg != "HS256" {
+			return fmt.Errorf("%w: algorithm %q, want HS256", ErrInvalid, alg)
+		}
+		mac := hmac.New(sha256.New, v.Secret)
+		mac.Write(input)
+		ok = hmac.Equal(sig, mac.Sum(nil))
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return fmt.Errorf("%w: algorithm %q, want RS256", ErrInvalid, alg)
+		}
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			return fmt.Errorf("%w: algorithm %q, want ES256", ErrInvalid, alg)
+		}
+		if len(sig) != 64 {
+			return fmt.Errorf("%w: bad signature", ErrInvalid)
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		ok = ecdsa.Verify(k, digest[:], r, s)
+	default:
+		return fmt.Errorf("webhook: unsupported key type %T", v.PublicKey)
+	}
+	if !ok {
+		return fmt.Errorf("%w: bad signature", ErrInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file implements the subset of YAML used by target lists and monitor
+// files: block mappings and sequences, plain and quoted scalars, simple flow
+// sequences ([a, b]) and flow mappings ({a: b}), "|" and ">" block scalars,
+// and comments. Anchors, tags and multi-document streams are not supported.
+// Documents are decoded by converting them to JSON, so the destination's
+// json struct tags apply. marshalYAML writes the same subset back.
+
+// unmarshalYAML decodes data into v.
+func unmarshalYAML(data []byte, v any) error {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func parseYAML(data []byte) (any, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.Contains(raw, "\t") && strings.TrimLeft(raw, " ") != strings.TrimLeft(raw, " \t") {
+			return nil, fmt.Errorf("yaml line %d: tabs are not allowed for indentation", i+1)
+		}
+		trimmed := strings.TrimLeft(raw, " ")
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(trimmed), text: trimmed})
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) && strings.TrimSpace(stripYAMLComment(p.lines[p.pos].text)) == "---" {
+		p.pos++
+		p.skipBlank()
+	}
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	v, err := p.parseBlock(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml line %d: unexpected content", p.lines[p.pos].num)
+	}
+	return v, nil
+}
+
+// skipBlank advances past empty and comment-only lines.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) {
+		t := strings.TrimSpace(stripYAMLComment(p.lines[p.pos].text))
+		if t != "" {
+			return
+		}
+		p.pos++
+	}
+}
+
+// current returns the current line with its comment removed.
+func (p *yamlParser) current() yamlLine {
+	l := p.lines[p.pos]
+	l.text = strings.TrimRight(stripYAMLComment(l.text), " ")
+	return l
+}
+
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	l := p.current()
+	if l.text == "-" || strings.HasPrefix(l.text, "- ") {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(l.text); ok {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return parseYAMLScalar(l.text, l.num)
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	list := []any{}
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return list, nil
+		}
+		l := p.current()
+		if l.indent < indent {
+			return list, nil
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("yaml line %d: bad indentation", l.num)
+		}
+		if l.text != "-" && !strings.HasPrefix(l.text, "- ") {
+			return list, nil
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			p.skipBlank()
+			if p.pos >= len(p.lines) || p.current().indent <= indent {
+				list = append(list, nil)
+				continue
+			}
+			v, err := p.parseBlock(p.current().indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		// "- key: value" starts a mapping whose keys line up with "key".
+		childIndent := indent + (len(l.text) - len(rest))
+		p.lines[p.pos] = yamlLine{num: l.num, indent: childIndent, text: rest}
+		v, err := p.parseBlock(childIndent)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	m := map[string]any{}
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return m, nil
+		}
+		l := p.current()
+		if l.indent < indent {
+			return m, nil
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("yaml line %d: bad indentation", l.num)
+		}
+		key, value, ok := splitYAMLKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("yaml line %d: expected \"key: value\"", l.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("yaml line %d: duplicate key %q", l.num, key)
+		}
+		p.pos++
+
+		switch {
+		case value == "|" || value == ">" || value == "|-" || value == ">-":
+			m[key] = p.parseBlockScalar(indent, value)
+		case value != "":
+			v, err := parseYAMLScalar(value, l.num)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		default:
+			p.skipBlank()
+			if p.pos >= len(p.lines) {
+				m[key] = nil
+				continue
+			}
+			next := p.current()
+			isSeq := next.text == "-" || strings.HasPrefix(next.text, "- ")
+			if next.indent > indent || (next.indent == indent && isSeq) {
+				v, err := p.parseBlock(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			} else {
+				m[key] = nil
+			}
+		}
+	}
+}
+
+// parseBlockScalar reads the indented lines following a "|" or ">" marker.
+func (p *yamlParser) parseBlockScalar(parentIndent int, style string) string {
+	var lines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if strings.TrimSpace(l.text) == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		if l.indent <= parentIndent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = l.indent
+		}
+		lines = append(lines, strings.Repeat(" ", max(0, l.indent-blockIndent))+l.text)
+		p.pos++
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	out := strings.Join(lines, "\n")
+	if strings.HasPrefix(style, ">") {
+		out = foldYAMLLines(lines)
+	}
+	if !strings.HasSuffix(style, "-") {
+		out += "\n"
+	}
+	return out
+}
+
+// foldYAMLLines joins the lines of a folded scalar: line breaks become
+// spaces, except that each blank line stands for a line break and breaks
+// next to more-indented lines are kept.
+func foldYAMLLines(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case line == "":
+				b.WriteString("\n")
+			case prev == "":
+				// The blank lines before line already stand for the break.
+			case strings.HasPrefix(line, " ") || strings.HasPrefix(prev, " "):
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// splitYAMLKey splits "key: value" (or "key:") outside of quotes.
+func splitYAMLKey(text string) (key, value string, ok bool) {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return "", "", false
+	}
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := closingQuote(text)
+		if end < 0 || !strings.HasPrefix(text[end+1:], ":") {
+			return "", "", false
+		}
+		k, err := parseYAMLScalar(text[:end+1], 0)
+		if err != nil {
+			return "", "", false
+		}
+		return fmt.Sprint(k), strings.TrimSpace(text[end+2:]), true
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func closingQuote(s string) int {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q:
+			if q == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment removes a trailing "# comment" that is not inside quotes.
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if quote == '"' && c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || text[i-1] == ' ' || text[i-1] == '[' || text[i-1] == '{' || text[i-1] == ',' || text[i-1] == ':' {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+func parseYAMLScalar(text string, line int) (any, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(text, `"`):
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml line %d: bad quoted string %s", line, text)
+		}
+		return s, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("yaml line %d: bad quoted string %s", line, text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("yaml line %d: unterminated flow sequence", line)
+		}
+		list := []any{}
+		for _, item := range splitYAMLFlow(text[1 : len(text)-1]) {
+			v, err := parseYAMLScalar(item, line)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case strings.HasPrefix(text, "{"):
+		if !strings.HasSuffix(text, "}") {
+			return nil, fmt.Errorf("yaml line %d: unterminated flow mapping", line)
+		}
+		m := map[string]any{}
+		for _, item := range splitYAMLFlow(text[1 : len(text)-1]) {
+			k, v, ok := splitYAMLKey(item)
+			if !ok {
+				return nil, fmt.Errorf("yaml line %d: expected \"key: value\" in flow mapping", line)
+			}
+			val, err := parseYAMLScalar(v, line)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = val
+		}
+		return m, nil
+	}
+
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXnN") {
+		return f, nil
+	}
+	return text, nil
+}
+
+// splitYAMLFlow splits the inside of a flow collection on top-level commas.
+func splitYAMLFlow(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if quote == '"' && c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// yamlPair is one key of a mapping read by readOrderedJSON, which keeps
+// keys in their JSON order rather than sorting them.
+type yamlPair struct {
+	key   string
+	value any
+}
+
+// marshalYAML encodes v as YAML that unmarshalYAML reads back. v is
+// encoded to JSON first, so json struct tags apply and fields keep their
+// declaration order.
+func marshalYAML(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	doc, err := readOrderedJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	var out strings.Builder
+	if yamlInline(doc) {
+		out.WriteString(yamlFlow(doc) + "\n")
+	} else {
+		writeYAMLBlock(&out, doc, 0)
+	}
+	return []byte(out.String()), nil
+}
+
+func readOrderedJSON(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := []yamlPair{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := readOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, yamlPair{key: key.(string), value: v})
+		}
+		_, err = dec.Token()
+		return m, err
+	case json.Delim('['):
+		list := []any{}
+		for dec.More() {
+			v, err := readOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+// yamlInline reports whether v is written on the line of its key: scalars
+// and empty collections.
+func yamlInline(v any) bool {
+	switch v := v.(type) {
+	case []yamlPair:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return true
+}
+
+func writeYAMLBlock(out *strings.Builder, v any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch v := v.(type) {
+	case []yamlPair:
+		for _, p := range v {
+			out.WriteString(pad + yamlScalar(p.key) + ":")
+			if yamlInline(p.value) {
+				out.WriteString(" " + yamlFlow(p.value) + "\n")
+				continue
+			}
+			out.WriteString("\n")
+			writeYAMLBlock(out, p.value, indent+2)
+		}
+	case []any:
+		for _, item := range v {
+			switch item.(type) {
+			case []yamlPair:
+				if !yamlInline(item) {
+					// The item's first key goes on the "- " line, the
+					// rest line up beneath it.
+					var sub strings.Builder
+					writeYAMLBlock(&sub, item, indent+2)
+					out.WriteString(pad + "- " + strings.TrimPrefix(sub.String(), pad+"  "))
+					continue
+				}
+			}
+			out.WriteString(pad + "- " + yamlFlow(item) + "\n")
+		}
+	}
+}
+
+// yamlFlow writes v on one line: a scalar, or a flow collection.
+func yamlFlow(v any) string {
+	switch v := v.(type) {
+	case []yamlPair:
+		parts := make([]string, len(v))
+		for i, p := range v {
+			parts[i] = yamlScalar(p.key) + ": " + yamlFlow(p.value)
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = yamlFlow(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case string:
+		return yamlScalar(v)
+	case nil:
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+// yamlScalar writes s plain when the parser reads it back as the same
+// string, and double-quoted otherwise.
+func yamlScalar(s string) string {
+	if s == "" || strings.TrimSpace(s) != s || strings.ContainsAny(s, "\"'#,[]{}|>&*!%@`\\\n\t") ||
+		strings.Contains(s, ": ") || strings.HasSuffix(s, ":") || strings.HasPrefix(s, "-") || strings.HasPrefix(s, "?") {
+		return strconv.Quote(s)
+	}
+	if v, err := parseYAMLScalar(s, 0); err != nil || v != any(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
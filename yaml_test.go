@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestYAMLBlockScalars(t *testing.T) {
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"literal", "a: |\n  line one\n  line two\n", "line one\nline two\n"},
+		{"folded", "a: >\n  folded\n  text\n", "folded text\n"},
+		{"folded paragraphs", "a: >\n  folded\n  text\n\n  para\n", "folded text\npara\n"},
+		{"folded two blank lines", "a: >\n  one\n\n\n  two\n", "one\n\ntwo\n"},
+		{"folded strip", "a: >-\n  folded\n  text\n\n  para\n", "folded text\npara"},
+		{"folded more indented", "a: >\n  text\n    code\n  more\n", "text\n  code\nmore\n"},
+	}
+	for _, tt := range tests {
+		doc, err := parseYAML([]byte(tt.doc))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		m, _ := doc.(map[string]any)
+		if got := m["a"]; got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}